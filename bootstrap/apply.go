@@ -0,0 +1,664 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// Report lists what Apply changed, entries look like "channel openai-main".
+type Report struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Deleted   []string `json:"deleted"`
+	Unchanged []string `json:"unchanged"`
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("created %d, updated %d, deleted %d, unchanged %d",
+		len(r.Created), len(r.Updated), len(r.Deleted), len(r.Unchanged))
+}
+
+// ApplyFile loads, validates and applies a config file.
+func ApplyFile(ctx context.Context, path string) (*Report, error) {
+	spec, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Apply(ctx, spec)
+}
+
+// Apply reconciles the database with the spec. The spec must have been validated.
+func Apply(ctx context.Context, spec *Spec) (*Report, error) {
+	report := new(Report)
+
+	if err := applyOptions(spec, report); err != nil {
+		return report, errors.Wrap(err, "apply options")
+	}
+	if err := applyGroups(spec, report); err != nil {
+		return report, errors.Wrap(err, "apply groups")
+	}
+	if err := applyChannels(spec, report); err != nil {
+		return report, errors.Wrap(err, "apply channels")
+	}
+	if err := applyUsers(ctx, spec, report); err != nil {
+		return report, errors.Wrap(err, "apply users")
+	}
+
+	logger.Logger.Info("declarative config applied",
+		zap.String("mode", string(spec.Mode)),
+		zap.Strings("created", report.Created),
+		zap.Strings("updated", report.Updated),
+		zap.Strings("deleted", report.Deleted))
+	return report, nil
+}
+
+func optionValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		// nested values are stored as json, e.g. for json typed options
+		out, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(out)
+	}
+}
+
+// optionStoredInDB reports whether the option was ever saved, options only living in
+// the in-memory defaults do not count as existing for ModeCreate.
+func optionStoredInDB(key string) (bool, error) {
+	var option model.Option
+	err := model.DB.Where(&model.Option{Key: key}).First(&option).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func setOption(spec *Spec, report *Report, key, value string) error {
+	name := "option " + key
+	if spec.Mode == ModeCreate {
+		exists, err := optionStoredInDB(key)
+		if err != nil {
+			return errors.Wrapf(err, "check option %s", key)
+		}
+		if exists {
+			report.Unchanged = append(report.Unchanged, name)
+			return nil
+		}
+	}
+
+	config.OptionMapRWMutex.RLock()
+	current, ok := config.OptionMap[key]
+	config.OptionMapRWMutex.RUnlock()
+	if ok && current == value {
+		report.Unchanged = append(report.Unchanged, name)
+		return nil
+	}
+
+	if err := model.UpdateOption(key, value); err != nil {
+		return errors.Wrapf(err, "update option %s", key)
+	}
+	report.Updated = append(report.Updated, name)
+	return nil
+}
+
+func applyOptions(spec *Spec, report *Report) error {
+	keys := make([]string, 0, len(spec.Options))
+	for key := range spec.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := setOption(spec, report, key, optionValue(spec.Options[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func floatPtrEqual(a, b *float64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func intPtrEqual(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func applyGroups(spec *Spec, report *Report) error {
+	groups, err := sortGroups(spec.Groups)
+	if err != nil {
+		return err
+	}
+
+	for _, groupSpec := range groups {
+		name := "group " + groupSpec.Name
+		desired := &model.Group{
+			Name:          groupSpec.Name,
+			Description:   groupSpec.Description,
+			Ratio:         groupSpec.Ratio,
+			AllowedModels: strings.Join(groupSpec.AllowedModels, ","),
+			DeniedModels:  strings.Join(groupSpec.DeniedModels, ","),
+			DefaultRPM:    groupSpec.DefaultRPM,
+			QueuePriority: groupSpec.QueuePriority,
+			Parent:        groupSpec.Parent,
+		}
+
+		current, err := model.GetGroupByName(groupSpec.Name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err = desired.Insert(); err != nil {
+				return errors.Wrapf(err, "create %s", name)
+			}
+			if groupSpec.ModelRatios != nil {
+				if err = model.SetGroupModelRatios(groupSpec.Name, groupSpec.ModelRatios); err != nil {
+					return errors.Wrapf(err, "set model ratios of %s", name)
+				}
+			}
+			report.Created = append(report.Created, name)
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "get %s", name)
+		}
+		if spec.Mode == ModeCreate {
+			report.Unchanged = append(report.Unchanged, name)
+			continue
+		}
+
+		changed := false
+		if current.Description != desired.Description ||
+			!floatPtrEqual(current.Ratio, desired.Ratio) ||
+			current.AllowedModels != desired.AllowedModels ||
+			current.DeniedModels != desired.DeniedModels ||
+			!intPtrEqual(current.DefaultRPM, desired.DefaultRPM) ||
+			!intPtrEqual(current.QueuePriority, desired.QueuePriority) ||
+			current.Parent != desired.Parent {
+			if err = desired.Update(); err != nil {
+				return errors.Wrapf(err, "update %s", name)
+			}
+			changed = true
+		}
+		if groupSpec.ModelRatios != nil {
+			currentRatios, err := model.GetGroupModelRatios(groupSpec.Name)
+			if err != nil {
+				return errors.Wrapf(err, "get model ratios of %s", name)
+			}
+			if !reflect.DeepEqual(currentRatios, groupSpec.ModelRatios) {
+				if err = model.SetGroupModelRatios(groupSpec.Name, groupSpec.ModelRatios); err != nil {
+					return errors.Wrapf(err, "set model ratios of %s", name)
+				}
+				changed = true
+			}
+		}
+
+		if changed {
+			report.Updated = append(report.Updated, name)
+		} else {
+			report.Unchanged = append(report.Unchanged, name)
+		}
+	}
+	return nil
+}
+
+// desiredChannel builds the channel row described by the spec.
+func desiredChannel(spec ChannelSpec) (*model.Channel, error) {
+	status := model.ChannelStatusEnabled
+	if spec.Status == StatusDisabled {
+		status = model.ChannelStatusManuallyDisabled
+	}
+	groups := spec.Groups
+	if len(groups) == 0 {
+		groups = []string{"default"}
+	}
+
+	channel := &model.Channel{
+		Type:         spec.Type,
+		Key:          spec.Key,
+		Status:       status,
+		Name:         spec.Name,
+		Weight:       &spec.Weight,
+		BaseURL:      &spec.BaseURL,
+		Models:       strings.Join(spec.Models, ","),
+		Group:        strings.Join(groups, ","),
+		Priority:     &spec.Priority,
+		SystemPrompt: &spec.SystemPrompt,
+		RateLimit:    &spec.RateLimit,
+	}
+
+	modelMapping := ""
+	if len(spec.ModelMapping) > 0 {
+		out, err := json.Marshal(spec.ModelMapping)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		modelMapping = string(out)
+	}
+	channel.ModelMapping = &modelMapping
+
+	modelConfigs := make(map[string]model.ModelConfigLocal, len(spec.ModelConfigs))
+	for name, cfg := range spec.ModelConfigs {
+		modelConfigs[name] = model.ModelConfigLocal{
+			Ratio:            cfg.Ratio,
+			CompletionRatio:  cfg.CompletionRatio,
+			MaxTokens:        cfg.MaxTokens,
+			Tiers:            cfg.Tiers,
+			Windows:          cfg.Windows,
+			CachedInputRatio: cfg.CachedInputRatio,
+			CacheWriteRatio:  cfg.CacheWriteRatio,
+		}
+	}
+	if err := channel.SetModelPriceConfigs(modelConfigs); err != nil {
+		return nil, err
+	}
+	if channel.ModelConfigs == nil {
+		empty := ""
+		channel.ModelConfigs = &empty
+	}
+
+	if len(spec.Config) > 0 {
+		out, err := json.Marshal(spec.Config)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		channel.Config = string(out)
+	}
+
+	if err := channel.SetInferenceProfileArnMap(spec.InferenceProfileArnMap); err != nil {
+		return nil, err
+	}
+	if channel.InferenceProfileArnMap == nil {
+		empty := ""
+		channel.InferenceProfileArnMap = &empty
+	}
+
+	return channel, nil
+}
+
+func sameJSON(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var va, vb any
+	if a == "" {
+		a = "{}"
+	}
+	if b == "" {
+		b = "{}"
+	}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefInt(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func derefUint(i *uint) uint {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func channelMatches(current, desired *model.Channel) bool {
+	return current.Type == desired.Type &&
+		current.Key == desired.Key &&
+		current.Status == desired.Status &&
+		current.Models == desired.Models &&
+		current.Group == desired.Group &&
+		current.GetPriority() == desired.GetPriority() &&
+		derefUint(current.Weight) == derefUint(desired.Weight) &&
+		current.GetBaseURL() == desired.GetBaseURL() &&
+		derefString(current.SystemPrompt) == derefString(desired.SystemPrompt) &&
+		derefInt(current.RateLimit) == derefInt(desired.RateLimit) &&
+		sameJSON(derefString(current.ModelMapping), derefString(desired.ModelMapping)) &&
+		sameJSON(derefString(current.ModelConfigs), derefString(desired.ModelConfigs)) &&
+		sameJSON(current.Config, desired.Config) &&
+		sameJSON(derefString(current.InferenceProfileArnMap), derefString(desired.InferenceProfileArnMap))
+}
+
+func applyChannels(spec *Spec, report *Report) error {
+	var existing []*model.Channel
+	if err := model.DB.Order("id asc").Find(&existing).Error; err != nil {
+		return errors.Wrap(err, "list channels")
+	}
+	byName := make(map[string]*model.Channel, len(existing))
+	declared := make(map[int]bool)
+	for _, channel := range existing {
+		if _, ok := byName[channel.Name]; !ok {
+			byName[channel.Name] = channel
+		}
+	}
+
+	for _, channelSpec := range spec.Channels {
+		name := "channel " + channelSpec.Name
+		desired, err := desiredChannel(channelSpec)
+		if err != nil {
+			return errors.Wrapf(err, "build %s", name)
+		}
+
+		current, ok := byName[channelSpec.Name]
+		if !ok {
+			desired.CreatedTime = helper.GetTimestamp()
+			if err = desired.Insert(); err != nil {
+				return errors.Wrapf(err, "create %s", name)
+			}
+			declared[desired.Id] = true
+			report.Created = append(report.Created, name)
+			continue
+		}
+
+		declared[current.Id] = true
+		if spec.Mode == ModeCreate || channelMatches(current, desired) {
+			report.Unchanged = append(report.Unchanged, name)
+			continue
+		}
+
+		desired.Id = current.Id
+		// Update only writes non-zero fields, so an emptied config has to be cleared explicitly
+		if desired.Config == "" && current.Config != "" {
+			if err = model.DB.Model(&model.Channel{}).Where("id = ?", current.Id).Update("config", "").Error; err != nil {
+				return errors.Wrapf(err, "clear config of %s", name)
+			}
+		}
+		if err = desired.Update(); err != nil {
+			return errors.Wrapf(err, "update %s", name)
+		}
+		report.Updated = append(report.Updated, name)
+	}
+
+	if spec.Mode != ModePrune {
+		return nil
+	}
+	for _, channel := range existing {
+		if declared[channel.Id] {
+			continue
+		}
+		if err := channel.Delete(); err != nil {
+			return errors.Wrapf(err, "delete channel %s", channel.Name)
+		}
+		report.Deleted = append(report.Deleted, fmt.Sprintf("channel %s#%d", channel.Name, channel.Id))
+	}
+	return nil
+}
+
+func parseRole(role string) (int, bool) {
+	switch role {
+	case "", "common":
+		return model.RoleCommonUser, true
+	case "admin":
+		return model.RoleAdminUser, true
+	case "root":
+		return model.RoleRootUser, true
+	}
+	return 0, false
+}
+
+func userStatus(status string) int {
+	if status == StatusDisabled {
+		return model.UserStatusDisabled
+	}
+	return model.UserStatusEnabled
+}
+
+func applyUsers(ctx context.Context, spec *Spec, report *Report) error {
+	for _, userSpec := range spec.Users {
+		user, err := applyUser(ctx, spec, userSpec, report)
+		if err != nil {
+			return errors.Wrapf(err, "user %s", userSpec.Username)
+		}
+		if userSpec.Tokens == nil {
+			continue
+		}
+		if err = applyTokens(spec, user, userSpec, report); err != nil {
+			return errors.Wrapf(err, "tokens of user %s", userSpec.Username)
+		}
+	}
+	return nil
+}
+
+func applyUser(ctx context.Context, spec *Spec, userSpec UserSpec, report *Report) (*model.User, error) {
+	name := "user " + userSpec.Username
+	role, _ := parseRole(userSpec.Role)
+	group := userSpec.Group
+	if group == "" {
+		group = "default"
+	}
+
+	user := &model.User{Username: userSpec.Username}
+	err := model.DB.Where("username = ?", userSpec.Username).First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		password := userSpec.Password
+		if password == "" {
+			// password login is simply not possible until an admin resets it
+			password = random.GetRandomString(20)
+		}
+		displayName := userSpec.DisplayName
+		if displayName == "" {
+			displayName = userSpec.Username
+		}
+		user = &model.User{
+			Username:    userSpec.Username,
+			Password:    password,
+			DisplayName: displayName,
+			Email:       userSpec.Email,
+			Role:        role,
+			Status:      userStatus(userSpec.Status),
+			Group:       group,
+		}
+		if err = user.Insert(ctx, 0); err != nil {
+			return nil, errors.Wrap(err, "create user")
+		}
+		if userSpec.Quota != nil {
+			if err = model.DB.Model(user).Update("quota", *userSpec.Quota).Error; err != nil {
+				return nil, errors.Wrap(err, "set quota")
+			}
+		}
+		report.Created = append(report.Created, name)
+		return user, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	if spec.Mode == ModeCreate {
+		report.Unchanged = append(report.Unchanged, name)
+		return user, nil
+	}
+
+	changed := false
+	updates := map[string]any{}
+	if userSpec.DisplayName != "" && user.DisplayName != userSpec.DisplayName {
+		updates["display_name"] = userSpec.DisplayName
+	}
+	if userSpec.Email != "" && user.Email != userSpec.Email {
+		updates["email"] = userSpec.Email
+	}
+	if user.Role != role {
+		updates["role"] = role
+	}
+	if user.Group != group {
+		updates["group"] = group
+	}
+	if status := userStatus(userSpec.Status); user.Status != status {
+		updates["status"] = status
+	}
+	if userSpec.Quota != nil && user.Quota != *userSpec.Quota {
+		updates["quota"] = *userSpec.Quota
+	}
+	if len(updates) > 0 {
+		if err = model.DB.Model(user).Updates(updates).Error; err != nil {
+			return nil, errors.Wrap(err, "update user")
+		}
+		if status, ok := updates["status"]; ok {
+			// keep the ban list in sync the same way User.Update does
+			if err = (&model.User{Id: user.Id, Status: status.(int)}).Update(false); err != nil {
+				return nil, errors.Wrap(err, "update user status")
+			}
+		}
+		changed = true
+	}
+	if userSpec.Password != "" && !common.ValidatePasswordAndHash(userSpec.Password, user.Password) {
+		hashed, err := common.Password2Hash(userSpec.Password)
+		if err != nil {
+			return nil, errors.Wrap(err, "hash password")
+		}
+		if err = model.DB.Model(user).Update("password", hashed).Error; err != nil {
+			return nil, errors.Wrap(err, "update password")
+		}
+		changed = true
+	}
+
+	if changed {
+		report.Updated = append(report.Updated, name)
+	} else {
+		report.Unchanged = append(report.Unchanged, name)
+	}
+	return user, nil
+}
+
+func desiredToken(userId int, tokenSpec TokenSpec) *model.Token {
+	status := model.TokenStatusEnabled
+	if tokenSpec.Status == StatusDisabled {
+		status = model.TokenStatusDisabled
+	}
+	expiredTime := tokenSpec.ExpiredTime
+	if expiredTime == 0 {
+		expiredTime = -1
+	}
+	models := strings.Join(tokenSpec.Models, ",")
+	subnet := tokenSpec.Subnet
+	return &model.Token{
+		UserId:         userId,
+		Name:           tokenSpec.Name,
+		Key:            NormalizeTokenKey(tokenSpec.Key),
+		Status:         status,
+		ExpiredTime:    expiredTime,
+		RemainQuota:    tokenSpec.RemainQuota,
+		UnlimitedQuota: tokenSpec.UnlimitedQuota,
+		Models:         &models,
+		Subnet:         &subnet,
+	}
+}
+
+func tokenMatches(current, desired *model.Token) bool {
+	return (desired.Key == "" || current.Key == desired.Key) &&
+		current.Status == desired.Status &&
+		current.ExpiredTime == desired.ExpiredTime &&
+		current.RemainQuota == desired.RemainQuota &&
+		current.UnlimitedQuota == desired.UnlimitedQuota &&
+		current.GetModels() == desired.GetModels() &&
+		derefString(current.Subnet) == derefString(desired.Subnet)
+}
+
+func applyTokens(spec *Spec, user *model.User, userSpec UserSpec, report *Report) error {
+	var existing []*model.Token
+	if err := model.DB.Where("user_id = ?", user.Id).Order("id asc").Find(&existing).Error; err != nil {
+		return errors.Wrap(err, "list tokens")
+	}
+	byName := make(map[string]*model.Token, len(existing))
+	for _, token := range existing {
+		if _, ok := byName[token.Name]; !ok {
+			byName[token.Name] = token
+		}
+	}
+
+	declared := make(map[int]bool)
+	for _, tokenSpec := range userSpec.Tokens {
+		name := fmt.Sprintf("token %s/%s", user.Username, tokenSpec.Name)
+		desired := desiredToken(user.Id, tokenSpec)
+
+		current, ok := byName[tokenSpec.Name]
+		if !ok {
+			if desired.Key == "" {
+				desired.Key = random.GenerateKey()
+			}
+			desired.CreatedTime = helper.GetTimestamp()
+			desired.AccessedTime = desired.CreatedTime
+			if err := desired.Insert(); err != nil {
+				return errors.Wrapf(err, "create %s", name)
+			}
+			declared[desired.Id] = true
+			report.Created = append(report.Created, name)
+			continue
+		}
+
+		declared[current.Id] = true
+		if spec.Mode == ModeCreate || tokenMatches(current, desired) {
+			report.Unchanged = append(report.Unchanged, name)
+			continue
+		}
+
+		desired.Id = current.Id
+		if desired.Key == "" {
+			desired.Key = current.Key
+		}
+		if desired.Key != current.Key {
+			if err := model.DB.Model(desired).Update("key", desired.Key).Error; err != nil {
+				return errors.Wrapf(err, "update key of %s", name)
+			}
+			// writes back unchanged fields, only to drop the cache entry of the old key
+			if err := current.SelectUpdate(); err != nil {
+				return errors.Wrapf(err, "rotate key of %s", name)
+			}
+		}
+		if err := desired.Update(); err != nil {
+			return errors.Wrapf(err, "update %s", name)
+		}
+		report.Updated = append(report.Updated, name)
+	}
+
+	if spec.Mode != ModePrune {
+		return nil
+	}
+	for _, token := range existing {
+		if declared[token.Id] {
+			continue
+		}
+		if err := token.Delete(); err != nil {
+			return errors.Wrapf(err, "delete token %s", token.Name)
+		}
+		report.Deleted = append(report.Deleted, fmt.Sprintf("token %s/%s", user.Username, token.Name))
+	}
+	return nil
+}
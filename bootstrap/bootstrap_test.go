@@ -0,0 +1,200 @@
+package bootstrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func setupTestDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	err = db.AutoMigrate(&model.User{}, &model.Channel{}, &model.Token{}, &model.Option{}, &model.Ability{}, &model.Log{}, &model.Group{}, &model.GroupModelRatio{})
+	require.NoError(t, err)
+
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	originalUsingSQLite, originalRedisEnabled := common.UsingSQLite, common.RedisEnabled
+	model.DB = db
+	model.LOG_DB = db
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	model.InitOptionMap()
+	t.Cleanup(func() {
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		common.UsingSQLite, common.RedisEnabled = originalUsingSQLite, originalRedisEnabled
+	})
+}
+
+const testConfig = `
+mode: update
+options:
+  QuotaForNewUser: 100
+  SystemName: Test API
+groups:
+  - name: vip-team
+    parent: vip
+    allowed_models: [gpt-4o]
+  - name: vip
+    ratio: 0.5
+    default_rpm: 60
+    model_ratios:
+      gpt-4o: 0.25
+channels:
+  - name: openai-main
+    type: 1
+    key: ${BOOTSTRAP_TEST_KEY}
+    models: [gpt-4o, gpt-4o-mini]
+    groups: [default, vip]
+    priority: 10
+    model_configs:
+      gpt-4o:
+        ratio: 1.25
+users:
+  - username: alice
+    password: alicepass123
+    role: admin
+    group: vip
+    quota: 1000
+    tokens:
+      - name: ci
+        key: sk-alicecitoken
+        unlimited_quota: true
+`
+
+func TestParseAndValidate(t *testing.T) {
+	t.Setenv("BOOTSTRAP_TEST_KEY", "sk-upstream")
+
+	spec, err := Parse([]byte(testConfig))
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate())
+	assert.Equal(t, ModeUpdate, spec.Mode)
+	require.Len(t, spec.Channels, 1)
+	assert.Equal(t, "sk-upstream", spec.Channels[0].Key)
+
+	// unknown fields are rejected
+	_, err = Parse([]byte("channels:\n  - nmae: typo\n"))
+	require.Error(t, err)
+
+	spec, err = Parse([]byte(`{"mode": "replace", "channels": [{"name": "a", "type": 0}, {"name": "a", "type": 1, "key": "k", "models": ["m"]}], "users": [{"username": "bob", "role": "owner"}]}`))
+	require.NoError(t, err)
+	spec.Groups = []GroupSpec{{Name: "a", Parent: "b"}, {Name: "b", Parent: "a"}}
+	err = spec.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{"mode must be one of", "unknown channel type", "duplicated channel name", "role must be", "inheritance cycle"} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("channels:\n  - name: a\n"), 0o600))
+	_, err := LoadFile(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(testConfig), 0o600))
+	t.Setenv("BOOTSTRAP_TEST_KEY", "sk-upstream")
+	_, err = LoadFile(path)
+	require.NoError(t, err)
+}
+
+func TestApply(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("BOOTSTRAP_TEST_KEY", "sk-upstream")
+	ctx := context.Background()
+
+	spec, err := Parse([]byte(testConfig))
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate())
+
+	report, err := Apply(ctx, spec)
+	require.NoError(t, err)
+	assert.Contains(t, report.Created, "channel openai-main")
+	assert.Contains(t, report.Created, "user alice")
+	assert.Contains(t, report.Created, "token alice/ci")
+	assert.Equal(t, "Test API", config.SystemName)
+	assert.Equal(t, int64(100), config.QuotaForNewUser)
+	assert.Contains(t, report.Created, "group vip-team")
+	policy := model.GetGroupPolicy("vip-team")
+	require.NotNil(t, policy)
+	assert.Equal(t, 0.5, policy.Ratio)
+	assert.Equal(t, 60, policy.RPM)
+	assert.False(t, policy.IsModelAllowed("gpt-4o-mini"))
+	assert.Equal(t, 0.25, billingratio.GetGroupModelRatio("vip-team", "gpt-4o"))
+
+	var channel model.Channel
+	require.NoError(t, model.DB.Where("name = ?", "openai-main").First(&channel).Error)
+	assert.Equal(t, channeltype.OpenAI, channel.Type)
+	assert.Equal(t, "sk-upstream", channel.Key)
+	assert.Equal(t, int64(10), channel.GetPriority())
+
+	var abilities int64
+	require.NoError(t, model.DB.Model(&model.Ability{}).Where("channel_id = ?", channel.Id).Count(&abilities).Error)
+	assert.Equal(t, int64(4), abilities)
+
+	user, err := model.GetUserById(1, false)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, model.RoleAdminUser, user.Role)
+	assert.Equal(t, int64(1000), user.Quota)
+
+	token := new(model.Token)
+	require.NoError(t, model.DB.Where("user_id = ? AND name = ?", user.Id, "ci").First(token).Error)
+	assert.Equal(t, "alicecitoken", token.Key)
+	assert.True(t, token.UnlimitedQuota)
+
+	// applying the same file again is a no-op
+	report, err = Apply(ctx, spec)
+	require.NoError(t, err)
+	assert.Empty(t, report.Created)
+	assert.Empty(t, report.Updated)
+	assert.Empty(t, report.Deleted)
+
+	// update existing resources
+	spec.Channels[0].Models = []string{"gpt-4o"}
+	spec.Users[0].Tokens[0].UnlimitedQuota = false
+	spec.Users[0].Tokens[0].RemainQuota = 42
+	report, err = Apply(ctx, spec)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"channel openai-main", "token alice/ci"}, report.Updated)
+
+	require.NoError(t, model.DB.Model(&model.Ability{}).Where("channel_id = ?", channel.Id).Count(&abilities).Error)
+	assert.Equal(t, int64(2), abilities)
+	token = new(model.Token)
+	require.NoError(t, model.DB.Where("user_id = ? AND name = ?", user.Id, "ci").First(token).Error)
+	assert.False(t, token.UnlimitedQuota)
+	assert.Equal(t, int64(42), token.RemainQuota)
+
+	// create mode leaves existing resources alone
+	spec.Mode = ModeCreate
+	spec.Channels[0].Priority = 99
+	report, err = Apply(ctx, spec)
+	require.NoError(t, err)
+	assert.Empty(t, report.Updated)
+
+	// prune removes undeclared channels and tokens
+	extra := &model.Channel{Name: "manual", Type: channeltype.OpenAI, Key: "k", Models: "gpt-4o", Group: "default"}
+	require.NoError(t, extra.Insert())
+	spec.Mode = ModePrune
+	spec.Users[0].Tokens = []TokenSpec{}
+	report, err = Apply(ctx, spec)
+	require.NoError(t, err)
+	assert.Contains(t, report.Deleted, "token alice/ci")
+	assert.Contains(t, report.Deleted, "channel manual#"+strconv.Itoa(extra.Id))
+
+	var channels int64
+	require.NoError(t, model.DB.Model(&model.Channel{}).Count(&channels).Error)
+	assert.Equal(t, int64(1), channels)
+}
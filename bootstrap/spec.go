@@ -0,0 +1,390 @@
+// Package bootstrap applies a declarative config file (YAML or JSON) that describes
+// channels, groups, options, users and tokens, so that a deployment can be
+// provisioned from version control instead of by clicking through the UI.
+//
+// The file is applied at startup when CONFIG_FILE is set and re-applied every time the
+// process receives SIGHUP. It can be checked offline with `one-api --validate-config <file>`.
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// Mode controls how the declared state is reconciled with the database.
+type Mode string
+
+const (
+	// ModeCreate only creates resources that do not exist yet, existing ones are left untouched.
+	ModeCreate Mode = "create"
+	// ModeUpdate creates missing resources and updates existing ones to match the file.
+	ModeUpdate Mode = "update"
+	// ModePrune behaves like ModeUpdate and additionally deletes channels that are not
+	// declared, as well as undeclared tokens of users that declare a token list.
+	// Users and groups are never deleted.
+	ModePrune Mode = "prune"
+)
+
+const (
+	StatusEnabled  = "enabled"
+	StatusDisabled = "disabled"
+)
+
+// Spec is the root of the declarative config file.
+type Spec struct {
+	Mode     Mode           `yaml:"mode" json:"mode"`
+	Options  map[string]any `yaml:"options" json:"options"`
+	Groups   []GroupSpec    `yaml:"groups" json:"groups"`
+	Channels []ChannelSpec  `yaml:"channels" json:"channels"`
+	Users    []UserSpec     `yaml:"users" json:"users"`
+}
+
+// GroupSpec declares one group, groups are identified by name.
+// Unset ratio, default_rpm and queue_priority are inherited from the parent.
+type GroupSpec struct {
+	Name          string   `yaml:"name" json:"name"`
+	Description   string   `yaml:"description" json:"description"`
+	Ratio         *float64 `yaml:"ratio" json:"ratio"`
+	AllowedModels []string `yaml:"allowed_models" json:"allowed_models"`
+	DeniedModels  []string `yaml:"denied_models" json:"denied_models"`
+	DefaultRPM    *int     `yaml:"default_rpm" json:"default_rpm"`
+	QueuePriority *int     `yaml:"queue_priority" json:"queue_priority"`
+	Parent        string   `yaml:"parent" json:"parent"`
+	// ModelRatios overrides ratio for single models, it is only managed when set
+	ModelRatios map[string]float64 `yaml:"model_ratios" json:"model_ratios"`
+}
+
+// ChannelSpec declares one channel, channels are identified by name.
+type ChannelSpec struct {
+	Name                   string                     `yaml:"name" json:"name"`
+	Type                   int                        `yaml:"type" json:"type"`
+	Key                    string                     `yaml:"key" json:"key"`
+	BaseURL                string                     `yaml:"base_url" json:"base_url"`
+	Models                 []string                   `yaml:"models" json:"models"`
+	Groups                 []string                   `yaml:"groups" json:"groups"`
+	Priority               int64                      `yaml:"priority" json:"priority"`
+	Weight                 uint                       `yaml:"weight" json:"weight"`
+	Status                 string                     `yaml:"status" json:"status"`
+	RateLimit              int                        `yaml:"ratelimit" json:"ratelimit"`
+	SystemPrompt           string                     `yaml:"system_prompt" json:"system_prompt"`
+	ModelMapping           map[string]string          `yaml:"model_mapping" json:"model_mapping"`
+	ModelConfigs           map[string]ModelConfigSpec `yaml:"model_configs" json:"model_configs"`
+	Config                 map[string]string          `yaml:"config" json:"config"`
+	InferenceProfileArnMap map[string]string          `yaml:"inference_profile_arn_map" json:"inference_profile_arn_map"`
+}
+
+// ModelConfigSpec mirrors model.ModelConfigLocal.
+type ModelConfigSpec struct {
+	Ratio           float64 `yaml:"ratio" json:"ratio"`
+	CompletionRatio float64 `yaml:"completion_ratio" json:"completion_ratio"`
+	MaxTokens       int32   `yaml:"max_tokens" json:"max_tokens"`
+	// Tiers, Windows and the cache ratios refine Ratio, see ratio.PriceRules
+	Tiers            []ratio.Tier        `yaml:"tiers" json:"tiers"`
+	Windows          []ratio.PriceWindow `yaml:"windows" json:"windows"`
+	CachedInputRatio float64             `yaml:"cached_input_ratio" json:"cached_input_ratio"`
+	CacheWriteRatio  float64             `yaml:"cache_write_ratio" json:"cache_write_ratio"`
+}
+
+// UserSpec declares one user, users are identified by username.
+type UserSpec struct {
+	Username    string `yaml:"username" json:"username"`
+	Password    string `yaml:"password" json:"password"`
+	DisplayName string `yaml:"display_name" json:"display_name"`
+	Email       string `yaml:"email" json:"email"`
+	Role        string `yaml:"role" json:"role"`
+	Group       string `yaml:"group" json:"group"`
+	Status      string `yaml:"status" json:"status"`
+	// Quota is only managed when set
+	Quota *int64 `yaml:"quota" json:"quota"`
+	// Tokens is only reconciled when set, an empty list prunes all tokens in prune mode
+	Tokens []TokenSpec `yaml:"tokens" json:"tokens"`
+}
+
+// TokenSpec declares one token of a user, tokens are identified by name within a user.
+type TokenSpec struct {
+	Name           string   `yaml:"name" json:"name"`
+	Key            string   `yaml:"key" json:"key"`
+	Status         string   `yaml:"status" json:"status"`
+	RemainQuota    int64    `yaml:"remain_quota" json:"remain_quota"`
+	UnlimitedQuota bool     `yaml:"unlimited_quota" json:"unlimited_quota"`
+	Models         []string `yaml:"models" json:"models"`
+	Subnet         string   `yaml:"subnet" json:"subnet"`
+	// ExpiredTime is a unix timestamp, 0 means never expires
+	ExpiredTime int64 `yaml:"expired_time" json:"expired_time"`
+}
+
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} with the value of the environment variable NAME,
+// so that secrets do not have to be committed. A bare `$` is left as is.
+func expandEnv(content []byte) []byte {
+	return envPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		name := envPattern.FindSubmatch(match)[1]
+		return []byte(os.Getenv(string(name)))
+	})
+}
+
+// Parse decodes a config file. JSON is accepted as well since it is valid YAML.
+// Unknown fields are rejected to catch typos early.
+func Parse(content []byte) (*Spec, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(expandEnv(content)))
+	decoder.KnownFields(true)
+
+	spec := new(Spec)
+	if err := decoder.Decode(spec); err != nil {
+		return nil, errors.Wrap(err, "decode config file")
+	}
+	if spec.Mode == "" {
+		spec.Mode = ModeUpdate
+	}
+	return spec, nil
+}
+
+// LoadFile reads, parses and validates a config file.
+func LoadFile(path string) (*Spec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read config file %s", path)
+	}
+	spec, err := Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	if err = spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Validate checks the spec without touching the database and reports every problem at once.
+func (spec *Spec) Validate() error {
+	var problems []string
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch spec.Mode {
+	case ModeCreate, ModeUpdate, ModePrune:
+	default:
+		addf("mode must be one of create, update or prune, got %q", spec.Mode)
+	}
+
+	for key := range spec.Options {
+		if strings.TrimSpace(key) == "" {
+			addf("options: empty option key")
+		}
+		if key == "GroupRatio" {
+			addf("options: GroupRatio is no longer supported, declare groups instead")
+		}
+	}
+
+	groupNames := make(map[string]bool)
+	for i, group := range spec.Groups {
+		where := fmt.Sprintf("groups[%d]", i)
+		if !model.ValidGroupName(group.Name) {
+			addf("%s: invalid group name %q", where, group.Name)
+		} else {
+			where = fmt.Sprintf("group %q", group.Name)
+			if groupNames[group.Name] {
+				addf("%s: duplicated group name", where)
+			}
+			groupNames[group.Name] = true
+		}
+		if group.Ratio != nil && *group.Ratio < 0 {
+			addf("%s: negative ratio", where)
+		}
+		if group.DefaultRPM != nil && *group.DefaultRPM < 0 {
+			addf("%s: negative default_rpm", where)
+		}
+		for modelName, ratio := range group.ModelRatios {
+			if modelName == "" || ratio < 0 {
+				addf("%s: invalid model_ratios entry %q: %v", where, modelName, ratio)
+			}
+		}
+		if group.Parent == group.Name && group.Name != "" {
+			addf("%s: a group cannot inherit from itself", where)
+		}
+		for _, m := range append(append([]string{}, group.AllowedModels...), group.DeniedModels...) {
+			if strings.TrimSpace(m) == "" || strings.Contains(m, ",") {
+				addf("%s: invalid model name %q", where, m)
+			}
+		}
+	}
+	if _, err := sortGroups(spec.Groups); err != nil {
+		addf("groups: %s", err.Error())
+	}
+
+	channelNames := make(map[string]bool)
+	for i, ch := range spec.Channels {
+		where := fmt.Sprintf("channels[%d]", i)
+		if ch.Name == "" {
+			addf("%s: name is required", where)
+		} else {
+			where = fmt.Sprintf("channel %q", ch.Name)
+			if channelNames[ch.Name] {
+				addf("%s: duplicated channel name", where)
+			}
+			channelNames[ch.Name] = true
+		}
+		if ch.Type <= channeltype.Unknown || ch.Type >= channeltype.Dummy {
+			addf("%s: unknown channel type %d", where, ch.Type)
+		}
+		if ch.Key == "" {
+			addf("%s: key is required", where)
+		}
+		if strings.Contains(ch.Key, "\n") {
+			addf("%s: key must be a single line, declare one channel per key", where)
+		}
+		if len(ch.Models) == 0 {
+			addf("%s: at least one model is required", where)
+		}
+		for _, m := range ch.Models {
+			if strings.TrimSpace(m) == "" || strings.Contains(m, ",") {
+				addf("%s: invalid model name %q", where, m)
+			}
+		}
+		for _, g := range ch.Groups {
+			if strings.TrimSpace(g) == "" || strings.Contains(g, ",") {
+				addf("%s: invalid group name %q", where, g)
+			}
+		}
+		if !validStatus(ch.Status) {
+			addf("%s: status must be enabled or disabled", where)
+		}
+		for modelName, cfg := range ch.ModelConfigs {
+			if cfg.Ratio < 0 || cfg.CompletionRatio < 0 || cfg.MaxTokens < 0 {
+				addf("%s: negative value in model_configs for %s", where, modelName)
+			}
+			if cfg.Ratio == 0 && cfg.CompletionRatio == 0 && cfg.MaxTokens == 0 {
+				addf("%s: model_configs for %s has no meaningful data", where, modelName)
+			}
+			rules := ratio.PriceRules{Tiers: cfg.Tiers, Windows: cfg.Windows,
+				CachedInputRatio: cfg.CachedInputRatio, CacheWriteRatio: cfg.CacheWriteRatio}
+			if err := rules.Validate(); err != nil {
+				addf("%s: model_configs for %s: %v", where, modelName, err)
+			}
+			if !rules.IsEmpty() && cfg.Ratio == 0 {
+				addf("%s: model_configs for %s: price rules require a ratio", where, modelName)
+			}
+		}
+		for k, v := range ch.InferenceProfileArnMap {
+			if k == "" || v == "" {
+				addf("%s: inference_profile_arn_map cannot contain empty keys or values", where)
+			}
+		}
+	}
+
+	usernames := make(map[string]bool)
+	tokenKeys := make(map[string]bool)
+	for i, user := range spec.Users {
+		where := fmt.Sprintf("users[%d]", i)
+		if user.Username == "" {
+			addf("%s: username is required", where)
+		} else {
+			where = fmt.Sprintf("user %q", user.Username)
+			if usernames[user.Username] {
+				addf("%s: duplicated username", where)
+			}
+			usernames[user.Username] = true
+		}
+		if len(user.Username) > 30 {
+			addf("%s: username is longer than 30 characters", where)
+		}
+		if user.Password != "" && (len(user.Password) < 8 || len(user.Password) > 20) {
+			addf("%s: password must be 8 to 20 characters long", where)
+		}
+		if _, ok := parseRole(user.Role); !ok {
+			addf("%s: role must be common, admin or root", where)
+		}
+		if !validStatus(user.Status) {
+			addf("%s: status must be enabled or disabled", where)
+		}
+		if user.Quota != nil && *user.Quota < 0 {
+			addf("%s: negative quota", where)
+		}
+
+		tokenNames := make(map[string]bool)
+		for j, token := range user.Tokens {
+			tokenWhere := fmt.Sprintf("%s tokens[%d]", where, j)
+			if token.Name == "" {
+				addf("%s: name is required", tokenWhere)
+			} else if tokenNames[token.Name] {
+				addf("%s: duplicated token name %q", tokenWhere, token.Name)
+			}
+			tokenNames[token.Name] = true
+			if token.Key != "" {
+				key := NormalizeTokenKey(token.Key)
+				if len(key) > 48 || strings.Contains(key, "-") {
+					addf("%s: key must be at most 48 characters without '-' (the sk- prefix is optional)", tokenWhere)
+				}
+				if tokenKeys[key] {
+					addf("%s: duplicated token key", tokenWhere)
+				}
+				tokenKeys[key] = true
+			}
+			if !validStatus(token.Status) {
+				addf("%s: status must be enabled or disabled", tokenWhere)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid config file:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// NormalizeTokenKey strips the prefixes that clients send but that are not stored.
+func NormalizeTokenKey(key string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(key, "sk-"), "laisky-")
+}
+
+func validStatus(status string) bool {
+	return status == "" || status == StatusEnabled || status == StatusDisabled
+}
+
+// sortGroups orders groups so that declared parents come before their children.
+// Parents that are not declared must already exist in the database.
+func sortGroups(groups []GroupSpec) ([]GroupSpec, error) {
+	byName := make(map[string]GroupSpec, len(groups))
+	for _, group := range groups {
+		byName[group.Name] = group
+	}
+
+	sorted := make([]GroupSpec, 0, len(groups))
+	state := make(map[string]int) // 1 visiting, 2 done
+	var visit func(group GroupSpec) error
+	visit = func(group GroupSpec) error {
+		switch state[group.Name] {
+		case 1:
+			return errors.Errorf("inheritance cycle through group %s", group.Name)
+		case 2:
+			return nil
+		}
+		state[group.Name] = 1
+		if parent, ok := byName[group.Parent]; ok && group.Parent != "" {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[group.Name] = 2
+		sorted = append(sorted, group)
+		return nil
+	}
+	for _, group := range groups {
+		if err := visit(group); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,49 @@
+package bootstrap
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// Reload applies the config file and refreshes the in-memory channel cache.
+func Reload(ctx context.Context, path string) (*Report, error) {
+	report, err := ApplyFile(ctx, path)
+	if err != nil {
+		return report, err
+	}
+	if config.MemoryCacheEnabled {
+		model.InitChannelCache()
+	}
+	return report, nil
+}
+
+// WatchSIGHUP re-applies the config file every time the process receives SIGHUP.
+// A broken file is logged and ignored, the previous state stays in effect.
+func WatchSIGHUP(ctx context.Context, path string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			logger.Logger.Info("SIGHUP received, reloading config file", zap.String("path", path))
+			report, err := Reload(ctx, path)
+			if err != nil {
+				logger.Logger.Error("failed to reload config file", zap.String("path", path), zap.Error(err))
+				continue
+			}
+			logger.Logger.Info("config file reloaded", zap.String("result", report.String()))
+		}
+	}
+}
@@ -103,7 +103,9 @@ func ConnectDatabase(dbType, dsn string) (*DatabaseConnection, error) {
 	oneapilogger.Logger.Info(fmt.Sprintf("Successfully connected to %s database", dbType))
 
 	return &DatabaseConnection{
-		DB:     db,
+		// skip model hooks so that encrypted channel secrets are copied as-is
+		// and never decrypted while exporting
+		DB:     db.Session(&gorm.Session{SkipHooks: true}),
 		Type:   strings.ToLower(dbType),
 		DSN:    dsn,
 		Driver: driver,
@@ -2,7 +2,9 @@ package blacklist
 
 import (
 	"fmt"
+	"net"
 	"sync"
+	"time"
 )
 
 var blackList sync.Map
@@ -27,3 +29,38 @@ func IsUserBanned(id int) bool {
 	_, ok := blackList.Load(userId2Key(id))
 	return ok
 }
+
+// IPBan is a banned network, ExpiredTime is a unix time, 0 never expires.
+type IPBan struct {
+	Network     *net.IPNet
+	ExpiredTime int64
+}
+
+var (
+	ipBans    []IPBan
+	ipBansMux sync.RWMutex
+)
+
+// SetIPBans replaces the banned networks.
+func SetIPBans(bans []IPBan) {
+	ipBansMux.Lock()
+	ipBans = bans
+	ipBansMux.Unlock()
+}
+
+// IsIPBanned reports whether the IP is in a network whose ban has not expired.
+func IsIPBanned(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	now := time.Now().Unix()
+	ipBansMux.RLock()
+	defer ipBansMux.RUnlock()
+	for _, ban := range ipBans {
+		if (ban.ExpiredTime == 0 || ban.ExpiredTime > now) && ban.Network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gutils "github.com/Laisky/go-utils/v5"
+	"github.com/go-redis/redis/v8"
+)
+
+// channelSlotLease is how long a slot stays taken in Redis without being renewed,
+// so the slots of a crashed node are freed eventually.
+const channelSlotLease = time.Minute
+
+var (
+	inMemoryChannelSlots    = make(map[int]int)
+	inMemoryChannelSlotsMux sync.Mutex
+)
+
+// acquireChannelSlotScript drops the expired leases of the channel and adds a new one
+// if fewer than the limit remain.
+var acquireChannelSlotScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+func channelSlotKey(channelId int) string {
+	return fmt.Sprintf("inFlight:channel:%d", channelId)
+}
+
+// AcquireChannelSlot takes one of the limit in-flight slots of the channel, shared by all nodes
+// when Redis is enabled. It returns false if every slot is taken, otherwise release must be
+// called once the upstream request is done.
+func AcquireChannelSlot(ctx context.Context, channelId int, limit int) (release func(), ok bool, err error) {
+	if !RedisEnabled {
+		inMemoryChannelSlotsMux.Lock()
+		defer inMemoryChannelSlotsMux.Unlock()
+		if inMemoryChannelSlots[channelId] >= limit {
+			return nil, false, nil
+		}
+		inMemoryChannelSlots[channelId]++
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				inMemoryChannelSlotsMux.Lock()
+				defer inMemoryChannelSlotsMux.Unlock()
+				if inMemoryChannelSlots[channelId]--; inMemoryChannelSlots[channelId] <= 0 {
+					delete(inMemoryChannelSlots, channelId)
+				}
+			})
+		}, true, nil
+	}
+
+	key := channelSlotKey(channelId)
+	lease := gutils.UUID7()
+	now := time.Now()
+	acquired, err := acquireChannelSlotScript.Run(ctx, RDB, []string{key},
+		now.UnixMilli(), limit, now.Add(channelSlotLease).UnixMilli(), lease, channelSlotLease.Milliseconds()).Int()
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "acquire slot of channel %d", channelId)
+	}
+	if acquired == 0 {
+		return nil, false, nil
+	}
+
+	// renew the lease while the request runs, e.g. a long stream
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(channelSlotLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				RDB.ZAddXX(context.Background(), key, &redis.Z{
+					Score:  float64(time.Now().Add(channelSlotLease).UnixMilli()),
+					Member: lease,
+				})
+				RDB.PExpire(context.Background(), key, channelSlotLease)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			// the request context may be canceled already
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			RDB.ZRem(ctx, key, lease)
+		})
+	}, true, nil
+}
+
+// ChannelInFlight returns the number of requests the channel is serving.
+func ChannelInFlight(ctx context.Context, channelId int) (int, error) {
+	counts, err := ChannelsInFlight(ctx, []int{channelId})
+	if err != nil {
+		return 0, err
+	}
+	return counts[channelId], nil
+}
+
+// ChannelsInFlight returns the number of requests each of the channels is serving,
+// counted in a single round trip to Redis.
+func ChannelsInFlight(ctx context.Context, channelIds []int) (map[int]int, error) {
+	counts := make(map[int]int, len(channelIds))
+	if len(channelIds) == 0 {
+		return counts, nil
+	}
+	if !RedisEnabled {
+		inMemoryChannelSlotsMux.Lock()
+		defer inMemoryChannelSlotsMux.Unlock()
+		for _, channelId := range channelIds {
+			counts[channelId] = inMemoryChannelSlots[channelId]
+		}
+		return counts, nil
+	}
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	cmds := make([]*redis.IntCmd, len(channelIds))
+	_, err := RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, channelId := range channelIds {
+			cmds[i] = pipe.ZCount(ctx, channelSlotKey(channelId), now, "+inf")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "count in-flight requests of channels")
+	}
+	for i, channelId := range channelIds {
+		counts[channelId] = int(cmds[i].Val())
+	}
+	return counts, nil
+}
@@ -45,6 +45,15 @@ var ChannelSuspendSecondsFor429 = time.Second * time.Duration(env.Int("CHANNEL_S
 // Any options with "Secret", "Token" in its key won't be return by GetOptions
 
 var SessionSecret = os.Getenv("SESSION_SECRET")
+
+// ChannelSecretKey is the master key used to encrypt channel keys and channel config
+// secrets at rest. Leave it empty to store them in plaintext (legacy behavior).
+var ChannelSecretKey = os.Getenv("CHANNEL_SECRET_KEY")
+
+// ChannelSecretPreviousKeys is a comma separated list of retired master keys,
+// kept so that values encrypted before a key rotation can still be decrypted.
+var ChannelSecretPreviousKeys = env.String("CHANNEL_SECRET_PREVIOUS_KEYS", "")
+
 var DisableCookieSecret = strings.ToLower(os.Getenv("DISABLE_COOKIE_SECURE")) == "true"
 
 var OptionMap map[string]string
@@ -108,6 +117,10 @@ var WeChatAccountQRCodeImageURL = ""
 var MessagePusherAddress = ""
 var MessagePusherToken = ""
 
+// SCIMToken is the bearer token of the SCIM provisioning endpoint /scim/v2, which is
+// disabled while it is empty
+var SCIMToken = ""
+
 var TurnstileSiteKey = ""
 var TurnstileSecretKey = ""
 
@@ -184,6 +197,10 @@ var MetricSuccessRateThreshold = env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.
 var MetricSuccessChanSize = env.Int("METRIC_SUCCESS_CHAN_SIZE", 1024)
 var MetricFailChanSize = env.Int("METRIC_FAIL_CHAN_SIZE", 128)
 
+// ConfigFile is a declarative YAML/JSON file describing channels, groups, options and users,
+// it is applied at startup and re-applied on SIGHUP
+var ConfigFile = env.String("CONFIG_FILE", "")
+
 var InitialRootToken = os.Getenv("INITIAL_ROOT_TOKEN")
 
 var InitialRootAccessToken = os.Getenv("INITIAL_ROOT_ACCESS_TOKEN")
@@ -208,3 +225,27 @@ var OpenrouterProviderSort = env.String("OPENROUTER_PROVIDER_SORT", "")
 var DefaultMaxToken = env.Int("DEFAULT_MAX_TOKEN", 2048)
 
 var DefaultUseMinMaxTokensModel = env.Bool("DEFAULT_USE_MIN_MAX_TOKENS_MODEL", false)
+
+// TranscriptMaxBodyBytes caps the request and response bodies stored by transcript capture
+var TranscriptMaxBodyBytes = env.Int("TRANSCRIPT_MAX_BODY_BYTES", 64*1024)
+
+// TranscriptRetentionDays is the number of days captured transcripts are kept, 0 keeps them forever
+var TranscriptRetentionDays = env.Int("TRANSCRIPT_RETENTION_DAYS", 7)
+
+// ChannelRecoveryEnabled probes auto-disabled channels and enables them again once they work
+var ChannelRecoveryEnabled = env.Bool("CHANNEL_RECOVERY_ENABLED", false)
+
+// ChannelRecoveryInterval is the delay before the first probe of an auto-disabled channel,
+// it doubles after every failed probe up to ChannelRecoveryMaxInterval. Unit is second.
+var ChannelRecoveryInterval = env.Int("CHANNEL_RECOVERY_INTERVAL", 60)
+var ChannelRecoveryMaxInterval = env.Int("CHANNEL_RECOVERY_MAX_INTERVAL", 3600)
+
+// ChannelRecoverySuccesses is the number of consecutive successful probes that enable a channel again
+var ChannelRecoverySuccesses = env.Int("CHANNEL_RECOVERY_SUCCESSES", 3)
+
+// ChannelQueueTimeout is how long a request waits for a channel when every channel of its
+// model is suspended, 0 answers 503 at once. Unit is second.
+var ChannelQueueTimeout = env.Int("CHANNEL_QUEUE_TIMEOUT", 0)
+
+// ChannelQueueMaxDepth bounds the requests waiting for a channel per group and model
+var ChannelQueueMaxDepth = env.Int("CHANNEL_QUEUE_MAX_DEPTH", 100)
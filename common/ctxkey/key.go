@@ -45,4 +45,19 @@ const (
 	// Additional context keys
 	ConvertedResponse = "converted_response"
 	ResponseFormat    = "response_format"
+	// RerankRequest is the canonical *model.RerankRequest of a rerank relay
+	RerankRequest = "rerank_request"
+	// EmbeddingOptions is the model.EmbeddingOptions of an embeddings relay
+	EmbeddingOptions = "embedding_options"
+	// VirtualModel is the *model.VirtualModel the request was sent to, if any
+	VirtualModel = "virtual_model"
+	// VirtualModelTarget is the index of the target of VirtualModel that serves the request
+	VirtualModelTarget = "virtual_model_target"
+	// RoutingGroup is the group whose channels serve the request, it differs from
+	// Group when a virtual model target selects the channels of another group
+	RoutingGroup = "routing_group"
+	// VirtualModelRequestBody is the request body before a virtual model target rewrote it
+	VirtualModelRequestBody = "virtual_model_request_body"
+	// ContentGuard is the *contentpolicy.Guard of the request, if any policy covers the caller
+	ContentGuard = "content_guard"
 )
@@ -16,13 +16,15 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+	// ValidateConfig checks a declarative config file and exits without starting the server
+	ValidateConfig = flag.String("validate-config", "", "validate the given declarative config file and exit")
 )
 
 func printHelp() {
 	fmt.Println("One API " + Version + " - All in one API service for OpenAI API.")
 	fmt.Println("Copyright (C) 2025 JustSong. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/Laisky/one-api")
-	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--validate-config <config file>] [--version] [--help]")
 }
 
 func Init() {
@@ -0,0 +1,259 @@
+// Package jwks fetches and caches the JSON Web Key Sets (RFC 7517) that JWT issuers
+// publish their signing keys in.
+//
+// A key set is refetched after RefreshInterval, and early when a token is signed by a
+// key it does not know yet, so that keys the issuer rotates in are picked up without
+// waiting for the next refresh. Early refetches are throttled by MinRefreshInterval,
+// tokens with made up key ids must not make the gateway hammer the issuer.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var (
+	// RefreshInterval is the time a fetched key set is used for.
+	RefreshInterval = time.Hour
+	// MinRefreshInterval is the minimum time between two fetches of a key set.
+	MinRefreshInterval = time.Minute
+	// MaxStaleness is the time a key set keeps being used while it cannot be fetched.
+	MaxStaleness = 24 * time.Hour
+)
+
+// fetchTimeout bounds a fetch of a key set, it does not depend on the request that
+// started it as other requests may wait for it too.
+const fetchTimeout = 5 * time.Second
+
+var client = &http.Client{Timeout: fetchTimeout}
+
+// JSONWebKey is a public key of a key set, only the members of signing keys are read.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// PublicKey returns the key as *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (k *JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	decode := func(name string, value string) ([]byte, error) {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(b) == 0 {
+			return nil, errors.Errorf("invalid %s of key %q", name, k.Kid)
+		}
+		return b, nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode("n", k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e", k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.Errorf("invalid e of key %q", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %q of key %q", k.Crv, k.Kid)
+		}
+		x, err := decode("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y", k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.Errorf("key %q is not on curve %s", k.Kid, k.Crv)
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.Errorf("unsupported curve %q of key %q", k.Crv, k.Kid)
+		}
+		x, err := decode("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("invalid x of key %q", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.Errorf("unsupported key type %q of key %q", k.Kty, k.Kid)
+}
+
+// keySet is the cached key set of an URL.
+type keySet struct {
+	mu sync.Mutex
+	// keys are the signing keys by key id
+	keys map[string]crypto.PublicKey
+	// fetched is the time the keys were fetched, attempted is the time of the last fetch
+	fetched   time.Time
+	attempted time.Time
+	// fetching is closed when the running fetch is done, nil if none runs
+	fetching chan struct{}
+}
+
+var (
+	setsMu sync.Mutex
+	sets   = make(map[string]*keySet)
+)
+
+// Key returns the signing key of the key id from the key set at the URL. If the token
+// names no key id, the key set must consist of a single key.
+//
+// The key set is fetched in the background, once for all the requests that need it.
+// A request waits for the fetch only if the key is not known yet, an expired key set
+// keeps being used until the new one arrives.
+func Key(ctx context.Context, url string, kid string) (crypto.PublicKey, error) {
+	setsMu.Lock()
+	set, ok := sets[url]
+	if !ok {
+		set = &keySet{}
+		sets[url] = set
+	}
+	setsMu.Unlock()
+
+	set.mu.Lock()
+	now := time.Now()
+	_, known := set.lookup(kid)
+	expired := now.Sub(set.fetched) > RefreshInterval
+	if (expired || !known) && set.fetching == nil && now.Sub(set.attempted) > MinRefreshInterval {
+		set.attempted = now
+		set.fetching = make(chan struct{})
+		go set.refresh(context.WithoutCancel(ctx), url)
+	}
+	fetching := set.fetching
+	stale := now.Sub(set.fetched) > MaxStaleness
+	set.mu.Unlock()
+
+	if fetching != nil && (!known || stale) {
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "wait for key set %s", url)
+		}
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if time.Since(set.fetched) > MaxStaleness {
+		return nil, errors.Errorf("no current key set from %s", url)
+	}
+	key, ok := set.lookup(kid)
+	if !ok {
+		return nil, errors.Errorf("key %q not found in key set %s", kid, url)
+	}
+	return key, nil
+}
+
+// refresh fetches the key set and ends the running fetch, the keys are kept if it fails.
+func (s *keySet) refresh(ctx context.Context, url string) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	keys, err := fetch(ctx, url)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		logger.Logger.Warn("failed to fetch JWKS", zap.String("url", url), zap.Error(err))
+	} else {
+		s.keys, s.fetched = keys, time.Now()
+	}
+	close(s.fetching)
+	s.fetching = nil
+}
+
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// fetch downloads the key set and returns its signing keys, keys of other uses or of
+// unsupported types are skipped.
+func fetch(ctx context.Context, url string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("status %d", res.StatusCode)
+	}
+	var body struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, errors.Wrap(err, "decode key set")
+	}
+	keys := make(map[string]crypto.PublicKey, len(body.Keys))
+	for i := range body.Keys {
+		if body.Keys[i].Use != "" && body.Keys[i].Use != "sig" {
+			continue
+		}
+		key, err := body.Keys[i].PublicKey()
+		if err != nil {
+			logger.Logger.Warn("skip JWKS key", zap.String("url", url), zap.Error(err))
+			continue
+		}
+		keys[body.Keys[i].Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("key set has no signing keys")
+	}
+	return keys, nil
+}
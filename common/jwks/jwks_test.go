@@ -0,0 +1,56 @@
+package jwks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey_FetchOutlivesCaller(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []any{map[string]any{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+		}}})
+	}))
+	defer server.Close()
+
+	// the caller gives up, the fetch goes on for the next requests
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = Key(ctx, server.URL, "k1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// a request for another key of the set waits for the same fetch
+	done := make(chan error, 1)
+	go func() {
+		_, err := Key(context.Background(), server.URL, "k2")
+		done <- err
+	}()
+	close(release)
+	assert.ErrorContains(t, <-done, `key "k2" not found`)
+
+	key, err := Key(context.Background(), server.URL, "k1")
+	require.NoError(t, err)
+	assert.True(t, privateKey.PublicKey.Equal(key))
+	assert.Equal(t, int32(1), fetches.Load())
+}
@@ -16,6 +16,8 @@ type MetricsRecorder interface {
 	// Channel metrics
 	UpdateChannelMetrics(channelId int, channelName, channelType string, status int, balance float64, responseTimeMs int, successRate float64)
 	UpdateChannelRequestsInFlight(channelId int, channelName, channelType string, delta float64)
+	UpdateChannelQueueDepth(group, model string, depth int)
+	RecordChannelQueueWait(group, model string, wait time.Duration, served bool)
 
 	// User metrics
 	RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64)
@@ -66,6 +68,9 @@ func (n *NoOpRecorder) UpdateChannelMetrics(channelId int, channelName, channelT
 }
 func (n *NoOpRecorder) UpdateChannelRequestsInFlight(channelId int, channelName, channelType string, delta float64) {
 }
+func (n *NoOpRecorder) UpdateChannelQueueDepth(group, model string, depth int) {}
+func (n *NoOpRecorder) RecordChannelQueueWait(group, model string, wait time.Duration, served bool) {
+}
 func (n *NoOpRecorder) RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64) {
 }
 func (n *NoOpRecorder) RecordDBQuery(startTime time.Time, operation, table string, success bool) {}
@@ -0,0 +1,228 @@
+// Package secret implements envelope encryption for secrets stored in the database.
+//
+// Every value is encrypted with its own random data key (AES-256-GCM), and the data
+// key is in turn encrypted ("wrapped") with the master key from CHANNEL_SECRET_KEY.
+// Rotating the master key therefore only requires re-wrapping the data keys, the
+// payloads themselves never need to be re-encrypted.
+//
+// Encrypted values are stored as:
+//
+//	enc:v1:<key id>:<base64 wrapped data key>:<base64 ciphertext>
+//
+// Values without the prefix are treated as legacy plaintext and returned unchanged.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const (
+	prefix  = "enc:v1:"
+	keySize = 32
+)
+
+// Masked is returned in place of a secret when it must be shown to a user.
+const Masked = "******"
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+// keyring holds the master keys read from config.
+type keyring struct {
+	current *masterKey
+	byId    map[string]*masterKey
+}
+
+// keys caches the keyring, it is swapped atomically so Reload is safe while secrets are in use
+var keys atomic.Pointer[keyring]
+
+func newMasterKey(raw string) *masterKey {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var key []byte
+	if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil && len(decoded) == keySize {
+		key = decoded
+	} else {
+		hashed := sha256.Sum256([]byte(raw))
+		key = hashed[:]
+	}
+	sum := sha256.Sum256(key)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), key: key}
+}
+
+func loadKeys() *keyring {
+	if ring := keys.Load(); ring != nil {
+		return ring
+	}
+	ring := &keyring{byId: make(map[string]*masterKey)}
+	ring.current = newMasterKey(config.ChannelSecretKey)
+	if ring.current != nil {
+		ring.byId[ring.current.id] = ring.current
+	}
+	for _, raw := range strings.Split(config.ChannelSecretPreviousKeys, ",") {
+		if k := newMasterKey(raw); k != nil {
+			if _, ok := ring.byId[k.id]; !ok {
+				ring.byId[k.id] = k
+			}
+		}
+	}
+	// keep the keyring of a concurrent load, both were read from the same config
+	if !keys.CompareAndSwap(nil, ring) {
+		return keys.Load()
+	}
+	return ring
+}
+
+// Reload drops the cached master keys so that they are read from config again.
+// It is intended for tests and for tools that change the keys at runtime.
+func Reload() {
+	keys.Store(nil)
+}
+
+// Enabled reports whether a master key is configured.
+func Enabled() bool {
+	return loadKeys().current != nil
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// NeedsRotation reports whether value should be re-encrypted with the current
+// master key, either because it is still plaintext or because it was wrapped by
+// a retired key.
+func NeedsRotation(value string) bool {
+	currentKey := loadKeys().current
+	if value == "" || currentKey == nil {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 3)
+	return len(parts) != 3 || parts[0] != currentKey.id
+}
+
+// Encrypt encrypts plaintext with a fresh data key wrapped by the current master key.
+// It returns the input unchanged when no master key is configured, when the input
+// is empty, or when it is already encrypted.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	currentKey := loadKeys().current
+	if currentKey == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", errors.Wrap(err, "generate data key")
+	}
+	wrappedKey, err := seal(currentKey.key, dataKey)
+	if err != nil {
+		return "", errors.Wrap(err, "wrap data key")
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", errors.Wrap(err, "encrypt value")
+	}
+
+	return prefix + currentKey.id + ":" +
+		base64.StdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt reverses Encrypt. Plaintext values are returned unchanged.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 3)
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	key, ok := loadKeys().byId[parts[0]]
+	if !ok {
+		return "", errors.Errorf("no master key configured for key id %s", parts[0])
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.Wrap(err, "decode data key")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.Wrap(err, "decode ciphertext")
+	}
+
+	dataKey, err := open(key.key, wrappedKey)
+	if err != nil {
+		return "", errors.Wrap(err, "unwrap data key")
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypt value")
+	}
+	return string(plaintext), nil
+}
+
+// Mask hides a secret for display, keeping only a short hint of its tail.
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	if IsEncrypted(value) || len(value) <= 8 {
+		return Masked
+	}
+	return Masked + value[len(value)-4:]
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	return plaintext, errors.WithStack(err)
+}
@@ -0,0 +1,109 @@
+package secret
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func withKeys(t *testing.T, current, previous string) {
+	t.Helper()
+	oldCurrent, oldPrevious := config.ChannelSecretKey, config.ChannelSecretPreviousKeys
+	config.ChannelSecretKey, config.ChannelSecretPreviousKeys = current, previous
+	Reload()
+	t.Cleanup(func() {
+		config.ChannelSecretKey, config.ChannelSecretPreviousKeys = oldCurrent, oldPrevious
+		Reload()
+	})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	withKeys(t, "master-key-1", "")
+
+	encrypted, err := Encrypt("sk-plaintext")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "sk-plaintext")
+
+	// every value gets its own data key
+	again, err := Encrypt("sk-plaintext")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+
+	decrypted, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plaintext", decrypted)
+
+	// encrypting twice is a no-op
+	same, err := Encrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, same)
+}
+
+func TestDisabledIsPassthrough(t *testing.T) {
+	withKeys(t, "", "")
+
+	assert.False(t, Enabled())
+	value, err := Encrypt("sk-plaintext")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plaintext", value)
+	assert.False(t, NeedsRotation("sk-plaintext"))
+}
+
+func TestRotation(t *testing.T) {
+	withKeys(t, "old-key", "")
+	encrypted, err := Encrypt("sk-rotate-me")
+	require.NoError(t, err)
+
+	withKeys(t, "new-key", "old-key")
+	assert.True(t, NeedsRotation(encrypted))
+	assert.True(t, NeedsRotation("sk-legacy-plaintext"))
+
+	plaintext, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	rotated, err := Encrypt(plaintext)
+	require.NoError(t, err)
+	assert.False(t, NeedsRotation(rotated))
+
+	decrypted, err := Decrypt(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-rotate-me", decrypted)
+
+	// without the old key the original value cannot be read anymore
+	withKeys(t, "new-key", "")
+	_, err = Decrypt(encrypted)
+	assert.Error(t, err)
+}
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "", Mask(""))
+	assert.Equal(t, Masked, Mask("short"))
+	assert.Equal(t, Masked+"cdef", Mask("sk-0123456789abcdef"))
+}
+
+func TestReloadWhileInUse(t *testing.T) {
+	withKeys(t, "master-key-1", "")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				encrypted, err := Encrypt("sk-plaintext")
+				assert.NoError(t, err)
+				decrypted, err := Decrypt(encrypted)
+				assert.NoError(t, err)
+				assert.Equal(t, "sk-plaintext", decrypted)
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		Reload()
+	}
+	wg.Wait()
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/Laisky/errors/v2"
@@ -15,8 +14,6 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
-	"github.com/songquanpeng/one-api/controller"
-	"github.com/songquanpeng/one-api/model"
 )
 
 type GitHubOAuthResponse struct {
@@ -82,142 +79,28 @@ func getGitHubUserInfoByCode(code string) (*GitHubUser, error) {
 	return &githubUser, nil
 }
 
-func GitHubOAuth(c *gin.Context) {
-	ctx := c.Request.Context()
-	session := sessions.Default(c)
-	state := c.Query("state")
-	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"message": "state is empty or not same",
-		})
-		return
-	}
-	username := session.Get("username")
-	if username != nil {
-		GitHubBind(c)
-		return
-	}
+// githubProvider logs in with GitHub accounts, identified by their login.
+type githubProvider struct{}
 
-	if !config.GitHubOAuthEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "The administrator did not turn on login and registration via GitHub",
-		})
-		return
-	}
-	code := c.Query("code")
-	githubUser, err := getGitHubUserInfoByCode(code)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user := model.User{
-		GitHubId: githubUser.Login,
-	}
-	if model.IsGitHubIdAlreadyTaken(user.GitHubId) {
-		err := user.FillUserByGitHubId()
-		if err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": err.Error(),
-			})
-			return
-		}
-	} else {
-		if config.RegisterEnabled {
-			user.Username = "github_" + strconv.Itoa(model.GetMaxUserId()+1)
-			if githubUser.Name != "" {
-				user.DisplayName = githubUser.Name
-			} else {
-				user.DisplayName = "GitHub User"
-			}
-			user.Email = githubUser.Email
-			user.Role = model.RoleCommonUser
-			user.Status = model.UserStatusEnabled
+func (githubProvider) Name() string          { return "github" }
+func (githubProvider) Title() string         { return "GitHub" }
+func (githubProvider) Enabled() bool         { return config.GitHubOAuthEnabled }
+func (githubProvider) RegisterEnabled() bool { return true }
 
-			if err := user.Insert(ctx, 0); err != nil {
-				c.JSON(http.StatusOK, gin.H{
-					"success": false,
-					"message": err.Error(),
-				})
-				return
-			}
-		} else {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "The administrator has turned off new user registration",
-			})
-			return
-		}
-	}
-
-	if user.Status != model.UserStatusEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "User has been banned",
-			"success": false,
-		})
-		return
+func (githubProvider) Identify(c *gin.Context) (*Identity, error) {
+	githubUser, err := getGitHubUserInfoByCode(c.Query("code"))
+	if err != nil {
+		return nil, err
 	}
-	controller.SetupLogin(&user, c)
+	return &Identity{
+		Subject:     githubUser.Login,
+		DisplayName: githubUser.Name,
+		Email:       githubUser.Email,
+	}, nil
 }
 
-func GitHubBind(c *gin.Context) {
-	if !config.GitHubOAuthEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "The administrator did not turn on login and registration via GitHub",
-		})
-		return
-	}
-	code := c.Query("code")
-	githubUser, err := getGitHubUserInfoByCode(code)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user := model.User{
-		GitHubId: githubUser.Login,
-	}
-	if model.IsGitHubIdAlreadyTaken(user.GitHubId) {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "The GitHub account has been bound",
-		})
-		return
-	}
-	session := sessions.Default(c)
-	id := session.Get("id")
-	// id := c.GetInt("id")  // critical bug!
-	user.Id = id.(int)
-	err = user.FillUserById()
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user.GitHubId = githubUser.Login
-	err = user.Update(false)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "bind",
-	})
-	return
+func GitHubOAuth(c *gin.Context) {
+	oauthCallback(c, githubProvider{})
 }
 
 func GenerateOAuthCode(c *gin.Context) {
@@ -5,18 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Laisky/errors/v2"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/controller"
-	"github.com/songquanpeng/one-api/model"
 )
 
 type LarkOAuthResponse struct {
@@ -82,129 +78,28 @@ func getLarkUserInfoByCode(code string) (*LarkUser, error) {
 	return &larkUser, nil
 }
 
-func LarkOAuth(c *gin.Context) {
-	ctx := c.Request.Context()
-	session := sessions.Default(c)
-	state := c.Query("state")
-	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"message": "state is empty or not same",
-		})
-		return
-	}
-	username := session.Get("username")
-	if username != nil {
-		LarkBind(c)
-		return
-	}
-	code := c.Query("code")
-	larkUser, err := getLarkUserInfoByCode(code)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user := model.User{
-		LarkId: larkUser.OpenID,
-	}
-	if model.IsLarkIdAlreadyTaken(user.LarkId) {
-		err := user.FillUserByLarkId()
-		if err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": err.Error(),
-			})
-			return
-		}
-	} else {
-		if config.RegisterEnabled {
-			parts := strings.Split(larkUser.Email, "@")
-			if len(parts) > 1 {
-				user.Username = parts[0]
-			} else {
-				user.Username = "lark_" + strconv.Itoa(model.GetMaxUserId()+1)
-			}
-			if larkUser.Name != "" {
-				user.DisplayName = larkUser.Name
-			} else {
-				user.DisplayName = "Lark User"
-			}
-			user.Role = model.RoleCommonUser
-			user.Status = model.UserStatusEnabled
+// larkProvider logs in with Lark accounts, identified by their open id.
+type larkProvider struct{}
 
-			if err := user.Insert(ctx, 0); err != nil {
-				c.JSON(http.StatusOK, gin.H{
-					"success": false,
-					"message": err.Error(),
-				})
-				return
-			}
-		} else {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "The administrator has turned off new user registration",
-			})
-			return
-		}
-	}
+func (larkProvider) Name() string          { return "lark" }
+func (larkProvider) Title() string         { return "Lark" }
+func (larkProvider) Enabled() bool         { return config.LarkClientId != "" }
+func (larkProvider) RegisterEnabled() bool { return true }
 
-	if user.Status != model.UserStatusEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "User has been banned",
-			"success": false,
-		})
-		return
+func (larkProvider) Identify(c *gin.Context) (*Identity, error) {
+	larkUser, err := getLarkUserInfoByCode(c.Query("code"))
+	if err != nil {
+		return nil, err
 	}
-	controller.SetupLogin(&user, c)
+	username, _, _ := strings.Cut(larkUser.Email, "@")
+	return &Identity{
+		Subject:     larkUser.OpenID,
+		Username:    username,
+		DisplayName: larkUser.Name,
+		Email:       larkUser.Email,
+	}, nil
 }
 
-func LarkBind(c *gin.Context) {
-	code := c.Query("code")
-	larkUser, err := getLarkUserInfoByCode(code)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user := model.User{
-		LarkId: larkUser.OpenID,
-	}
-	if model.IsLarkIdAlreadyTaken(user.LarkId) {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "This Lark account has already been bound",
-		})
-		return
-	}
-	session := sessions.Default(c)
-	id := session.Get("id")
-	// id := c.GetInt("id")  // critical bug!
-	user.Id = id.(int)
-	err = user.FillUserById()
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user.LarkId = larkUser.OpenID
-	err = user.Update(false)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "bind",
-	})
-	return
+func LarkOAuth(c *gin.Context) {
+	oauthCallback(c, larkProvider{})
 }
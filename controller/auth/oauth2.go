@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// oauth2Provider logs in with a generic OAuth2 authorization code flow, the claims of
+// the user are read from the userinfo endpoint.
+type oauth2Provider struct {
+	configuredProvider
+}
+
+var oauth2Client = &http.Client{Timeout: 5 * time.Second}
+
+func (p oauth2Provider) LoginURL(ctx context.Context, state string) (string, error) {
+	authorizationURL, err := url.Parse(p.config.AuthorizationURL)
+	if err != nil {
+		return "", errors.Wrap(err, "parse authorization url")
+	}
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientId)
+	query.Set("redirect_uri", p.callbackURL("callback"))
+	if p.config.Scopes != "" {
+		query.Set("scope", p.config.Scopes)
+	}
+	query.Set("state", state)
+	authorizationURL.RawQuery = query.Encode()
+	return authorizationURL.String(), nil
+}
+
+func (p oauth2Provider) Identify(c *gin.Context) (*Identity, error) {
+	if errorCode := c.Query("error"); errorCode != "" {
+		return nil, errors.Errorf("%s refused the login: %s", p.Title(), errorCode)
+	}
+	code := c.Query("code")
+	if code == "" {
+		return nil, errors.New("Invalid parameter")
+	}
+	accessToken, err := p.exchangeCode(c.Request.Context(), code)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.userinfo(c.Request.Context(), accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.identity(claims)
+}
+
+// exchangeCode returns the access token for the authorization code.
+func (p oauth2Provider) exchangeCode(ctx context.Context, code string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.callbackURL("callback")},
+		"client_id":     {p.config.ClientId},
+		"client_secret": {p.config.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "new token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var res struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = doOAuth2Request(req, &res); err != nil {
+		return "", errors.Wrapf(err, "exchange code with %s", p.Title())
+	}
+	if res.AccessToken == "" {
+		if res.Error != "" {
+			return "", errors.Errorf("%s: %s %s", p.Title(), res.Error, res.ErrorDescription)
+		}
+		return "", errors.Errorf("%s returned no access token", p.Title())
+	}
+	return res.AccessToken, nil
+}
+
+// userinfo returns the claims of the user the access token belongs to.
+func (p oauth2Provider) userinfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.UserinfoURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new userinfo request")
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	claims := map[string]any{}
+	if err = doOAuth2Request(req, &claims); err != nil {
+		return nil, errors.Wrapf(err, "get userinfo from %s", p.Title())
+	}
+	return claims, nil
+}
+
+func doOAuth2Request(req *http.Request, v any) error {
+	res, err := oauth2Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return errors.Wrap(err, "read response")
+	}
+	// token endpoints answer errors with 400 and a JSON body, let the caller see it
+	if res.StatusCode >= http.StatusInternalServerError ||
+		(res.StatusCode >= http.StatusMultipleChoices && res.StatusCode != http.StatusBadRequest && res.StatusCode != http.StatusUnauthorized) {
+		return errors.Errorf("status %d", res.StatusCode)
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return errors.Wrapf(err, "status %d, decode response", res.StatusCode)
+	}
+	return nil
+}
@@ -5,18 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Laisky/errors/v2"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/controller"
-	"github.com/songquanpeng/one-api/model"
 )
 
 type OidcResponse struct {
@@ -85,141 +81,27 @@ func getOidcUserInfoByCode(code string) (*OidcUser, error) {
 	return &oidcUser, nil
 }
 
-func OidcAuth(c *gin.Context) {
-	ctx := c.Request.Context()
-	session := sessions.Default(c)
-	state := c.Query("state")
-	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"message": "state is empty or not same",
-		})
-		return
-	}
-	username := session.Get("username")
-	if username != nil {
-		OidcBind(c)
-		return
-	}
-	if !config.OidcEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "Administrator has not enabled OIDC Log in and Sign up",
-		})
-		return
-	}
-	code := c.Query("code")
-	oidcUser, err := getOidcUserInfoByCode(code)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user := model.User{
-		OidcId: oidcUser.OpenID,
-	}
-	if model.IsOidcIdAlreadyTaken(user.OidcId) {
-		err := user.FillUserByOidcId()
-		if err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": err.Error(),
-			})
-			return
-		}
-	} else {
-		if config.RegisterEnabled {
-			user.Email = oidcUser.Email
-			if oidcUser.PreferredUsername != "" {
-				user.Username = oidcUser.PreferredUsername
-			} else {
-				user.Username = "oidc_" + strconv.Itoa(model.GetMaxUserId()+1)
-			}
-			if oidcUser.Name != "" {
-				user.DisplayName = oidcUser.Name
-			} else {
-				user.DisplayName = "OIDC User"
-			}
-			err := user.Insert(ctx, 0)
-			if err != nil {
-				c.JSON(http.StatusOK, gin.H{
-					"success": false,
-					"message": err.Error(),
-				})
-				return
-			}
-		} else {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "The administrator has turned off new user registration",
-			})
-			return
-		}
-	}
+// oidcProvider logs in with the accounts of the OIDC provider, identified by their subject.
+type oidcProvider struct{}
 
-	if user.Status != model.UserStatusEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "User has been banned",
-			"success": false,
-		})
-		return
-	}
-	controller.SetupLogin(&user, c)
-}
+func (oidcProvider) Name() string          { return "oidc" }
+func (oidcProvider) Title() string         { return "OIDC" }
+func (oidcProvider) Enabled() bool         { return config.OidcEnabled }
+func (oidcProvider) RegisterEnabled() bool { return true }
 
-func OidcBind(c *gin.Context) {
-	if !config.OidcEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "The administrator has turned off new user registration",
-		})
-		return
-	}
-	code := c.Query("code")
-	oidcUser, err := getOidcUserInfoByCode(code)
+func (oidcProvider) Identify(c *gin.Context) (*Identity, error) {
+	oidcUser, err := getOidcUserInfoByCode(c.Query("code"))
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user := model.User{
-		OidcId: oidcUser.OpenID,
-	}
-	if model.IsOidcIdAlreadyTaken(user.OidcId) {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "This OIDC account has already been bound",
-		})
-		return
-	}
-	session := sessions.Default(c)
-	id := session.Get("id")
-	// id := c.GetInt("id")  // critical bug!
-	user.Id = id.(int)
-	err = user.FillUserById()
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user.OidcId = oidcUser.OpenID
-	err = user.Update(false)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
+		return nil, err
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "bind",
-	})
-	return
+	return &Identity{
+		Subject:     oidcUser.OpenID,
+		Username:    oidcUser.PreferredUsername,
+		DisplayName: oidcUser.Name,
+		Email:       oidcUser.Email,
+	}, nil
+}
+
+func OidcAuth(c *gin.Context) {
+	oauthCallback(c, oidcProvider{})
 }
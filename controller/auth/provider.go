@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// Identity is what an identity provider tells about the user who signed in.
+type Identity struct {
+	// Subject identifies the user at the provider, it is what users are linked by
+	Subject     string
+	Username    string
+	DisplayName string
+	Email       string
+	// Group and Role are assigned from the attributes of the provider, "" and 0 leave
+	// the user's group and role alone
+	Group string
+	Role  int
+}
+
+// Provider is a way to log in. The built-in providers are configured by options, the
+// others by model.IdentityProvider.
+type Provider interface {
+	// Name is the name users are linked by, see model.BindIdentity
+	Name() string
+	// Title is shown to users, e.g. GitHub
+	Title() string
+	Enabled() bool
+	// RegisterEnabled reports whether unknown users may sign up through the provider,
+	// on top of config.RegisterEnabled
+	RegisterEnabled() bool
+	// Identify returns the identity of the user the provider redirected back
+	Identify(c *gin.Context) (*Identity, error)
+}
+
+// errRegisterDisabled is returned for unknown users if they may not sign up.
+var errRegisterDisabled = errors.New("The administrator has turned off new user registration")
+
+// errUserBanned is returned for disabled users.
+var errUserBanned = errors.New("User has been banned")
+
+// loginWithIdentity returns the user linked to the identity, signing them up if they
+// are unknown. Group and role given by the provider are applied to the user.
+func loginWithIdentity(ctx context.Context, p Provider, identity *Identity) (*model.User, error) {
+	if model.IsIdentityTaken(p.Name(), identity.Subject) {
+		user, err := model.GetUserByIdentity(p.Name(), identity.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if user.Status != model.UserStatusEnabled {
+			return nil, errUserBanned
+		}
+		if err = user.ApplyIdentityAttributes(identity.Group, identity.Role); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !config.RegisterEnabled || !p.RegisterEnabled() {
+		return nil, errRegisterDisabled
+	}
+
+	user := &model.User{
+		Username:    identity.Username,
+		DisplayName: identity.DisplayName,
+		Email:       identity.Email,
+		Role:        model.RoleCommonUser,
+		Status:      model.UserStatusEnabled,
+	}
+	if user.Username == "" || len(user.Username) > 30 || model.IsUsernameAlreadyTaken(user.Username) {
+		user.Username = p.Name() + "_" + strconv.Itoa(model.GetMaxUserId()+1)
+	}
+	if user.DisplayName == "" || len(user.DisplayName) > 20 {
+		user.DisplayName = p.Title() + " User"
+	}
+	if identity.Group != "" {
+		user.Group = identity.Group
+	}
+	if identity.Role != 0 {
+		user.Role = identity.Role
+	}
+	if err := user.Insert(ctx, 0); err != nil {
+		return nil, err
+	}
+	if err := model.BindIdentity(user.Id, p.Name(), identity.Subject); err != nil {
+		return nil, err
+	}
+	logger.Logger.Info("user signed up through identity provider",
+		zap.String("provider", p.Name()), zap.Int("user_id", user.Id))
+	return user, nil
+}
+
+// bindIdentity links the identity to the user.
+func bindIdentity(p Provider, identity *Identity, userId int) error {
+	if userId == 0 {
+		return errors.New("id is empty!")
+	}
+	if model.IsIdentityTaken(p.Name(), identity.Subject) {
+		return errors.Errorf("This %s account has already been bound", p.Title())
+	}
+	return model.BindIdentity(userId, p.Name(), identity.Subject)
+}
+
+// oauthCallback handles the redirect of the built-in OAuth providers, which the
+// frontend forwards with the state it created with GenerateOAuthCode. It binds the
+// account if the user is logged in, and logs in otherwise.
+func oauthCallback(c *gin.Context, p Provider) {
+	session := sessions.Default(c)
+	state := c.Query("state")
+	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	if session.Get("username") != nil {
+		id, _ := session.Get("id").(int)
+		bindWith(c, p, id)
+		return
+	}
+	loginWith(c, p)
+}
+
+// loginWith logs the user in with the provider and returns the user like Login does.
+func loginWith(c *gin.Context, p Provider) {
+	if !p.Enabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The administrator has not enabled login and registration via %s", p.Title()),
+		})
+		return
+	}
+	identity, err := p.Identify(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := loginWithIdentity(c.Request.Context(), p, identity)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	controller.SetupLogin(user, c)
+}
+
+// bindWith links the account at the provider to the user.
+func bindWith(c *gin.Context, p Provider, userId int) {
+	if !p.Enabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The administrator has not enabled login and registration via %s", p.Title()),
+		})
+		return
+	}
+	identity, err := p.Identify(c)
+	if err == nil {
+		err = bindIdentity(p, identity, userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "bind",
+	})
+}
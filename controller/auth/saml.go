@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// samlProvider logs in with a SAML 2.0 identity provider. Authentication requests are
+// sent with the redirect binding, the signed responses come back with the POST binding
+// to the assertion consumer service.
+type samlProvider struct {
+	configuredProvider
+}
+
+// samlServiceProvider is the service provider built for a provider configuration, it is
+// built again when the configuration is reloaded.
+type samlServiceProvider struct {
+	config *model.IdentityProvider
+	sp     *saml.ServiceProvider
+}
+
+var samlServiceProviders sync.Map // name -> *samlServiceProvider
+
+// samlRequestId derives the id of the authentication request from the state, so that
+// the response can be checked against the request without keeping it anywhere.
+func samlRequestId(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return "id-" + hex.EncodeToString(sum[:])[:40]
+}
+
+func (p samlProvider) LoginURL(ctx context.Context, state string) (string, error) {
+	sp, err := p.serviceProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", errors.Wrap(err, "make saml authentication request")
+	}
+	req.ID = samlRequestId(state)
+	// Redirect appends the relay state as it is, the state only holds URL safe characters
+	redirectURL, err := req.Redirect(state, sp)
+	if err != nil {
+		return "", errors.Wrap(err, "make saml redirect")
+	}
+	return redirectURL.String(), nil
+}
+
+func (p samlProvider) Identify(c *gin.Context) (*Identity, error) {
+	sp, err := p.serviceProvider(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Request.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "parse saml response")
+	}
+	state := c.Request.PostForm.Get("RelayState")
+	assertion, err := sp.ParseResponse(c.Request, []string{samlRequestId(state)})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			err = invalid.PrivateErr
+		}
+		return nil, errors.Wrap(err, "invalid saml response")
+	}
+	return p.identity(samlClaims(assertion))
+}
+
+// samlClaims returns the attributes of the assertion by name and by friendly name, and
+// the subject as NameID.
+func samlClaims(assertion *saml.Assertion) map[string]any {
+	claims := map[string]any{}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		claims["NameID"] = assertion.Subject.NameID.Value
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			values := make([]string, 0, len(attribute.Values))
+			for _, value := range attribute.Values {
+				values = append(values, value.Value)
+			}
+			if attribute.Name != "" {
+				claims[attribute.Name] = values
+			}
+			if attribute.FriendlyName != "" {
+				claims[attribute.FriendlyName] = values
+			}
+		}
+	}
+	return claims
+}
+
+// metadata returns the service provider metadata.
+func (p samlProvider) metadata(ctx context.Context) ([]byte, error) {
+	sp, err := p.serviceProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal saml metadata")
+	}
+	return metadata, nil
+}
+
+// serviceProvider returns the service provider of the configuration, building it on
+// first use.
+func (p samlProvider) serviceProvider(ctx context.Context) (*saml.ServiceProvider, error) {
+	if cached, ok := samlServiceProviders.Load(p.config.Name); ok && cached.(*samlServiceProvider).config == p.config {
+		return cached.(*samlServiceProvider).sp, nil
+	}
+	metadataURL, err := url.Parse(p.callbackURL("metadata"))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse metadata url")
+	}
+	acsURL, err := url.Parse(p.callbackURL("acs"))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse acs url")
+	}
+	idpMetadata, err := p.idpMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sp := &saml.ServiceProvider{
+		EntityID:    metadataURL.String(),
+		MetadataURL: *metadataURL,
+		AcsURL:      *acsURL,
+		IDPMetadata: idpMetadata,
+	}
+	if p.config.Certificate != "" && p.config.PrivateKey != "" {
+		keyPair, err := tls.X509KeyPair([]byte(p.config.Certificate), []byte(p.config.PrivateKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "load saml key pair")
+		}
+		if sp.Certificate, err = x509.ParseCertificate(keyPair.Certificate[0]); err != nil {
+			return nil, errors.Wrap(err, "parse saml certificate")
+		}
+		signer, ok := keyPair.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("the saml private key cannot sign")
+		}
+		sp.Key = signer
+		switch signer.(type) {
+		case *rsa.PrivateKey:
+			sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+		case *ecdsa.PrivateKey:
+			sp.SignatureMethod = dsig.ECDSASHA256SignatureMethod
+		default:
+			return nil, errors.Errorf("unsupported saml private key %T", signer)
+		}
+	}
+	samlServiceProviders.Store(p.config.Name, &samlServiceProvider{config: p.config, sp: sp})
+	return sp, nil
+}
+
+// idpMetadata returns the metadata of the identity provider, given in the configuration
+// or fetched from its URL.
+func (p samlProvider) idpMetadata(ctx context.Context) (*saml.EntityDescriptor, error) {
+	raw := []byte(p.config.Metadata)
+	if len(raw) == 0 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.MetadataURL, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "new saml metadata request")
+		}
+		res, err := oauth2Client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch saml metadata of %s", p.Title())
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("fetch saml metadata of %s: status %d", p.Title(), res.StatusCode)
+		}
+		if raw, err = io.ReadAll(io.LimitReader(res.Body, 1<<22)); err != nil {
+			return nil, errors.Wrapf(err, "read saml metadata of %s", p.Title())
+		}
+	}
+	return parseIDPMetadata(raw)
+}
+
+// parseIDPMetadata parses an EntityDescriptor, or the first EntityDescriptor of an
+// EntitiesDescriptor, that describes an identity provider.
+func parseIDPMetadata(raw []byte) (*saml.EntityDescriptor, error) {
+	entity := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(raw, entity); err == nil && len(entity.IDPSSODescriptors) > 0 {
+		return entity, nil
+	}
+	entities := &saml.EntitiesDescriptor{}
+	if err := xml.Unmarshal(raw, entities); err != nil {
+		return nil, errors.Wrap(err, "parse saml metadata")
+	}
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("the saml metadata describes no identity provider")
+}
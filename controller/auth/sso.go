@@ -0,0 +1,436 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	gocache "github.com/patrickmn/go-cache"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// ssoStateTTL bounds the time between the redirect to a configured provider and the
+// way back.
+const ssoStateTTL = 10 * time.Minute
+
+// ssoNonceCookie binds the state of a login to the browser that started it, so that a
+// state cannot be handed to another browser.
+const ssoNonceCookie = "sso_nonce"
+
+// ssoTicketTTL bounds the time between the SAML assertion consumer service and the
+// redirect that finishes the login, see SSOFinish.
+const ssoTicketTTL = time.Minute
+
+// ssoProvider is a provider configured by a model.IdentityProvider. The gateway sends
+// the browser to it and receives it back, without the frontend.
+type ssoProvider interface {
+	Provider
+	// LoginURL returns the URL the browser is sent to, the provider must return the state
+	LoginURL(ctx context.Context, state string) (string, error)
+}
+
+// configuredProvider holds what the configured providers share.
+type configuredProvider struct {
+	config *model.IdentityProvider
+}
+
+func (p configuredProvider) Name() string          { return p.config.Name }
+func (p configuredProvider) Title() string         { return p.config.Title }
+func (p configuredProvider) Enabled() bool         { return p.config.Enabled }
+func (p configuredProvider) RegisterEnabled() bool { return p.config.RegisterEnabled }
+
+// callbackURL returns the URL of the gateway the provider sends the browser back to.
+func (p configuredProvider) callbackURL(endpoint string) string {
+	return fmt.Sprintf("%s/api/sso/%s/%s", strings.TrimSuffix(config.ServerAddress, "/"), p.config.Name, endpoint)
+}
+
+// identity reads the identity from the claims of the user as the provider maps them.
+func (p configuredProvider) identity(claims map[string]any) (*Identity, error) {
+	names := p.config.GetClaims()
+	first := func(name string) string {
+		if values := model.ClaimValues(claims, name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	identity := &Identity{
+		Subject:     first(names.Subject),
+		Username:    first(names.Username),
+		DisplayName: first(names.DisplayName),
+		Email:       first(names.Email),
+	}
+	if identity.Subject == "" {
+		return nil, errors.Errorf("the %s claim identifying the user is missing", names.Subject)
+	}
+	if names.Group != "" {
+		identity.Group = p.config.MapGroup(model.ClaimValues(claims, names.Group))
+	}
+	if names.Role != "" {
+		identity.Role = p.config.MapRole(model.ClaimValues(claims, names.Role))
+	}
+	return identity, nil
+}
+
+// getSSOProvider returns the enabled configured provider of the name.
+func getSSOProvider(name string) (ssoProvider, error) {
+	cfg := model.GetIdentityProvider(name)
+	if cfg == nil {
+		return nil, errors.Errorf("identity provider %s not found", name)
+	}
+	switch cfg.Type {
+	case model.IdentityProviderTypeOAuth2:
+		return oauth2Provider{configuredProvider{cfg}}, nil
+	case model.IdentityProviderTypeSAML:
+		return samlProvider{configuredProvider{cfg}}, nil
+	}
+	return nil, errors.Errorf("unknown identity provider type %q", cfg.Type)
+}
+
+// newSSOState returns the signed state of a login through the provider. userId is the
+// logged in user who binds the provider, or 0, nonce is the value of the nonce cookie.
+func newSSOState(provider string, userId int, nonce string) string {
+	payload := fmt.Sprintf("%d.%d.%s", time.Now().Unix(), userId, nonce)
+	return payload + "." + signSSOState(provider, payload)
+}
+
+func signSSOState(provider string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.SessionSecret))
+	mac.Write([]byte(provider + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ssoState is what the state of a login carries.
+type ssoState struct {
+	// UserId is the logged in user who binds the provider, or 0
+	UserId int
+	// Nonce must match the nonce cookie of the browser that finishes the login
+	Nonce string
+}
+
+// parseSSOState verifies the signature and the age of the state.
+func parseSSOState(provider string, state string) (*ssoState, error) {
+	i := strings.LastIndex(state, ".")
+	if i <= 0 {
+		return nil, errors.New("invalid state")
+	}
+	payload, signature := state[:i], state[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(signSSOState(provider, payload))) {
+		return nil, errors.New("invalid state")
+	}
+	parts := strings.SplitN(payload, ".", 3)
+	if len(parts) != 3 {
+		return nil, errors.New("invalid state")
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > ssoStateTTL {
+		return nil, errors.New("the login has expired, please try again")
+	}
+	userId, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errors.New("invalid state")
+	}
+	return &ssoState{UserId: userId, Nonce: parts[2]}, nil
+}
+
+// checkNonce verifies that the login comes back to the browser that started it.
+func (s *ssoState) checkNonce(nonce string) error {
+	if nonce == "" || !hmac.Equal([]byte(s.Nonce), []byte(nonce)) {
+		return errors.New("the login was started in another browser, please try again")
+	}
+	return nil
+}
+
+// setSSONonce sets the nonce cookie of a login, an empty nonce removes it. The cookie
+// follows the session cookie: without DISABLE_COOKIE_SECURE it is sent along with the
+// cross-site POST of a SAML identity provider, otherwise the SAML login is finished
+// after the same-site redirect of SSOFinish.
+func setSSONonce(c *gin.Context, nonce string) {
+	maxAge := int(ssoStateTTL.Seconds())
+	if nonce == "" {
+		maxAge = -1
+	}
+	cookie := &http.Cookie{
+		Name:     ssoNonceCookie,
+		Value:    nonce,
+		Path:     "/api/sso/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	}
+	if config.DisableCookieSecret {
+		cookie.Secure, cookie.SameSite = false, http.SameSiteLaxMode
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// ssoTicket carries a SAML login from the assertion consumer service to SSOFinish.
+type ssoTicket struct {
+	Provider string
+	State    *ssoState
+	Identity *Identity
+}
+
+// ssoTickets holds the tickets when Redis is not enabled.
+var (
+	ssoTickets    = gocache.New(ssoTicketTTL, ssoTicketTTL)
+	ssoTicketsMux sync.Mutex
+)
+
+// saveSSOTicket stores the ticket and returns its id.
+func saveSSOTicket(ctx context.Context, ticket *ssoTicket) (string, error) {
+	id := random.GetRandomString(32)
+	if !common.RedisEnabled {
+		ssoTickets.Set(id, ticket, ssoTicketTTL)
+		return id, nil
+	}
+	encoded, err := json.Marshal(ticket)
+	if err != nil {
+		return "", errors.Wrap(err, "encode sso ticket")
+	}
+	if err = common.RDB.Set(ctx, "sso_ticket:"+id, encoded, ssoTicketTTL).Err(); err != nil {
+		return "", errors.Wrap(err, "save sso ticket")
+	}
+	return id, nil
+}
+
+// takeSSOTicket returns the ticket and removes it, a ticket is used once.
+func takeSSOTicket(ctx context.Context, id string) (*ssoTicket, error) {
+	if id == "" {
+		return nil, errors.New("the login has expired, please try again")
+	}
+	if !common.RedisEnabled {
+		ssoTicketsMux.Lock()
+		defer ssoTicketsMux.Unlock()
+		ticket, ok := ssoTickets.Get(id)
+		if !ok {
+			return nil, errors.New("the login has expired, please try again")
+		}
+		ssoTickets.Delete(id)
+		return ticket.(*ssoTicket), nil
+	}
+	key := "sso_ticket:" + id
+	var get *redis.StringCmd
+	_, err := common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, errors.New("the login has expired, please try again")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "take sso ticket")
+	}
+	ticket := new(ssoTicket)
+	if err = json.Unmarshal([]byte(get.Val()), ticket); err != nil {
+		return nil, errors.Wrap(err, "decode sso ticket")
+	}
+	return ticket, nil
+}
+
+// usedSSOStates remembers the states that came back when Redis is not enabled.
+var usedSSOStates = gocache.New(ssoStateTTL, ssoStateTTL)
+
+// useSSOState marks the state as used, it returns false if it was used before, so that
+// a login cannot be replayed.
+func useSSOState(ctx context.Context, state string) bool {
+	if common.RedisEnabled {
+		ok, err := common.RDB.SetNX(ctx, "sso_state:"+state, 1, ssoStateTTL).Result()
+		if err != nil {
+			logger.Logger.Error("failed to mark sso state as used", zap.Error(err))
+			return false
+		}
+		return ok
+	}
+	return usedSSOStates.Add(state, true, ssoStateTTL) == nil
+}
+
+// SSOLogin sends the browser to the configured identity provider. A logged in user
+// binds the provider to their account instead of logging in.
+func SSOLogin(c *gin.Context) {
+	p, err := getSSOProvider(c.Param("name"))
+	if err != nil {
+		renderSSOResult(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	userId, _ := sessions.Default(c).Get("id").(int)
+	nonce := random.GetRandomString(16)
+	loginURL, err := p.LoginURL(c.Request.Context(), newSSOState(p.Name(), userId, nonce))
+	if err != nil {
+		logger.Logger.Error("failed to start sso login", zap.String("provider", p.Name()), zap.Error(err))
+		renderSSOResult(c, http.StatusBadGateway, fmt.Sprintf("Unable to connect to %s, please try again later!", p.Title()), nil)
+		return
+	}
+	setSSONonce(c, nonce)
+	c.Redirect(http.StatusFound, loginURL)
+}
+
+// SSOCallback receives the browser back from the configured identity provider, the
+// OAuth2 callback and the SAML assertion consumer service. It logs the user in, or
+// binds the provider to the user who started the login.
+//
+// The SAML assertion consumer service is reached by a cross-site POST, which the
+// session cookie and, with DISABLE_COOKIE_SECURE, the nonce cookie are not sent with.
+// It redirects to SSOFinish with a single use ticket instead of finishing the login.
+func SSOCallback(c *gin.Context) {
+	p, err := getSSOProvider(c.Param("name"))
+	if err != nil {
+		renderSSOResult(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	state := c.Query("state")
+	if c.Request.Method == http.MethodPost {
+		state = c.PostForm("RelayState")
+	}
+	st, err := parseSSOState(p.Name(), state)
+	if err == nil && !useSSOState(c.Request.Context(), state) {
+		err = errors.New("the login has already been used, please try again")
+	}
+	if err != nil {
+		renderSSOResult(c, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+
+	identity, err := p.Identify(c)
+	if err != nil {
+		logger.Logger.Warn("sso login failed", zap.String("provider", p.Name()), zap.Error(err))
+		renderSSOResult(c, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	if c.Request.Method != http.MethodPost {
+		finishSSO(c, p, st, identity)
+		return
+	}
+	ticket, err := saveSSOTicket(c.Request.Context(), &ssoTicket{Provider: p.Name(), State: st, Identity: identity})
+	if err != nil {
+		logger.Logger.Error("failed to save sso ticket", zap.Error(err))
+		renderSSOResult(c, http.StatusInternalServerError, "Unable to save login session information, please try again", nil)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/api/sso/%s/finish?ticket=%s", p.Name(), ticket))
+}
+
+// SSOFinish finishes a SAML login after the same-site redirect from the assertion
+// consumer service, where the cookies of the browser are available.
+func SSOFinish(c *gin.Context) {
+	p, err := getSSOProvider(c.Param("name"))
+	if err != nil {
+		renderSSOResult(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	ticket, err := takeSSOTicket(c.Request.Context(), c.Query("ticket"))
+	if err == nil && ticket.Provider != p.Name() {
+		err = errors.New("invalid ticket")
+	}
+	if err != nil {
+		renderSSOResult(c, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	finishSSO(c, p, ticket.State, ticket.Identity)
+}
+
+// finishSSO checks that the login comes back to the browser that started it, and logs
+// the user in or binds the provider to the user of the session.
+func finishSSO(c *gin.Context, p ssoProvider, st *ssoState, identity *Identity) {
+	nonce, _ := c.Cookie(ssoNonceCookie)
+	setSSONonce(c, "")
+	if err := st.checkNonce(nonce); err != nil {
+		renderSSOResult(c, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	if st.UserId != 0 {
+		// only the user who started the binding may finish it
+		if sessionUserId, _ := sessions.Default(c).Get("id").(int); sessionUserId != st.UserId {
+			renderSSOResult(c, http.StatusForbidden, "Please log in again to bind your account", nil)
+			return
+		}
+		if err := bindIdentity(p, identity, st.UserId); err != nil {
+			renderSSOResult(c, http.StatusOK, err.Error(), nil)
+			return
+		}
+		c.Redirect(http.StatusFound, "/setting")
+		return
+	}
+	user, err := loginWithIdentity(c.Request.Context(), p, identity)
+	if err != nil {
+		renderSSOResult(c, http.StatusOK, err.Error(), nil)
+		return
+	}
+	cleanUser, err := controller.SaveLoginSession(user, c)
+	if err != nil {
+		logger.Logger.Error("failed to save sso login session", zap.Error(err))
+		renderSSOResult(c, http.StatusInternalServerError, "Unable to save login session information, please try again", nil)
+		return
+	}
+	renderSSOResult(c, http.StatusOK, "Login successful!", cleanUser)
+}
+
+// SAMLMetadata returns the service provider metadata of a SAML identity provider, to
+// be registered at the identity provider.
+func SAMLMetadata(c *gin.Context) {
+	p, err := getSSOProvider(c.Param("name"))
+	if err == nil {
+		if sp, ok := p.(samlProvider); ok {
+			metadata, err := sp.metadata(c.Request.Context())
+			if err != nil {
+				c.String(http.StatusBadGateway, err.Error())
+				return
+			}
+			c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+			return
+		}
+		err = errors.Errorf("identity provider %s is not a SAML provider", p.Name())
+	}
+	c.String(http.StatusNotFound, err.Error())
+}
+
+// ssoResultPage ends a login through a configured provider. The frontends keep the
+// logged in user in local storage, the page puts it there like their login forms do.
+var ssoResultPage = template.Must(template.New("sso").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Message}}</title></head>
+<body>
+<p>{{.Message}}</p>
+{{if .User}}<script>localStorage.setItem("user", {{.User}}); window.location.replace("/");</script>
+{{else}}<p><a href="/login">Back to login</a></p>
+{{end}}</body>
+</html>
+`))
+
+func renderSSOResult(c *gin.Context, status int, message string, user *model.User) {
+	data := struct {
+		Message string
+		User    string
+	}{Message: message}
+	if user != nil {
+		encoded, _ := json.Marshal(user)
+		data.User = string(encoded)
+	}
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	if err := ssoResultPage.Execute(c.Writer, data); err != nil {
+		logger.Logger.Error("failed to render sso result", zap.Error(err))
+	}
+}
@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestSSOState(t *testing.T) {
+	state := newSSOState("corp", 42, "nonce-1")
+	st, err := parseSSOState("corp", state)
+	require.NoError(t, err)
+	assert.Equal(t, 42, st.UserId)
+	assert.NoError(t, st.checkNonce("nonce-1"))
+
+	_, err = parseSSOState("other", state)
+	assert.Error(t, err)
+	_, err = parseSSOState("corp", state[:len(state)-1]+"x")
+	assert.Error(t, err)
+	_, err = parseSSOState("corp", "")
+	assert.Error(t, err)
+
+	// the state only comes back to the browser that started the login
+	assert.EqualError(t, st.checkNonce("nonce-2"), "the login was started in another browser, please try again")
+	assert.Error(t, st.checkNonce(""))
+
+	payload := fmt.Sprintf("%d.0.abcdefgh", time.Now().Add(-ssoStateTTL-time.Minute).Unix())
+	_, err = parseSSOState("corp", payload+"."+signSSOState("corp", payload))
+	assert.EqualError(t, err, "the login has expired, please try again")
+
+	assert.NotEqual(t, samlRequestId(state), samlRequestId(newSSOState("corp", 42, "nonce-2")))
+}
+
+func TestSSONonceCookie(t *testing.T) {
+	originalDisable := config.DisableCookieSecret
+	defer func() { config.DisableCookieSecret = originalDisable }()
+
+	for _, disable := range []bool{false, true} {
+		config.DisableCookieSecret = disable
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		setSSONonce(c, "nonce")
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		// the nonce cookie follows the session cookie
+		assert.Equal(t, !disable, cookies[0].Secure)
+		if disable {
+			assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+		} else {
+			assert.Equal(t, http.SameSiteNoneMode, cookies[0].SameSite)
+		}
+	}
+}
+
+func TestClaimValues(t *testing.T) {
+	claims := map[string]any{
+		"sub":          "alice",
+		"realm_access": map[string]any{"roles": []any{"ops", "staff"}},
+		"urn:oid:0.9":  []string{"research"},
+		"level":        float64(3),
+	}
+	assert.Equal(t, []string{"alice"}, model.ClaimValues(claims, "sub"))
+	assert.Equal(t, []string{"ops", "staff"}, model.ClaimValues(claims, "realm_access.roles"))
+	assert.Equal(t, []string{"research"}, model.ClaimValues(claims, "urn:oid:0.9"))
+	assert.Equal(t, []string{"3"}, model.ClaimValues(claims, "level"))
+	assert.Nil(t, model.ClaimValues(claims, "realm_access.groups"))
+}
+
+func TestOAuth2ProviderLogin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}, &model.Log{}, &model.IdentityProvider{}, &model.UserIdentity{}, &model.Ban{}))
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	originalRedis, originalRegister, originalAddress := common.RedisEnabled, config.RegisterEnabled, config.ServerAddress
+	model.DB, model.LOG_DB = db, db
+	common.RedisEnabled, config.RegisterEnabled, config.ServerAddress = false, true, "https://gateway.example.com"
+	defer func() {
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		common.RedisEnabled, config.RegisterEnabled, config.ServerAddress = originalRedis, originalRegister, originalAddress
+	}()
+
+	department := "research"
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "the-code", r.PostForm.Get("code"))
+			assert.Equal(t, "client-secret", r.PostForm.Get("client_secret"))
+			assert.Equal(t, "https://gateway.example.com/api/sso/corp/callback", r.PostForm.Get("redirect_uri"))
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access-token"})
+		case "/userinfo":
+			assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"sub":                "u-1",
+				"preferred_username": "alice",
+				"email":              "alice@example.com",
+				"department":         department,
+				"roles":              []string{"staff", "ops"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer idp.Close()
+
+	provider := &model.IdentityProvider{
+		Name:             "corp",
+		Title:            "Corp",
+		Type:             model.IdentityProviderTypeOAuth2,
+		Enabled:          true,
+		RegisterEnabled:  true,
+		ClientId:         "client",
+		ClientSecret:     "client-secret",
+		AuthorizationURL: idp.URL + "/authorize",
+		TokenURL:         idp.URL + "/token",
+		UserinfoURL:      idp.URL + "/userinfo",
+		Scopes:           "openid profile",
+		Claims:           `{"group": "department", "role": "roles"}`,
+		GroupMapping:     `{"research": "vip"}`,
+		RoleMapping:      `{"ops": "admin"}`,
+	}
+	require.NoError(t, provider.Insert())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret"))))
+	router.GET("/api/sso/:name/login", SSOLogin)
+	router.GET("/api/sso/:name/callback", SSOCallback)
+
+	// the cookies of the browser
+	var cookies []*http.Cookie
+	login := func() (state string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sso/corp/login", nil))
+		require.Equal(t, http.StatusFound, w.Code)
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "/authorize", location.Path)
+		assert.Equal(t, "client", location.Query().Get("client_id"))
+		assert.Equal(t, "openid profile", location.Query().Get("scope"))
+		cookies = w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, ssoNonceCookie, cookies[0].Name)
+		assert.Equal(t, http.SameSiteNoneMode, cookies[0].SameSite)
+		assert.True(t, cookies[0].Secure)
+		return location.Query().Get("state")
+	}
+	callback := func(state string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/sso/corp/callback?code=the-code&state="+url.QueryEscape(state), nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// a state handed to another browser is refused
+	state := login()
+	cookies = nil
+	assert.Equal(t, http.StatusForbidden, callback(state).Code)
+
+	state = login()
+	w := callback(state)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `localStorage.setItem("user"`)
+	assert.NotEmpty(t, w.Header().Get("Set-Cookie"))
+
+	user, err := model.GetUserByIdentity("corp", "u-1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "vip", user.Group)
+	assert.Equal(t, model.RoleAdminUser, user.Role)
+
+	// the state cannot be used twice
+	assert.Equal(t, http.StatusForbidden, callback(state).Code)
+
+	// the next login keeps the user and syncs the attributes
+	department = "sales"
+	provider.RoleMapping = `{"staff": "common"}`
+	require.NoError(t, provider.Update())
+	require.Equal(t, http.StatusOK, callback(login()).Code)
+	user, err = model.GetUserByIdentity("corp", "u-1")
+	require.NoError(t, err)
+	assert.Equal(t, "vip", user.Group)
+	assert.Equal(t, model.RoleCommonUser, user.Role)
+	var count int64
+	require.NoError(t, db.Model(&model.User{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// a binding is only finished in the session of the user who started it
+	nonce := "nonce-of-the-victim"
+	cookies = []*http.Cookie{{Name: ssoNonceCookie, Value: nonce}}
+	w = callback(newSSOState("corp", user.Id+1, nonce))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Please log in again to bind your account")
+}
+
+const testIDPMetadata = `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com">
+  <IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </IDPSSODescriptor>
+</EntityDescriptor>`
+
+func TestSAMLProvider(t *testing.T) {
+	originalAddress := config.ServerAddress
+	config.ServerAddress = "https://gateway.example.com"
+	defer func() { config.ServerAddress = originalAddress }()
+
+	p := samlProvider{configuredProvider{&model.IdentityProvider{
+		Name:     "corp-saml",
+		Type:     model.IdentityProviderTypeSAML,
+		Metadata: testIDPMetadata,
+	}}}
+	state := newSSOState(p.Name(), 0, "nonce")
+	loginURL, err := p.LoginURL(t.Context(), state)
+	require.NoError(t, err)
+	location, err := url.Parse(loginURL)
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.com", location.Host)
+	assert.Equal(t, state, location.Query().Get("RelayState"))
+	assert.NotEmpty(t, location.Query().Get("SAMLRequest"))
+
+	metadata, err := p.metadata(t.Context())
+	require.NoError(t, err)
+	assert.Contains(t, string(metadata), `entityID="https://gateway.example.com/api/sso/corp-saml/metadata"`)
+	assert.Contains(t, string(metadata), `Location="https://gateway.example.com/api/sso/corp-saml/acs"`)
+
+	_, err = parseIDPMetadata([]byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata"/>`))
+	assert.Error(t, err)
+}
+
+// testIDP is a SAML identity provider signing the responses it makes with a self-signed certificate.
+func testIDP(t *testing.T) *saml.IdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	return &saml.IdentityProvider{Key: key, Certificate: certificate, MetadataURL: *metadataURL, SSOURL: *ssoURL}
+}
+
+// samlPostForm returns the form the identity provider has the browser POST to the
+// assertion consumer service for the login of the state.
+func samlPostForm(t *testing.T, idp *saml.IdentityProvider, p samlProvider, state string, nameId string) url.Values {
+	sp, err := p.serviceProvider(t.Context())
+	require.NoError(t, err)
+	spMetadata := sp.Metadata()
+	req := &saml.IdpAuthnRequest{
+		IDP:                     idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, "https://idp.example.com/sso", nil),
+		RelayState:              state,
+		Request:                 saml.AuthnRequest{ID: samlRequestId(state), IssueInstant: time.Now()},
+		ServiceProviderMetadata: spMetadata,
+		SPSSODescriptor:         &spMetadata.SPSSODescriptors[0],
+		ACSEndpoint:             &spMetadata.SPSSODescriptors[0].AssertionConsumerServices[0],
+		Now:                     time.Now(),
+	}
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(req, &saml.Session{
+		ID: "session", CreateTime: time.Now(), ExpireTime: time.Now().Add(time.Hour), Index: "1", NameID: nameId,
+	}))
+	require.NoError(t, req.MakeResponse())
+	form, err := req.PostBinding()
+	require.NoError(t, err)
+	return url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+}
+
+func TestSAMLPostBinding(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}, &model.Log{}, &model.IdentityProvider{}, &model.UserIdentity{}, &model.Ban{}))
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	originalRedis, originalAddress, originalDisable := common.RedisEnabled, config.ServerAddress, config.DisableCookieSecret
+	model.DB, model.LOG_DB = db, db
+	// the nonce cookie is SameSite=Lax like the session cookie, neither comes with the POST
+	common.RedisEnabled, config.ServerAddress, config.DisableCookieSecret = false, "https://gateway.example.com", true
+	defer func() {
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		common.RedisEnabled, config.ServerAddress, config.DisableCookieSecret = originalRedis, originalAddress, originalDisable
+	}()
+
+	user := &model.User{Username: "alice", Password: "password-123", DisplayName: "Alice", Role: model.RoleCommonUser, Status: model.UserStatusEnabled}
+	require.NoError(t, db.Create(user).Error)
+
+	idp := testIDP(t)
+	idpMetadata, err := xml.Marshal(idp.Metadata())
+	require.NoError(t, err)
+	provider := &model.IdentityProvider{
+		Name:     "corp-saml",
+		Title:    "Corp SAML",
+		Type:     model.IdentityProviderTypeSAML,
+		Enabled:  true,
+		Metadata: string(idpMetadata),
+	}
+	require.NoError(t, provider.Insert())
+	p, err := getSSOProvider("corp-saml")
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret"))))
+	router.GET("/test/login", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("id", user.Id)
+		require.NoError(t, session.Save())
+	})
+	router.GET("/api/sso/:name/login", SSOLogin)
+	router.POST("/api/sso/:name/acs", SSOCallback)
+	router.GET("/api/sso/:name/finish", SSOFinish)
+
+	serve := func(r *http.Request, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	w := serve(httptest.NewRequest(http.MethodGet, "/test/login", nil))
+	session := w.Result().Cookies()
+
+	// bind starts a binding in the session and returns the redirect to finish it
+	bind := func() (finish string, nonce *http.Cookie) {
+		w := serve(httptest.NewRequest(http.MethodGet, "/api/sso/corp-saml/login", nil), session...)
+		require.Equal(t, http.StatusFound, w.Code)
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		nonce = w.Result().Cookies()[0]
+		assert.Equal(t, http.SameSiteLaxMode, nonce.SameSite)
+
+		form := samlPostForm(t, idp, p.(samlProvider), location.Query().Get("RelayState"), "u-1")
+		acs := httptest.NewRequest(http.MethodPost, "/api/sso/corp-saml/acs", strings.NewReader(form.Encode()))
+		acs.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = serve(acs)
+		require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+		return w.Header().Get("Location"), nonce
+	}
+
+	// the binding is not finished without the session of the user who started it
+	finish, nonce := bind()
+	w = serve(httptest.NewRequest(http.MethodGet, finish, nil), nonce)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Please log in again to bind your account")
+
+	finish, nonce = bind()
+	w = serve(httptest.NewRequest(http.MethodGet, finish, nil), append(session, nonce)...)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	assert.Equal(t, "/setting", w.Header().Get("Location"))
+	bound, err := model.GetUserByIdentity("corp-saml", "u-1")
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, bound.Id)
+
+	// a ticket is used once
+	w = serve(httptest.NewRequest(http.MethodGet, finish, nil), append(session, nonce)...)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/Laisky/errors/v2"
@@ -12,8 +11,6 @@ import (
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
-	"github.com/songquanpeng/one-api/controller"
-	"github.com/songquanpeng/one-api/model"
 )
 
 type wechatLoginResponse struct {
@@ -53,117 +50,27 @@ func getWeChatIdByCode(code string) (string, error) {
 	return res.Data, nil
 }
 
-func WeChatAuth(c *gin.Context) {
-	ctx := c.Request.Context()
-	if !config.WeChatAuthEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "The administrator has not enabled login and registration via WeChat",
-			"success": false,
-		})
-		return
-	}
-	code := c.Query("code")
-	wechatId, err := getWeChatIdByCode(code)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"message": err.Error(),
-			"success": false,
-		})
-		return
-	}
-	user := model.User{
-		WeChatId: wechatId,
-	}
-	if model.IsWeChatIdAlreadyTaken(wechatId) {
-		err := user.FillUserByWeChatId()
-		if err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": err.Error(),
-			})
-			return
-		}
-	} else {
-		if config.RegisterEnabled {
-			user.Username = "wechat_" + strconv.Itoa(model.GetMaxUserId()+1)
-			user.DisplayName = "WeChat User"
-			user.Role = model.RoleCommonUser
-			user.Status = model.UserStatusEnabled
+// wechatProvider logs in with WeChat accounts through the WeChat server, identified by
+// the id the server returns for the verification code.
+type wechatProvider struct{}
 
-			if err := user.Insert(ctx, 0); err != nil {
-				c.JSON(http.StatusOK, gin.H{
-					"success": false,
-					"message": err.Error(),
-				})
-				return
-			}
-		} else {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "The administrator has turned off new user registration",
-			})
-			return
-		}
-	}
+func (wechatProvider) Name() string          { return "wechat" }
+func (wechatProvider) Title() string         { return "WeChat" }
+func (wechatProvider) Enabled() bool         { return config.WeChatAuthEnabled }
+func (wechatProvider) RegisterEnabled() bool { return true }
 
-	if user.Status != model.UserStatusEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "User has been banned",
-			"success": false,
-		})
-		return
+func (wechatProvider) Identify(c *gin.Context) (*Identity, error) {
+	wechatId, err := getWeChatIdByCode(c.Query("code"))
+	if err != nil {
+		return nil, err
 	}
-	controller.SetupLogin(&user, c)
+	return &Identity{Subject: wechatId}, nil
+}
+
+func WeChatAuth(c *gin.Context) {
+	loginWith(c, wechatProvider{})
 }
 
 func WeChatBind(c *gin.Context) {
-	if !config.WeChatAuthEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "The administrator has not enabled login and registration via WeChat",
-			"success": false,
-		})
-		return
-	}
-	code := c.Query("code")
-	wechatId, err := getWeChatIdByCode(code)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"message": err.Error(),
-			"success": false,
-		})
-		return
-	}
-	if model.IsWeChatIdAlreadyTaken(wechatId) {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "The WeChat account has been bound",
-		})
-		return
-	}
-	id := c.GetInt(ctxkey.Id)
-	user := model.User{
-		Id: id,
-	}
-	err = user.FillUserById()
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	user.WeChatId = wechatId
-	err = user.Update(false)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-	})
-	return
+	bindWith(c, wechatProvider{}, c.GetInt(ctxkey.Id))
 }
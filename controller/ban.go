@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetBans returns a page of the bans, newest first. The type and user_id query
+// parameters filter, active=true keeps only the bans in force.
+func GetBans(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	itemsPerPage, err := strconv.Atoi(c.Query("items_per_page"))
+	if err != nil || itemsPerPage <= 0 {
+		itemsPerPage = config.DefaultItemsPerPage
+	}
+	if itemsPerPage > config.MaxItemsPerPage {
+		itemsPerPage = config.MaxItemsPerPage
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	active, _ := strconv.ParseBool(c.Query("active"))
+
+	bans, total, err := model.GetBans(p*itemsPerPage, itemsPerPage, c.Query("type"), userId, active)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    bans,
+		"total":   total,
+	})
+}
+
+// AddBan bans a user or a network, admins can only ban users of a lower role.
+func AddBan(c *gin.Context) {
+	ban := model.Ban{}
+	if err := c.ShouldBindJSON(&ban); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	ban.Id = 0
+	ban.ActorId = c.GetInt(ctxkey.Id)
+	var user *model.User
+	if ban.Type == model.BanTypeUser {
+		var err error
+		if user, err = model.GetUserById(ban.UserId, false); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		if !canManageBannedUser(c, user) {
+			return
+		}
+	}
+	if err := ban.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user != nil {
+		model.RecordLog(c.Request.Context(), user.Id, model.LogTypeManage,
+			fmt.Sprintf("Admin (ID: %d) banned user %s: %s", ban.ActorId, user.Username, ban.Reason))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    ban,
+	})
+}
+
+// LiftBan ends a ban before it expires.
+func LiftBan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	ban, err := model.GetBanById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var user *model.User
+	if ban.Type == model.BanTypeUser {
+		if user, err = model.GetUserById(ban.UserId, false); err == nil && !canManageBannedUser(c, user) {
+			return
+		}
+	}
+	if err = ban.Lift(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user != nil {
+		model.RecordLog(c.Request.Context(), user.Id, model.LogTypeManage,
+			fmt.Sprintf("Admin (ID: %d) lifted ban %d of user %s", c.GetInt(ctxkey.Id), ban.Id, user.Username))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    ban,
+	})
+}
+
+// canManageBannedUser reports whether the caller may ban or unban the user, and
+// answers the request if not.
+func canManageBannedUser(c *gin.Context, user *model.User) bool {
+	myRole := c.GetInt(ctxkey.Role)
+	if user.Id == c.GetInt(ctxkey.Id) || (myRole <= user.Role && myRole != model.RoleRootUser) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "No permission to ban yourself or users with the same or higher permission level",
+		})
+		return false
+	}
+	return true
+}
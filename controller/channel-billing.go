@@ -425,7 +425,7 @@ func updateAllChannelsBalance() error {
 		} else {
 			// err is nil & balance <= 0 means quota is used up
 			if balance <= 0 {
-				monitor.DisableChannel(channel.Id, channel.Name, "Insufficient balance")
+				monitor.DisableChannel(channel.Id, channel.Name, "", "Insufficient balance")
 			}
 		}
 		time.Sleep(config.RequestInterval)
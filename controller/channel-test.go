@@ -97,13 +97,14 @@ func calculateTestCost(usage *relaymodel.Usage, meta *meta.Meta, request *relaym
 	return quota
 }
 
-func testChannel(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, err error, openaiErr *relaymodel.Error) {
-	startTime := time.Now()
+// newTestContext returns a context for relaying a request of the admin to the channel,
+// the response is written to the returned recorder instead of a client.
+func newTestContext(channel *model.Channel, path string) (*gin.Context, *httptest.ResponseRecorder) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = &http.Request{
 		Method: http.MethodPost,
-		URL:    &url.URL{Path: "/v1/chat/completions"},
+		URL:    &url.URL{Path: path},
 		Body:   nil,
 		Header: make(http.Header),
 	}
@@ -114,6 +115,22 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	cfg, _ := channel.LoadConfig()
 	c.Set(ctxkey.Config, cfg)
 	middleware.SetupContextForSelectedChannel(c, channel, "")
+	return c, w
+}
+
+// setInferenceProfileArn maps the model to the AWS inference profile ARN of the channel, if any.
+func setInferenceProfileArn(channel *model.Channel, meta *meta.Meta, modelName string) {
+	if channel.Type != channeltype.AwsClaude {
+		return
+	}
+	if arn := channel.GetInferenceProfileArnMap()[modelName]; arn != "" {
+		meta.ActualModelName = arn
+	}
+}
+
+func testChannel(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, err error, openaiErr *relaymodel.Error) {
+	startTime := time.Now()
+	c, w := newTestContext(channel, "/v1/chat/completions")
 	meta := meta.GetByContext(c)
 	apiType := channeltype.ToAPIType(channel.Type)
 	adaptor := relay.GetAdaptor(apiType)
@@ -132,15 +149,7 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	if modelMap != nil && modelMap[modelName] != "" {
 		modelName = modelMap[modelName]
 	}
-	// Check for AWS inference profile ARN mapping
-	if channel.Type == channeltype.AwsClaude {
-		arnMap := channel.GetInferenceProfileArnMap()
-		if arnMap != nil {
-			if arn, exists := arnMap[modelName]; exists && arn != "" {
-				meta.ActualModelName = arn
-			}
-		}
-	}
+	setInferenceProfileArn(channel, meta, modelName)
 	meta.OriginModelName = request.Model
 	request.Model = modelName
 	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, request)
@@ -315,13 +324,13 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 			if isChannelEnabled && milliseconds > disableThreshold {
 				err = fmt.Errorf("Response time %.2fs exceeds threshold %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0)
 				if config.AutomaticDisableChannelEnabled {
-					monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+					monitor.DisableChannel(channel.Id, channel.Name, "", err.Error())
 				} else {
 					_ = message.Notify(message.ByAll, fmt.Sprintf("Channel %s （%d）Test超时", channel.Name, channel.Id), "", err.Error())
 				}
 			}
-			if isChannelEnabled && (err != nil || monitor.ShouldDisableChannel(openaiErr, -1)) {
-				monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+			if isChannelEnabled && (err != nil || monitor.ShouldDisableChannel(channel.Id, channel.Type, openaiErr, -1)) {
+				monitor.DisableChannel(channel.Id, channel.Name, "", err.Error())
 			}
 			if !isChannelEnabled && (err == nil && monitor.ShouldEnableChannel(err, openaiErr)) {
 				monitor.EnableChannel(channel.Id, channel.Name)
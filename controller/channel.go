@@ -32,6 +32,16 @@ func GetAllChannels(c *gin.Context) {
 		})
 		return
 	}
+	for _, channel := range channels {
+		channel.MaskSecrets()
+	}
+	if err = model.AttachChannelRecoveries(channels); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -50,6 +60,16 @@ func SearchChannels(c *gin.Context) {
 		})
 		return
 	}
+	for _, channel := range channels {
+		channel.MaskSecrets()
+	}
+	if err = model.AttachChannelRecoveries(channels); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -75,6 +95,14 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	channel.MaskSecrets()
+	if err = model.AttachChannelRecoveries([]*model.Channel{channel}); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -190,6 +218,23 @@ func UpdateChannel(c *gin.Context) {
 		}
 	}
 
+	// the UI only ever sees masked config secrets, keep the stored ones if they come back unchanged
+	storedChannel, err := model.GetChannelById(channel.Id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = channel.KeepMaskedSecrets(storedChannel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -198,6 +243,7 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	channel.MaskSecrets()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -409,9 +455,13 @@ func GetChannelDefaultPricing(c *gin.Context) {
 	modelConfigs := make(map[string]model.ModelConfigLocal)
 	for modelName, price := range defaultPricing {
 		modelConfigs[modelName] = model.ModelConfigLocal{
-			Ratio:           price.Ratio,
-			CompletionRatio: price.CompletionRatio,
-			MaxTokens:       price.MaxTokens,
+			Ratio:            price.Ratio,
+			CompletionRatio:  price.CompletionRatio,
+			MaxTokens:        price.MaxTokens,
+			Tiers:            price.Tiers,
+			Windows:          price.Windows,
+			CachedInputRatio: price.CachedInputRatio,
+			CacheWriteRatio:  price.CacheWriteRatio,
 		}
 	}
 
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetChannelErrorRules(c *gin.Context) {
+	rules, err := model.GetAllChannelErrorRules()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rules,
+	})
+}
+
+// AddChannelErrorRule creates a channel error rule, it is enabled unless the body says otherwise.
+func AddChannelErrorRule(c *gin.Context) {
+	rule := model.ChannelErrorRule{Enabled: true}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rule.Id = 0
+	if err := rule.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rule,
+	})
+}
+
+// UpdateChannelErrorRule replaces all settings of a channel error rule.
+func UpdateChannelErrorRule(c *gin.Context) {
+	rule := model.ChannelErrorRule{}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	stored, err := model.GetChannelErrorRuleById(rule.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rule.CreatedTime = stored.CreatedTime
+	if err = rule.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rule,
+	})
+}
+
+func DeleteChannelErrorRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rule, err := model.GetChannelErrorRuleById(id)
+	if err == nil {
+		err = rule.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+)
+
+// channelRecoveryTick is how often the due recovery probes are looked for.
+const channelRecoveryTick = 10 * time.Second
+
+// AutomaticallyRecoverChannels probes the auto-disabled channels with exponential backoff
+// and enables them again after config.ChannelRecoverySuccesses successes in a row.
+// The recovery states are synced with the channels every config.SyncFrequency seconds,
+// the channels disabled in between start their recovery when they are disabled.
+func AutomaticallyRecoverChannels() {
+	ctx := context.Background()
+	var lastSync time.Time
+	for {
+		if time.Since(lastSync) >= time.Duration(config.SyncFrequency)*time.Second {
+			if err := model.SyncChannelRecoveries(); err != nil {
+				logger.Logger.Error("failed to sync channel recoveries", zap.Error(err))
+			} else {
+				lastSync = time.Now()
+			}
+		}
+		recoverChannels(ctx)
+		time.Sleep(channelRecoveryTick)
+	}
+}
+
+func recoverChannels(ctx context.Context) {
+	recoveries, err := model.GetDueChannelRecoveries(time.Now().Unix())
+	if err != nil {
+		logger.Logger.Error("failed to get due channel recoveries", zap.Error(err))
+		return
+	}
+	for _, recovery := range recoveries {
+		channel, err := model.GetChannelById(recovery.ChannelId, true)
+		if err != nil {
+			logger.Logger.Error("failed to get channel to probe", zap.Int("channel_id", recovery.ChannelId), zap.Error(err))
+			continue
+		}
+		if channel.Status != model.ChannelStatusAutoDisabled {
+			continue
+		}
+		_, probeErr, _ := testChannel(ctx, channel, buildTestRequest(recovery.Model))
+		if err = recovery.RecordProbe(probeErr, time.Now().Unix()); err != nil {
+			logger.Logger.Error("failed to record channel probe", zap.Int("channel_id", channel.Id), zap.Error(err))
+			continue
+		}
+		if probeErr != nil {
+			logger.Logger.Info(fmt.Sprintf("channel #%d is still failing, next probe in %ds: %s",
+				channel.Id, recovery.NextProbeTime-recovery.LastProbeTime, probeErr.Error()))
+		} else if recovery.Successes >= config.ChannelRecoverySuccesses {
+			monitor.EnableChannel(channel.Id, channel.Name)
+		}
+		time.Sleep(config.RequestInterval)
+	}
+}
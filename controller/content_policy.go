@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetContentPolicies(c *gin.Context) {
+	policies, err := model.GetAllContentPolicies()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    policies,
+	})
+}
+
+// AddContentPolicy creates a content policy, it is enabled unless the body says otherwise.
+func AddContentPolicy(c *gin.Context) {
+	policy := model.ContentPolicy{Enabled: true}
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	policy.Id = 0
+	if err := policy.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    policy,
+	})
+}
+
+// UpdateContentPolicy replaces all settings of a content policy.
+func UpdateContentPolicy(c *gin.Context) {
+	policy := model.ContentPolicy{}
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	stored, err := model.GetContentPolicyById(policy.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	policy.CreatedTime = stored.CreatedTime
+	if err = policy.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    policy,
+	})
+}
+
+func DeleteContentPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	policy, err := model.GetContentPolicyById(id)
+	if err == nil {
+		err = policy.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetContentPolicyEvents returns a page of the recorded policy matches, newest first.
+// The reviewed query parameter filters by review status.
+func GetContentPolicyEvents(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	itemsPerPage, err := strconv.Atoi(c.Query("items_per_page"))
+	if err != nil || itemsPerPage <= 0 {
+		itemsPerPage = config.DefaultItemsPerPage
+	}
+	if itemsPerPage > config.MaxItemsPerPage {
+		itemsPerPage = config.MaxItemsPerPage
+	}
+	var reviewed *bool
+	if value, err := strconv.ParseBool(c.Query("reviewed")); err == nil {
+		reviewed = &value
+	}
+
+	events, total, err := model.GetContentPolicyEvents(p*itemsPerPage, itemsPerPage, reviewed)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    events,
+		"total":   total,
+	})
+}
+
+func ReviewContentPolicyEvent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err == nil {
+		err = model.ReviewContentPolicyEvent(id)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -5,13 +5,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 
-	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/model"
 )
 
+// GetGroups returns the names of all groups, it is used by the group selectors of the UI.
 func GetGroups(c *gin.Context) {
-	groupNames := make([]string, 0)
-	for groupName := range billingratio.GroupRatio {
-		groupNames = append(groupNames, groupName)
+	groups, err := model.GetAllGroups()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	groupNames := make([]string, 0, len(groups))
+	for _, group := range groups {
+		groupNames = append(groupNames, group.Name)
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -19,3 +28,159 @@ func GetGroups(c *gin.Context) {
 		"data":    groupNames,
 	})
 }
+
+// groupDetail is a group together with its settings after inheritance is resolved.
+type groupDetail struct {
+	*model.Group
+	Effective *model.GroupPolicy `json:"effective"`
+}
+
+// ListGroups returns all groups with their own and their effective settings.
+func ListGroups(c *gin.Context) {
+	groups, err := model.GetAllGroups()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	details := make([]groupDetail, 0, len(groups))
+	for _, group := range groups {
+		details = append(details, groupDetail{Group: group, Effective: model.GetGroupPolicy(group.Name)})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    details,
+	})
+}
+
+func GetGroup(c *gin.Context) {
+	group, err := model.GetGroupByName(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    groupDetail{Group: group, Effective: model.GetGroupPolicy(group.Name)},
+	})
+}
+
+func AddGroup(c *gin.Context) {
+	group := model.Group{}
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := group.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    group,
+	})
+}
+
+// UpdateGroup replaces all settings of a group, omitted settings become inherited.
+func UpdateGroup(c *gin.Context) {
+	group := model.Group{}
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	stored, err := model.GetGroupByName(group.Name)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	group.CreatedTime = stored.CreatedTime
+	if err = group.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    group,
+	})
+}
+
+func DeleteGroup(c *gin.Context) {
+	group := model.Group{Name: c.Param("name")}
+	if err := group.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetGroupModelRatios returns the per model ratio overrides declared by the group itself.
+func GetGroupModelRatios(c *gin.Context) {
+	ratios, err := model.GetGroupModelRatios(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    ratios,
+	})
+}
+
+// UpdateGroupModelRatios replaces the per model ratio overrides of the group,
+// the body is a model -> ratio json object.
+func UpdateGroupModelRatios(c *gin.Context) {
+	ratios := make(map[string]float64)
+	if err := c.ShouldBindJSON(&ratios); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := model.SetGroupModelRatios(c.Param("name"), ratios); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    ratios,
+	})
+}
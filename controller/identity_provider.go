@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// getIdentityProviderStatus lists the enabled identity providers for the login page,
+// users log in with them at /api/sso/:name/login.
+func getIdentityProviderStatus() []gin.H {
+	providers := model.GetIdentityProviders()
+	status := make([]gin.H, 0, len(providers))
+	for _, provider := range providers {
+		if provider.Type == model.IdentityProviderTypeJWT {
+			continue
+		}
+		status = append(status, gin.H{
+			"name":  provider.Name,
+			"title": provider.Title,
+			"type":  provider.Type,
+		})
+	}
+	return status
+}
+
+// GetIdentityProviders returns the identity providers, their secrets masked.
+func GetIdentityProviders(c *gin.Context) {
+	providers, err := model.GetAllIdentityProviders()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	for _, provider := range providers {
+		provider.MaskSecrets()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    providers,
+	})
+}
+
+// AddIdentityProvider adds an identity provider, it is enabled unless the body says
+// otherwise.
+func AddIdentityProvider(c *gin.Context) {
+	provider := model.IdentityProvider{Enabled: true}
+	if err := c.ShouldBindJSON(&provider); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	provider.Id = 0
+	if err := provider.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	provider.MaskSecrets()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    provider,
+	})
+}
+
+// UpdateIdentityProvider replaces the settings of an identity provider, masked secrets
+// keep their stored values.
+func UpdateIdentityProvider(c *gin.Context) {
+	provider := model.IdentityProvider{}
+	if err := c.ShouldBindJSON(&provider); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	stored, err := model.GetIdentityProviderById(provider.Id)
+	if err == nil && provider.Name != stored.Name {
+		// users are linked by the name
+		err = errors.New("the name of an identity provider cannot be changed")
+	}
+	if err == nil {
+		provider.KeepMaskedSecrets(stored)
+		err = provider.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	provider.MaskSecrets()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    provider,
+	})
+}
+
+// DeleteIdentityProvider deletes an identity provider and unlinks its users.
+func DeleteIdentityProvider(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	provider, err := model.GetIdentityProviderById(id)
+	if err == nil {
+		err = provider.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// LinkIdentityProviderUser links a user to their subject at an identity provider, an
+// empty subject removes the link. Users link themselves to login providers by logging
+// in, the subjects of JWT issuers can only be linked here.
+func LinkIdentityProviderUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	link := struct {
+		UserId  int    `json:"user_id"`
+		Subject string `json:"subject"`
+	}{}
+	err = c.ShouldBindJSON(&link)
+	var provider *model.IdentityProvider
+	if err == nil {
+		provider, err = model.GetIdentityProviderById(id)
+	}
+	if err == nil {
+		_, err = model.GetUserById(link.UserId, false)
+	}
+	if err == nil && link.Subject != "" {
+		if linked, lookupErr := model.GetUserByIdentity(provider.Name, link.Subject); lookupErr == nil && linked.Id != link.UserId {
+			err = errors.Errorf("%s is already linked to user %d", link.Subject, linked.Id)
+		}
+	}
+	if err == nil {
+		err = model.SetIdentity(link.UserId, provider.Name, link.Subject)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
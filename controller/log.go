@@ -25,6 +25,14 @@ func GetAllLogs(c *gin.Context) {
 	channel, _ := strconv.Atoi(c.Query("channel"))
 	sortBy := c.DefaultQuery("sort_by", "")
 	sortOrder := c.DefaultQuery("sort_order", "desc")
+	tokenKind := c.Query("token_kind")
+	if !model.IsValidLogTokenKind(tokenKind) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "invalid token_kind, expect one of cached, reasoning, audio, image",
+		})
+		return
+	}
 
 	// Validate date range for sorting requests (max 30 days)
 	if sortBy != "" && startTimestamp > 0 && endTimestamp > 0 {
@@ -46,7 +54,7 @@ func GetAllLogs(c *gin.Context) {
 		itemsPerPage = config.MaxItemsPerPage
 	}
 
-	logs, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, p*itemsPerPage, itemsPerPage, channel, sortBy, sortOrder)
+	logs, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, p*itemsPerPage, itemsPerPage, channel, sortBy, sortOrder, tokenKind)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -75,6 +83,14 @@ func GetUserLogs(c *gin.Context) {
 	modelName := c.Query("model_name")
 	sortBy := c.DefaultQuery("sort_by", "")
 	sortOrder := c.DefaultQuery("sort_order", "desc")
+	tokenKind := c.Query("token_kind")
+	if !model.IsValidLogTokenKind(tokenKind) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "invalid token_kind, expect one of cached, reasoning, audio, image",
+		})
+		return
+	}
 
 	// Validate date range for sorting requests (max 30 days)
 	if sortBy != "" && startTimestamp > 0 && endTimestamp > 0 {
@@ -88,7 +104,7 @@ func GetUserLogs(c *gin.Context) {
 		}
 	}
 
-	logs, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, p*config.MaxItemsPerPage, config.MaxItemsPerPage, sortBy, sortOrder)
+	logs, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, p*config.MaxItemsPerPage, config.MaxItemsPerPage, sortBy, sortOrder, tokenKind)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -149,14 +165,29 @@ func GetLogsStat(c *gin.Context) {
 	username := c.Query("username")
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
-	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel)
-	//tokenNum := model.SumUsedToken(logType, startTimestamp, endTimestamp, modelName, username, "")
+	tokenKind := c.Query("token_kind")
+	if !model.IsValidLogTokenKind(tokenKind) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "invalid token_kind, expect one of cached, reasoning, audio, image",
+		})
+		return
+	}
+	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, tokenKind)
+	tokenStat, err := model.SumLogTokens(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tokenKind)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"data": gin.H{
-			"quota": quotaNum,
-			//"token": tokenNum,
+			"quota":  quotaNum,
+			"tokens": tokenStat,
 		},
 	})
 	return
@@ -170,14 +201,29 @@ func GetLogsSelfStat(c *gin.Context) {
 	tokenName := c.Query("token_name")
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
-	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel)
-	//tokenNum := model.SumUsedToken(logType, startTimestamp, endTimestamp, modelName, username, tokenName)
+	tokenKind := c.Query("token_kind")
+	if !model.IsValidLogTokenKind(tokenKind) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "invalid token_kind, expect one of cached, reasoning, audio, image",
+		})
+		return
+	}
+	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, tokenKind)
+	tokenStat, err := model.SumLogTokens(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tokenKind)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"data": gin.H{
-			"quota": quotaNum,
-			//"token": tokenNum,
+			"quota":  quotaNum,
+			"tokens": tokenStat,
 		},
 	})
 	return
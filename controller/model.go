@@ -1,10 +1,10 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,8 +12,9 @@ import (
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
 	relay "github.com/songquanpeng/one-api/relay"
-	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/catalog"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
@@ -37,85 +38,50 @@ type OpenAIModelPermission struct {
 }
 
 type OpenAIModels struct {
-	// Id model's name
-	//
-	// BUG: Different channels may have the same model name
+	// Id model's name, it is unique in a model list
 	Id      string `json:"id"`
 	Object  string `json:"object"`
 	Created int    `json:"created"`
-	// OwnedBy is the channel's adaptor name
+	// OwnedBy is the name of the channel type that serves the model
 	OwnedBy    string                  `json:"owned_by"`
 	Permission []OpenAIModelPermission `json:"permission"`
 	Root       string                  `json:"root"`
 	Parent     *string                 `json:"parent"`
+
+	// The metadata of the model catalog, omitted when unknown
+	ContextLength   int              `json:"context_length,omitempty"`
+	MaxOutputTokens int              `json:"max_output_tokens,omitempty"`
+	Modalities      *ModelModalities `json:"modalities,omitempty"`
+	SupportsTools   *bool            `json:"supports_tools,omitempty"`
+	SupportsVision  *bool            `json:"supports_vision,omitempty"`
+	Description     string           `json:"description,omitempty"`
+	Pricing         *catalog.Pricing `json:"pricing,omitempty"`
+}
+
+// ModelModalities lists the kinds of input and output of a model, e.g. text, image, audio.
+type ModelModalities struct {
+	Input  []string `json:"input"`
+	Output []string `json:"output"`
 }
 
-// BUG(#39): 更新 custom channel 时，应该同步更新所有自定义的 models 到 allModels
-var allModels []OpenAIModels
-var modelsMap map[string]OpenAIModels
+var modelPermission = []OpenAIModelPermission{{
+	Id:                 "modelperm-LwHkVFn8AcMItP432fKKDIKJ",
+	Object:             "model_permission",
+	Created:            1626777600,
+	AllowCreateEngine:  true,
+	AllowSampling:      true,
+	AllowLogprobs:      true,
+	AllowSearchIndices: false,
+	AllowView:          true,
+	AllowFineTuning:    false,
+	Organization:       "*",
+	Group:              nil,
+	IsBlocking:         false,
+}}
+
 var channelId2Models map[int][]string
 
 func init() {
-	var permission []OpenAIModelPermission
-	permission = append(permission, OpenAIModelPermission{
-		Id:                 "modelperm-LwHkVFn8AcMItP432fKKDIKJ",
-		Object:             "model_permission",
-		Created:            1626777600,
-		AllowCreateEngine:  true,
-		AllowSampling:      true,
-		AllowLogprobs:      true,
-		AllowSearchIndices: false,
-		AllowView:          true,
-		AllowFineTuning:    false,
-		Organization:       "*",
-		Group:              nil,
-		IsBlocking:         false,
-	})
-	// https://platform.openai.com/docs/models/model-endpoint-compatibility
-	for i := 0; i < apitype.Dummy; i++ {
-		if i == apitype.AIProxyLibrary {
-			continue
-		}
-		adaptor := relay.GetAdaptor(i)
-		if adaptor == nil {
-			continue
-		}
-
-		channelName := adaptor.GetChannelName()
-		modelNames := adaptor.GetModelList()
-		for _, modelName := range modelNames {
-			allModels = append(allModels, OpenAIModels{
-				Id:         modelName,
-				Object:     "model",
-				Created:    1626777600,
-				OwnedBy:    channelName,
-				Permission: permission,
-				Root:       modelName,
-				Parent:     nil,
-			})
-		}
-	}
-	for _, channelType := range openai.CompatibleChannels {
-		if channelType == channeltype.Azure {
-			continue
-		}
-		channelName, channelModelList := openai.GetCompatibleChannelMeta(channelType)
-		for _, modelName := range channelModelList {
-			allModels = append(allModels, OpenAIModels{
-				Id:         modelName,
-				Object:     "model",
-				Created:    1626777600,
-				OwnedBy:    channelName,
-				Permission: permission,
-				Root:       modelName,
-				Parent:     nil,
-			})
-		}
-	}
-	modelsMap = make(map[string]OpenAIModels)
-	for _, model := range allModels {
-		modelsMap[model.Id] = model
-	}
 	channelId2Models = make(map[int][]string)
 	for i := 1; i < channeltype.Dummy; i++ {
 		adaptor := relay.GetAdaptor(channeltype.ToAPIType(i))
@@ -131,6 +97,30 @@ func init() {
 	}
 }
 
+// openAIModelFromEntry converts a catalog entry, id is the name the model is exposed as.
+func openAIModelFromEntry(id string, entry catalog.Entry, groupRatio float64) OpenAIModels {
+	price := entry.Pricing(groupRatio)
+	return OpenAIModels{
+		Id:              id,
+		Object:          "model",
+		Created:         1626777600,
+		OwnedBy:         entry.OwnedBy,
+		Permission:      modelPermission,
+		Root:            id,
+		Parent:          nil,
+		ContextLength:   entry.ContextLength,
+		MaxOutputTokens: entry.MaxOutputTokens,
+		Modalities: &ModelModalities{
+			Input:  entry.InputModalities,
+			Output: entry.OutputModalities,
+		},
+		SupportsTools:  entry.SupportsTools,
+		SupportsVision: entry.SupportsVision,
+		Description:    entry.Description,
+		Pricing:        &price,
+	}
+}
+
 func DashboardListModels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -140,9 +130,19 @@ func DashboardListModels(c *gin.Context) {
 }
 
 func ListAllModels(c *gin.Context) {
+	modelCatalog, err := catalog.Get()
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	models := make([]OpenAIModels, 0)
+	for _, entry := range modelCatalog.Models() {
+		models = append(models, openAIModelFromEntry(entry.Model, entry, 1))
+	}
 	c.JSON(200, gin.H{
 		"object": "list",
-		"data":   allModels,
+		"data":   models,
 	})
 }
 
@@ -162,9 +162,10 @@ type ChannelModelsDisplayInfo struct {
 
 // ModelDisplayInfo represents display information for a single model
 type ModelDisplayInfo struct {
-	InputPrice  float64 `json:"input_price"`  // Price per 1M input tokens in USD
-	OutputPrice float64 `json:"output_price"` // Price per 1M output tokens in USD
+	InputPrice  float64 `json:"input_price"`  // Price per 1M input tokens in USD, group ratio applied
+	OutputPrice float64 `json:"output_price"` // Price per 1M output tokens in USD, group ratio applied
 	MaxTokens   int32   `json:"max_tokens"`   // Maximum tokens limit, 0 means unlimited
+	GroupRatio  float64 `json:"group_ratio"`  // Ratio of the caller's group for this model
 }
 
 // GetModelsDisplay returns models available to the current user grouped by channel/adaptor with pricing information
@@ -252,41 +253,24 @@ func GetModelsDisplay(c *gin.Context) {
 			}
 
 			if modelConfig, exists := pricing[actualModelName]; exists {
-				// Convert pricing based on the format used by the adapter
-				// Some adapters use quota-based pricing (ratio.MilliTokensUsd = 0.5)
-				// Others use USD-based pricing (MilliTokensUsd = 0.000001)
-				// We detect the format by checking the magnitude of the ratio
-				if modelConfig.Ratio < 0.001 {
-					// USD-based pricing (like AWS): ratio is already in USD per token
-					// Just convert to USD per 1M tokens
-					inputPrice = modelConfig.Ratio * 1000000
-				} else {
-					// Quota-based pricing (like OpenAI): ratio is in quota per token
-					// Convert from quota to USD: ratio.QuotaPerUsd = 500000
-					inputPrice = (modelConfig.Ratio * 1000000) / 500000
-				}
+				inputPrice = catalog.USDPerMillionTokens(modelConfig.Ratio)
 				outputPrice = inputPrice * modelConfig.CompletionRatio
 				maxTokens = modelConfig.MaxTokens
 			} else {
 				// Fallback to adapter methods if not in pricing map
-				inputRatio := adaptor.GetModelRatio(actualModelName)
-				completionRatio := adaptor.GetCompletionRatio(actualModelName)
-				// Apply the same detection logic for fallback pricing
-				if inputRatio < 0.001 {
-					// USD-based pricing
-					inputPrice = inputRatio * 1000000
-				} else {
-					// Quota-based pricing
-					inputPrice = (inputRatio * 1000000) / 500000
-				}
-				outputPrice = inputPrice * completionRatio
+				inputPrice = catalog.USDPerMillionTokens(adaptor.GetModelRatio(actualModelName))
+				outputPrice = inputPrice * adaptor.GetCompletionRatio(actualModelName)
 				maxTokens = 0 // Default to unlimited
 			}
 
+			// Show the effective price of the caller's group, including per model overrides
+			groupRatio := billingratio.GetGroupModelRatio(userGroup, modelName)
+
 			modelsInfo[modelName] = ModelDisplayInfo{
-				InputPrice:  inputPrice,
-				OutputPrice: outputPrice,
+				InputPrice:  inputPrice * groupRatio,
+				OutputPrice: outputPrice * groupRatio,
 				MaxTokens:   maxTokens,
+				GroupRatio:  groupRatio,
 			}
 		}
 
@@ -306,11 +290,24 @@ func GetModelsDisplay(c *gin.Context) {
 	})
 }
 
-// ListModels lists all models available to the user.
-func ListModels(c *gin.Context) {
-	userId := c.GetInt(ctxkey.Id)
+// callerGroup returns the group of the relay caller, the group a JWT maps to or the
+// group of the token owner.
+func callerGroup(c *gin.Context) (string, error) {
+	if group := c.GetString(ctxkey.Group); group != "" {
+		return group, nil
+	}
+	return model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+}
 
-	userGroup, err := model.CacheGetUserGroup(userId)
+// ListModels lists all models available to the user with the metadata of the model catalog
+// and the prices of the user's group.
+//
+// Different channel types may serve the same model name, the model is listed once. The
+// metadata comes from a channel type that declares the model itself, and custom models
+// of OpenAI-compatible channels borrow the metadata of the channel type declaring them.
+// Mapped models use the metadata of the model they are mapped to.
+func ListModels(c *gin.Context) {
+	userGroup, err := callerGroup(c)
 	if err != nil {
 		middleware.AbortWithError(c, http.StatusBadRequest, err)
 		return
@@ -323,54 +320,67 @@ func ListModels(c *gin.Context) {
 		return
 	}
 
-	// fix(#39): Previously, to fix #31, I concatenated model_name with adaptor name to return models.
-	// But this caused an issue with custom channels, where the returned adaptor is "openai",
-	// resulting in adaptor name and ownedBy field mismatches when matching against allModels.
-	// For deepseek example, the adaptor is "openai" but ownedBy is "deepseek", causing mismatch.
-	// Our current solution: for models from custom channels, don't concatenate adaptor name,
-	// just match by model name only. However, this may reintroduce the duplicate models bug
-	// mentioned in #31. A complete fix would require significant changes, so I'll leave it for now.
+	modelCatalog, err := catalog.Get()
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
 
-	// Create ability maps for both exact matches and model-only matches
-	exactMatches := make(map[string]bool)
-	modelMatches := make(map[string]bool)
+	modelMappings, err := getChannelModelMappings(availableAbilities)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
 
+	type candidate struct {
+		entry  catalog.Entry
+		native bool
+	}
+	candidates := make(map[string]candidate)
 	for _, ability := range availableAbilities {
-		adaptor := relay.GetAdaptor(channeltype.ToAPIType(ability.ChannelType))
-		// Store exact match
-		key := ability.Model + ":" + adaptor.GetChannelName()
-		exactMatches[key] = true
+		actualModel := ability.Model
+		if mappedModel := modelMappings[ability.ChannelId][ability.Model]; mappedModel != "" {
+			actualModel = mappedModel
+		}
+
+		entry, native, ok := modelCatalog.Lookup(ability.ChannelType, actualModel)
+		if !ok {
+			entry = catalog.Entry{
+				Model:            actualModel,
+				ChannelType:      ability.ChannelType,
+				OwnedBy:          channeltype.IdToName(ability.ChannelType),
+				InputModalities:  []string{"text"},
+				OutputModalities: []string{"text"},
+			}
+		}
 
-		// Store model name for fallback matching
-		modelMatches[ability.Model] = true
+		current, exists := candidates[ability.Model]
+		switch {
+		case !exists,
+			native && !current.native,
+			native == current.native && entry.ChannelType < current.entry.ChannelType:
+			candidates[ability.Model] = candidate{entry: entry, native: native}
+		}
 	}
 
-	userAvailableModels := make([]OpenAIModels, 0)
-	for _, model := range allModels {
-		key := model.Id + ":" + model.OwnedBy
+	virtualModels, err := listVirtualModels(c.Request.Context(), userGroup, availableAbilities, modelCatalog)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
 
-		// Check for exact match first
-		if exactMatches[key] {
-			userAvailableModels = append(userAvailableModels, model)
+	userAvailableModels := make([]OpenAIModels, 0, len(candidates)+len(virtualModels))
+	userAvailableModels = append(userAvailableModels, virtualModels...)
+	for modelName, candidate := range candidates {
+		// virtual models take precedence over models of the same name
+		if model.GetVirtualModel(modelName) != nil {
 			continue
 		}
-
-		// Fall back to model-only match if:
-		// 1. Model name matches
-		// 2. No exact match exists for this model name
-		if modelMatches[model.Id] {
-			hasExactMatch := false
-			for exactKey := range exactMatches {
-				if strings.HasPrefix(exactKey, model.Id+":") {
-					hasExactMatch = true
-					break
-				}
-			}
-
-			if !hasExactMatch {
-				userAvailableModels = append(userAvailableModels, model)
-			}
+		if candidate.entry.Hidden {
+			continue
 		}
+		groupRatio := billingratio.GetGroupModelRatio(userGroup, modelName)
+		userAvailableModels = append(userAvailableModels, openAIModelFromEntry(modelName, candidate.entry, groupRatio))
 	}
 
 	// Sort models alphabetically for consistent presentation
@@ -384,10 +394,123 @@ func ListModels(c *gin.Context) {
 	})
 }
 
+// listVirtualModels returns the virtual models the group may use and that have a target
+// with an available channel. A virtual model is described and priced as its first such target.
+func listVirtualModels(ctx context.Context, userGroup string, userAbilities []model.EnabledAbility,
+	modelCatalog *catalog.Catalog) ([]OpenAIModels, error) {
+	groupModels := make(map[string]map[string]bool)
+	reachable := func(group string, modelName string) (bool, error) {
+		if _, ok := groupModels[group]; !ok {
+			abilities := userAbilities
+			if group != userGroup {
+				var err error
+				if abilities, err = model.CacheGetGroupModelsV2(ctx, group); err != nil {
+					return false, err
+				}
+			}
+			groupModels[group] = make(map[string]bool, len(abilities))
+			for _, ability := range abilities {
+				groupModels[group][ability.Model] = true
+			}
+		}
+		return groupModels[group][modelName], nil
+	}
+
+	var models []OpenAIModels
+	for _, virtualModel := range model.GetVirtualModels() {
+		if !model.IsGroupModelAllowed(userGroup, virtualModel.Name) {
+			continue
+		}
+		targets, err := virtualModel.GetTargets()
+		if err != nil {
+			continue
+		}
+		for _, target := range targets {
+			if !model.IsGroupModelAllowed(userGroup, target.Model) {
+				continue
+			}
+			ok, err := reachable(target.ChannelGroup(userGroup), target.Model)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			entry := virtualModelEntry(modelCatalog, virtualModel, target.Model)
+			groupRatio := billingratio.GetGroupModelRatio(userGroup, target.Model)
+			virtual := openAIModelFromEntry(virtualModel.Name, entry, groupRatio)
+			virtual.Parent = &target.Model
+			models = append(models, virtual)
+			break
+		}
+	}
+	return models, nil
+}
+
+// virtualModelEntry describes the virtual model with the catalog entry of its target.
+func virtualModelEntry(modelCatalog *catalog.Catalog, virtualModel *model.VirtualModel, targetModel string) catalog.Entry {
+	entry, _, ok := modelCatalog.Lookup(0, targetModel)
+	if !ok {
+		entry = catalog.Entry{
+			Model:            targetModel,
+			InputModalities:  []string{"text"},
+			OutputModalities: []string{"text"},
+		}
+	}
+	entry.OwnedBy = "virtual"
+	entry.Hidden = false
+	if virtualModel.Description != "" {
+		entry.Description = virtualModel.Description
+	}
+	return entry
+}
+
+// getChannelModelMappings returns the model mappings of the channels of the abilities.
+func getChannelModelMappings(abilities []model.EnabledAbility) (map[int]map[string]string, error) {
+	channelIds := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, ability := range abilities {
+		if !seen[ability.ChannelId] {
+			seen[ability.ChannelId] = true
+			channelIds = append(channelIds, ability.ChannelId)
+		}
+	}
+
+	channels, err := model.GetChannelsByIds(channelIds)
+	if err != nil {
+		return nil, err
+	}
+	mappings := make(map[int]map[string]string, len(channels))
+	for _, channel := range channels {
+		if mapping := channel.GetModelMapping(); len(mapping) > 0 {
+			mappings[channel.Id] = mapping
+		}
+	}
+	return mappings, nil
+}
+
 func RetrieveModel(c *gin.Context) {
 	modelId := c.Param("model")
-	if model, ok := modelsMap[modelId]; ok {
-		c.JSON(200, model)
+	modelCatalog, err := catalog.Get()
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	entry, _, ok := modelCatalog.Lookup(0, modelId)
+	priceModel := modelId
+	if virtualModel := model.GetVirtualModel(modelId); virtualModel != nil {
+		// a virtual model is described by its first target
+		targets, _ := virtualModel.GetTargets()
+		priceModel = targets[0].Model
+		entry, ok = virtualModelEntry(modelCatalog, virtualModel, priceModel), true
+	}
+	if ok && !entry.Hidden {
+		groupRatio := 1.0
+		if userGroup, err := callerGroup(c); err == nil {
+			groupRatio = billingratio.GetGroupModelRatio(userGroup, priceModel)
+		}
+		c.JSON(200, openAIModelFromEntry(modelId, entry, groupRatio))
 	} else {
 		Error := relaymodel.Error{
 			Message: fmt.Sprintf("The model '%s' does not exist", modelId),
@@ -4,15 +4,25 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
 )
 
+// initTestDB opens the database in a temporary directory, so no sqlite file is left in the tree
+func initTestDB(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	t.Cleanup(func() { common.SQLitePath = originalPath })
+	model.InitDB()
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -21,8 +31,7 @@ func min(a, b int) int {
 }
 
 func TestDashboardListModels(t *testing.T) {
-	// Initialize the database for testing
-	model.InitDB()
+	initTestDB(t)
 
 	// Create a test router
 	gin.SetMode(gin.TestMode)
@@ -78,8 +87,7 @@ func TestDashboardListModels(t *testing.T) {
 }
 
 func TestListAllModels(t *testing.T) {
-	// Initialize the database for testing
-	model.InitDB()
+	initTestDB(t)
 
 	// Create a test router
 	gin.SetMode(gin.TestMode)
@@ -131,7 +139,7 @@ func TestModelEndpointsDifference(t *testing.T) {
 	// This test verifies that the two endpoints return different data structures
 	// as expected by the frontend
 
-	model.InitDB()
+	initTestDB(t)
 	gin.SetMode(gin.TestMode)
 
 	// Test DashboardListModels (/api/models)
@@ -185,7 +193,7 @@ func TestModelEndpointsDifference(t *testing.T) {
 
 func TestDeepSeekModelsInDashboard(t *testing.T) {
 	// This test verifies that DeepSeek models are correctly included in the dashboard models endpoint
-	model.InitDB()
+	initTestDB(t)
 	gin.SetMode(gin.TestMode)
 
 	router := gin.New()
@@ -231,7 +239,7 @@ func TestDeepSeekModelsInDashboard(t *testing.T) {
 func TestChannelDefaultPricing(t *testing.T) {
 	// This test verifies that the /api/channel/default-pricing endpoint works correctly
 	// for different channel types
-	model.InitDB()
+	initTestDB(t)
 	gin.SetMode(gin.TestMode)
 
 	// Initialize global pricing manager for the test
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/catalog"
+)
+
+// GetModelCatalogOverrides returns the overrides of the model catalog.
+func GetModelCatalogOverrides(c *gin.Context) {
+	overrides, err := model.GetModelCatalogOverrides()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    overrides,
+	})
+}
+
+// SaveModelCatalogOverride creates or replaces the override of a model on a channel type,
+// channel type 0 applies to the model on every channel type.
+func SaveModelCatalogOverride(c *gin.Context) {
+	override := &model.ModelCatalogOverride{}
+	if err := c.ShouldBindJSON(override); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := model.SaveModelCatalogOverride(override); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	catalog.Invalidate()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    override,
+	})
+}
+
+// DeleteModelCatalogOverride deletes an override, the model falls back to the derived metadata.
+func DeleteModelCatalogOverride(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = model.DeleteModelCatalogOverride(id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	catalog.Invalidate()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetPromptTemplates(c *gin.Context) {
+	templates, err := model.GetAllPromptTemplates()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    templates,
+	})
+}
+
+// AddPromptTemplate stores a new version of a prompt template, it is enabled unless
+// the body says otherwise.
+func AddPromptTemplate(c *gin.Context) {
+	template := model.PromptTemplate{Enabled: true}
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	template.Id = 0
+	if err := template.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    template,
+	})
+}
+
+// UpdatePromptTemplate changes the description, groups and status of a template version,
+// a changed content is added as a new version instead.
+func UpdatePromptTemplate(c *gin.Context) {
+	update := model.PromptTemplate{}
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	template, err := model.GetPromptTemplateById(update.Id)
+	if err == nil {
+		template.Description = update.Description
+		template.Groups = update.Groups
+		template.Enabled = update.Enabled
+		err = template.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    template,
+	})
+}
+
+func DeletePromptTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	template, err := model.GetPromptTemplateById(id)
+	if err == nil {
+		err = template.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
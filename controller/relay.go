@@ -28,7 +28,17 @@ import (
 
 // https://platform.openai.com/docs/api-reference/chat
 
+// channelBusyCode is the error code of a request whose channel reached its max concurrency
+// after being selected, it does not count against the channel.
+const channelBusyCode = "channel_busy"
+
 func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
+	release, bizErr := acquireChannelSlot(c)
+	if bizErr != nil {
+		return bizErr
+	}
+	defer release()
+
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
 	case relaymode.ImagesGenerations,
@@ -42,6 +52,8 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = controller.RelayAudioHelper(c, relayMode)
 	case relaymode.Proxy:
 		err = controller.RelayProxyHelper(c, relayMode)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c)
 	case relaymode.ResponseAPI:
 		err = controller.RelayResponseAPIHelper(c)
 	case relaymode.ClaudeMessages:
@@ -77,9 +89,14 @@ func Relay(c *gin.Context) {
 	}
 	lastFailedChannelId := channelId
 	channelName := c.GetString(ctxkey.ChannelName)
-	group := c.GetString(ctxkey.Group)
+	userGroup := c.GetString(ctxkey.Group)
+	group := routingGroup(c)
 	originalModel := c.GetString(ctxkey.OriginalModel)
-	go processChannelRelayError(ctx, userId, channelId, channelName, group, originalModel, *bizErr)
+	virtualModel, targetIdx := middleware.GetVirtualModelRoute(c)
+	channelType := c.GetInt(ctxkey.Channel)
+	if bizErr.Code != channelBusyCode {
+		go processChannelRelayError(ctx, userId, channelId, channelName, channelType, group, originalModel, *bizErr)
+	}
 
 	// Record failed relay request metrics
 	PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, false, 0, 0, 0)
@@ -89,6 +106,11 @@ func Relay(c *gin.Context) {
 	if err := shouldRetry(c, bizErr.StatusCode); err != nil {
 		logger.Logger.Error(fmt.Sprintf("relay error happen, won't retry since of %v", err.Error()))
 		retryTimes = 0
+	} else if virtualModel != nil {
+		// a virtual model falls back to its remaining targets even if retries are disabled
+		if targets, err := virtualModel.GetTargets(); err == nil && len(targets)-1-targetIdx > retryTimes {
+			retryTimes = len(targets) - 1 - targetIdx
+		}
 	}
 
 	// For 429 errors, increase retry attempts to exhaust all available channels
@@ -166,6 +188,24 @@ func Relay(c *gin.Context) {
 			}
 		}
 
+		// the channels of the current target are exhausted, fall back to the next target
+		switchedTarget := false
+		if err != nil && virtualModel != nil {
+			var nextChannel *dbmodel.Channel
+			var nextIdx int
+			nextChannel, nextIdx, err = middleware.SelectVirtualModelChannel(virtualModel, targetIdx+1, userGroup, failedChannels)
+			if err == nil {
+				targets, _ := virtualModel.GetTargets()
+				logger.Logger.Info("falling back to the next target of virtual model",
+					zap.String("virtual_model", virtualModel.Name),
+					zap.String("from_model", originalModel),
+					zap.String("to_model", targets[nextIdx].Model))
+				channel, targetIdx, switchedTarget = nextChannel, nextIdx, true
+				originalModel = targets[nextIdx].Model
+				group = targets[nextIdx].ChannelGroup(userGroup)
+			}
+		}
+
 		if err != nil {
 			logger.Logger.Error("CacheGetRandomSatisfiedChannelExcluding failed",
 				zap.Error(err),
@@ -181,6 +221,12 @@ func Relay(c *gin.Context) {
 
 		logger.Logger.Info(fmt.Sprintf("using channel #%d to retry (remain times %d)", channel.Id, i))
 		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		if switchedTarget {
+			if err = middleware.ApplyVirtualModelTarget(c, virtualModel, targetIdx, userGroup); err != nil {
+				logger.Logger.Error("failed to apply virtual model target", zap.Error(err))
+				break
+			}
+		}
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
@@ -211,9 +257,11 @@ func Relay(c *gin.Context) {
 		}
 		channelName := c.GetString(ctxkey.ChannelName)
 		// Update group and originalModel potentially if changed by middleware, though unlikely for these.
-		group = c.GetString(ctxkey.Group)
+		group = routingGroup(c)
 		originalModel = c.GetString(ctxkey.OriginalModel)
-		go processChannelRelayError(ctx, userId, channelId, channelName, group, originalModel, *bizErr)
+		if bizErr.Code != channelBusyCode {
+			go processChannelRelayError(ctx, userId, channelId, channelName, c.GetInt(ctxkey.Channel), group, originalModel, *bizErr)
+		}
 	}
 
 	if bizErr != nil {
@@ -234,6 +282,46 @@ func Relay(c *gin.Context) {
 	}
 }
 
+// acquireChannelSlot takes one of the in-flight slots of the selected channel, which is held
+// while the upstream request and its response, including streams, are relayed.
+func acquireChannelSlot(c *gin.Context) (release func(), bizErr *model.ErrorWithStatusCode) {
+	channel, ok := c.Value(ctxkey.ChannelModel).(*dbmodel.Channel)
+	if !ok || channel.GetMaxConcurrency() <= 0 {
+		return func() {}, nil
+	}
+	releaseSlot, acquired, err := common.AcquireChannelSlot(c.Request.Context(), channel.Id, channel.GetMaxConcurrency())
+	if err != nil {
+		// do not fail the request because the limit cannot be checked
+		logger.Logger.Warn("failed to acquire channel slot", zap.Int("channel_id", channel.Id), zap.Error(err))
+		return func() {}, nil
+	}
+	if !acquired {
+		return nil, &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: fmt.Sprintf("channel #%d is serving its max concurrency of %d requests", channel.Id, channel.GetMaxConcurrency()),
+				Type:    "one_api_error",
+				Code:    channelBusyCode,
+			},
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+	modelName := c.GetString(ctxkey.OriginalModel)
+	return func() {
+		releaseSlot()
+		// a request waiting for a channel may take the free slot
+		middleware.WakeChannelQueue(modelName)
+	}, nil
+}
+
+// routingGroup returns the group whose channels serve the request,
+// it is the caller's group unless a virtual model target selects another group.
+func routingGroup(c *gin.Context) string {
+	if group := c.GetString(ctxkey.RoutingGroup); group != "" {
+		return group
+	}
+	return c.GetString(ctxkey.Group)
+}
+
 // shouldRetry returns nil if should retry, otherwise returns error
 func shouldRetry(c *gin.Context, statusCode int) error {
 	if specificChannelId := c.GetInt(ctxkey.SpecificChannelId); specificChannelId != 0 {
@@ -300,35 +388,37 @@ func logChannelSuspensionStatus(ctx context.Context, group, model string, failed
 	}
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, group string, originalModel string, err model.ErrorWithStatusCode) {
+func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, channelType int, group string, originalModel string, err model.ErrorWithStatusCode) {
 	logger.Logger.Error(fmt.Sprintf("relay error (channel id %d, name %s, user_id %d, group: %s, model: %s): %s", channelId, channelName, userId, group, originalModel, err.Message))
 
-	// Handle 400 errors differently - they are client request issues, not channel problems
-	if err.StatusCode == http.StatusBadRequest {
-		// For 400 errors, log but don't disable channel or suspend abilities
-		// These are typically schema validation errors or malformed requests
-		logger.Logger.Info(fmt.Sprintf("client request error (400) for channel %d (%s) - not disabling channel as this is not a channel issue", channelId, channelName))
-		// Still emit failure for monitoring purposes, but don't disable the channel
+	// The channel error rules decide whether the error disables or suspends the channel,
+	// the default rules ignore 400 errors and suspend the model on 429 errors
+	rule := monitor.MatchChannelErrorRule(channelId, channelType, &err.Error, err.StatusCode)
+	if rule == nil {
 		monitor.Emit(channelId, false)
 		return
 	}
-
-	if err.StatusCode == http.StatusTooManyRequests {
-		// For 429, we will suspend the specific model for a while
-		logger.Logger.Info(fmt.Sprintf("suspending model %s in group %s on channel %d (%s) due to rate limit", originalModel, group, channelId, channelName))
-		if suspendErr := dbmodel.SuspendAbility(ctx,
-			group, originalModel, channelId,
-			config.ChannelSuspendSecondsFor429); suspendErr != nil {
+	switch rule.Action {
+	case dbmodel.ChannelErrorActionDisable:
+		if !config.AutomaticDisableChannelEnabled {
+			monitor.Emit(channelId, false)
+			return
+		}
+		monitor.DisableChannel(channelId, channelName, originalModel, fmt.Sprintf("%s (rule: %s)", err.Message, rule.Name))
+	case dbmodel.ChannelErrorActionSuspend:
+		logger.Logger.Info(fmt.Sprintf("suspending model %s in group %s on channel %d (%s) for %ds by rule %s", originalModel, group, channelId, channelName, rule.Seconds, rule.Name))
+		if suspendErr := dbmodel.SuspendAbility(ctx, group, originalModel, channelId, rule.Duration()); suspendErr != nil {
 			logger.Logger.Error(fmt.Sprintf("failed to suspend ability for channel %d, model %s, group %s: %v", channelId, originalModel, group, errors.Wrap(suspendErr, "suspend ability failed")))
 		}
-	}
-
-	// Only disable channel for server errors (5xx) or specific client errors that indicate channel issues
-	// 400 errors are client request problems and should not disable channels
-	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
-		monitor.DisableChannel(channelId, channelName, err.Message)
-	} else {
 		monitor.Emit(channelId, false)
+	case dbmodel.ChannelErrorActionKeyCooldown:
+		logger.Logger.Info(fmt.Sprintf("cooling down the key of channel %d (%s) for %ds by rule %s", channelId, channelName, rule.Seconds, rule.Name))
+		if suspendErr := dbmodel.SuspendChannelAbilities(ctx, channelId, rule.Duration()); suspendErr != nil {
+			logger.Logger.Error(fmt.Sprintf("failed to suspend abilities for channel %d: %v", channelId, errors.Wrap(suspendErr, "suspend channel abilities failed")))
+		}
+		monitor.Emit(channelId, false)
+	case dbmodel.ChannelErrorActionIgnore:
+		// the error does not count against the channel
 	}
 }
 
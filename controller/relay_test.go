@@ -4,15 +4,19 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -762,3 +766,83 @@ func TestErrorHandlingWithProperWrapping(t *testing.T) {
 
 	t.Logf("✓ Error wrapping works correctly with github.com/Laisky/errors/v2")
 }
+
+func TestAcquireChannelSlot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalRedis := common.RedisEnabled
+	common.RedisEnabled = false
+	defer func() { common.RedisEnabled = originalRedis }()
+
+	limit := 1
+	channel := &dbmodel.Channel{Id: 4242, MaxConcurrency: &limit}
+	newContext := func() *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		c.Set(ctxkey.ChannelModel, channel)
+		return c
+	}
+
+	release, bizErr := acquireChannelSlot(newContext())
+	assert.Nil(t, bizErr)
+
+	_, bizErr = acquireChannelSlot(newContext())
+	if assert.NotNil(t, bizErr) {
+		assert.Equal(t, http.StatusTooManyRequests, bizErr.StatusCode)
+		assert.Equal(t, channelBusyCode, bizErr.Code)
+	}
+
+	release()
+	release, bizErr = acquireChannelSlot(newContext())
+	assert.Nil(t, bizErr)
+	release()
+
+	// channels without a limit are not tracked
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set(ctxkey.ChannelModel, &dbmodel.Channel{Id: 4243})
+	release, bizErr = acquireChannelSlot(c)
+	assert.Nil(t, bizErr)
+	release()
+}
+
+func TestProcessChannelRelayErrorRules(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&dbmodel.ChannelErrorRule{}))
+	originalDB := dbmodel.DB
+	dbmodel.DB = testDB
+	t.Cleanup(func() {
+		require.NoError(t, testDB.Where("1 = 1").Delete(&dbmodel.ChannelErrorRule{}).Error)
+		dbmodel.InitChannelErrorRuleCache()
+		dbmodel.DB = originalDB
+	})
+	for _, rule := range dbmodel.DefaultChannelErrorRules {
+		rule.Enabled = true
+		require.NoError(t, rule.Insert())
+	}
+	for _, modelName := range []string{"gpt-4o", "gpt-4o-mini"} {
+		require.NoError(t, testDB.Create(&dbmodel.Ability{Group: "default", Model: modelName, ChannelId: 7, Enabled: true}).Error)
+	}
+	suspended := func(modelName string) bool {
+		ability := &dbmodel.Ability{}
+		require.NoError(t, testDB.Where("model = ?", modelName).First(ability).Error)
+		return ability.SuspendUntil != nil && ability.SuspendUntil.After(time.Now())
+	}
+	relayError := func(statusCode int) model.ErrorWithStatusCode {
+		return model.ErrorWithStatusCode{StatusCode: statusCode, Error: model.Error{Message: "upstream error", Type: "upstream_error"}}
+	}
+	ctx := context.Background()
+
+	// the default rules ignore 400 errors and suspend the model on 429 errors
+	processChannelRelayError(ctx, 1, 7, "test", 1, "default", "gpt-4o", relayError(http.StatusBadRequest))
+	assert.False(t, suspended("gpt-4o"))
+	processChannelRelayError(ctx, 1, 7, "test", 1, "default", "gpt-4o", relayError(http.StatusTooManyRequests))
+	assert.True(t, suspended("gpt-4o"))
+	assert.False(t, suspended("gpt-4o-mini"))
+
+	// a rule of the admin overrides the default for 400 errors
+	rule := &dbmodel.ChannelErrorRule{Name: "context too long", StatusCode: http.StatusBadRequest,
+		Action: dbmodel.ChannelErrorActionSuspend, Seconds: 60, Priority: 1, Enabled: true}
+	require.NoError(t, rule.Insert())
+	processChannelRelayError(ctx, 1, 7, "test", 1, "default", "gpt-4o-mini", relayError(http.StatusBadRequest))
+	assert.True(t, suspended("gpt-4o-mini"))
+}
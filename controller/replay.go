@@ -0,0 +1,271 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/controller"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// maxReplayTargets caps the number of channels a request is replayed on at once.
+const maxReplayTargets = 10
+
+// ReplayRequest is the body of ReplayRequests. The replayed request is either the
+// captured transcript of RequestId or Body, a request to Path.
+type ReplayRequest struct {
+	RequestId string          `json:"request_id"`
+	Body      json.RawMessage `json:"body"`
+	// Path is the relay path of Body, /v1/chat/completions by default
+	Path    string         `json:"path"`
+	Targets []ReplayTarget `json:"targets"`
+}
+
+// ReplayTarget is a channel a request is replayed on. Model replaces the model of the
+// request, the channel must serve it.
+type ReplayTarget struct {
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+}
+
+// ReplayResult is the outcome of a replay on a target.
+type ReplayResult struct {
+	ChannelId        int    `json:"channel_id"`
+	ChannelName      string `json:"channel_name"`
+	Model            string `json:"model"`
+	Latency          int64  `json:"latency"` // ms
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	// Quota is what the request would have cost at the channel's model prices
+	Quota    int64           `json:"quota"`
+	Content  string          `json:"content"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// ReplayRequests runs a captured or given chat completion or completion request on the
+// target channels through the adaptors and returns the responses side by side. Streams
+// are replayed as complete responses. Replays are logged as channel tests, no user is billed.
+func ReplayRequests(c *gin.Context) {
+	var req ReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	mode, request, err := loadReplayRequest(&req)
+	if err == nil && len(req.Targets) == 0 {
+		err = errors.New("at least one target is required")
+	}
+	if err == nil && len(req.Targets) > maxReplayTargets {
+		err = errors.Errorf("at most %d targets are allowed", maxReplayTargets)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	results := make([]*ReplayResult, len(req.Targets))
+	var wg sync.WaitGroup
+	for i, target := range req.Targets {
+		// every target gets its own copy, the adaptors modify the request
+		var targetRequest relaymodel.GeneralOpenAIRequest
+		encoded, _ := json.Marshal(request)
+		_ = json.Unmarshal(encoded, &targetRequest)
+		wg.Add(1)
+		go func(i int, target ReplayTarget) {
+			defer wg.Done()
+			results[i] = replayOnChannel(c.Request.Context(), req.RequestId, mode, target, &targetRequest)
+		}(i, target)
+	}
+	wg.Wait()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    results,
+	})
+}
+
+// loadReplayRequest returns the relay mode and the request to replay.
+func loadReplayRequest(req *ReplayRequest) (int, *relaymodel.GeneralOpenAIRequest, error) {
+	body, path := []byte(req.Body), req.Path
+	switch {
+	case req.RequestId != "" && len(req.Body) > 0:
+		return 0, nil, errors.New("either request_id or body is required, not both")
+	case req.RequestId != "":
+		transcript, err := model.GetTranscriptByRequestId(req.RequestId)
+		if err != nil {
+			return 0, nil, err
+		}
+		if transcript.RequestTruncated {
+			return 0, nil, errors.Errorf("the captured body of request %s was truncated, replay it with body", req.RequestId)
+		}
+		body, path = []byte(transcript.RequestBody), transcript.Path
+	case len(req.Body) == 0:
+		return 0, nil, errors.New("request_id or body is required")
+	}
+	if path == "" {
+		path = "/v1/chat/completions"
+	}
+	mode := relaymode.GetByPath(path)
+	if mode != relaymode.ChatCompletions && mode != relaymode.Completions {
+		return 0, nil, errors.Errorf("only chat completions and completions can be replayed, got %s", path)
+	}
+
+	request := &relaymodel.GeneralOpenAIRequest{}
+	if err := json.Unmarshal(body, request); err != nil {
+		return 0, nil, errors.Wrap(err, "unmarshal replayed request")
+	}
+	request.Stream = false
+	request.StreamOptions = nil
+	return mode, request, nil
+}
+
+// replayOnChannel sends the request to the target channel like testChannel does.
+func replayOnChannel(ctx context.Context, requestId string, mode int, target ReplayTarget, request *relaymodel.GeneralOpenAIRequest) *ReplayResult {
+	result := &ReplayResult{ChannelId: target.ChannelId, Model: request.Model}
+	if target.Model != "" {
+		result.Model = target.Model
+	}
+	channel, err := model.GetChannelById(target.ChannelId, true)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ChannelName = channel.Name
+	if !channelServesModel(channel, result.Model) {
+		result.Error = fmt.Sprintf("channel %s does not serve model %s", channel.Name, result.Model)
+		return result
+	}
+
+	startTime := time.Now()
+	path := "/v1/chat/completions"
+	if mode == relaymode.Completions {
+		path = "/v1/completions"
+	}
+	c, w := newTestContext(channel, path)
+	c.Request = c.Request.WithContext(ctx)
+	c.Set(ctxkey.RequestModel, result.Model)
+	relayMeta := meta.GetByContext(c)
+	setInferenceProfileArn(channel, relayMeta, relayMeta.ActualModelName)
+	request.Model = relayMeta.ActualModelName
+
+	usage, err := doReplay(c, relayMeta, mode, request)
+	result.Latency = time.Since(startTime).Milliseconds()
+	if usage != nil {
+		result.PromptTokens = usage.PromptTokens
+		result.CompletionTokens = usage.CompletionTokens
+		result.Quota = calculateTestCost(usage, relayMeta, request)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Response, result.Content = replayResponse(w.Body.Bytes())
+	}
+
+	logContent := fmt.Sprintf("replay of request %s on channel %s", requestId, channel.Name)
+	if requestId == "" {
+		logContent = fmt.Sprintf("replay on channel %s", channel.Name)
+	}
+	if err != nil {
+		logContent += fmt.Sprintf(" failed: %s", err.Error())
+	}
+	go model.RecordTestLog(context.Background(), &model.Log{
+		ChannelId:        channel.Id,
+		ModelName:        result.Model,
+		Content:          logContent,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+		Quota:            int(result.Quota),
+		ElapsedTime:      helper.CalcElapsedTime(startTime),
+	})
+	return result
+}
+
+// doReplay converts and sends the request and writes the converted response to the
+// recorder of the context.
+func doReplay(c *gin.Context, relayMeta *meta.Meta, mode int, request *relaymodel.GeneralOpenAIRequest) (*relaymodel.Usage, error) {
+	adaptor := relay.GetAdaptor(relayMeta.APIType)
+	if adaptor == nil {
+		return nil, errors.Errorf("invalid api type: %d, adaptor is nil", relayMeta.APIType)
+	}
+	adaptor.Init(relayMeta)
+	convertedRequest, err := adaptor.ConvertRequest(c, mode, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert request")
+	}
+	c.Set(ctxkey.ConvertedRequest, convertedRequest)
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal converted request")
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(jsonData))
+
+	resp, err := adaptor.DoRequest(c, relayMeta, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, errors.Wrap(err, "do request")
+	}
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		wrappedErr := controller.RelayErrorHandler(resp)
+		return nil, errors.Errorf("http status code: %d, error message: %s", resp.StatusCode, wrappedErr.Error.Message)
+	}
+	usage, respErr := adaptor.DoResponse(c, resp, relayMeta)
+	if respErr != nil {
+		return usage, errors.New(respErr.Error.Message)
+	}
+	return usage, nil
+}
+
+// channelServesModel reports whether the model is one of the models of the channel.
+func channelServesModel(channel *model.Channel, modelName string) bool {
+	for _, m := range strings.Split(channel.Models, ",") {
+		if strings.TrimSpace(m) == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+// replayResponse returns the response body and the text of its first choice.
+func replayResponse(body []byte) (json.RawMessage, string) {
+	if !json.Valid(body) {
+		encoded, _ := json.Marshal(string(body))
+		return encoded, ""
+	}
+	var response struct {
+		Choices []struct {
+			Text    string `json:"text"`
+			Message struct {
+				Content any `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || len(response.Choices) == 0 {
+		return body, ""
+	}
+	if content, ok := response.Choices[0].Message.Content.(string); ok {
+		return body, content
+	}
+	return body, response.Choices[0].Text
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestReplayRequests(t *testing.T) {
+	var upstreamRequest map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&upstreamRequest))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","object":"chat.completion","model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":"4"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}`))
+	}))
+	defer upstream.Close()
+	originalClient := client.HTTPClient
+	client.HTTPClient = http.DefaultClient
+	defer func() { client.HTTPClient = originalClient }()
+
+	testDB := setupTestDB(t)
+	sqlDB, err := testDB.DB()
+	require.NoError(t, err)
+	// the test logs are written from other goroutines
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, testDB.AutoMigrate(&model.Transcript{}))
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	model.DB, model.LOG_DB = testDB, testDB
+	defer func() { model.DB, model.LOG_DB = originalDB, originalLogDB }()
+
+	baseURL := upstream.URL
+	mapping := `{"fast":"gpt-4o-mini"}`
+	require.NoError(t, testDB.Create(&model.Channel{Id: 1, Name: "openai", Type: channeltype.OpenAICompatible, Key: "sk-test",
+		BaseURL: &baseURL, Models: "gpt-4o,fast", ModelMapping: &mapping, Status: model.ChannelStatusEnabled}).Error)
+	require.NoError(t, (&model.Transcript{RequestId: "req-1", Path: "/v1/chat/completions",
+		RequestBody: `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"2 + 2 = ?"}]}`}).Insert())
+	require.NoError(t, (&model.Transcript{RequestId: "req-2", RequestTruncated: true, RequestBody: `{"mod`}).Insert())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/channel/replay", ReplayRequests)
+	replay := func(body string) (response struct {
+		Success bool            `json:"success"`
+		Message string          `json:"message"`
+		Data    []*ReplayResult `json:"data"`
+	}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/channel/replay", bytes.NewBufferString(body)))
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	response := replay(`{"request_id":"req-1","targets":[{"channel_id":1,"model":"fast"},{"channel_id":1,"model":"claude-sonnet-4-0"},{"channel_id":2}]}`)
+	require.True(t, response.Success, response.Message)
+	require.Len(t, response.Data, 3)
+	fast := response.Data[0]
+	assert.Empty(t, fast.Error)
+	assert.Equal(t, "fast", fast.Model)
+	assert.Equal(t, "4", fast.Content)
+	assert.Equal(t, 10, fast.PromptTokens)
+	assert.Positive(t, fast.Quota)
+	assert.Contains(t, string(fast.Response), `"finish_reason":"stop"`)
+	// the mapped model is sent, and streams are replayed as complete responses
+	assert.Equal(t, "gpt-4o-mini", upstreamRequest["model"])
+	assert.NotEqual(t, true, upstreamRequest["stream"])
+	assert.Contains(t, response.Data[1].Error, "does not serve model claude-sonnet-4-0")
+	assert.NotEmpty(t, response.Data[2].Error)
+
+	// replays are logged as tests, the original user is not billed
+	require.Eventually(t, func() bool {
+		var count int64
+		testDB.Model(&model.Log{}).Where("type = ?", model.LogTypeTest).Count(&count)
+		return count == 1
+	}, time.Second, 10*time.Millisecond)
+	var users int64
+	require.NoError(t, testDB.Model(&model.Log{}).Where("user_id <> 0").Count(&users).Error)
+	assert.Zero(t, users)
+
+	assert.Contains(t, replay(`{"request_id":"req-2","targets":[{"channel_id":1}]}`).Message, "truncated")
+	assert.Contains(t, replay(`{"body":{"model":"gpt-4o"},"path":"/v1/embeddings","targets":[{"channel_id":1}]}`).Message, "only chat completions")
+	assert.Contains(t, replay(`{"body":{"model":"gpt-4o"}}`).Message, "at least one target")
+}
@@ -0,0 +1,367 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// filter is a parsed SCIM filter (RFC 7644 3.4.2.2), it is matched against resources
+// in their JSON form.
+type filter interface {
+	match(resource map[string]any) bool
+}
+
+type logicalFilter struct {
+	and         bool
+	left, right filter
+}
+
+func (f logicalFilter) match(resource map[string]any) bool {
+	if f.and {
+		return f.left.match(resource) && f.right.match(resource)
+	}
+	return f.left.match(resource) || f.right.match(resource)
+}
+
+type notFilter struct {
+	filter filter
+}
+
+func (f notFilter) match(resource map[string]any) bool {
+	return !f.filter.match(resource)
+}
+
+// attributeFilter compares the values of an attribute, op is one of the SCIM operators
+// in lower case.
+type attributeFilter struct {
+	attr, sub string
+	op        string
+	value     any
+}
+
+func (f attributeFilter) match(resource map[string]any) bool {
+	values := attributeValues(resource, f.attr, f.sub)
+	switch f.op {
+	case "pr":
+		return len(values) > 0
+	case "ne":
+		return !attributeFilter{attr: f.attr, sub: f.sub, op: "eq", value: f.value}.match(resource)
+	case "eq":
+		if f.value == nil {
+			return len(values) == 0
+		}
+	}
+	for _, value := range values {
+		if compareValue(value, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valuePathFilter matches resources with a value of the multi-valued attribute that
+// matches the filter, e.g. emails[type eq "work" and value co "@example.com"].
+type valuePathFilter struct {
+	attr   string
+	filter filter
+}
+
+func (f valuePathFilter) match(resource map[string]any) bool {
+	for _, value := range attributeValues(resource, f.attr, "") {
+		if object, ok := value.(map[string]any); ok && f.filter.match(object) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeValues returns the values of the attribute, multi-valued attributes are
+// flattened. Attribute names are case insensitive.
+func attributeValues(resource map[string]any, attr string, sub string) []any {
+	value, ok := lookup(resource, attr)
+	if !ok {
+		return nil
+	}
+	var values []any
+	if list, ok := value.([]any); ok {
+		values = list
+	} else {
+		values = []any{value}
+	}
+	if sub == "" {
+		return values
+	}
+	var subValues []any
+	for _, value := range values {
+		if object, ok := value.(map[string]any); ok {
+			if subValue, ok := lookup(object, sub); ok {
+				subValues = append(subValues, subValue)
+			}
+		}
+	}
+	return subValues
+}
+
+func lookup(object map[string]any, name string) (any, bool) {
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value, value != nil
+		}
+	}
+	return nil, false
+}
+
+// compareValue compares strings case insensitively, as the attributes of the User and
+// Group schemas are not case exact apart from id.
+func compareValue(value any, op string, target any) bool {
+	switch target := target.(type) {
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		s, target = strings.ToLower(s), strings.ToLower(target)
+		switch op {
+		case "eq":
+			return s == target
+		case "co":
+			return strings.Contains(s, target)
+		case "sw":
+			return strings.HasPrefix(s, target)
+		case "ew":
+			return strings.HasSuffix(s, target)
+		case "gt":
+			return s > target
+		case "ge":
+			return s >= target
+		case "lt":
+			return s < target
+		case "le":
+			return s <= target
+		}
+	case bool:
+		b, ok := value.(bool)
+		return ok && op == "eq" && b == target
+	case float64:
+		n, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return n == target
+		case "gt":
+			return n > target
+		case "ge":
+			return n >= target
+		case "lt":
+			return n < target
+		case "le":
+			return n <= target
+		}
+	}
+	return false
+}
+
+var filterOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// parseFilter parses a SCIM filter, e.g. userName eq "alice" and not (emails pr).
+func parseFilter(expression string) (filter, error) {
+	tokens, err := tokenizeFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.Errorf("unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type filterToken struct {
+	text string
+	// quoted tokens are string values
+	quoted bool
+}
+
+func tokenizeFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, filterToken{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(expression) && expression[end] != '"'; end++ {
+				if expression[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expression) {
+				return nil, errors.New("unterminated string in filter")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(expression[i:end+1]), &value); err != nil {
+				return nil, errors.Wrap(err, "invalid string in filter")
+			}
+			tokens = append(tokens, filterToken{text: value, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for ; end < len(expression) && !strings.ContainsRune(" \t\n()[]\"", rune(expression[end])); end++ {
+			}
+			tokens = append(tokens, filterToken{text: expression[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// keyword reports whether the next token is the unquoted keyword, and consumes it.
+func (p *filterParser) keyword(keyword string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, errors.New("unexpected end of filter")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.keyword(text) {
+		return errors.Errorf("expected %q in filter", text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.keyword("or") {
+		var right filter
+		if right, err = p.parseAnd(); err == nil {
+			left = logicalFilter{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filter, error) {
+	left, err := p.parseFactor()
+	for err == nil && p.keyword("and") {
+		var right filter
+		if right, err = p.parseFactor(); err == nil {
+			left = logicalFilter{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseFactor() (filter, error) {
+	if p.keyword("not") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := p.parseOr()
+		if err == nil {
+			err = p.expect(")")
+		}
+		return notFilter{filter: f}, err
+	}
+	if p.keyword("(") {
+		f, err := p.parseOr()
+		if err == nil {
+			err = p.expect(")")
+		}
+		return f, err
+	}
+
+	token, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if token.quoted {
+		return nil, errors.Errorf("expected an attribute in filter, got %q", token.text)
+	}
+	attr, sub := splitAttributePath(token.text)
+	if p.keyword("[") {
+		f, err := p.parseOr()
+		if err == nil {
+			err = p.expect("]")
+		}
+		return valuePathFilter{attr: attr, filter: f}, err
+	}
+
+	token, err = p.next()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(token.text)
+	if token.quoted || !filterOperators[op] {
+		return nil, errors.Errorf("unknown filter operator %q", token.text)
+	}
+	f := attributeFilter{attr: attr, sub: sub, op: op}
+	if op == "pr" {
+		return f, nil
+	}
+	if token, err = p.next(); err != nil {
+		return nil, err
+	}
+	if f.value, err = parseFilterValue(token); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseFilterValue(token filterToken) (any, error) {
+	if token.quoted {
+		return token.text, nil
+	}
+	switch strings.ToLower(token.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(token.text, 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid filter value %q", token.text)
+	}
+	return number, nil
+}
+
+// splitAttributePath splits an attribute path into the attribute and sub-attribute,
+// dropping the schema URN, e.g. urn:ietf:params:scim:schemas:core:2.0:User:name.givenName.
+func splitAttributePath(path string) (attr string, sub string) {
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	attr, sub, _ = strings.Cut(path, ".")
+	return attr, sub
+}
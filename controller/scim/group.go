@@ -0,0 +1,356 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// Group is the SCIM representation of a model.Group, its members are the users in it.
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id"`
+	DisplayName string      `json:"displayName"`
+	Members     []Reference `json:"members"`
+	Meta        Meta        `json:"meta"`
+}
+
+func groupResource(c *gin.Context, group *model.Group, members []*model.User) *Group {
+	resource := &Group{
+		Schemas:     []string{SchemaGroup},
+		Id:          group.Name,
+		DisplayName: group.Name,
+		Members:     make([]Reference, 0, len(members)),
+		Meta: Meta{
+			ResourceType: "Group",
+			Location:     location(c, "/Groups/"+group.Name),
+		},
+	}
+	if group.CreatedTime != 0 {
+		resource.Meta.Created = timestamp(group.CreatedTime)
+	}
+	if group.UpdatedTime != 0 {
+		resource.Meta.LastModified = timestamp(group.UpdatedTime)
+	}
+	for _, member := range members {
+		id := strconv.Itoa(member.Id)
+		resource.Members = append(resource.Members, Reference{
+			Value:   id,
+			Ref:     location(c, "/Users/"+id),
+			Display: member.Username,
+		})
+	}
+	return resource
+}
+
+// getGroup returns the group of the id in the path with its members.
+func getGroup(c *gin.Context) (*model.Group, []*model.User, bool) {
+	group, err := model.GetGroupByName(c.Param("id"))
+	if err != nil {
+		AbortWithError(c, http.StatusNotFound, "", fmt.Sprintf("group %s not found", c.Param("id")))
+		return nil, nil, false
+	}
+	members, err := model.GetGroupUsers(group.Name)
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return nil, nil, false
+	}
+	return group, members, true
+}
+
+// memberIds returns the user ids of a members value, the users must exist.
+func memberIds(value any) ([]int, error) {
+	var members []any
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		members = value
+	case map[string]any:
+		members = []any{value}
+	default:
+		return nil, errors.New("members must be a list")
+	}
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		object, _ := member.(map[string]any)
+		raw := fmt.Sprint(object["value"])
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errors.Errorf("invalid member %q", raw)
+		}
+		user, err := model.GetUserById(id, false)
+		if err != nil || user.Status == model.UserStatusDeleted {
+			return nil, errors.Errorf("member %d not found", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// groupChange collects the membership changes of a request.
+type groupChange struct {
+	group   *model.Group
+	members map[int]bool
+}
+
+func newGroupChange(group *model.Group, members []*model.User) *groupChange {
+	ch := &groupChange{group: group, members: make(map[int]bool, len(members))}
+	for _, member := range members {
+		ch.members[member.Id] = true
+	}
+	return ch
+}
+
+// set applies an operation on an attribute of the group.
+func (ch *groupChange) set(op string, attr string, f filter, value any) error {
+	switch strings.ToLower(attr) {
+	case "displayname":
+		if op == "remove" {
+			return errors.New("displayName is required")
+		}
+		name, err := stringValue("displayName", value)
+		if err == nil && name != ch.group.Name {
+			err = errors.New("groups cannot be renamed, channels refer to them by name")
+		}
+		return err
+	case "members":
+		if f != nil {
+			if op != "remove" {
+				return errors.New("members can only be removed by a filter")
+			}
+			for id := range ch.members {
+				if f.match(map[string]any{"value": strconv.Itoa(id)}) {
+					delete(ch.members, id)
+				}
+			}
+			return nil
+		}
+		ids, err := memberIds(value)
+		if err != nil {
+			return err
+		}
+		switch {
+		case op == "replace" || (op == "remove" && value == nil):
+			ch.members = make(map[int]bool, len(ids))
+			for _, id := range ids {
+				ch.members[id] = true
+			}
+		case op == "remove":
+			for _, id := range ids {
+				delete(ch.members, id)
+			}
+		default:
+			for _, id := range ids {
+				ch.members[id] = true
+			}
+		}
+	}
+	return nil
+}
+
+// save moves the new members to the group and the removed members to the default group.
+func (ch *groupChange) save(previous []*model.User) error {
+	var added, removed []int
+	current := make(map[int]bool, len(previous))
+	for _, member := range previous {
+		current[member.Id] = true
+		if !ch.members[member.Id] {
+			removed = append(removed, member.Id)
+		}
+	}
+	for id := range ch.members {
+		if !current[id] {
+			added = append(added, id)
+		}
+	}
+	if ch.group.Name == model.DefaultGroupName && len(removed) > 0 {
+		return errors.New("users cannot be removed from the default group, add them to another group instead")
+	}
+	if err := model.SetUsersGroup(removed, model.DefaultGroupName); err != nil {
+		return err
+	}
+	return model.SetUsersGroup(added, ch.group.Name)
+}
+
+// respondGroup responds with the group as it is stored now.
+func respondGroup(c *gin.Context, status int, group *model.Group) {
+	members, err := model.GetGroupUsers(group.Name)
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	resource := groupResource(c, group, members)
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	respond(c, status, resource)
+}
+
+func GetGroups(c *gin.Context) {
+	groups, err := model.GetAllGroups()
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	users, err := model.GetAllUsersForProvisioning()
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	members := make(map[string][]*model.User)
+	for _, user := range users {
+		members[user.Group] = append(members[user.Group], user)
+	}
+	resources := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, toMap(groupResource(c, group, members[group.Name])))
+	}
+	listResources(c, resources)
+}
+
+func GetGroup(c *gin.Context) {
+	group, members, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	resource := toMap(groupResource(c, group, members))
+	project(resource, c.Query("attributes"), c.Query("excludedAttributes"))
+	respond(c, http.StatusOK, resource)
+}
+
+// CreateGroup creates a group named by displayName, without settings, and moves its
+// members to it.
+func CreateGroup(c *gin.Context) {
+	body, ok := decodeBody(c)
+	if !ok {
+		return
+	}
+	displayName, _ := lookup(body, "displayName")
+	name, err := stringValue("displayName", displayName)
+	if err != nil || !model.ValidGroupName(name) {
+		AbortWithError(c, http.StatusBadRequest, "invalidValue", fmt.Sprintf("invalid group name %q", name))
+		return
+	}
+	if _, err = model.GetGroupByName(name); err == nil {
+		AbortWithError(c, http.StatusConflict, "uniqueness", fmt.Sprintf("group %s already exists", name))
+		return
+	}
+	members, _ := lookup(body, "members")
+	ch := newGroupChange(&model.Group{Name: name}, nil)
+	if err = ch.set("add", "members", nil, members); err != nil {
+		AbortWithError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	if err = ch.group.Insert(); err == nil {
+		err = ch.save(nil)
+	}
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	respondGroup(c, http.StatusCreated, ch.group)
+}
+
+// ReplaceGroup replaces the members of a group.
+func ReplaceGroup(c *gin.Context) {
+	group, previous, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	body, ok := decodeBody(c)
+	if !ok {
+		return
+	}
+	ch := newGroupChange(group, previous)
+	displayName, _ := lookup(body, "displayName")
+	members, _ := lookup(body, "members")
+	err := ch.set("replace", "displayName", nil, displayName)
+	if err == nil {
+		err = ch.set("replace", "members", nil, members)
+	}
+	if err != nil {
+		AbortWithError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	if err = ch.save(previous); err != nil {
+		AbortWithError(c, http.StatusBadRequest, "mutability", err.Error())
+		return
+	}
+	respondGroup(c, http.StatusOK, group)
+}
+
+// PatchGroup applies the operations of a PATCH request to the members of a group.
+func PatchGroup(c *gin.Context) {
+	group, previous, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	operations, ok := decodePatch(c)
+	if !ok {
+		return
+	}
+	ch := newGroupChange(group, previous)
+	for _, operation := range operations {
+		var err error
+		if operation.Path == "" {
+			object, ok := operation.Value.(map[string]any)
+			if !ok {
+				AbortWithError(c, http.StatusBadRequest, "noTarget", "an operation without path needs an object value")
+				return
+			}
+			for key, value := range object {
+				if err = ch.set(operation.Op, key, nil, value); err != nil {
+					break
+				}
+			}
+		} else {
+			var path patchPath
+			if path, err = parsePatchPath(operation.Path); err != nil {
+				AbortWithError(c, http.StatusBadRequest, "invalidPath", err.Error())
+				return
+			}
+			err = ch.set(operation.Op, path.attr, path.filter, operation.Value)
+		}
+		if err != nil {
+			AbortWithError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	if err := ch.save(previous); err != nil {
+		AbortWithError(c, http.StatusBadRequest, "mutability", err.Error())
+		return
+	}
+	respondGroup(c, http.StatusOK, group)
+}
+
+// DeleteGroup moves the members of a group to the default group and deletes it.
+func DeleteGroup(c *gin.Context) {
+	group, members, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	if group.Name == model.DefaultGroupName {
+		AbortWithError(c, http.StatusBadRequest, "mutability", "the default group cannot be deleted")
+		return
+	}
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.Id)
+	}
+	err := model.SetUsersGroup(ids, model.DefaultGroupName)
+	if err == nil {
+		err = group.Delete()
+	}
+	if err != nil {
+		AbortWithError(c, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,308 @@
+// Package scim implements a SCIM 2.0 service provider (RFC 7643, RFC 7644), so that
+// identity providers can provision users and their groups.
+//
+// SCIM users are model.User, identified by their id, and SCIM groups are model.Group,
+// identified by their name. A user is a member of exactly one group, their Group.
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// ContentType is the media type of SCIM messages.
+const ContentType = "application/scim+json"
+
+// maxResults bounds the page size of list responses.
+const maxResults = 1000
+
+// Error is a SCIM error response.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// AbortWithError responds with a SCIM error, scimType is one of the error types of
+// RFC 7644 3.12 or "".
+func AbortWithError(c *gin.Context, status int, scimType string, detail string) {
+	respond(c, status, Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+	c.Abort()
+}
+
+func respond(c *gin.Context, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, ContentType, body)
+}
+
+// Meta is the metadata of a resource.
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location"`
+}
+
+type listResponse struct {
+	Schemas      []string         `json:"schemas"`
+	TotalResults int              `json:"totalResults"`
+	StartIndex   int              `json:"startIndex"`
+	ItemsPerPage int              `json:"itemsPerPage"`
+	Resources    []map[string]any `json:"Resources"`
+}
+
+// location returns the URL of the resource, on the server address if it is configured.
+func location(c *gin.Context, path string) string {
+	base := strings.TrimSuffix(config.ServerAddress, "/")
+	if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+	return base + "/scim/v2" + path
+}
+
+// timestamp formats a unix timestamp as SCIM dateTime.
+func timestamp(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+// toMap returns the JSON form of the resource, which filters and projections work on.
+func toMap(resource any) map[string]any {
+	body, _ := json.Marshal(resource)
+	object := map[string]any{}
+	_ = json.Unmarshal(body, &object)
+	return object
+}
+
+// listResources filters, pages and projects the resources as the query asks.
+func listResources(c *gin.Context, resources []map[string]any) {
+	if expression := c.Query("filter"); expression != "" {
+		f, err := parseFilter(expression)
+		if err != nil {
+			AbortWithError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		matched := resources[:0]
+		for _, resource := range resources {
+			if f.match(resource) {
+				matched = append(matched, resource)
+			}
+		}
+		resources = matched
+	}
+
+	startIndex, count := 1, maxResults
+	if value := c.Query("startIndex"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 1 {
+			startIndex = n
+		}
+	}
+	if value := c.Query("count"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 && n < maxResults {
+			count = n
+		}
+	}
+	total := len(resources)
+	page := resources[min(startIndex-1, total):min(startIndex-1+count, total)]
+	for _, resource := range page {
+		project(resource, c.Query("attributes"), c.Query("excludedAttributes"))
+	}
+	respond(c, http.StatusOK, listResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// project keeps the top level attributes the client asked for, id, schemas and meta are
+// always returned.
+func project(resource map[string]any, attributes string, excludedAttributes string) {
+	split := func(list string) map[string]bool {
+		names := map[string]bool{}
+		for _, name := range strings.Split(list, ",") {
+			if attr, _ := splitAttributePath(strings.TrimSpace(name)); attr != "" {
+				names[strings.ToLower(attr)] = true
+			}
+		}
+		return names
+	}
+	included, excluded := split(attributes), split(excludedAttributes)
+	for key := range resource {
+		switch lower := strings.ToLower(key); {
+		case lower == "id" || lower == "schemas" || lower == "meta":
+		case len(included) > 0 && !included[lower], excluded[lower]:
+			delete(resource, key)
+		}
+	}
+}
+
+// decodeBody decodes the JSON body of the request into an object.
+func decodeBody(c *gin.Context) (map[string]any, bool) {
+	body := map[string]any{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+		AbortWithError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return nil, false
+	}
+	return body, true
+}
+
+// patchOperation is an operation of a PATCH request.
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// patchPath is the parsed path of a patch operation, e.g. emails[type eq "work"].value.
+type patchPath struct {
+	attr   string
+	filter filter
+	sub    string
+}
+
+func parsePatchPath(path string) (patchPath, error) {
+	open := strings.Index(path, "[")
+	if open < 0 {
+		attr, sub := splitAttributePath(path)
+		return patchPath{attr: attr, sub: sub}, nil
+	}
+	closing := strings.LastIndex(path, "]")
+	if closing < open {
+		return patchPath{}, errors.Errorf("invalid path %q", path)
+	}
+	f, err := parseFilter(path[open+1 : closing])
+	if err != nil {
+		return patchPath{}, err
+	}
+	attr, _ := splitAttributePath(path[:open])
+	return patchPath{attr: attr, filter: f, sub: strings.TrimPrefix(path[closing+1:], ".")}, nil
+}
+
+// decodePatch decodes the operations of a PATCH request, operation names are lower
+// cased as some clients send Replace or Add.
+func decodePatch(c *gin.Context) ([]patchOperation, bool) {
+	var request struct {
+		Schemas    []string         `json:"schemas"`
+		Operations []patchOperation `json:"Operations"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		AbortWithError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return nil, false
+	}
+	for i := range request.Operations {
+		request.Operations[i].Op = strings.ToLower(request.Operations[i].Op)
+		switch request.Operations[i].Op {
+		case "add", "replace", "remove":
+		default:
+			AbortWithError(c, http.StatusBadRequest, "invalidSyntax", "unknown patch operation "+request.Operations[i].Op)
+			return nil, false
+		}
+	}
+	return request.Operations, true
+}
+
+// boolValue reads a boolean sent as JSON boolean or, by some clients, as string.
+func boolValue(value any) (bool, error) {
+	switch value := value.(type) {
+	case bool:
+		return value, nil
+	case string:
+		return strconv.ParseBool(value)
+	}
+	return false, errors.Errorf("invalid boolean %v", value)
+}
+
+// stringValue reads a string attribute, null clears it.
+func stringValue(name string, value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(value), nil
+	}
+	return "", errors.Errorf("%s must be a string", name)
+}
+
+// GetServiceProviderConfig describes the SCIM features the server supports.
+func GetServiceProviderConfig(c *gin.Context) {
+	respond(c, http.StatusOK, gin.H{
+		"schemas":          []string{SchemaServiceProviderConfig},
+		"documentationUri": "https://github.com/songquanpeng/one-api",
+		"patch":            gin.H{"supported": true},
+		"bulk":             gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           gin.H{"supported": true, "maxResults": maxResults},
+		"changePassword":   gin.H{"supported": true},
+		"sort":             gin.H{"supported": false},
+		"etag":             gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "The SCIMToken option of the gateway",
+		}},
+		"meta": gin.H{"resourceType": "ServiceProviderConfig", "location": location(c, "/ServiceProviderConfig")},
+	})
+}
+
+// GetResourceTypes lists the resource types the server provides.
+func GetResourceTypes(c *gin.Context) {
+	resourceTypes := []map[string]any{
+		{
+			"schemas":     []string{SchemaResourceType},
+			"id":          "User",
+			"name":        "User",
+			"endpoint":    "/Users",
+			"description": "User Account",
+			"schema":      SchemaUser,
+			"meta":        gin.H{"resourceType": "ResourceType", "location": location(c, "/ResourceTypes/User")},
+		},
+		{
+			"schemas":     []string{SchemaResourceType},
+			"id":          "Group",
+			"name":        "Group",
+			"endpoint":    "/Groups",
+			"description": "Group",
+			"schema":      SchemaGroup,
+			"meta":        gin.H{"resourceType": "ResourceType", "location": location(c, "/ResourceTypes/Group")},
+		},
+	}
+	respond(c, http.StatusOK, listResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resourceTypes),
+		StartIndex:   1,
+		ItemsPerPage: len(resourceTypes),
+		Resources:    resourceTypes,
+	})
+}
@@ -0,0 +1,299 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestParseFilter(t *testing.T) {
+	alice := toMap(map[string]any{
+		"userName": "Alice",
+		"active":   true,
+		"name":     map[string]any{"givenName": "Alice"},
+		"emails":   []any{map[string]any{"value": "alice@example.com", "type": "work"}},
+		"meta":     map[string]any{"lastModified": "2024-05-01T00:00:00Z"},
+	})
+	for expression, expected := range map[string]bool{
+		`userName eq "alice"`: true,
+		`USERNAME Eq "alice"`: true,
+		`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "al"`: true,
+		`userName ne "alice"`:                                 false,
+		`name.givenName co "lic"`:                             true,
+		`emails.value ew "@example.com"`:                      true,
+		`emails[type eq "work" and value co "alice"]`:         true,
+		`emails[type eq "home"]`:                              false,
+		`active eq true and not (userName eq "bob")`:          true,
+		`userName eq "bob" or active eq true and title pr`:    false,
+		`(userName eq "bob" or active eq true) and emails pr`: true,
+		`meta.lastModified gt "2024-01-01T00:00:00Z"`:         true,
+		`title eq null`:                                       true,
+	} {
+		f, err := parseFilter(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, expected, f.match(alice), expression)
+	}
+	for _, expression := range []string{``, `userName`, `userName eq`, `userName like "a"`, `(userName eq "a"`, `userName eq "a`, `"a" eq "a"`} {
+		_, err := parseFilter(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+type scimClient struct {
+	t      *testing.T
+	router *gin.Engine
+}
+
+func (s scimClient) do(method string, path string, body any) (int, map[string]any) {
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		require.NoError(s.t, err)
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", ContentType)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	response := map[string]any{}
+	if w.Body.Len() > 0 {
+		assert.Equal(s.t, ContentType, w.Header().Get("Content-Type"))
+		require.NoError(s.t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	}
+	return w.Code, response
+}
+
+func setupSCIM(t *testing.T) scimClient {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}, &model.Log{}, &model.Group{},
+		&model.GroupModelRatio{}, &model.UserIdentity{}))
+	require.NoError(t, db.Create(&model.Group{Name: model.DefaultGroupName}).Error)
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	originalRedis, originalAddress := common.RedisEnabled, config.ServerAddress
+	model.DB, model.LOG_DB = db, db
+	common.RedisEnabled, config.ServerAddress = false, "https://gateway.example.com"
+	t.Cleanup(func() {
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		common.RedisEnabled, config.ServerAddress = originalRedis, originalAddress
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/scim/v2")
+	group.GET("/Users", GetUsers)
+	group.POST("/Users", CreateUser)
+	group.GET("/Users/:id", GetUser)
+	group.PUT("/Users/:id", ReplaceUser)
+	group.PATCH("/Users/:id", PatchUser)
+	group.DELETE("/Users/:id", DeleteUser)
+	group.GET("/Groups", GetGroups)
+	group.POST("/Groups", CreateGroup)
+	group.GET("/Groups/:id", GetGroup)
+	group.PUT("/Groups/:id", ReplaceGroup)
+	group.PATCH("/Groups/:id", PatchGroup)
+	group.DELETE("/Groups/:id", DeleteGroup)
+	return scimClient{t: t, router: router}
+}
+
+func userTokenStatuses(t *testing.T, userId int) []int {
+	var statuses []int
+	require.NoError(t, model.DB.Model(&model.Token{}).Where("user_id = ?", userId).Pluck("status", &statuses).Error)
+	return statuses
+}
+
+func TestSCIMUsers(t *testing.T) {
+	client := setupSCIM(t)
+
+	status, user := client.do(http.MethodPost, "/scim/v2/Users", map[string]any{
+		"schemas":    []string{SchemaUser},
+		"userName":   "alice",
+		"externalId": "ext-1",
+		"name":       map[string]any{"givenName": "Alice", "familyName": "Liddell"},
+		"emails": []any{
+			map[string]any{"value": "alice@home.example", "type": "home"},
+			map[string]any{"value": "alice@example.com", "type": "work", "primary": true},
+		},
+		"active": true,
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]any{"department": "R&D"},
+	})
+	require.Equal(t, http.StatusCreated, status, user)
+	id := user["id"].(string)
+	assert.Equal(t, "ext-1", user["externalId"])
+	assert.Equal(t, "Alice Liddell", user["displayName"])
+	assert.Equal(t, true, user["active"])
+	assert.Equal(t, "alice@example.com", user["emails"].([]any)[0].(map[string]any)["value"])
+	assert.Equal(t, "https://gateway.example.com/scim/v2/Users/"+id, user["meta"].(map[string]any)["location"])
+
+	status, conflict := client.do(http.MethodPost, "/scim/v2/Users", map[string]any{"userName": "alice"})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "uniqueness", conflict["scimType"])
+	assert.Equal(t, []any{SchemaError}, conflict["schemas"])
+	status, _ = client.do(http.MethodPost, "/scim/v2/Users", map[string]any{"userName": "alice2", "externalId": "ext-1"})
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = client.do(http.MethodPost, "/scim/v2/Users", map[string]any{"displayName": "nobody"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	for filter, total := range map[string]float64{
+		`userName eq "ALICE"`:                                1,
+		`externalId eq "ext-1"`:                              1,
+		`emails[type eq "work" and value co "@example.com"]`: 1,
+		`userName eq "bob"`:                                  0,
+	} {
+		status, list := client.do(http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(filter), nil)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, total, list["totalResults"], filter)
+		assert.Equal(t, []any{SchemaListResponse}, list["schemas"])
+	}
+	status, list := client.do(http.MethodGet, "/scim/v2/Users?count=0", nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(1), list["totalResults"])
+	assert.Empty(t, list["Resources"])
+	status, list = client.do(http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`userName xx "a"`), nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalidFilter", list["scimType"])
+	status, user = client.do(http.MethodGet, "/scim/v2/Users/"+id+"?attributes=userName", nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "alice", user["userName"])
+	assert.NotContains(t, user, "emails")
+	assert.Contains(t, user, "id")
+
+	// deactivation disables the user and their tokens at once, some clients send booleans as strings
+	userId := mustAtoi(t, id)
+	assert.Equal(t, []int{model.TokenStatusEnabled}, userTokenStatuses(t, userId))
+	status, user = client.do(http.MethodPatch, "/scim/v2/Users/"+id, map[string]any{
+		"schemas":    []string{SchemaPatchOp},
+		"Operations": []any{map[string]any{"op": "Replace", "path": "active", "value": "False"}},
+	})
+	require.Equal(t, http.StatusOK, status, user)
+	assert.Equal(t, false, user["active"])
+	assert.Equal(t, []int{model.TokenStatusDisabled}, userTokenStatuses(t, userId))
+	stored, err := model.GetUserById(userId, false)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserStatusDisabled, stored.Status)
+
+	status, user = client.do(http.MethodPatch, "/scim/v2/Users/"+id, map[string]any{
+		"schemas": []string{SchemaPatchOp},
+		"Operations": []any{
+			map[string]any{"op": "replace", "value": map[string]any{"active": true, "displayName": "A. Liddell"}},
+			map[string]any{"op": "replace", "path": `emails[type eq "work"].value`, "value": "alice@corp.example"},
+			map[string]any{"op": "remove", "path": "externalId"},
+		},
+	})
+	require.Equal(t, http.StatusOK, status, user)
+	assert.Equal(t, true, user["active"])
+	assert.Equal(t, "A. Liddell", user["displayName"])
+	assert.Equal(t, "alice@corp.example", user["emails"].([]any)[0].(map[string]any)["value"])
+	assert.NotContains(t, user, "externalId")
+	status, _ = client.do(http.MethodPatch, "/scim/v2/Users/"+id, map[string]any{
+		"Operations": []any{map[string]any{"op": "remove", "path": "userName"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// PUT replaces the user, the email it leaves out is cleared
+	status, user = client.do(http.MethodPut, "/scim/v2/Users/"+id, map[string]any{
+		"userName": "alice.liddell", "displayName": "Alice", "active": true,
+	})
+	require.Equal(t, http.StatusOK, status, user)
+	assert.Equal(t, "alice.liddell", user["userName"])
+	assert.NotContains(t, user, "emails")
+
+	status, _ = client.do(http.MethodDelete, "/scim/v2/Users/"+id, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, user = client.do(http.MethodGet, "/scim/v2/Users/"+id, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "404", user["status"])
+	assert.Equal(t, []int{model.TokenStatusDisabled}, userTokenStatuses(t, userId))
+}
+
+func TestSCIMGroups(t *testing.T) {
+	client := setupSCIM(t)
+	var ids []string
+	for _, username := range []string{"alice", "bob"} {
+		status, user := client.do(http.MethodPost, "/scim/v2/Users", map[string]any{"userName": username})
+		require.Equal(t, http.StatusCreated, status, user)
+		ids = append(ids, user["id"].(string))
+	}
+	userGroup := func(id string) string {
+		user, err := model.GetUserById(mustAtoi(t, id), false)
+		require.NoError(t, err)
+		return user.Group
+	}
+
+	status, group := client.do(http.MethodPost, "/scim/v2/Groups", map[string]any{
+		"schemas":     []string{SchemaGroup},
+		"displayName": "research",
+		"members":     []any{map[string]any{"value": ids[0]}},
+	})
+	require.Equal(t, http.StatusCreated, status, group)
+	assert.Equal(t, "research", group["id"])
+	assert.Len(t, group["members"], 1)
+	assert.Equal(t, "research", userGroup(ids[0]))
+	status, _ = client.do(http.MethodPost, "/scim/v2/Groups", map[string]any{"displayName": "research"})
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = client.do(http.MethodPost, "/scim/v2/Groups", map[string]any{"displayName": "a, b"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, list := client.do(http.MethodGet, "/scim/v2/Groups?filter="+url.QueryEscape(`displayName eq "research"`)+"&excludedAttributes=members", nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(1), list["totalResults"])
+	assert.NotContains(t, list["Resources"].([]any)[0], "members")
+
+	patch := func(operations ...any) (int, map[string]any) {
+		return client.do(http.MethodPatch, "/scim/v2/Groups/research", map[string]any{
+			"schemas": []string{SchemaPatchOp}, "Operations": operations,
+		})
+	}
+	status, group = patch(map[string]any{"op": "add", "path": "members", "value": []any{map[string]any{"value": ids[1]}}})
+	require.Equal(t, http.StatusOK, status, group)
+	assert.Len(t, group["members"], 2)
+	status, group = patch(map[string]any{"op": "remove", "path": `members[value eq "` + ids[0] + `"]`})
+	require.Equal(t, http.StatusOK, status, group)
+	assert.Equal(t, model.DefaultGroupName, userGroup(ids[0]))
+	assert.Equal(t, "research", userGroup(ids[1]))
+	status, _ = patch(map[string]any{"op": "replace", "path": "displayName", "value": "science"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = patch(map[string]any{"op": "add", "path": "members", "value": []any{map[string]any{"value": "999"}}})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, group = client.do(http.MethodPut, "/scim/v2/Groups/research", map[string]any{
+		"displayName": "research", "members": []any{map[string]any{"value": ids[0]}},
+	})
+	require.Equal(t, http.StatusOK, status, group)
+	assert.Equal(t, "research", userGroup(ids[0]))
+	assert.Equal(t, model.DefaultGroupName, userGroup(ids[1]))
+
+	status, user := client.do(http.MethodGet, "/scim/v2/Users/"+ids[0], nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "research", user["groups"].([]any)[0].(map[string]any)["value"])
+
+	status, _ = client.do(http.MethodDelete, "/scim/v2/Groups/"+model.DefaultGroupName, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = client.do(http.MethodDelete, "/scim/v2/Groups/research", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, model.DefaultGroupName, userGroup(ids[0]))
+	status, _ = client.do(http.MethodGet, "/scim/v2/Groups/research", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	n, err := strconv.Atoi(s)
+	require.NoError(t, err)
+	return n
+}
@@ -0,0 +1,435 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// User is the SCIM representation of a model.User.
+type User struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id"`
+	ExternalId  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *Name       `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []Email     `json:"emails,omitempty"`
+	Active      bool        `json:"active"`
+	Groups      []Reference `json:"groups,omitempty"`
+	Meta        Meta        `json:"meta"`
+}
+
+type Name struct {
+	Formatted string `json:"formatted,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary"`
+}
+
+// Reference refers to a user or group, value is its id.
+type Reference struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+func userResource(c *gin.Context, user *model.User, externalId string) *User {
+	resource := &User{
+		Schemas:     []string{SchemaUser},
+		Id:          strconv.Itoa(user.Id),
+		ExternalId:  externalId,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      user.Status == model.UserStatusEnabled,
+		Meta: Meta{
+			ResourceType: "User",
+			Location:     location(c, "/Users/"+strconv.Itoa(user.Id)),
+		},
+	}
+	if user.DisplayName != "" {
+		resource.Name = &Name{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		resource.Emails = []Email{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	if user.Group != "" {
+		resource.Groups = []Reference{{
+			Value:   user.Group,
+			Ref:     location(c, "/Groups/"+user.Group),
+			Display: user.Group,
+		}}
+	}
+	return resource
+}
+
+// userChange collects the attributes a request sets on a user.
+type userChange struct {
+	user       *model.User
+	externalId string
+	password   string
+	// an explicit displayName takes precedence over the parts of name
+	displayNameSet                   bool
+	formatted, givenName, familyName string
+}
+
+// set sets the attribute, a nil value clears it. Attributes the gateway does not keep
+// are ignored, so that clients can send their full schema.
+func (ch *userChange) set(attr string, sub string, value any) (err error) {
+	switch strings.ToLower(attr) {
+	case "username":
+		var username string
+		if username, err = stringValue("userName", value); err == nil && username == "" {
+			err = errors.New("userName is required")
+		}
+		ch.user.Username = username
+	case "displayname":
+		ch.user.DisplayName, err = stringValue("displayName", value)
+		ch.displayNameSet = true
+	case "name":
+		if sub != "" {
+			return ch.setName(sub, value)
+		}
+		object, _ := value.(map[string]any)
+		ch.formatted, ch.givenName, ch.familyName = "", "", ""
+		for key, part := range object {
+			if err = ch.setName(key, part); err != nil {
+				return err
+			}
+		}
+	case "emails":
+		if sub != "" {
+			if strings.EqualFold(sub, "value") {
+				ch.user.Email, err = stringValue("emails.value", value)
+			}
+			return err
+		}
+		ch.user.Email, err = primaryEmail(value)
+	case "active":
+		var active bool
+		if active, err = boolValue(value); err == nil {
+			ch.user.Status = model.UserStatusDisabled
+			if active {
+				ch.user.Status = model.UserStatusEnabled
+			}
+		}
+	case "externalid":
+		ch.externalId, err = stringValue("externalId", value)
+	case "password":
+		ch.password, err = stringValue("password", value)
+	}
+	return err
+}
+
+func (ch *userChange) setName(part string, value any) (err error) {
+	switch strings.ToLower(part) {
+	case "formatted":
+		ch.formatted, err = stringValue("name.formatted", value)
+	case "givenname":
+		ch.givenName, err = stringValue("name.givenName", value)
+	case "familyname":
+		ch.familyName, err = stringValue("name.familyName", value)
+	}
+	return err
+}
+
+// primaryEmail returns the primary email of the emails, or the first one.
+func primaryEmail(value any) (string, error) {
+	var emails []any
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		emails = value
+	case map[string]any:
+		emails = []any{value}
+	default:
+		return "", errors.New("emails must be a list")
+	}
+	email := ""
+	for _, item := range emails {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return "", errors.New("emails must be a list of objects")
+		}
+		address, err := stringValue("emails.value", object["value"])
+		if err != nil {
+			return "", err
+		}
+		if primary, _ := boolValue(object["primary"]); primary {
+			return address, nil
+		}
+		if email == "" {
+			email = address
+		}
+	}
+	return email, nil
+}
+
+// apply sets the attributes of the resource, e.g. the body of a POST or PUT.
+func (ch *userChange) apply(resource map[string]any) error {
+	for key, value := range resource {
+		attr, sub := splitAttributePath(key)
+		if err := ch.set(attr, sub, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish derives the display name and checks the user.
+func (ch *userChange) finish() error {
+	user := ch.user
+	if !ch.displayNameSet {
+		if name := strings.TrimSpace(ch.givenName + " " + ch.familyName); ch.formatted != "" {
+			user.DisplayName = ch.formatted
+		} else if name != "" {
+			user.DisplayName = name
+		}
+	}
+	if user.Username == "" {
+		return errors.New("userName is required")
+	}
+	if len(user.Username) > 30 {
+		return errors.New("userName must not be longer than 30 characters")
+	}
+	if len(user.Email) > 50 {
+		return errors.New("email must not be longer than 50 characters")
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = user.Username
+	}
+	if name := []rune(user.DisplayName); len(name) > 20 {
+		user.DisplayName = string(name[:20])
+	}
+	return nil
+}
+
+// checkUnique responds with a conflict if the username or externalId of the change is
+// used by another user.
+func (ch *userChange) checkUnique(c *gin.Context, username string) bool {
+	if ch.user.Username != username && model.IsUsernameAlreadyTaken(ch.user.Username) {
+		AbortWithError(c, http.StatusConflict, "uniqueness", fmt.Sprintf("userName %s is already taken", ch.user.Username))
+		return false
+	}
+	if ch.externalId != "" {
+		owner, err := model.GetUserByIdentity(model.SCIMIdentityProvider, ch.externalId)
+		if err == nil && owner.Id != ch.user.Id {
+			AbortWithError(c, http.StatusConflict, "uniqueness", fmt.Sprintf("externalId %s is already taken", ch.externalId))
+			return false
+		}
+	}
+	return true
+}
+
+// save links the externalId and applies a deactivation to the user's tokens.
+func (ch *userChange) save() error {
+	if err := model.SetIdentity(ch.user.Id, model.SCIMIdentityProvider, ch.externalId); err != nil {
+		return err
+	}
+	if ch.user.Status != model.UserStatusEnabled {
+		return ch.user.DisableWithTokens()
+	}
+	return nil
+}
+
+// getUser returns the user of the id in the path, root users can be read but not
+// provisioned.
+func getUser(c *gin.Context, provision bool) (*model.User, string, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	var user *model.User
+	if err == nil {
+		user, err = model.GetUserById(id, false)
+	}
+	if err != nil || user.Status == model.UserStatusDeleted {
+		AbortWithError(c, http.StatusNotFound, "", fmt.Sprintf("user %s not found", c.Param("id")))
+		return nil, "", false
+	}
+	if provision && user.Role == model.RoleRootUser {
+		AbortWithError(c, http.StatusForbidden, "", "root users cannot be provisioned")
+		return nil, "", false
+	}
+	subjects, err := model.GetIdentitySubjects(model.SCIMIdentityProvider)
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return nil, "", false
+	}
+	return user, subjects[user.Id], true
+}
+
+func GetUsers(c *gin.Context) {
+	users, err := model.GetAllUsersForProvisioning()
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	subjects, err := model.GetIdentitySubjects(model.SCIMIdentityProvider)
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	resources := make([]map[string]any, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toMap(userResource(c, user, subjects[user.Id])))
+	}
+	listResources(c, resources)
+}
+
+func GetUser(c *gin.Context) {
+	user, externalId, ok := getUser(c, false)
+	if !ok {
+		return
+	}
+	resource := toMap(userResource(c, user, externalId))
+	project(resource, c.Query("attributes"), c.Query("excludedAttributes"))
+	respond(c, http.StatusOK, resource)
+}
+
+// CreateUser provisions a user. Users without a password can only log in through an
+// identity provider.
+func CreateUser(c *gin.Context) {
+	body, ok := decodeBody(c)
+	if !ok {
+		return
+	}
+	ch := &userChange{user: &model.User{Role: model.RoleCommonUser, Status: model.UserStatusEnabled}}
+	err := ch.apply(body)
+	if err == nil {
+		err = ch.finish()
+	}
+	if err != nil {
+		AbortWithError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	if !ch.checkUnique(c, "") {
+		return
+	}
+	ch.user.Password = ch.password
+	if err := ch.user.Insert(c.Request.Context(), 0); err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if err := ch.save(); err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	logger.Logger.Info("user provisioned by scim", zap.Int("user_id", ch.user.Id), zap.String("username", ch.user.Username))
+	resource := userResource(c, ch.user, ch.externalId)
+	c.Header("Location", resource.Meta.Location)
+	respond(c, http.StatusCreated, resource)
+}
+
+// ReplaceUser replaces the attributes of a user, attributes missing in the body are
+// cleared.
+func ReplaceUser(c *gin.Context) {
+	user, _, ok := getUser(c, true)
+	if !ok {
+		return
+	}
+	body, ok := decodeBody(c)
+	if !ok {
+		return
+	}
+	username := user.Username
+	user.DisplayName, user.Email, user.Status = "", "", model.UserStatusEnabled
+	ch := &userChange{user: user}
+	if err := ch.apply(body); err != nil {
+		AbortWithError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	updateUser(c, ch, username)
+}
+
+// PatchUser applies the operations of a PATCH request to a user.
+func PatchUser(c *gin.Context) {
+	user, externalId, ok := getUser(c, true)
+	if !ok {
+		return
+	}
+	operations, ok := decodePatch(c)
+	if !ok {
+		return
+	}
+	username := user.Username
+	ch := &userChange{user: user, externalId: externalId}
+	for _, operation := range operations {
+		value := operation.Value
+		if operation.Op == "remove" {
+			value = nil
+		}
+		var err error
+		if operation.Path == "" {
+			object, ok := value.(map[string]any)
+			if !ok {
+				AbortWithError(c, http.StatusBadRequest, "noTarget", "an operation without path needs an object value")
+				return
+			}
+			err = ch.apply(object)
+		} else {
+			var path patchPath
+			if path, err = parsePatchPath(operation.Path); err != nil {
+				AbortWithError(c, http.StatusBadRequest, "invalidPath", err.Error())
+				return
+			}
+			err = ch.set(path.attr, path.sub, value)
+		}
+		if err != nil {
+			AbortWithError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	updateUser(c, ch, username)
+}
+
+func updateUser(c *gin.Context, ch *userChange, username string) {
+	if err := ch.finish(); err != nil {
+		AbortWithError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	if !ch.checkUnique(c, username) {
+		return
+	}
+	ch.user.Password = ch.password
+	if err := ch.user.UpdateProvisioned(ch.password != ""); err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if err := ch.save(); err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	respond(c, http.StatusOK, userResource(c, ch.user, ch.externalId))
+}
+
+// DeleteUser deprovisions a user, the user and their tokens are disabled at once and
+// the user is deleted.
+func DeleteUser(c *gin.Context) {
+	user, _, ok := getUser(c, true)
+	if !ok {
+		return
+	}
+	err := user.DisableWithTokens()
+	if err == nil {
+		err = model.SetIdentity(user.Id, model.SCIMIdentityProvider, "")
+	}
+	if err == nil {
+		err = user.Delete()
+	}
+	if err != nil {
+		AbortWithError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	logger.Logger.Info("user deprovisioned by scim", zap.Int("user_id", user.Id))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetTranscriptRules(c *gin.Context) {
+	rules, err := model.GetAllTranscriptRules()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rules,
+	})
+}
+
+// AddTranscriptRule creates a transcript rule. Unless the body says otherwise it is
+// enabled, captures every request and redacts all personal data detectors.
+func AddTranscriptRule(c *gin.Context) {
+	rule := model.TranscriptRule{
+		Enabled:    true,
+		SampleRate: 1,
+		RedactPII:  strings.Join(model.PIIDetectors, ","),
+	}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rule.Id = 0
+	if err := rule.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rule,
+	})
+}
+
+// UpdateTranscriptRule replaces all settings of a transcript rule.
+func UpdateTranscriptRule(c *gin.Context) {
+	rule := model.TranscriptRule{}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	stored, err := model.GetTranscriptRuleById(rule.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rule.CreatedTime = stored.CreatedTime
+	if err = rule.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rule,
+	})
+}
+
+func DeleteTranscriptRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rule, err := model.GetTranscriptRuleById(id)
+	if err == nil {
+		err = rule.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetTranscript returns the captured transcript of a request by its request id.
+func GetTranscript(c *gin.Context) {
+	transcript, err := model.GetTranscriptByRequestId(c.Param("request_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    transcript,
+	})
+}
@@ -26,6 +26,8 @@ type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	TotpCode string `json:"totp_code,omitempty"`
+	// RecoveryCode replaces the TOTP code or the passkey of the second factor
+	RecoveryCode string `json:"recovery_code,omitempty"`
 }
 
 type TotpSetupRequest struct {
@@ -76,17 +78,25 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Check if TOTP is enabled for this user
-	if user.TotpSecret != "" {
-		// TOTP is enabled, check if code is provided
-		if loginRequest.TotpCode == "" {
-			// Return special response indicating TOTP is required
+	// Check if a second factor, TOTP or passkeys, is enabled for this user
+	webAuthnEnabled := model.HasWebAuthnCredentials(user.Id)
+	if user.TotpSecret != "" || webAuthnEnabled {
+		// Second factor is enabled, check if a code is provided
+		if loginRequest.TotpCode == "" && loginRequest.RecoveryCode == "" {
+			// Let a passkey assertion complete the login instead of a code
+			setPendingLogin(c, user.Id)
+			message := "totp_required"
+			if user.TotpSecret == "" {
+				message = "webauthn_required"
+			}
+			// Return special response indicating the second factor is required
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
-				"message": "totp_required",
+				"message": message,
 				"data": gin.H{
-					"totp_required": true,
-					"user_id":       user.Id,
+					"totp_required":     user.TotpSecret != "",
+					"webauthn_required": webAuthnEnabled,
+					"user_id":           user.Id,
 				},
 			})
 			return
@@ -101,8 +111,17 @@ func Login(c *gin.Context) {
 			return
 		}
 
-		// Verify TOTP code
-		if !verifyTotpCode(user.Id, user.TotpSecret, loginRequest.TotpCode) {
+		// Verify the recovery code, or else the TOTP code
+		if loginRequest.RecoveryCode != "" {
+			if !model.UseRecoveryCode(user.Id, loginRequest.RecoveryCode) {
+				c.JSON(http.StatusOK, gin.H{
+					"message": "Invalid recovery code",
+					"success": false,
+				})
+				return
+			}
+			model.RecordLog(c.Request.Context(), user.Id, model.LogTypeManage, "Logged in with a recovery code")
+		} else if !verifyTotpCode(user.Id, user.TotpSecret, loginRequest.TotpCode) {
 			c.JSON(http.StatusOK, gin.H{
 				"message": "Invalid TOTP code",
 				"success": false,
@@ -116,6 +135,40 @@ func Login(c *gin.Context) {
 
 // setup session & cookies and then return user info
 func SetupLogin(user *model.User, c *gin.Context) {
+	ban, err := model.CacheGetUserBan(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if ban != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": ban.Message(),
+			"success": false,
+		})
+		return
+	}
+	cleanUser, err := SaveLoginSession(user, c)
+	if err != nil {
+		logger.Logger.Error(fmt.Sprintf("Unable to save login session information: %+v", err))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Unable to save login session information, please try again",
+			"success": false,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "",
+		"success": true,
+		"data":    cleanUser,
+	})
+}
+
+// SaveLoginSession stores the login of the user in the session and returns the user
+// info that may be handed to the frontend.
+func SaveLoginSession(user *model.User, c *gin.Context) (*model.User, error) {
 	// BUG: 如果用户发送了一段不合法的 session cookie，因为 gorilla 对无法识别的 session 会默认返回 nil，
 	// 导致 session.Set 中会出现 panic
 	//
@@ -137,14 +190,8 @@ func SetupLogin(user *model.User, c *gin.Context) {
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
-	err := session.Save()
-	if err != nil {
-		logger.Logger.Error(fmt.Sprintf("Unable to save login session information: %+v", err))
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Unable to save login session information, please try again",
-			"success": false,
-		})
-		return
+	if err := session.Save(); err != nil {
+		return nil, err
 	}
 
 	// set auth header
@@ -152,18 +199,13 @@ func SetupLogin(user *model.User, c *gin.Context) {
 	// GenerateAccessToken(c)
 	// c.Header("Authorization", user.AccessToken)
 
-	cleanUser := model.User{
+	return &model.User{
 		Id:          user.Id,
 		Username:    user.Username,
 		DisplayName: user.DisplayName,
 		Role:        user.Role,
 		Status:      user.Status,
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"message": "",
-		"success": true,
-		"data":    cleanUser,
-	})
+	}, nil
 }
 
 func Logout(c *gin.Context) {
@@ -1171,9 +1213,22 @@ func ConfirmTotp(c *gin.Context) {
 	session.Delete("temp_totp_secret")
 	session.Save()
 
+	// Users get recovery codes with their first second factor
+	recoveryCodes, err := ensureRecoveryCodes(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "TOTP has been successfully enabled",
+		"data": gin.H{
+			"recovery_codes": recoveryCodes,
+		},
 	})
 }
 
@@ -0,0 +1,504 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const (
+	// maxWebAuthnCredentials bounds the credentials a user may register
+	maxWebAuthnCredentials = 10
+	// pendingLoginTTL is the time a password check waits for the passkey assertion
+	pendingLoginTTL = 5 * time.Minute
+
+	sessionWebAuthnRegistration = "webauthn_registration"
+	sessionWebAuthnLogin        = "webauthn_login"
+	sessionPendingLoginId       = "pending_login_id"
+	sessionPendingLoginTime     = "pending_login_time"
+)
+
+// webAuthnUser is a user with their credentials, as the WebAuthn ceremonies see them.
+type webAuthnUser struct {
+	user        *model.User
+	stored      []*model.WebAuthnCredential
+	credentials []webauthn.Credential
+}
+
+func loadWebAuthnUser(user *model.User) (*webAuthnUser, error) {
+	stored, err := model.GetUserWebAuthnCredentials(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	u := &webAuthnUser{user: user, stored: stored}
+	for _, s := range stored {
+		var credential webauthn.Credential
+		if err = json.Unmarshal([]byte(s.Credential), &credential); err != nil {
+			return nil, errors.Wrapf(err, "decode webauthn credential %d", s.Id)
+		}
+		u.credentials = append(u.credentials, credential)
+	}
+	return u, nil
+}
+
+// WebAuthnID is the user handle, the decimal user id.
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.user.Id))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	if u.user.DisplayName != "" {
+		return u.user.DisplayName
+	}
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// updateUsage stores the credential used for a login with its new sign count.
+func (u *webAuthnUser) updateUsage(credential *webauthn.Credential) error {
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	for _, s := range u.stored {
+		if s.CredentialId == id {
+			encoded, err := json.Marshal(credential)
+			if err != nil {
+				return err
+			}
+			s.Credential = string(encoded)
+			return s.UpdateUsage()
+		}
+	}
+	return errors.Errorf("webauthn credential %s not found", id)
+}
+
+// newWebAuthn returns the relying party of the server address, passkeys are bound to
+// its host name.
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	origin, err := url.Parse(config.ServerAddress)
+	if err != nil || origin.Hostname() == "" {
+		return nil, errors.New("the server address must be configured to use passkeys")
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          origin.Hostname(),
+		RPDisplayName: config.SystemName,
+		RPOrigins:     []string{origin.Scheme + "://" + origin.Host},
+	})
+}
+
+// saveWebAuthnSession keeps the state of a ceremony until it is finished.
+func saveWebAuthnSession(c *gin.Context, key string, data *webauthn.SessionData) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	session.Set(key, string(encoded))
+	return session.Save()
+}
+
+// takeWebAuthnSession returns the state of a ceremony, it can be taken once.
+func takeWebAuthnSession(c *gin.Context, key string) (*webauthn.SessionData, error) {
+	session := sessions.Default(c)
+	encoded, _ := session.Get(key).(string)
+	session.Delete(key)
+	_ = session.Save()
+	if encoded == "" {
+		return nil, errors.New("no passkey ceremony in progress, please start again")
+	}
+	data := &webauthn.SessionData{}
+	if err := json.Unmarshal([]byte(encoded), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// setPendingLogin remembers that the user passed the password check, so that a passkey
+// assertion can complete the login.
+func setPendingLogin(c *gin.Context, userId int) {
+	session := sessions.Default(c)
+	session.Set(sessionPendingLoginId, userId)
+	session.Set(sessionPendingLoginTime, time.Now().Unix())
+	_ = session.Save()
+}
+
+// getPendingLogin returns the user who passed the password check, or 0.
+func getPendingLogin(c *gin.Context) int {
+	session := sessions.Default(c)
+	userId, _ := session.Get(sessionPendingLoginId).(int)
+	since, _ := session.Get(sessionPendingLoginTime).(int64)
+	if time.Since(time.Unix(since, 0)) > pendingLoginTTL {
+		return 0
+	}
+	return userId
+}
+
+func clearPendingLogin(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Delete(sessionPendingLoginId)
+	session.Delete(sessionPendingLoginTime)
+	_ = session.Save()
+}
+
+// webAuthnError responds with the error of a ceremony, with the details the library
+// gives for protocol errors.
+func webAuthnError(c *gin.Context, err error) {
+	message := err.Error()
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.DevInfo != "" {
+		message = fmt.Sprintf("%s: %s", protocolErr.Details, protocolErr.DevInfo)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": message,
+	})
+}
+
+// GetWebAuthnCredentials lists the passkeys of the current user.
+func GetWebAuthnCredentials(c *gin.Context) {
+	credentials, err := model.GetUserWebAuthnCredentials(c.GetInt(ctxkey.Id))
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    credentials,
+	})
+}
+
+// BeginWebAuthnRegistration returns the options of navigator.credentials.create() for
+// a new passkey of the current user.
+func BeginWebAuthnRegistration(c *gin.Context) {
+	wa, err := newWebAuthn()
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	u, err := loadWebAuthnUser(user)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	if len(u.credentials) >= maxWebAuthnCredentials {
+		webAuthnError(c, errors.Errorf("at most %d passkeys can be registered", maxWebAuthnCredentials))
+		return
+	}
+	creation, data, err := wa.BeginRegistration(u,
+		webauthn.WithExclusions(webauthn.Credentials(u.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err == nil {
+		err = saveWebAuthnSession(c, sessionWebAuthnRegistration, data)
+	}
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    creation,
+	})
+}
+
+// FinishWebAuthnRegistration verifies the credential the browser created and stores it
+// under the name in the query. Users who had no recovery codes get them now.
+func FinishWebAuthnRegistration(c *gin.Context) {
+	wa, err := newWebAuthn()
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	data, err := takeWebAuthnSession(c, sessionWebAuthnRegistration)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	u, err := loadWebAuthnUser(user)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	credential, err := wa.FinishRegistration(u, *data, c.Request)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	encoded, err := json.Marshal(credential)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = fmt.Sprintf("Passkey %d", len(u.credentials)+1)
+	}
+	if len([]rune(name)) > 64 {
+		name = string([]rune(name)[:64])
+	}
+	stored := &model.WebAuthnCredential{
+		UserId:       user.Id,
+		Name:         name,
+		CredentialId: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Credential:   string(encoded),
+	}
+	if err = stored.Insert(); err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	recoveryCodes, err := ensureRecoveryCodes(user.Id)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Passkey has been successfully registered",
+		"data": gin.H{
+			"credential":     stored,
+			"recovery_codes": recoveryCodes,
+		},
+	})
+}
+
+// DeleteWebAuthnCredential deletes a passkey of the current user.
+func DeleteWebAuthnCredential(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	if err = model.DeleteWebAuthnCredential(id, c.GetInt(ctxkey.Id)); err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// BeginWebAuthnLogin returns the options of navigator.credentials.get(). After the
+// password check of a user with a second factor, the assertion must come from one of
+// their passkeys; otherwise any passkey may log its user in without password.
+func BeginWebAuthnLogin(c *gin.Context) {
+	wa, err := newWebAuthn()
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	var assertion *protocol.CredentialAssertion
+	var data *webauthn.SessionData
+	if userId := getPendingLogin(c); userId != 0 {
+		var user *model.User
+		var u *webAuthnUser
+		if user, err = model.GetUserById(userId, false); err == nil {
+			if u, err = loadWebAuthnUser(user); err == nil {
+				assertion, data, err = wa.BeginLogin(u)
+			}
+		}
+	} else {
+		// without a password, the authenticator must verify the user
+		assertion, data, err = wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	}
+	if err == nil {
+		err = saveWebAuthnSession(c, sessionWebAuthnLogin, data)
+	}
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    assertion,
+	})
+}
+
+// FinishWebAuthnLogin verifies the assertion and logs the user in.
+func FinishWebAuthnLogin(c *gin.Context) {
+	wa, err := newWebAuthn()
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	data, err := takeWebAuthnSession(c, sessionWebAuthnLogin)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+
+	var u *webAuthnUser
+	var credential *webauthn.Credential
+	if len(data.UserID) > 0 {
+		userId, _ := strconv.Atoi(string(data.UserID))
+		if userId == 0 || userId != getPendingLogin(c) {
+			webAuthnError(c, errors.New("the password check has expired, please log in again"))
+			return
+		}
+		var user *model.User
+		if user, err = model.GetUserById(userId, false); err == nil {
+			if u, err = loadWebAuthnUser(user); err == nil {
+				credential, err = wa.FinishLogin(u, *data, c.Request)
+			}
+		}
+	} else {
+		credential, err = wa.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			userId, err := strconv.Atoi(string(userHandle))
+			if err != nil {
+				return nil, errors.New("invalid user handle")
+			}
+			user, err := model.GetUserById(userId, false)
+			if err != nil {
+				return nil, err
+			}
+			u, err = loadWebAuthnUser(user)
+			return u, err
+		}, *data, c.Request)
+	}
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	if credential.Authenticator.CloneWarning {
+		webAuthnError(c, errors.New("the sign count of the passkey went backwards, it may have been cloned"))
+		return
+	}
+	if u.user.Status != model.UserStatusEnabled {
+		webAuthnError(c, errors.New("User has been banned"))
+		return
+	}
+	if err = u.updateUsage(credential); err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	clearPendingLogin(c)
+	SetupLogin(u.user, c)
+}
+
+// ensureRecoveryCodes generates recovery codes for a user who has none left, it returns
+// nil if they still have some.
+func ensureRecoveryCodes(userId int) ([]string, error) {
+	count, err := model.CountRecoveryCodes(userId)
+	if err != nil || count > 0 {
+		return nil, err
+	}
+	return model.GenerateRecoveryCodes(userId)
+}
+
+// GetRecoveryCodeStatus returns the number of unused recovery codes of the current user.
+func GetRecoveryCodeStatus(c *gin.Context) {
+	count, err := model.CountRecoveryCodes(c.GetInt(ctxkey.Id))
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"remaining": count,
+		},
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user, who must
+// have a second factor enabled.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), true)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	if user.TotpSecret == "" && !model.HasWebAuthnCredentials(user.Id) {
+		webAuthnError(c, errors.New("enable TOTP or register a passkey first"))
+		return
+	}
+	codes, err := model.GenerateRecoveryCodes(user.Id)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// AdminResetUserWebAuthn allows admins to delete the passkeys and recovery codes of a
+// user who lost their authenticators.
+func AdminResetUserWebAuthn(c *gin.Context) {
+	ctx := c.Request.Context()
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	myRole := c.GetInt(ctxkey.Role)
+	if myRole <= user.Role && myRole != model.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "No permission to modify user with the same or higher permission level",
+		})
+		return
+	}
+	if err = model.DeleteUserWebAuthnCredentials(user.Id); err == nil {
+		err = model.DeleteRecoveryCodes(user.Id)
+	}
+	if err != nil {
+		webAuthnError(c, err)
+		return
+	}
+	model.RecordLog(ctx, user.Id, model.LogTypeManage, fmt.Sprintf("Admin (ID: %d) reset the passkeys and recovery codes of user %s", c.GetInt(ctxkey.Id), user.Username))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "The passkeys and recovery codes of the user have been reset",
+	})
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// softAuthenticator is a platform authenticator holding one ES256 passkey.
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &softAuthenticator{key: key, id: []byte("soft-credential-1")}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// authData builds the authenticator data, flags UP|UV and AT for attested credentials.
+func (a *softAuthenticator) authData(t *testing.T, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte("localhost"))
+	data := append([]byte{}, rpIdHash[:]...)
+	flags := byte(0x05)
+	if attested {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+			Curve:         1,
+			XCoord:        a.key.X.FillBytes(make([]byte, 32)),
+			YCoord:        a.key.Y.FillBytes(make([]byte, 32)),
+		})
+		require.NoError(t, err)
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+func clientData(ceremony string, options gin.H) []byte {
+	publicKey := options["publicKey"].(map[string]any)
+	data, _ := json.Marshal(gin.H{
+		"type":      ceremony,
+		"challenge": publicKey["challenge"],
+		"origin":    "http://localhost:3000",
+	})
+	return data
+}
+
+// create answers navigator.credentials.create() with a "none" attestation.
+func (a *softAuthenticator) create(t *testing.T, options gin.H) []byte {
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(t, true),
+	})
+	require.NoError(t, err)
+	body, _ := json.Marshal(gin.H{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": gin.H{
+			"clientDataJSON":    b64(clientData("webauthn.create", options)),
+			"attestationObject": b64(attestation),
+		},
+	})
+	return body
+}
+
+// get answers navigator.credentials.get() for the user handle.
+func (a *softAuthenticator) get(t *testing.T, options gin.H, userHandle string) []byte {
+	a.signCount++
+	authData := a.authData(t, false)
+	client := clientData("webauthn.get", options)
+	clientHash := sha256.Sum256(client)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+	body, _ := json.Marshal(gin.H{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": gin.H{
+			"clientDataJSON":    b64(client),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64([]byte(userHandle)),
+		},
+	})
+	return body
+}
+
+// browser keeps the session cookie between requests.
+type browser struct {
+	router  *gin.Engine
+	cookies map[string]*http.Cookie
+}
+
+func (b *browser) post(t *testing.T, path string, body []byte) gin.H {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	b.router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		b.cookies[cookie.Name] = cookie
+	}
+	response := gin.H{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	return response
+}
+
+func TestWebAuthnSecondFactorAndPasswordlessLogin(t *testing.T) {
+	db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	// the TOTP rate limit of the user also guards recovery codes, other tests used it
+	originalAddress, originalDebug := config.ServerAddress, config.DebugEnabled
+	config.ServerAddress, config.DebugEnabled = "http://localhost:3000", true
+	defer func() { config.ServerAddress, config.DebugEnabled = originalAddress, originalDebug }()
+	password, err := common.Password2Hash("password123")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&model.User{}).Where("id = 1").Update("password", password).Error)
+
+	router := setupTestRouter()
+	authed := func(handler gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set(ctxkey.Id, 1)
+			c.Set(ctxkey.Role, model.RoleRootUser)
+			handler(c)
+		}
+	}
+	router.POST("/login", Login)
+	router.POST("/login/webauthn/begin", BeginWebAuthnLogin)
+	router.POST("/login/webauthn/finish", FinishWebAuthnLogin)
+	router.POST("/webauthn/register/begin", authed(BeginWebAuthnRegistration))
+	router.POST("/webauthn/register/finish", authed(FinishWebAuthnRegistration))
+	router.POST("/webauthn/reset/:id", func(c *gin.Context) {
+		c.Set(ctxkey.Id, 2)
+		c.Set(ctxkey.Role, model.RoleRootUser)
+		AdminResetUserWebAuthn(c)
+	})
+	authenticator := newSoftAuthenticator(t)
+	newBrowser := func() *browser { return &browser{router: router, cookies: map[string]*http.Cookie{}} }
+	loginBody, _ := json.Marshal(LoginRequest{Username: "testuser", Password: "password123"})
+
+	// registration
+	b := newBrowser()
+	response := b.post(t, "/webauthn/register/begin", nil)
+	require.True(t, response["success"].(bool), response)
+	creation := response["data"].(map[string]any)
+	response = b.post(t, "/webauthn/register/finish?name=Laptop", authenticator.create(t, creation))
+	require.True(t, response["success"].(bool), response)
+	recoveryCodes := response["data"].(map[string]any)["recovery_codes"].([]any)
+	assert.Len(t, recoveryCodes, model.RecoveryCodeCount)
+	credentials, err := model.GetUserWebAuthnCredentials(1)
+	require.NoError(t, err)
+	require.Len(t, credentials, 1)
+	assert.Equal(t, "Laptop", credentials[0].Name)
+
+	// the password alone no longer logs in
+	b = newBrowser()
+	response = b.post(t, "/login", loginBody)
+	assert.False(t, response["success"].(bool))
+	assert.Equal(t, "webauthn_required", response["message"])
+
+	// the passkey completes the login of the password check
+	response = b.post(t, "/login/webauthn/begin", nil)
+	require.True(t, response["success"].(bool), response)
+	assertion := response["data"].(map[string]any)
+	assert.Len(t, assertion["publicKey"].(map[string]any)["allowCredentials"], 1)
+	response = b.post(t, "/login/webauthn/finish", authenticator.get(t, assertion, "1"))
+	require.True(t, response["success"].(bool), response)
+	assert.Equal(t, "testuser", response["data"].(map[string]any)["username"])
+
+	// passwordless login with the user handle of the passkey
+	b = newBrowser()
+	response = b.post(t, "/login/webauthn/begin", nil)
+	require.True(t, response["success"].(bool), response)
+	assertion = response["data"].(map[string]any)
+	assert.Equal(t, "required", assertion["publicKey"].(map[string]any)["userVerification"])
+	assert.Nil(t, assertion["publicKey"].(map[string]any)["allowCredentials"])
+	response = b.post(t, "/login/webauthn/finish", authenticator.get(t, assertion, "1"))
+	require.True(t, response["success"].(bool), response)
+	// the ceremony can be finished once only
+	response = b.post(t, "/login/webauthn/finish", authenticator.get(t, assertion, "1"))
+	assert.False(t, response["success"].(bool))
+
+	// a sign count going backwards reveals a cloned authenticator
+	response = b.post(t, "/login/webauthn/begin", nil)
+	assertion = response["data"].(map[string]any)
+	authenticator.signCount = 0
+	response = b.post(t, "/login/webauthn/finish", authenticator.get(t, assertion, "1"))
+	assert.False(t, response["success"].(bool))
+
+	// recovery codes replace the second factor once each
+	recoveryBody, _ := json.Marshal(LoginRequest{Username: "testuser", Password: "password123", RecoveryCode: recoveryCodes[0].(string)})
+	response = newBrowser().post(t, "/login", recoveryBody)
+	assert.True(t, response["success"].(bool), response)
+	response = newBrowser().post(t, "/login", recoveryBody)
+	assert.False(t, response["success"].(bool))
+	remaining, err := model.CountRecoveryCodes(1)
+	require.NoError(t, err)
+	assert.EqualValues(t, model.RecoveryCodeCount-1, remaining)
+
+	// admins reset the passkeys of users who lost them
+	response = newBrowser().post(t, "/webauthn/reset/1", nil)
+	require.True(t, response["success"].(bool), response)
+	assert.False(t, model.HasWebAuthnCredentials(1))
+	response = newBrowser().post(t, "/login", loginBody)
+	assert.True(t, response["success"].(bool), response)
+}
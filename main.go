@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/base64"
 	"fmt"
@@ -19,6 +20,7 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/songquanpeng/one-api/bootstrap"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
@@ -40,6 +42,14 @@ var buildFS embed.FS
 func main() {
 	common.Init()
 	logger.SetupLogger()
+	if *common.ValidateConfig != "" {
+		if _, err := bootstrap.LoadFile(*common.ValidateConfig); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("config file is valid")
+		os.Exit(0)
+	}
 	logger.Logger.Info(fmt.Sprintf("One API %s started", common.Version))
 
 	if os.Getenv("GIN_MODE") != gin.DebugMode {
@@ -73,7 +83,25 @@ func main() {
 
 	// Initialize options
 	model.InitOptionMap()
+	model.InitGroupCache()
+	model.InitVirtualModelCache()
+	model.InitContentPolicyCache()
+	model.InitTranscriptRuleCache()
+	model.InitPromptTemplateCache()
+	model.InitIdentityProviderCache()
+	model.InitBanCache()
+	model.InitChannelErrorRuleCache()
 	logger.Logger.Info(fmt.Sprintf("using theme %s", config.Theme))
+
+	// Apply declarative config, only the master node writes to the database
+	if config.ConfigFile != "" && config.IsMasterNode {
+		report, err := bootstrap.ApplyFile(context.Background(), config.ConfigFile)
+		if err != nil {
+			logger.Logger.Fatal("failed to apply config file", zap.String("path", config.ConfigFile), zap.Error(err))
+		}
+		logger.Logger.Info("config file applied", zap.String("result", report.String()))
+		go bootstrap.WatchSIGHUP(context.Background(), config.ConfigFile)
+	}
 	if common.RedisEnabled {
 		// for compatibility with old versions
 		config.MemoryCacheEnabled = true
@@ -85,8 +113,27 @@ func main() {
 	}
 	if config.MemoryCacheEnabled {
 		go model.SyncOptions(config.SyncFrequency)
+		go model.SyncGroupCache(config.SyncFrequency)
+		go model.SyncVirtualModelCache(config.SyncFrequency)
+		go model.SyncContentPolicyCache(config.SyncFrequency)
+		go model.SyncTranscriptRuleCache(config.SyncFrequency)
+		go model.SyncPromptTemplateCache(config.SyncFrequency)
+		go model.SyncIdentityProviderCache(config.SyncFrequency)
+		go model.SyncBanCache(config.SyncFrequency)
+		go model.SyncChannelErrorRuleCache(config.SyncFrequency)
 		go model.SyncChannelCache(config.SyncFrequency)
 	}
+	if common.RedisEnabled {
+		// the periodic syncs above stay as the fallback for missed invalidations
+		go func() {
+			for {
+				if err := model.SubscribeCacheInvalidation(context.Background()); err != nil {
+					logger.Logger.Error("cache invalidation subscription failed", zap.Error(err))
+				}
+				time.Sleep(10 * time.Second)
+			}
+		}()
+	}
 	if os.Getenv("CHANNEL_TEST_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_TEST_FREQUENCY"))
 		if err != nil {
@@ -94,6 +141,12 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if config.ChannelRecoveryEnabled && config.IsMasterNode {
+		go controller.AutomaticallyRecoverChannels()
+	}
+	if config.TranscriptRetentionDays > 0 && config.IsMasterNode {
+		go model.PruneTranscripts(config.TranscriptRetentionDays)
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.Logger.Info("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -155,6 +208,7 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	server.Use(middleware.IPBan())
 	server.Use(middleware.Language())
 
 	// Add Prometheus middleware if enabled
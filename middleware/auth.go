@@ -21,6 +21,7 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -96,6 +97,25 @@ func authHelper(c *gin.Context, minRole int) {
 		return
 	}
 
+	// Check if an admin banned the user for a while
+	ban, err := model.CacheGetUserBan(id.(int))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if ban != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": ban.Message(),
+		})
+		c.Abort()
+		return
+	}
+
 	// Check if user has sufficient role permissions
 	if role.(int) < minRole {
 		c.JSON(http.StatusOK, gin.H{
@@ -159,8 +179,20 @@ func TokenAuth() func(c *gin.Context) {
 		parts := GetTokenKeyParts(c)
 		key := parts[0]
 
-		// Validate the API token against the database
-		token, err := model.ValidateUserToken(key)
+		// Validate the API token against the database, or the JWT against its issuer
+		var token *model.Token
+		var authorization *jwtAuthorization
+		var err error
+		if isJWT(key) {
+			if authorization, err = authenticateJWT(ctx, key); err == nil {
+				token = authorization.token
+				if authorization.group != "" {
+					c.Set(ctxkey.Group, authorization.group)
+				}
+			}
+		} else {
+			token, err = model.ValidateUserToken(key)
+		}
 		if err != nil {
 			AbortWithError(c, http.StatusUnauthorized, err)
 			return
@@ -184,6 +216,15 @@ func TokenAuth() func(c *gin.Context) {
 			AbortWithError(c, http.StatusForbidden, errors.New("User has been banned"))
 			return
 		}
+		ban, err := model.CacheGetUserBan(token.UserId)
+		if err != nil {
+			AbortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if ban != nil {
+			AbortWithError(c, http.StatusForbidden, errors.New(ban.Message()))
+			return
+		}
 
 		// Extract and validate the requested model (for AI/ML API endpoints)
 		requestModel, err := getRequestModel(c)
@@ -202,6 +243,32 @@ func TokenAuth() func(c *gin.Context) {
 			}
 		}
 
+		// Check the model restrictions of the JWT claims
+		if authorization != nil && authorization.models != nil {
+			models := allowedModels(authorization.models, token.GetModels())
+			c.Set(ctxkey.AvailableModels, strings.Join(models, ","))
+			if requestModel != "" && !slices.Contains(models, requestModel) {
+				AbortWithError(c, http.StatusForbidden, errors.Errorf("This JWT does not have permission to use the model: %s", requestModel))
+				return
+			}
+		}
+
+		// Check the model restrictions of the token owner's group, or of the JWT's group
+		if requestModel != "" {
+			userGroup := c.GetString(ctxkey.Group)
+			if userGroup == "" {
+				userGroup, err = model.CacheGetUserGroup(token.UserId)
+				if err != nil {
+					AbortWithError(c, http.StatusInternalServerError, err)
+					return
+				}
+			}
+			if !model.IsGroupModelAllowed(userGroup, requestModel) {
+				AbortWithError(c, http.StatusForbidden, errors.Errorf("Group %s does not have permission to use the model: %s", userGroup, requestModel))
+				return
+			}
+		}
+
 		// Set token-related context for downstream handlers
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
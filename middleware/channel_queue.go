@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// channelQueuePollInterval is how often the first waiter of a queue looks for a channel
+// when it is not woken earlier.
+const channelQueuePollInterval = time.Second
+
+// channelWaiter is a request waiting for a channel.
+type channelWaiter struct {
+	group    string
+	priority int
+	wake     chan struct{}
+	// channel is the channel the dispatch found for the waiter, guarded by channelQueuesMux
+	channel *model.Channel
+}
+
+var (
+	// channelQueues holds the waiters per model, by priority and then arrival. The groups
+	// of a model compete for the same channels, so they wait in the same queue.
+	channelQueues    = make(map[string][]*channelWaiter)
+	channelQueuesMux sync.Mutex
+)
+
+// enqueueChannelWaiter adds a waiter of the group behind the waiters of the same or a
+// higher priority, it returns nil if the queue is full.
+func enqueueChannelWaiter(group string, modelName string, priority int) *channelWaiter {
+	channelQueuesMux.Lock()
+	defer channelQueuesMux.Unlock()
+	queue := channelQueues[modelName]
+	if len(queue) >= config.ChannelQueueMaxDepth {
+		return nil
+	}
+	waiter := &channelWaiter{group: group, priority: priority, wake: make(chan struct{}, 1)}
+	idx := len(queue)
+	for i, w := range queue {
+		if w.priority < priority {
+			idx = i
+			break
+		}
+	}
+	queue = append(queue, nil)
+	copy(queue[idx+1:], queue[idx:])
+	queue[idx] = waiter
+	channelQueues[modelName] = queue
+	if idx > 0 {
+		// the first waiter dispatches, it tries the group of the new waiter at once
+		wakeChannelWaiter(queue[0])
+	}
+	updateChannelQueueDepth(queue, group, modelName)
+	return waiter
+}
+
+// dequeueChannelWaiter removes the waiter and wakes the next one.
+func dequeueChannelWaiter(modelName string, waiter *channelWaiter) {
+	channelQueuesMux.Lock()
+	defer channelQueuesMux.Unlock()
+	queue := channelQueues[modelName]
+	for i, w := range queue {
+		if w == waiter {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(channelQueues, modelName)
+	} else {
+		channelQueues[modelName] = queue
+		wakeChannelWaiter(queue[0])
+	}
+	updateChannelQueueDepth(queue, waiter.group, modelName)
+}
+
+// updateChannelQueueDepth reports the number of waiters of the group in the queue of the model.
+func updateChannelQueueDepth(queue []*channelWaiter, group string, modelName string) {
+	depth := 0
+	for _, w := range queue {
+		if w.group == group {
+			depth++
+		}
+	}
+	metrics.GlobalRecorder.UpdateChannelQueueDepth(group, modelName, depth)
+}
+
+// isFirstChannelWaiter reports whether the waiter is first in the queue of the model.
+func isFirstChannelWaiter(modelName string, waiter *channelWaiter) bool {
+	channelQueuesMux.Lock()
+	defer channelQueuesMux.Unlock()
+	queue := channelQueues[modelName]
+	return len(queue) > 0 && queue[0] == waiter
+}
+
+// hasChannelWaiters reports whether requests of any group wait for a channel of the model.
+func hasChannelWaiters(modelName string) bool {
+	channelQueuesMux.Lock()
+	defer channelQueuesMux.Unlock()
+	return len(channelQueues[modelName]) > 0
+}
+
+// WakeChannelQueue wakes the first request waiting for a channel of the model,
+// e.g. when a channel has a free slot again.
+func WakeChannelQueue(modelName string) {
+	channelQueuesMux.Lock()
+	defer channelQueuesMux.Unlock()
+	if queue := channelQueues[modelName]; len(queue) > 0 {
+		wakeChannelWaiter(queue[0])
+	}
+}
+
+func wakeChannelWaiter(waiter *channelWaiter) {
+	select {
+	case waiter.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeDispatchedChannel returns the channel the dispatch found for the waiter, or nil.
+func takeDispatchedChannel(waiter *channelWaiter) *model.Channel {
+	channelQueuesMux.Lock()
+	defer channelQueuesMux.Unlock()
+	channel := waiter.channel
+	waiter.channel = nil
+	return channel
+}
+
+// dispatchChannelQueue looks for a channel for the waiters of the model in the order of
+// the queue, trying each group once, and hands the first channel found to the first
+// waiter of its group. So a waiter is only passed over when its own group has no
+// channel. It returns when the earliest suspension of the groups tried ends, or nil.
+func dispatchChannelQueue(modelName string) (resumeTime *time.Time) {
+	channelQueuesMux.Lock()
+	waiters := append([]*channelWaiter(nil), channelQueues[modelName]...)
+	channelQueuesMux.Unlock()
+
+	tried := make(map[string]bool)
+	for _, waiter := range waiters {
+		if tried[waiter.group] {
+			continue
+		}
+		tried[waiter.group] = true
+		// the database knows about expired suspensions before the channel cache does
+		channel, err := model.GetRandomSatisfiedChannel(waiter.group, modelName, true)
+		if err != nil {
+			if groupResumeTime, err := model.GetAbilityResumeTime(waiter.group, modelName); err == nil && groupResumeTime != nil &&
+				(resumeTime == nil || groupResumeTime.Before(*resumeTime)) {
+				resumeTime = groupResumeTime
+			}
+			continue
+		}
+
+		channelQueuesMux.Lock()
+		waiter.channel = channel
+		wakeChannelWaiter(waiter)
+		channelQueuesMux.Unlock()
+		return nil
+	}
+	return resumeTime
+}
+
+// waitForChannel holds the request until a channel of the model is available in the group
+// or config.ChannelQueueTimeout passes. The requests of all groups wait for the model in
+// one queue: requests of groups with a higher queue priority are served first, requests
+// of the same priority in order of arrival.
+func waitForChannel(c *gin.Context, group string, modelName string) (*model.Channel, error) {
+	startTime := time.Now()
+	waiter := enqueueChannelWaiter(group, modelName, model.GetGroupQueuePriority(group))
+	if waiter == nil {
+		return nil, errors.Errorf("%d requests are already waiting", config.ChannelQueueMaxDepth)
+	}
+	served := false
+	defer func() {
+		dequeueChannelWaiter(modelName, waiter)
+		metrics.GlobalRecorder.RecordChannelQueueWait(group, modelName, time.Since(startTime), served)
+	}()
+
+	deadline := time.NewTimer(time.Duration(config.ChannelQueueTimeout) * time.Second)
+	defer deadline.Stop()
+	for {
+		poll := channelQueuePollInterval
+		if isFirstChannelWaiter(modelName, waiter) {
+			if resumeTime := dispatchChannelQueue(modelName); resumeTime != nil {
+				poll = min(poll, max(time.Until(*resumeTime), 10*time.Millisecond))
+			}
+		}
+		if channel := takeDispatchedChannel(waiter); channel != nil {
+			served = true
+			return channel, nil
+		}
+
+		timer := time.NewTimer(poll)
+		select {
+		case <-waiter.wake:
+		case <-timer.C:
+		case <-deadline.C:
+			timer.Stop()
+			return nil, errors.Errorf("no channel became available within %ds", config.ChannelQueueTimeout)
+		case <-c.Request.Context().Done():
+			timer.Stop()
+			return nil, errors.Wrap(c.Request.Context().Err(), "request canceled while waiting for a channel")
+		}
+		timer.Stop()
+	}
+}
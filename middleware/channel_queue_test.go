@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestChannelQueueOrder(t *testing.T) {
+	originalDepth := config.ChannelQueueMaxDepth
+	config.ChannelQueueMaxDepth = 3
+	defer func() { config.ChannelQueueMaxDepth = originalDepth }()
+
+	low := enqueueChannelWaiter("default", "gpt-4o", 0)
+	high := enqueueChannelWaiter("default", "gpt-4o", 10)
+	lateHigh := enqueueChannelWaiter("default", "gpt-4o", 10)
+	require.NotNil(t, low)
+	require.NotNil(t, high)
+	require.NotNil(t, lateHigh)
+	assert.Nil(t, enqueueChannelWaiter("vip", "gpt-4o", 20), "the queue is full")
+	assert.False(t, hasChannelWaiters("gpt-4"))
+
+	for _, waiter := range []*channelWaiter{high, lateHigh, low} {
+		assert.True(t, isFirstChannelWaiter("gpt-4o", waiter))
+		dequeueChannelWaiter("gpt-4o", waiter)
+	}
+	assert.False(t, hasChannelWaiters("gpt-4o"))
+	// the next waiter is woken when the first leaves
+	select {
+	case <-low.wake:
+	default:
+		t.Fatal("the last waiter was not woken")
+	}
+}
+
+func TestWaitForChannel(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.Ability{}))
+	originalDB, originalSQLite, originalTimeout := model.DB, common.UsingSQLite, config.ChannelQueueTimeout
+	model.DB, common.UsingSQLite, config.ChannelQueueTimeout = db, true, 1
+	defer func() {
+		model.DB, common.UsingSQLite, config.ChannelQueueTimeout = originalDB, originalSQLite, originalTimeout
+	}()
+
+	priority := int64(0)
+	channel := model.Channel{Id: 1, Name: "openai", Status: model.ChannelStatusEnabled, Models: "gpt-4o", Group: "default", Priority: &priority}
+	require.NoError(t, db.Create(&channel).Error)
+	require.NoError(t, channel.AddAbilities())
+	require.NoError(t, model.SuspendAbility(context.Background(), "default", "gpt-4o", 1, 300*time.Millisecond))
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	start := time.Now()
+	selected, err := waitForChannel(c, "default", "gpt-4o")
+	require.NoError(t, err)
+	assert.Equal(t, 1, selected.Id)
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+	assert.False(t, hasChannelWaiters("gpt-4o"))
+
+	require.NoError(t, model.SuspendAbility(context.Background(), "default", "gpt-4o", 1, time.Minute))
+	_, err = waitForChannel(c, "default", "gpt-4o")
+	assert.ErrorContains(t, err, "within 1s")
+}
+
+func TestWaitForChannel_GroupPriority(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.Ability{}, &model.Group{}, &model.GroupModelRatio{}))
+	originalDB, originalSQLite, originalTimeout := model.DB, common.UsingSQLite, config.ChannelQueueTimeout
+	model.DB, common.UsingSQLite, config.ChannelQueueTimeout = db, true, 5
+	defer func() {
+		require.NoError(t, db.Where("1 = 1").Delete(&model.Group{}).Error)
+		model.InitGroupCache()
+		model.DB, common.UsingSQLite, config.ChannelQueueTimeout = originalDB, originalSQLite, originalTimeout
+	}()
+	queuePriority := 10
+	require.NoError(t, (&model.Group{Name: "vip", QueuePriority: &queuePriority}).Insert())
+	require.Equal(t, 10, model.GetGroupQueuePriority("vip"))
+
+	// both groups share the only channel of the model
+	priority := int64(0)
+	channel := model.Channel{Id: 1, Name: "openai", Status: model.ChannelStatusEnabled, Models: "gpt-4o", Group: "default,vip", Priority: &priority}
+	require.NoError(t, db.Create(&channel).Error)
+	require.NoError(t, channel.AddAbilities())
+	for _, group := range []string{"default", "vip"} {
+		require.NoError(t, model.SuspendAbility(context.Background(), group, "gpt-4o", 1, 300*time.Millisecond))
+	}
+
+	served := make(chan string, 2)
+	wait := func(group string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		_, err := waitForChannel(c, group, "gpt-4o")
+		assert.NoError(t, err)
+		served <- group
+	}
+	go wait("default")
+	require.Eventually(t, func() bool { return hasChannelWaiters("gpt-4o") }, time.Second, time.Millisecond)
+	// the vip request arrives later but waits ahead of the default one
+	go wait("vip")
+	require.Eventually(t, func() bool {
+		channelQueuesMux.Lock()
+		defer channelQueuesMux.Unlock()
+		return len(channelQueues["gpt-4o"]) == 2
+	}, time.Second, time.Millisecond)
+	channelQueuesMux.Lock()
+	assert.Equal(t, "vip", channelQueues["gpt-4o"][0].group)
+	channelQueuesMux.Unlock()
+
+	assert.Equal(t, "vip", <-served)
+	assert.Equal(t, "default", <-served)
+	assert.False(t, hasChannelWaiters("gpt-4o"))
+}
+
+func TestDispatchChannelQueue_SkipsGroupsWithoutChannel(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.Ability{}))
+	originalDB, originalSQLite, originalDepth := model.DB, common.UsingSQLite, config.ChannelQueueMaxDepth
+	model.DB, common.UsingSQLite, config.ChannelQueueMaxDepth = db, true, 10
+	defer func() {
+		model.DB, common.UsingSQLite, config.ChannelQueueMaxDepth = originalDB, originalSQLite, originalDepth
+	}()
+
+	// only the default group has a channel of the model
+	priority := int64(0)
+	channel := model.Channel{Id: 1, Name: "openai", Status: model.ChannelStatusEnabled, Models: "gpt-4o", Group: "default", Priority: &priority}
+	require.NoError(t, db.Create(&channel).Error)
+	require.NoError(t, channel.AddAbilities())
+
+	vip := enqueueChannelWaiter("vip", "gpt-4o", 10)
+	other := enqueueChannelWaiter("default", "gpt-4o", 0)
+	defer dequeueChannelWaiter("gpt-4o", vip)
+	defer dequeueChannelWaiter("gpt-4o", other)
+
+	assert.Nil(t, dispatchChannelQueue("gpt-4o"))
+	assert.Nil(t, takeDispatchedChannel(vip))
+	dispatched := takeDispatchedChannel(other)
+	require.NotNil(t, dispatched)
+	assert.Equal(t, 1, dispatched.Id)
+}
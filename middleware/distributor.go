@@ -9,6 +9,7 @@ import (
 	gutils "github.com/Laisky/go-utils/v5"
 	"github.com/gin-gonic/gin"
 
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
@@ -23,10 +24,20 @@ type ModelRequest struct {
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		userId := c.GetInt(ctxkey.Id)
-		userGroup, _ := model.CacheGetUserGroup(userId)
-		c.Set(ctxkey.Group, userGroup)
+		// a JWT may have set the group of the call already
+		userGroup := c.GetString(ctxkey.Group)
+		if userGroup == "" {
+			userGroup, _ = model.CacheGetUserGroup(userId)
+			c.Set(ctxkey.Group, userGroup)
+		}
+		if !checkGroupRateLimit(c, userGroup, userId) {
+			AbortWithError(c, http.StatusTooManyRequests, errors.Errorf("Group %s rate limit exceeded", userGroup))
+			return
+		}
+		c.Set(ctxkey.RoutingGroup, userGroup)
 		var requestModel string
 		var channel *model.Channel
+		virtualModel, targetIdx := model.GetVirtualModel(c.GetString(ctxkey.RequestModel)), 0
 		channelId := c.GetInt(ctxkey.SpecificChannelId)
 		if channelId != 0 {
 			var err error
@@ -39,11 +50,38 @@ func Distribute() func(c *gin.Context) {
 				AbortWithError(c, http.StatusForbidden, errors.New("The channel has been disabled"))
 				return
 			}
+			if virtualModel != nil {
+				// the channel is fixed, so the virtual model can only resolve to its first target
+				targets, _ := virtualModel.GetTargets()
+				requestModel = targets[0].Model
+				if !model.IsGroupModelAllowed(userGroup, requestModel) {
+					AbortWithError(c, http.StatusForbidden, errors.Errorf("Group %s does not have permission to use the model: %s", userGroup, requestModel))
+					return
+				}
+			}
+		} else if virtualModel != nil {
+			var err error
+			channel, targetIdx, err = SelectVirtualModelChannel(virtualModel, 0, userGroup, nil)
+			if err != nil {
+				AbortWithError(c, http.StatusServiceUnavailable, err)
+				return
+			}
+			targets, _ := virtualModel.GetTargets()
+			requestModel = targets[targetIdx].Model
 		} else {
 			requestModel = c.GetString(ctxkey.RequestModel)
 			var err error
-			// First try to get highest priority channels
-			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			if config.ChannelQueueTimeout > 0 && hasChannelWaiters(requestModel) {
+				// queue behind the requests already waiting, so they are served first
+				channel, err = waitForChannel(c, userGroup, requestModel)
+				if err != nil {
+					AbortWithError(c, http.StatusServiceUnavailable, errors.Errorf("No available channels for Model %s under Group %s: %s", requestModel, userGroup, err.Error()))
+					return
+				}
+			} else {
+				// First try to get highest priority channels
+				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			}
 			if err != nil {
 				// If no highest priority channels available, try lower priority channels as fallback
 				logger.Logger.Info(fmt.Sprintf("No highest priority channels available for model %s in group %s, trying lower priority channels", requestModel, userGroup))
@@ -53,31 +91,47 @@ func Distribute() func(c *gin.Context) {
 					if channel != nil {
 						logger.Logger.Error(fmt.Sprintf("Channel does not exist: %d", channel.Id))
 						message = "Database consistency has been broken, please contact the administrator"
+					} else if config.ChannelQueueTimeout > 0 {
+						// every channel is suspended, wait until one resumes
+						if channel, err = waitForChannel(c, userGroup, requestModel); err != nil {
+							message += ": " + err.Error()
+						}
+					}
+					if err != nil {
+						AbortWithError(c, http.StatusServiceUnavailable, errors.New(message))
+						return
 					}
-					AbortWithError(c, http.StatusServiceUnavailable, errors.New(message))
-					return
 				}
 			}
 		}
 		logger.Logger.Debug(fmt.Sprintf("user id %d, user group: %s, request model: %s, using channel #%d", userId, userGroup, requestModel, channel.Id))
 		SetupContextForSelectedChannel(c, channel, requestModel)
+		if virtualModel != nil {
+			if err := ApplyVirtualModelTarget(c, virtualModel, targetIdx, userGroup); err != nil {
+				AbortWithError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
 		c.Next()
 	}
 }
 
 func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
-	// one channel could relates to multiple groups,
-	// and each groud has individual ratio,
-	// set minimal group ratio as channel_ratio
-	var minimalRatio float64 = -1
-	for _, grp := range strings.Split(channel.Group, ",") {
-		v := ratio.GetGroupRatio(grp)
-		if minimalRatio < 0 || v < minimalRatio {
-			minimalRatio = v
+	// bill with the ratio of the caller's group for the model. Without a caller,
+	// e.g. when testing channels, fall back to the minimal ratio of the channel's groups
+	var channelRatio float64 = -1
+	if userGroup := c.GetString(ctxkey.Group); userGroup != "" {
+		channelRatio = ratio.GetGroupModelRatio(userGroup, modelName)
+	} else {
+		for _, grp := range strings.Split(channel.Group, ",") {
+			v := ratio.GetGroupRatio(grp)
+			if channelRatio < 0 || v < channelRatio {
+				channelRatio = v
+			}
 		}
 	}
-	logger.Logger.Info(fmt.Sprintf("set channel %s ratio to %f", channel.Name, minimalRatio))
-	c.Set(ctxkey.ChannelRatio, minimalRatio)
+	logger.Logger.Info(fmt.Sprintf("set channel %s ratio to %f", channel.Name, channelRatio))
+	c.Set(ctxkey.ChannelRatio, channelRatio)
 	c.Set(ctxkey.ChannelModel, channel)
 
 	// generate an unique cost id for each request
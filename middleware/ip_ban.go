@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/blacklist"
+)
+
+// IPBan rejects the requests of banned networks before any authentication is tried.
+func IPBan() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if blacklist.IsIPBanned(c.ClientIP()) {
+			AbortWithError(c, http.StatusForbidden, errors.New("Your IP address has been banned"))
+			return
+		}
+		c.Next()
+	}
+}
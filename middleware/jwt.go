@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+	gocache "github.com/patrickmn/go-cache"
+
+	"github.com/songquanpeng/one-api/common/jwks"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// jwtMethods are the signature algorithms accepted for JWTs, all asymmetric, so that
+// a public key of the key set can never be used as an HMAC secret.
+var jwtMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// jwtTokenKeys caches the key of the token a JWT identity is charged to, the token
+// itself is still validated on every call.
+var jwtTokenKeys = gocache.New(time.Minute, 10*time.Minute)
+
+// jwtAuthorization is what the claims of a JWT grant a relay call.
+type jwtAuthorization struct {
+	// token is the token of the user the call is charged to
+	token *model.Token
+	// group replaces the group of the user if set
+	group string
+	// models restricts the models of the call if not nil
+	models []string
+}
+
+// isJWT reports whether the key of a request is a JWT rather than a token key, JWTs
+// are three base64url parts with a JSON header.
+func isJWT(key string) bool {
+	return strings.HasPrefix(key, "eyJ") && strings.Count(key, ".") == 2
+}
+
+// authenticateJWT verifies the JWT with the keys of its issuer and maps its claims to
+// the user, the token whose quota is used, the group and the allowed models.
+func authenticateJWT(ctx context.Context, raw string) (*jwtAuthorization, error) {
+	var provider *model.IdentityProvider
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(jwtMethods))
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		issuer, _ := claims["iss"].(string)
+		if provider = model.GetJWTIssuer(issuer); provider == nil {
+			return nil, errors.Errorf("unknown issuer %q", issuer)
+		}
+		kid, _ := token.Header["kid"].(string)
+		return jwks.Key(ctx, provider.JwksURL, kid)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid JWT")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("invalid JWT: exp is required")
+	}
+	if provider.Audience != "" && !claims.VerifyAudience(provider.Audience, true) {
+		return nil, errors.Errorf("invalid JWT: audience %s is required", provider.Audience)
+	}
+
+	names := provider.GetClaims()
+	tokenName := provider.TokenName
+	if values := model.ClaimValues(claims, names.Token); len(values) > 0 {
+		tokenName = values[0]
+	}
+	if tokenName == "" {
+		return nil, errors.Errorf("JWT of issuer %s names no token to charge", provider.Issuer)
+	}
+	key, err := jwtTokenKey(provider, claims, tokenName)
+	if err != nil {
+		return nil, err
+	}
+	token, err := model.ValidateUserToken(key)
+	if err != nil {
+		return nil, err
+	}
+
+	authorization := &jwtAuthorization{
+		token: token,
+		group: provider.MapGroup(model.ClaimValues(claims, names.Group)),
+	}
+	if values := model.ClaimValues(claims, names.Models); len(values) > 0 {
+		authorization.models = []string{}
+		for _, value := range values {
+			authorization.models = append(authorization.models, strings.FieldsFunc(value, func(r rune) bool {
+				return r == ',' || r == ' '
+			})...)
+		}
+	}
+	return authorization, nil
+}
+
+// jwtTokenKey returns the key of the named token of the user linked to the subject of
+// the JWT at its issuer.
+func jwtTokenKey(provider *model.IdentityProvider, claims jwt.MapClaims, tokenName string) (string, error) {
+	var subject string
+	if values := model.ClaimValues(claims, provider.GetClaims().Subject); len(values) > 0 {
+		subject = values[0]
+	}
+	cacheKey := strings.Join([]string{provider.Name, subject, tokenName}, "\x00")
+	if key, ok := jwtTokenKeys.Get(cacheKey); ok {
+		return key.(string), nil
+	}
+
+	user, err := model.GetUserByIdentity(provider.Name, subject)
+	if err != nil {
+		return "", errors.Errorf("no user is linked to %q of JWT issuer %s", subject, provider.Issuer)
+	}
+	if user.Role >= model.RoleAdminUser && !provider.AllowAdmins {
+		return "", errors.Errorf("JWTs of issuer %s cannot act for admins", provider.Issuer)
+	}
+	token, err := model.GetTokenByName(user.Id, tokenName)
+	if err != nil {
+		return "", errors.Errorf("user %d has no token %q", user.Id, tokenName)
+	}
+	jwtTokenKeys.SetDefault(cacheKey, token.Key)
+	return token.Key, nil
+}
+
+// allowedModels returns the models of the list that are also in the allowed list.
+func allowedModels(models []string, allowed string) []string {
+	if allowed == "" {
+		return models
+	}
+	var kept []string
+	for _, m := range models {
+		if isModelInList(m, allowed) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
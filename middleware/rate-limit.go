@@ -16,6 +16,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
 )
 
 var timeFormat = "2006-01-02T15:04:05.000Z"
@@ -156,6 +157,21 @@ func ChannelRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(maxRequestNum, config.ChannelRateLimitDuration, "CR")
 }
 
+// checkGroupRateLimit enforces the default RPM of the user's group, counted per user
+func checkGroupRateLimit(c *gin.Context, group string, userId int) bool {
+	rpm := model.GetGroupRPM(group)
+	if rpm <= 0 || config.DebugEnabled {
+		return true
+	}
+
+	key := fmt.Sprintf("rateLimit:GP:%s:%d", group, userId)
+	if common.RedisEnabled {
+		return checkRedisRateLimit(c, key, rpm, 60)
+	}
+	inMemoryRateLimiter.Init(config.RateLimitKeyExpirationDuration)
+	return inMemoryRateLimiter.Request(key, rpm, 60)
+}
+
 // TotpRateLimit limits TOTP verification attempts to 1 per second per user
 func TotpRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(1, 1, "TOTP")
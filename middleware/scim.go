@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/controller/scim"
+)
+
+// SCIMAuth authenticates SCIM clients by the bearer token of the SCIMToken option,
+// the endpoint is disabled while the option is empty.
+func SCIMAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if config.SCIMToken == "" {
+			scim.AbortWithError(c, http.StatusForbidden, "", "SCIM provisioning is disabled")
+			return
+		}
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(config.SCIMToken)) != 1 {
+			scim.AbortWithError(c, http.StatusUnauthorized, "", "invalid SCIM token")
+			return
+		}
+		c.Next()
+	}
+}
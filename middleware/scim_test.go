@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestSCIMAuth(t *testing.T) {
+	originalToken := config.SCIMToken
+	defer func() { config.SCIMToken = originalToken }()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/scim/v2/Users", SCIMAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	config.SCIMToken = ""
+	assert.Equal(t, http.StatusForbidden, request("Bearer "))
+
+	config.SCIMToken = "scim-secret"
+	assert.Equal(t, http.StatusOK, request("Bearer scim-secret"))
+	assert.Equal(t, http.StatusUnauthorized, request("Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, request("scim-secret"))
+	assert.Equal(t, http.StatusUnauthorized, request(""))
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
+)
+
+// transcriptRedactionMargin is captured beyond TranscriptMaxBodyBytes so that a match
+// crossing the cut is still redacted before the body is cut.
+const transcriptRedactionMargin = 256
+
+// CaptureTranscript stores the request and response bodies of the requests opted in to
+// transcript capture by a model.TranscriptRule. It must run after TokenAuth.
+func CaptureTranscript() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := model.GetTranscriptRule(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId))
+		if rule == nil || rand.Float64() >= rule.SampleRate {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		writer := &transcriptWriter{ResponseWriter: c.Writer, limit: config.TranscriptMaxBodyBytes + transcriptRedactionMargin}
+		c.Writer = writer
+		c.Next()
+
+		// the body of a virtual model request was rewritten for its target
+		requestBody, _ := c.Get(ctxkey.VirtualModelRequestBody)
+		body, ok := requestBody.([]byte)
+		if !ok {
+			body, _ = common.GetRequestBody(c)
+		}
+		transcript := &model.Transcript{
+			RequestId:   c.GetString(ctxkey.RequestId),
+			UserId:      c.GetInt(ctxkey.Id),
+			TokenId:     c.GetInt(ctxkey.TokenId),
+			ChannelId:   c.GetInt(ctxkey.ChannelId),
+			ModelName:   c.GetString(ctxkey.RequestModel),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			StatusCode:  writer.Status(),
+			IsStream:    strings.HasPrefix(writer.Header().Get("Content-Type"), "text/event-stream"),
+			ElapsedTime: time.Since(start).Milliseconds(),
+		}
+		requestSize := len(body)
+		if requestSize > writer.limit {
+			body = body[:writer.limit]
+		}
+		requestContentType := c.Request.Header.Get("Content-Type")
+		responseContentType := writer.Header().Get("Content-Type")
+		responseBody, responseSize := writer.body.Bytes(), writer.size
+		go saveTranscript(transcript, rule, body, requestSize, requestContentType, responseBody, responseSize, responseContentType)
+	}
+}
+
+// saveTranscript redacts and cuts the bodies and writes the transcript. A transcript
+// whose redaction fails is dropped rather than stored unredacted.
+func saveTranscript(transcript *model.Transcript, rule *model.TranscriptRule,
+	requestBody []byte, requestSize int, requestContentType string,
+	responseBody []byte, responseSize int, responseContentType string) {
+	redactor, err := contentpolicy.NewRedactor(rule.RedactPII, model.SplitTranscriptRedactPatterns(rule.RedactPatterns))
+	if err != nil {
+		logger.Logger.Error("failed to redact transcript, dropping it",
+			zap.String("request_id", transcript.RequestId), zap.Error(err))
+		return
+	}
+	transcript.RequestBody, transcript.RequestTruncated = transcriptBody(redactor, requestBody, requestSize, requestContentType)
+	transcript.ResponseBody, transcript.ResponseTruncated = transcriptBody(redactor, responseBody, responseSize, responseContentType)
+	if err := transcript.Insert(); err != nil {
+		logger.Logger.Error("failed to save transcript", zap.String("request_id", transcript.RequestId), zap.Error(err))
+	}
+}
+
+// transcriptBody returns the redacted body cut to TranscriptMaxBodyBytes, size is the
+// size of the whole body. Bodies that are not text are replaced by a description.
+func transcriptBody(redactor *contentpolicy.Redactor, body []byte, size int, contentType string) (string, bool) {
+	if !isTextContentType(contentType) {
+		return fmt.Sprintf("[%s body of %d bytes]", contentType, size), false
+	}
+	text := redactor.Redact(string(body))
+	truncated := size > len(body)
+	if len(text) > config.TranscriptMaxBodyBytes {
+		// a rune cut in half is dropped
+		text = strings.ToValidUTF8(text[:config.TranscriptMaxBodyBytes], "")
+		truncated = true
+	}
+	return text, truncated
+}
+
+func isTextContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// transcriptWriter keeps the first limit bytes of the response.
+type transcriptWriter struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+	size  int
+}
+
+func (w *transcriptWriter) capture(data []byte) {
+	w.size += len(data)
+	if remaining := w.limit - w.body.Len(); remaining > 0 {
+		if len(data) > remaining {
+			data = data[:remaining]
+		}
+		w.body.Write(data)
+	}
+}
+
+func (w *transcriptWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.capture(data[:n])
+	return n, err
+}
+
+func (w *transcriptWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.capture([]byte(s[:n]))
+	return n, err
+}
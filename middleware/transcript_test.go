@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestCaptureTranscript(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.TranscriptRule{}, &model.Transcript{}))
+	originalDB, originalLogDB, originalMaxBytes := model.DB, model.LOG_DB, config.TranscriptMaxBodyBytes
+	model.DB, model.LOG_DB, config.TranscriptMaxBodyBytes = db, db, 96
+	t.Cleanup(func() {
+		require.NoError(t, db.Where("1 = 1").Delete(&model.TranscriptRule{}).Error)
+		model.InitTranscriptRuleCache()
+		model.DB, model.LOG_DB, config.TranscriptMaxBodyBytes = originalDB, originalLogDB, originalMaxBytes
+	})
+	require.NoError(t, (&model.TranscriptRule{TokenId: 5, SampleRate: 1, RedactPII: "email",
+		RedactPatterns: `sk-[a-z0-9]+`, Enabled: true}).Insert())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set(ctxkey.Id, 1)
+		if c.GetHeader("X-Token-Id") == "5" {
+			c.Set(ctxkey.TokenId, 5)
+		}
+		c.Set(ctxkey.RequestId, c.GetHeader("X-Request-Id"))
+		c.Next()
+	}, CaptureTranscript(), func(c *gin.Context) {
+		c.Set(ctxkey.RequestModel, "gpt-4o")
+		c.Set(ctxkey.ChannelId, 3)
+		c.Data(http.StatusOK, "application/json", []byte(`{"content":"write to bob@example.com`+strings.Repeat(".", 100)+`"}`))
+	})
+
+	send := func(requestId string, tokenId string) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+			strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"my key is sk-abc123"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-Id", requestId)
+		req.Header.Set("X-Token-Id", tokenId)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		// the caller receives the response unchanged
+		require.Contains(t, w.Body.String(), "bob@example.com")
+	}
+	send("req-1", "5")
+	send("req-2", "6")
+
+	var transcript *model.Transcript
+	require.Eventually(t, func() bool {
+		transcript, err = model.GetTranscriptByRequestId("req-1")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"my key is [REDACTED]"}]}`, transcript.RequestBody)
+	assert.False(t, transcript.RequestTruncated)
+	assert.Equal(t, `{"content":"write to [REDACTED:email]`+strings.Repeat(".", 96-len(`{"content":"write to [REDACTED:email]`)), transcript.ResponseBody)
+	assert.True(t, transcript.ResponseTruncated)
+	assert.Equal(t, "gpt-4o", transcript.ModelName)
+	assert.Equal(t, 3, transcript.ChannelId)
+	assert.Equal(t, http.StatusOK, transcript.StatusCode)
+
+	// requests of other tokens are not captured
+	time.Sleep(50 * time.Millisecond)
+	_, err = model.GetTranscriptByRequestId("req-2")
+	assert.Error(t, err)
+}
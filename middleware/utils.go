@@ -80,10 +80,13 @@ func isModelInList(modelName string, models string) bool {
 
 // GetTokenKeyParts extracts the token key parts from the Authorization header
 //
-// key like `sk-{token}[-{channelid}]`
+// key like `sk-{token}[-{channelid}]`, a JWT is a single part
 func GetTokenKeyParts(c *gin.Context) []string {
 	key := c.Request.Header.Get("Authorization")
 	key = strings.TrimPrefix(key, "Bearer ")
+	if isJWT(key) {
+		return []string{key}
+	}
 	key = strings.TrimPrefix(strings.TrimPrefix(key, "sk-"), "laisky-")
 	return strings.Split(key, "-")
 }
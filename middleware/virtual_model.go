@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// SelectVirtualModelChannel returns a channel of the first target, starting at the
+// target index from, that has an available channel which is not excluded. Targets whose
+// model the caller's group may not use are skipped, even if they route to another group.
+func SelectVirtualModelChannel(vm *model.VirtualModel, from int, userGroup string, excluded map[int]bool) (*model.Channel, int, error) {
+	targets, err := vm.GetTargets()
+	if err != nil {
+		return nil, -1, err
+	}
+	for idx := from; idx < len(targets); idx++ {
+		target := targets[idx]
+		if !model.IsGroupModelAllowed(userGroup, target.Model) {
+			logger.Logger.Info("the group may not use the virtual model target, trying the next target",
+				zap.String("virtual_model", vm.Name),
+				zap.String("target_model", target.Model),
+				zap.String("group", userGroup))
+			continue
+		}
+		group := target.ChannelGroup(userGroup)
+		channel, err := model.CacheGetRandomSatisfiedChannelExcluding(group, target.Model, false, excluded, false)
+		if err != nil {
+			channel, err = model.CacheGetRandomSatisfiedChannelExcluding(group, target.Model, true, excluded, false)
+		}
+		if err == nil {
+			return channel, idx, nil
+		}
+		logger.Logger.Info("no available channels for virtual model target, trying the next target",
+			zap.String("virtual_model", vm.Name),
+			zap.String("target_model", target.Model),
+			zap.String("group", group))
+	}
+	return nil, -1, errors.Errorf("No available channels for any target of virtual model %s under Group %s", vm.Name, userGroup)
+}
+
+// ApplyVirtualModelTarget routes the request to a target of the virtual model. The model
+// and the parameter overrides of the target are written into the JSON request body, and
+// the request is billed as the target model. It must be called after the channel of the
+// target was set up by SetupContextForSelectedChannel.
+func ApplyVirtualModelTarget(c *gin.Context, vm *model.VirtualModel, idx int, userGroup string) error {
+	targets, err := vm.GetTargets()
+	if err != nil {
+		return err
+	}
+	if idx < 0 || idx >= len(targets) {
+		return errors.Errorf("virtual model %s has no target %d", vm.Name, idx)
+	}
+	target := targets[idx]
+
+	c.Set(ctxkey.VirtualModel, vm)
+	c.Set(ctxkey.VirtualModelTarget, idx)
+	c.Set(ctxkey.RoutingGroup, target.ChannelGroup(userGroup))
+	c.Set(ctxkey.RequestModel, target.Model)
+
+	// multipart requests keep their body, the model is taken from the context
+	if strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		originalBody, ok := c.Get(ctxkey.VirtualModelRequestBody)
+		if !ok {
+			body, err := common.GetRequestBody(c)
+			if err != nil {
+				return errors.Wrap(err, "get request body")
+			}
+			originalBody = body
+			c.Set(ctxkey.VirtualModelRequestBody, body)
+		}
+		body, err := rewriteVirtualModelRequest(originalBody.([]byte), target)
+		if err != nil {
+			return errors.Wrapf(err, "apply target %s of virtual model %s", target.Model, vm.Name)
+		}
+		c.Set(ctxkey.KeyRequestBody, body)
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+	}
+
+	// the relay meta outlives a retry, it has to follow the target
+	if v, ok := c.Get(ctxkey.Meta); ok {
+		relayMeta := v.(*meta.Meta)
+		relayMeta.OriginModelName = target.Model
+		relayMeta.ActualModelName = meta.GetMappedModelName(target.Model, c.GetStringMapString(ctxkey.ModelMapping))
+		relayMeta.ChannelRatio = c.GetFloat64(ctxkey.ChannelRatio)
+	}
+	return nil
+}
+
+// rewriteVirtualModelRequest replaces the model of the request with the target model
+// and applies the parameter overrides of the target.
+func rewriteVirtualModelRequest(body []byte, target model.VirtualModelTarget) ([]byte, error) {
+	// keep the raw values so that e.g. large integers survive the rewrite
+	request := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errors.Wrap(err, "unmarshal request body")
+	}
+	overrides := map[string]any{"model": target.Model}
+	for key, value := range target.Params {
+		overrides[key] = value
+	}
+	for key, value := range overrides {
+		if value == nil {
+			delete(request, key)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal parameter %s", key)
+		}
+		request[key] = encoded
+	}
+
+	rewritten, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal request body")
+	}
+	return rewritten, nil
+}
+
+// GetVirtualModelRoute returns the virtual model the request was sent to and the index
+// of the target serving it, the virtual model is nil for requests to other models.
+func GetVirtualModelRoute(c *gin.Context) (*model.VirtualModel, int) {
+	v, ok := c.Get(ctxkey.VirtualModel)
+	if !ok {
+		return nil, -1
+	}
+	return v.(*model.VirtualModel), c.GetInt(ctxkey.VirtualModelTarget)
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+func setupVirtualModelDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.Ability{}, &model.VirtualModel{}))
+	originalDB, originalSQLite, originalMemoryCache := model.DB, common.UsingSQLite, config.MemoryCacheEnabled
+	model.DB, common.UsingSQLite, config.MemoryCacheEnabled = db, true, false
+	t.Cleanup(func() {
+		// empty the virtual model cache before the database is swapped back
+		require.NoError(t, db.Where("1 = 1").Delete(&model.VirtualModel{}).Error)
+		model.InitVirtualModelCache()
+		model.DB, common.UsingSQLite, config.MemoryCacheEnabled = originalDB, originalSQLite, originalMemoryCache
+	})
+
+	priority := int64(0)
+	for _, channel := range []model.Channel{
+		{Id: 1, Name: "claude", Status: model.ChannelStatusEnabled, Models: "claude-sonnet-4-0", Group: "a", Priority: &priority},
+		{Id: 2, Name: "openai", Status: model.ChannelStatusEnabled, Models: "gpt-4o", Group: "default", Priority: &priority},
+	} {
+		require.NoError(t, db.Create(&channel).Error)
+		require.NoError(t, channel.AddAbilities())
+	}
+}
+
+func TestSelectVirtualModelChannel(t *testing.T) {
+	setupVirtualModelDB(t)
+	vm := &model.VirtualModel{
+		Name:    "smart",
+		Targets: `[{"model":"claude-sonnet-4-0","group":"a"},{"model":"gpt-4o"},{"model":"deepseek-chat"}]`,
+		Enabled: true,
+	}
+	require.NoError(t, vm.Insert())
+	vm = model.GetVirtualModel("smart")
+	require.NotNil(t, vm)
+
+	channel, idx, err := SelectVirtualModelChannel(vm, 0, "default", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, channel.Id)
+	assert.Equal(t, 0, idx)
+
+	// the channel of the first target failed, fall back to the second target
+	channel, idx, err = SelectVirtualModelChannel(vm, 0, "default", map[int]bool{1: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, channel.Id)
+	assert.Equal(t, 1, idx)
+
+	// deepseek-chat has no channel
+	_, _, err = SelectVirtualModelChannel(vm, 2, "default", nil)
+	assert.Error(t, err)
+}
+
+func TestSelectVirtualModelChannel_GroupPolicy(t *testing.T) {
+	setupVirtualModelDB(t)
+	require.NoError(t, model.DB.AutoMigrate(&model.Group{}, &model.GroupModelRatio{}))
+	t.Cleanup(func() {
+		require.NoError(t, model.DB.Where("1 = 1").Delete(&model.Group{}).Error)
+		model.InitGroupCache()
+	})
+	require.NoError(t, (&model.Group{Name: "default", DeniedModels: "claude-sonnet-4-0"}).Insert())
+
+	vm := &model.VirtualModel{
+		Name:    "smart",
+		Targets: `[{"model":"claude-sonnet-4-0","group":"a"},{"model":"gpt-4o"}]`,
+		Enabled: true,
+	}
+	require.NoError(t, vm.Insert())
+	vm = model.GetVirtualModel("smart")
+	require.NotNil(t, vm)
+
+	// the caller's group may not use the first target, even through the channels of group a
+	channel, idx, err := SelectVirtualModelChannel(vm, 0, "default", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, channel.Id)
+	assert.Equal(t, 1, idx)
+}
+
+func TestApplyVirtualModelTarget(t *testing.T) {
+	setupVirtualModelDB(t)
+	gin.SetMode(gin.TestMode)
+	vm := &model.VirtualModel{
+		Name:    "smart",
+		Targets: `[{"model":"claude-sonnet-4-0","group":"a","params":{"temperature":0.2,"top_p":null}},{"model":"gpt-4o"}]`,
+		Enabled: true,
+	}
+	require.NoError(t, vm.Insert())
+	vm = model.GetVirtualModel("smart")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"smart","seed":12345678901234567,"top_p":0.9,"temperature":1}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(ctxkey.ModelMapping, map[string]string{"gpt-4o": "gpt-4o-2024-11-20"})
+
+	require.NoError(t, ApplyVirtualModelTarget(c, vm, 0, "default"))
+	body, err := common.GetRequestBody(c)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"claude-sonnet-4-0","seed":12345678901234567,"temperature":0.2}`, string(body))
+	assert.Equal(t, "claude-sonnet-4-0", c.GetString(ctxkey.RequestModel))
+	assert.Equal(t, "a", c.GetString(ctxkey.RoutingGroup))
+
+	// a retry falls back to the next target, the rewrite starts from the original body
+	relayMeta := &meta.Meta{OriginModelName: "claude-sonnet-4-0", ActualModelName: "claude-sonnet-4-0"}
+	meta.Set2Context(c, relayMeta)
+	require.NoError(t, ApplyVirtualModelTarget(c, vm, 1, "default"))
+	body, err = common.GetRequestBody(c)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"gpt-4o","seed":12345678901234567,"top_p":0.9,"temperature":1}`, string(body))
+	assert.Equal(t, "default", c.GetString(ctxkey.RoutingGroup))
+	assert.Equal(t, "gpt-4o", relayMeta.OriginModelName)
+	assert.Equal(t, "gpt-4o-2024-11-20", relayMeta.ActualModelName)
+
+	routed, idx := GetVirtualModelRoute(c)
+	assert.Equal(t, vm, routed)
+	assert.Equal(t, 1, idx)
+}
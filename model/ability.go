@@ -9,9 +9,11 @@ import (
 
 	"github.com/Laisky/errors/v2"
 	gutils "github.com/Laisky/go-utils/v5"
+	"github.com/Laisky/zap"
 	"gorm.io/gorm"
 
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/utils"
 )
 
@@ -33,6 +35,8 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 		trueVal = "true"
 	}
 	now := time.Now()
+	// channels at their max concurrency are skipped like suspended ones
+	fullIds := fullChannelIds()
 
 	var err error = nil
 	var channelQuery *gorm.DB
@@ -40,8 +44,14 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 		channelQuery = DB.Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND (suspend_until IS NULL OR suspend_until < ?)", group, model, now)
 	} else {
 		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND (suspend_until IS NULL OR suspend_until < ?)", group, model, now)
+		if len(fullIds) > 0 {
+			maxPrioritySubQuery = maxPrioritySubQuery.Where("channel_id NOT IN (?)", fullIds)
+		}
 		channelQuery = DB.Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND priority = (?) AND (suspend_until IS NULL OR suspend_until < ?)", group, model, maxPrioritySubQuery, now)
 	}
+	if len(fullIds) > 0 {
+		channelQuery = channelQuery.Where("channel_id NOT IN (?)", fullIds)
+	}
 	if common.UsingSQLite || common.UsingPostgreSQL {
 		err = channelQuery.Order("RANDOM()").First(&ability).Error
 	} else {
@@ -185,7 +195,73 @@ func SuspendAbility(ctx context.Context, group string, modelName string, channel
 		Update("suspend_until", suspendTime).Error
 }
 
+// SuspendChannelAbilities sets the SuspendUntil timestamp for every ability of the channel.
+func SuspendChannelAbilities(ctx context.Context, channelId int, duration time.Duration) error {
+	if channelId == 0 {
+		return errors.New("channelId must be specified for suspending abilities")
+	}
+	return DB.Model(&Ability{}).
+		Where("channel_id = ?", channelId).
+		Update("suspend_until", time.Now().Add(duration)).Error
+}
+
+// fullChannelIds returns the ids of the channels serving as many requests as their max concurrency allows.
+func fullChannelIds() []int {
+	limits := getChannelConcurrencyLimits()
+	if len(limits) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(limits))
+	for channelId := range limits {
+		ids = append(ids, channelId)
+	}
+	inFlight, err := common.ChannelsInFlight(context.Background(), ids)
+	if err != nil {
+		logger.Logger.Warn("failed to count in-flight requests", zap.Error(err))
+		return nil
+	}
+	var full []int
+	for _, channelId := range ids {
+		if inFlight[channelId] >= limits[channelId] {
+			full = append(full, channelId)
+		}
+	}
+	return full
+}
+
+// GetAbilityResumeTime returns when the first suspended ability of the model in the group
+// resumes, or nil if none is suspended.
+func GetAbilityResumeTime(group string, modelName string) (*time.Time, error) {
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+	var abilities []Ability
+	err := DB.Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND suspend_until > ?", group, modelName, time.Now()).
+		Order("suspend_until asc").Limit(1).Find(&abilities).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "get ability resume time")
+	}
+	if len(abilities) == 0 {
+		return nil, nil
+	}
+	return abilities[0].SuspendUntil, nil
+}
+
 func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstPriority bool, excludeChannelIds map[int]bool) (*Channel, error) {
+	// channels at their max concurrency are skipped like suspended ones
+	if fullIds := fullChannelIds(); len(fullIds) > 0 {
+		excluded := make(map[int]bool, len(excludeChannelIds)+len(fullIds))
+		for channelId := range excludeChannelIds {
+			excluded[channelId] = true
+		}
+		for _, channelId := range fullIds {
+			excluded[channelId] = true
+		}
+		excludeChannelIds = excluded
+	}
 	ability := Ability{}
 	groupCol := "`group`"
 	trueVal := "1"
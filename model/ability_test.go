@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -194,3 +195,53 @@ func TestGetRandomSatisfiedChannelExcluding_SuspendedChannels(t *testing.T) {
 	assert.NotNil(t, channel)
 	assert.Equal(t, 1, channel.Id, "Should only return the non-suspended channel")
 }
+
+func TestGetRandomSatisfiedChannel_SkipsFullChannels(t *testing.T) {
+	testDB := setupTestDB(t)
+	originalDB, originalSQLite, originalRedis := DB, common.UsingSQLite, common.RedisEnabled
+	DB, common.UsingSQLite, common.RedisEnabled = testDB, true, false
+	defer func() { DB, common.UsingSQLite, common.RedisEnabled = originalDB, originalSQLite, originalRedis }()
+	setChannelConcurrencyLimits(nil)
+	defer setChannelConcurrencyLimits(nil)
+
+	one := 1
+	channels := []Channel{
+		{Id: 1, Name: "ollama", Status: ChannelStatusEnabled, Models: "llama3", Group: "default", Priority: &[]int64{100}[0], MaxConcurrency: &one},
+		{Id: 2, Name: "fallback", Status: ChannelStatusEnabled, Models: "llama3", Group: "default", Priority: &[]int64{10}[0]},
+	}
+	for _, channel := range channels {
+		require.NoError(t, DB.Create(&channel).Error)
+		require.NoError(t, channel.AddAbilities())
+	}
+
+	channel, err := GetRandomSatisfiedChannel("default", "llama3", false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, channel.Id)
+
+	release, ok, err := common.AcquireChannelSlot(context.Background(), 1, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = common.AcquireChannelSlot(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.False(t, ok, "the only slot is taken")
+
+	// the full channel is skipped like a suspended one
+	channel, err = GetRandomSatisfiedChannel("default", "llama3", false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, channel.Id)
+	channel, err = GetRandomSatisfiedChannelExcluding("default", "llama3", false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, channel.Id)
+	assert.Empty(t, skipFullChannels([]*Channel{&channels[0]}))
+	assert.Equal(t, []*Channel{&channels[1]}, skipFullChannels([]*Channel{&channels[0], &channels[1]}))
+	assert.Equal(t, map[int]int{1: 1}, getChannelConcurrencyLimits())
+
+	release()
+	release() // releasing twice frees the slot once
+	inFlight, err := common.ChannelInFlight(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Zero(t, inFlight)
+	channel, err = GetRandomSatisfiedChannel("default", "llama3", false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, channel.Id)
+}
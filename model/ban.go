@@ -0,0 +1,268 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Ban types
+const (
+	// BanTypeUser bans the user UserId from the dashboard and the relay
+	BanTypeUser = "user"
+	// BanTypeIP bans the network Cidr from every route
+	BanTypeIP = "ip"
+)
+
+// Ban bans a user or a network until ExpiredTime. Bans are kept after they expire or
+// are lifted so that the history of a user can be reviewed.
+type Ban struct {
+	Id     int    `json:"id"`
+	Type   string `json:"type" gorm:"type:varchar(16);index"`
+	UserId int    `json:"user_id" gorm:"index;default:0"`
+	// Cidr is the banned network of ip bans, a single address is stored as /32 or /128
+	Cidr   string `json:"cidr" gorm:"type:varchar(64);default:''"`
+	Reason string `json:"reason" gorm:"type:varchar(255)"`
+	// ActorId is the admin who issued the ban
+	ActorId     int   `json:"actor_id"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+	// ExpiredTime is the unix time the ban ends at, 0 never ends
+	ExpiredTime int64 `json:"expired_time" gorm:"bigint;default:0"`
+	// LiftedTime is the unix time an admin lifted the ban at, 0 if it was not lifted
+	LiftedTime int64 `json:"lifted_time" gorm:"bigint;default:0"`
+}
+
+// IsActive reports whether the ban is in force at the unix time.
+func (b *Ban) IsActive(now int64) bool {
+	return b.LiftedTime == 0 && (b.ExpiredTime == 0 || b.ExpiredTime > now)
+}
+
+// validate normalizes the ban and checks its settings.
+func (b *Ban) validate() error {
+	b.Reason = strings.TrimSpace(b.Reason)
+	if len(b.Reason) > 255 {
+		return errors.New("reason must not be longer than 255 characters")
+	}
+	if b.ExpiredTime < 0 {
+		return errors.New("expired time must not be negative")
+	}
+	if b.ExpiredTime != 0 && b.ExpiredTime <= time.Now().Unix() {
+		return errors.New("expired time must be in the future")
+	}
+	switch b.Type {
+	case BanTypeUser:
+		if b.UserId <= 0 {
+			return errors.New("user id is required")
+		}
+		b.Cidr = ""
+	case BanTypeIP:
+		cidr, err := normalizeBanCidr(b.Cidr)
+		if err != nil {
+			return err
+		}
+		b.Cidr, b.UserId = cidr, 0
+	default:
+		return errors.Errorf("unknown ban type %q", b.Type)
+	}
+	return nil
+}
+
+// normalizeBanCidr turns an address or a network into the network in CIDR notation.
+func normalizeBanCidr(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if ip := net.ParseIP(value); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return "", errors.Errorf("invalid IP address or CIDR %q", value)
+	}
+	if ones, _ := network.Mask.Size(); ones == 0 {
+		return "", errors.Errorf("refuse to ban every address with %q", value)
+	}
+	return network.String(), nil
+}
+
+func (b *Ban) Insert() error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	b.CreatedTime = time.Now().Unix()
+	b.LiftedTime = 0
+	if err := DB.Create(b).Error; err != nil {
+		return errors.Wrap(err, "create ban")
+	}
+	b.invalidate()
+	return nil
+}
+
+// Lift ends the ban before it expires.
+func (b *Ban) Lift() error {
+	if b.LiftedTime != 0 {
+		return errors.Errorf("ban %d is already lifted", b.Id)
+	}
+	b.LiftedTime = time.Now().Unix()
+	if err := DB.Model(b).Update("lifted_time", b.LiftedTime).Error; err != nil {
+		return errors.Wrapf(err, "lift ban %d", b.Id)
+	}
+	b.invalidate()
+	return nil
+}
+
+// invalidate drops the cached ban of the user, or reloads the banned networks of every node.
+func (b *Ban) invalidate() {
+	if b.Type == BanTypeIP {
+		invalidateCache(CacheBans)
+		return
+	}
+	if common.RedisEnabled && common.RDB != nil {
+		if err := common.RedisDel(userBanCacheKey(b.UserId)); err != nil {
+			logger.Logger.Error("failed to clear user ban cache", zap.Int("user_id", b.UserId), zap.Error(err))
+		}
+	}
+}
+
+func GetBanById(id int) (*Ban, error) {
+	ban := &Ban{}
+	err := DB.First(ban, "id = ?", id).Error
+	return ban, errors.Wrapf(err, "get ban %d", id)
+}
+
+// GetBans returns a page of the bans, newest first. banType and userId filter if set,
+// active keeps only the bans in force.
+func GetBans(startIdx int, num int, banType string, userId int, active bool) (bans []*Ban, total int64, err error) {
+	query := DB.Model(&Ban{})
+	if banType != "" {
+		query = query.Where("type = ?", banType)
+	}
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if active {
+		query = whereBanActive(query, time.Now().Unix())
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "count bans")
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&bans).Error
+	return bans, total, errors.Wrap(err, "get bans")
+}
+
+// GetActiveUserBan returns the ban in force of the user that ends last, or nil.
+func GetActiveUserBan(userId int) (*Ban, error) {
+	var bans []*Ban
+	err := whereBanActive(DB.Where("type = ? AND user_id = ?", BanTypeUser, userId), time.Now().Unix()).
+		Order("id desc").Find(&bans).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get bans of user %d", userId)
+	}
+	var latest *Ban
+	for _, ban := range bans {
+		if latest == nil || latest.ExpiredTime != 0 && (ban.ExpiredTime == 0 || ban.ExpiredTime > latest.ExpiredTime) {
+			latest = ban
+		}
+	}
+	return latest, nil
+}
+
+func userBanCacheKey(userId int) string {
+	return fmt.Sprintf("user_ban:%d", userId)
+}
+
+// CacheGetUserBan returns the ban in force of the user, or nil. Redis keeps the answer
+// until the ban expires, at most for UserId2StatusCacheSeconds.
+func CacheGetUserBan(userId int) (*Ban, error) {
+	if !common.RedisEnabled {
+		return GetActiveUserBan(userId)
+	}
+	if cached, err := common.RedisGet(userBanCacheKey(userId)); err == nil {
+		if cached == "" {
+			return nil, nil
+		}
+		ban := &Ban{}
+		if err = json.Unmarshal([]byte(cached), ban); err == nil && ban.IsActive(time.Now().Unix()) {
+			return ban, nil
+		}
+	}
+
+	ban, err := GetActiveUserBan(userId)
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(UserId2StatusCacheSeconds) * time.Second
+	cached := ""
+	if ban != nil {
+		payload, err := json.Marshal(ban)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal ban")
+		}
+		cached = string(payload)
+		if ban.ExpiredTime != 0 {
+			ttl = min(ttl, time.Until(time.Unix(ban.ExpiredTime, 0)))
+		}
+	}
+	if ttl > 0 {
+		if err = common.RedisSet(userBanCacheKey(userId), cached, ttl); err != nil {
+			logger.Logger.Error("Redis set user ban error", zap.Error(err))
+		}
+	}
+	return ban, nil
+}
+
+// whereBanActive narrows the query to the bans in force at the unix time.
+func whereBanActive(query *gorm.DB, now int64) *gorm.DB {
+	return query.Where("lifted_time = 0 AND (expired_time = 0 OR expired_time > ?)", now)
+}
+
+// InitBanCache loads the banned networks in force, bans expiring later are dropped by
+// blacklist.IsIPBanned at their expiry.
+func InitBanCache() {
+	var bans []*Ban
+	if err := whereBanActive(DB.Where("type = ?", BanTypeIP), time.Now().Unix()).Find(&bans).Error; err != nil {
+		logger.Logger.Error("failed to load IP bans", zap.Error(err))
+		return
+	}
+	ipBans := make([]blacklist.IPBan, 0, len(bans))
+	for _, ban := range bans {
+		_, network, err := net.ParseCIDR(ban.Cidr)
+		if err != nil {
+			logger.Logger.Warn("skip invalid IP ban", zap.Int("id", ban.Id), zap.String("cidr", ban.Cidr))
+			continue
+		}
+		ipBans = append(ipBans, blacklist.IPBan{Network: network, ExpiredTime: ban.ExpiredTime})
+	}
+	blacklist.SetIPBans(ipBans)
+}
+
+func SyncBanCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing IP bans from database")
+		InitBanCache()
+	}
+}
+
+// Message tells the banned user why and until when they are banned.
+func (b *Ban) Message() string {
+	message := "User has been banned"
+	if b.Reason != "" {
+		message += ": " + b.Reason
+	}
+	if b.ExpiredTime != 0 {
+		message += ", until " + time.Unix(b.ExpiredTime, 0).UTC().Format(time.RFC3339)
+	}
+	return message
+}
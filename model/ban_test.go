@@ -0,0 +1,94 @@
+package model
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+)
+
+func TestBans(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&Ban{}))
+	originalDB, originalRedis := DB, common.RedisEnabled
+	DB, common.RedisEnabled = testDB, false
+	defer func() {
+		DB, common.RedisEnabled = originalDB, originalRedis
+		blacklist.SetIPBans(nil)
+	}()
+
+	for cidr, normalized := range map[string]string{
+		"203.0.113.7":    "203.0.113.7/32",
+		"203.0.113.7/24": "203.0.113.0/24",
+		"2001:db8::1":    "2001:db8::1/128",
+	} {
+		ban := &Ban{Type: BanTypeIP, Cidr: cidr}
+		require.NoError(t, ban.validate(), cidr)
+		assert.Equal(t, normalized, ban.Cidr)
+	}
+	for _, ban := range []*Ban{
+		{Type: BanTypeIP, Cidr: "0.0.0.0/0"},
+		{Type: BanTypeIP, Cidr: "example.com"},
+		{Type: BanTypeUser},
+		{Type: BanTypeUser, UserId: 1, ExpiredTime: time.Now().Add(-time.Minute).Unix()},
+		{Type: "group"},
+	} {
+		assert.Error(t, ban.Insert(), ban)
+	}
+
+	// the ban that ends last is reported, lifted and expired bans are not
+	ban, err := GetActiveUserBan(1)
+	require.NoError(t, err)
+	assert.Nil(t, ban)
+	short := &Ban{Type: BanTypeUser, UserId: 1, Reason: "spam", ExpiredTime: time.Now().Add(time.Hour).Unix()}
+	long := &Ban{Type: BanTypeUser, UserId: 1, Reason: "abuse", ExpiredTime: time.Now().Add(24 * time.Hour).Unix()}
+	require.NoError(t, long.Insert())
+	require.NoError(t, short.Insert())
+	ban, err = GetActiveUserBan(1)
+	require.NoError(t, err)
+	require.NotNil(t, ban)
+	assert.Equal(t, long.Id, ban.Id)
+	assert.Contains(t, ban.Message(), "abuse")
+
+	require.NoError(t, long.Lift())
+	assert.Error(t, long.Lift())
+	ban, err = GetActiveUserBan(1)
+	require.NoError(t, err)
+	require.NotNil(t, ban)
+	assert.Equal(t, short.Id, ban.Id)
+	require.NoError(t, DB.Model(short).Update("expired_time", time.Now().Add(-time.Second).Unix()).Error)
+	ban, err = GetActiveUserBan(1)
+	require.NoError(t, err)
+	assert.Nil(t, ban)
+
+	bans, total, err := GetBans(0, 10, BanTypeUser, 1, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, total)
+	assert.Len(t, bans, 2)
+	_, total, err = GetBans(0, 10, "", 0, true)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, total)
+
+	// network bans take effect on insert and end on lift
+	network := &Ban{Type: BanTypeIP, Cidr: "198.51.100.0/24"}
+	require.NoError(t, network.Insert())
+	assert.True(t, blacklist.IsIPBanned("198.51.100.20"))
+	assert.False(t, blacklist.IsIPBanned("198.51.101.20"))
+	assert.False(t, blacklist.IsIPBanned("not an ip"))
+	require.NoError(t, network.Lift())
+	assert.False(t, blacklist.IsIPBanned("198.51.100.20"))
+
+	blacklist.SetIPBans([]blacklist.IPBan{{Network: mustParseCIDR(t, "192.0.2.0/24"), ExpiredTime: time.Now().Add(-time.Second).Unix()}})
+	assert.False(t, blacklist.IsIPBanned("192.0.2.1"))
+}
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return network
+}
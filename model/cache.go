@@ -175,7 +175,16 @@ func CacheGetGroupModels(ctx context.Context, group string) (models []string, er
 }
 
 // CacheGetGroupModelsV2 is a version of CacheGetGroupModels that returns EnabledAbility instead of string
+// Models denied by the group policy are filtered out.
 func CacheGetGroupModelsV2(ctx context.Context, group string) (models []EnabledAbility, err error) {
+	models, err = cacheGetGroupModelsV2(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	return filterGroupModels(group, models), nil
+}
+
+func cacheGetGroupModelsV2(ctx context.Context, group string) (models []EnabledAbility, err error) {
 	if !common.RedisEnabled {
 		return GetGroupModelsV2(ctx, group)
 	}
@@ -213,6 +222,43 @@ func CacheGetGroupModelsV2(ctx context.Context, group string) (models []EnabledA
 var group2model2channels map[string]map[string][]*Channel
 var channelSyncLock sync.RWMutex
 
+var (
+	// channelConcurrencyLimits holds the max concurrency of the enabled channels that have one,
+	// it is refreshed with the channel cache or loaded when older than the sync frequency
+	channelConcurrencyLimits         map[int]int
+	channelConcurrencyLimitsLoadedAt time.Time
+	channelConcurrencyLimitsLock     sync.Mutex
+)
+
+func setChannelConcurrencyLimits(limits map[int]int) {
+	channelConcurrencyLimitsLock.Lock()
+	defer channelConcurrencyLimitsLock.Unlock()
+	channelConcurrencyLimits = limits
+	channelConcurrencyLimitsLoadedAt = time.Now()
+}
+
+// getChannelConcurrencyLimits returns the max concurrency of the enabled channels by id,
+// the channels without a limit are left out.
+func getChannelConcurrencyLimits() map[int]int {
+	channelConcurrencyLimitsLock.Lock()
+	defer channelConcurrencyLimitsLock.Unlock()
+	if channelConcurrencyLimits != nil && time.Since(channelConcurrencyLimitsLoadedAt) < time.Duration(config.SyncFrequency)*time.Second {
+		return channelConcurrencyLimits
+	}
+	var channels []*Channel
+	if err := DB.Select("id", "max_concurrency").Where("status = ? AND max_concurrency > 0", ChannelStatusEnabled).Find(&channels).Error; err != nil {
+		logger.Logger.Warn("failed to load channel concurrency limits", zap.Error(err))
+		return channelConcurrencyLimits
+	}
+	limits := make(map[int]int, len(channels))
+	for _, channel := range channels {
+		limits[channel.Id] = channel.GetMaxConcurrency()
+	}
+	channelConcurrencyLimits = limits
+	channelConcurrencyLimitsLoadedAt = time.Now()
+	return limits
+}
+
 func InitChannelCache() {
 	newChannelId2channel := make(map[int]*Channel)
 	var channels []*Channel
@@ -277,9 +323,17 @@ func InitChannelCache() {
 		}
 	}
 
+	newChannelLimits := make(map[int]int)
+	for _, channel := range channels {
+		if limit := channel.GetMaxConcurrency(); limit > 0 {
+			newChannelLimits[channel.Id] = limit
+		}
+	}
+
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
 	channelSyncLock.Unlock()
+	setChannelConcurrencyLimits(newChannelLimits)
 	logger.Logger.Info("channels synced from database, considering suspensions")
 }
 
@@ -309,6 +363,31 @@ func GetChannelsFromCache(group string, model string) ([]*Channel, error) {
 	return candidateChannels, nil
 }
 
+// skipFullChannels filters out the channels serving as many requests as their max concurrency allows.
+func skipFullChannels(channels []*Channel) []*Channel {
+	var limited []int
+	for _, channel := range channels {
+		if channel.GetMaxConcurrency() > 0 {
+			limited = append(limited, channel.Id)
+		}
+	}
+	if len(limited) == 0 {
+		return channels
+	}
+	inFlight, err := common.ChannelsInFlight(context.Background(), limited)
+	if err != nil {
+		logger.Logger.Warn("failed to count in-flight requests", zap.Error(err))
+		return channels
+	}
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if limit := channel.GetMaxConcurrency(); limit <= 0 || inFlight[channel.Id] < limit {
+			available = append(available, channel)
+		}
+	}
+	return available
+}
+
 func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
 	if !config.MemoryCacheEnabled {
 		return GetRandomSatisfiedChannel(group, model, ignoreFirstPriority)
@@ -337,6 +416,12 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 	copy(candidateChannels, channelsFromCache)
 	channelSyncLock.RUnlock()
 
+	// channels at their max concurrency are skipped like suspended ones
+	candidateChannels = skipFullChannels(candidateChannels)
+	if len(candidateChannels) == 0 {
+		return nil, errors.New("all channels are at their max concurrency")
+	}
+
 	endIdx := len(candidateChannels)
 	// choose by priority
 	if endIdx == 0 { // Should be caught by earlier check, but as a safeguard
@@ -454,6 +539,7 @@ func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreF
 		candidateChannels = LargerMaxTokensSizeChannels
 	}
 	channelSyncLock.RUnlock()
+	candidateChannels = skipFullChannels(candidateChannels)
 
 	if len(candidateChannels) == 0 {
 		return nil, errors.New("no available channels after excluding failed channels")
@@ -0,0 +1,201 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// CacheInvalidationChannel is the Redis pub/sub channel the nodes announce their
+// changes on, so that the other nodes drop their in-memory copies at once instead of
+// waiting for the next sync.
+const CacheInvalidationChannel = "one-api:cache_invalidation"
+
+// The caches a CacheInvalidation can target. Tokens are not among them, they are only
+// cached in Redis, which clearTokenCache already updates for every node.
+const (
+	CacheChannels          = "channels" // channels and abilities
+	CacheOptions           = "options"
+	CacheUser              = "user"
+	CacheGroups            = "groups"
+	CacheVirtualModels     = "virtual_models"
+	CacheContentPolicies   = "content_policies"
+	CacheTranscriptRules   = "transcript_rules"
+	CachePromptTemplates   = "prompt_templates"
+	CacheIdentityProviders = "identity_providers"
+	CacheBans              = "bans" // IP bans, user bans are only cached in Redis
+	CacheChannelErrorRules = "channel_error_rules"
+)
+
+// CacheInvalidation is the message published on CacheInvalidationChannel.
+type CacheInvalidation struct {
+	// Node is the node that made the change, it has already reloaded its own cache
+	Node  string `json:"node"`
+	Cache string `json:"cache"`
+	// Key is the option key of CacheOptions
+	Key string `json:"key,omitempty"`
+	// UserId and Status are the user of CacheUser and its new status
+	UserId int `json:"user_id,omitempty"`
+	Status int `json:"status,omitempty"`
+}
+
+// nodeId tells the messages of this process apart from those of the other nodes.
+var nodeId = random.GetUUID()
+
+// invalidateCache reloads the cache on this node and tells the other nodes to do the same.
+func invalidateCache(cache string) {
+	reloadCache(cache)
+	publishCacheInvalidation(&CacheInvalidation{Cache: cache})
+}
+
+// invalidateUserCache drops the cached status and group of the user from Redis and, if
+// the status is set, tells the other nodes to update their ban lists.
+func invalidateUserCache(userId int, status int) {
+	if !common.RedisEnabled || common.RDB == nil {
+		return
+	}
+	for _, key := range []string{fmt.Sprintf("user_enabled:%d", userId), fmt.Sprintf("user_group:%d", userId)} {
+		if err := common.RedisDel(key); err != nil {
+			logger.Logger.Error("failed to clear user cache", zap.String("key", key), zap.Error(err))
+		}
+	}
+	if status != 0 {
+		publishCacheInvalidation(&CacheInvalidation{Cache: CacheUser, UserId: userId, Status: status})
+	}
+}
+
+// publishCacheInvalidation announces the change to the other nodes. A failed publish is
+// only logged, the periodic sync still picks the change up.
+func publishCacheInvalidation(msg *CacheInvalidation) {
+	if !common.RedisEnabled || common.RDB == nil {
+		return
+	}
+	msg.Node = nodeId
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		logger.Logger.Error("failed to marshal cache invalidation", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err = common.RDB.Publish(ctx, CacheInvalidationChannel, payload).Err(); err != nil {
+		logger.Logger.Error("failed to publish cache invalidation",
+			zap.String("cache", msg.Cache), zap.Error(err))
+	}
+}
+
+// SubscribeCacheInvalidation applies the changes announced by the other nodes until the
+// context is done. go-redis resubscribes by itself after a lost connection.
+func SubscribeCacheInvalidation(ctx context.Context) error {
+	client, ok := common.RDB.(interface {
+		Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	})
+	if !ok {
+		return errors.Errorf("redis client %T does not support pub/sub", common.RDB)
+	}
+	pubsub := client.Subscribe(ctx, CacheInvalidationChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return errors.Wrap(err, "subscribe to cache invalidations")
+	}
+	logger.Logger.Info("subscribed to cache invalidations", zap.String("node", nodeId))
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handleCacheInvalidation(message.Payload)
+		}
+	}
+}
+
+// handleCacheInvalidation applies a message published by another node.
+func handleCacheInvalidation(payload string) {
+	msg := &CacheInvalidation{}
+	if err := json.Unmarshal([]byte(payload), msg); err != nil {
+		logger.Logger.Warn("invalid cache invalidation", zap.String("payload", payload), zap.Error(err))
+		return
+	}
+	if msg.Node == nodeId {
+		return
+	}
+	logger.Logger.Debug("cache invalidated by another node",
+		zap.String("cache", msg.Cache), zap.String("node", msg.Node))
+	switch msg.Cache {
+	case CacheOptions:
+		if msg.Key == "" {
+			loadOptionsFromDatabase()
+			return
+		}
+		reloadOption(msg.Key)
+	case CacheUser:
+		applyUserStatus(msg.UserId, msg.Status)
+	default:
+		reloadCache(msg.Cache)
+	}
+}
+
+// reloadCache reloads one of the in-memory caches from the database.
+func reloadCache(cache string) {
+	switch cache {
+	case CacheChannels:
+		InitChannelCache()
+	case CacheOptions:
+		loadOptionsFromDatabase()
+	case CacheGroups:
+		InitGroupCache()
+	case CacheVirtualModels:
+		InitVirtualModelCache()
+	case CacheContentPolicies:
+		InitContentPolicyCache()
+	case CacheTranscriptRules:
+		InitTranscriptRuleCache()
+	case CachePromptTemplates:
+		InitPromptTemplateCache()
+	case CacheIdentityProviders:
+		InitIdentityProviderCache()
+	case CacheBans:
+		InitBanCache()
+	case CacheChannelErrorRules:
+		InitChannelErrorRuleCache()
+	default:
+		logger.Logger.Warn("unknown cache to invalidate", zap.String("cache", cache))
+	}
+}
+
+// reloadOption reads a single option from the database into the option map.
+func reloadOption(key string) {
+	option := Option{}
+	if err := DB.Where(&Option{Key: key}).First(&option).Error; err != nil {
+		logger.Logger.Error("failed to reload option", zap.String("key", key), zap.Error(err))
+		return
+	}
+	if err := updateOptionMap(option.Key, option.Value); err != nil {
+		logger.Logger.Error("failed to update option map", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// applyUserStatus keeps the ban list of this node in line with the status of the user.
+func applyUserStatus(userId int, status int) {
+	switch status {
+	case UserStatusDisabled, UserStatusDeleted:
+		blacklist.BanUser(userId)
+	case UserStatusEnabled:
+		blacklist.UnbanUser(userId)
+	}
+}
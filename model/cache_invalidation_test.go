@@ -0,0 +1,80 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func invalidationPayload(t *testing.T, msg *CacheInvalidation) string {
+	payload, err := json.Marshal(msg)
+	require.NoError(t, err)
+	return string(payload)
+}
+
+func TestHandleCacheInvalidationUser(t *testing.T) {
+	defer blacklist.UnbanUser(42)
+
+	// messages of this node were already applied when they were published
+	handleCacheInvalidation(invalidationPayload(t, &CacheInvalidation{
+		Node: nodeId, Cache: CacheUser, UserId: 42, Status: UserStatusDisabled}))
+	assert.False(t, blacklist.IsUserBanned(42))
+
+	handleCacheInvalidation(invalidationPayload(t, &CacheInvalidation{
+		Node: "other", Cache: CacheUser, UserId: 42, Status: UserStatusDisabled}))
+	assert.True(t, blacklist.IsUserBanned(42))
+
+	handleCacheInvalidation(invalidationPayload(t, &CacheInvalidation{
+		Node: "other", Cache: CacheUser, UserId: 42, Status: UserStatusEnabled}))
+	assert.False(t, blacklist.IsUserBanned(42))
+
+	handleCacheInvalidation(invalidationPayload(t, &CacheInvalidation{
+		Node: "other", Cache: CacheUser, UserId: 42, Status: UserStatusDeleted}))
+	assert.True(t, blacklist.IsUserBanned(42))
+
+	// broken payloads are ignored
+	handleCacheInvalidation("{")
+}
+
+func TestHandleCacheInvalidationReloads(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&Option{}))
+	originalDB := DB
+	originalMemoryCacheEnabled := config.MemoryCacheEnabled
+	originalTopUpLink, originalOptionMap := config.TopUpLink, config.OptionMap
+	DB = testDB
+	config.MemoryCacheEnabled = true
+	config.OptionMap = make(map[string]string)
+	defer func() {
+		DB = originalDB
+		config.MemoryCacheEnabled = originalMemoryCacheEnabled
+		config.TopUpLink, config.OptionMap = originalTopUpLink, originalOptionMap
+		channelSyncLock.Lock()
+		group2model2channels = nil
+		channelSyncLock.Unlock()
+	}()
+
+	// another node saved an option
+	require.NoError(t, DB.Create(&Option{Key: "TopUpLink", Value: "https://example.com/topup"}).Error)
+	handleCacheInvalidation(invalidationPayload(t, &CacheInvalidation{
+		Node: "other", Cache: CacheOptions, Key: "TopUpLink"}))
+	assert.Equal(t, "https://example.com/topup", config.TopUpLink)
+
+	// another node added a channel
+	channel := &Channel{Id: 7, Name: "remote", Status: ChannelStatusEnabled, Group: "default", Models: "gpt-4o"}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, DB.Create(&Ability{Group: "default", Model: "gpt-4o", ChannelId: 7, Enabled: true}).Error)
+	_, err := GetChannelsFromCache("default", "gpt-4o")
+	require.Error(t, err)
+
+	handleCacheInvalidation(invalidationPayload(t, &CacheInvalidation{Node: "other", Cache: CacheChannels}))
+	channels, err := GetChannelsFromCache("default", "gpt-4o")
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "remote", channels[0].Name)
+}
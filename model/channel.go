@@ -12,6 +12,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 )
 
 const (
@@ -44,12 +45,16 @@ type Channel struct {
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
 	RateLimit          *int    `json:"ratelimit" gorm:"column:ratelimit;default:0"`
+	// MaxConcurrency is the maximum number of requests the channel serves at once, 0 for no limit
+	MaxConcurrency *int `json:"max_concurrency" gorm:"default:0"`
 	// Channel-specific pricing tables
 	// DEPRECATED: Use ModelConfigs instead. These fields are kept for backward compatibility and migration.
 	ModelRatio      *string `json:"model_ratio" gorm:"type:text"`      // DEPRECATED: JSON string of model pricing ratios
 	CompletionRatio *string `json:"completion_ratio" gorm:"type:text"` // DEPRECATED: JSON string of completion pricing ratios
 	// AWS-specific configuration
 	InferenceProfileArnMap *string `json:"inference_profile_arn_map" gorm:"type:text"` // JSON string mapping model names to AWS Bedrock Inference Profile ARNs
+	// Recovery is the recovery state of an auto-disabled channel, only set by the channel API
+	Recovery *ChannelRecovery `json:"recovery,omitempty" gorm:"-"`
 }
 
 type ChannelConfig struct {
@@ -75,6 +80,21 @@ type ModelConfigLocal struct {
 	Ratio           float64 `json:"ratio"`
 	CompletionRatio float64 `json:"completion_ratio,omitempty"`
 	MaxTokens       int32   `json:"max_tokens,omitempty"`
+	// Tiers, Windows and the cache ratios only apply when Ratio is set, see adaptor.ModelConfig
+	Tiers            []billingratio.Tier        `json:"tiers,omitempty"`
+	Windows          []billingratio.PriceWindow `json:"windows,omitempty"`
+	CachedInputRatio float64                    `json:"cached_input_ratio,omitempty"`
+	CacheWriteRatio  float64                    `json:"cache_write_ratio,omitempty"`
+}
+
+// PriceRules returns the rules that refine the ratio of the model.
+func (c ModelConfigLocal) PriceRules() billingratio.PriceRules {
+	return billingratio.PriceRules{
+		Tiers:            c.Tiers,
+		Windows:          c.Windows,
+		CachedInputRatio: c.CachedInputRatio,
+		CacheWriteRatio:  c.CacheWriteRatio,
+	}
 }
 
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
@@ -107,9 +127,31 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 	return &channel, err
 }
 
+// GetChannelsByIds returns the channels with the ids, without their keys.
+func GetChannelsByIds(ids []int) ([]*Channel, error) {
+	var channels []*Channel
+	if len(ids) == 0 {
+		return channels, nil
+	}
+	if err := DB.Omit("key").Where("id IN ?", ids).Find(&channels).Error; err != nil {
+		return nil, errors.Wrap(err, "get channels by ids")
+	}
+	return channels, nil
+}
+
 func BatchInsertChannels(channels []Channel) error {
 	var err error
+	for i := range channels {
+		if err = channels[i].encryptSecrets(); err != nil {
+			return err
+		}
+	}
 	err = DB.Create(&channels).Error
+	for i := range channels {
+		if decErr := channels[i].decryptSecrets(); decErr != nil && err == nil {
+			err = decErr
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -119,7 +161,7 @@ func BatchInsertChannels(channels []Channel) error {
 			return err
 		}
 	}
-	InitChannelCache()
+	invalidateCache(CacheChannels)
 	return nil
 }
 
@@ -130,6 +172,13 @@ func (channel *Channel) GetPriority() int64 {
 	return *channel.Priority
 }
 
+func (channel *Channel) GetMaxConcurrency() int {
+	if channel.MaxConcurrency == nil {
+		return 0
+	}
+	return *channel.MaxConcurrency
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -344,6 +393,15 @@ func (channel *Channel) validateModelPriceConfigs(configs map[string]ModelConfig
 			return errors.Errorf("negative MaxTokens for model %s: %d", modelName, config.MaxTokens)
 		}
 
+		// Validate tiers and windows
+		rules := config.PriceRules()
+		if err := rules.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid price rules for model %s", modelName)
+		}
+		if !rules.IsEmpty() && config.Ratio == 0 {
+			return errors.Errorf("price rules for model %s require a ratio", modelName)
+		}
+
 		// Validate that at least one field has meaningful data
 		if config.Ratio == 0 && config.CompletionRatio == 0 && config.MaxTokens == 0 {
 			return errors.Errorf("model %s has no meaningful configuration data", modelName)
@@ -428,6 +486,28 @@ func (channel *Channel) GetModelRatioFromConfigs() map[string]float64 {
 	return modelRatios
 }
 
+// GetPriceRulesFromConfigs extracts the price rules of every model that has a
+// channel specific ratio, rules are only honoured together with the ratio they refine.
+func (channel *Channel) GetPriceRulesFromConfigs() map[string]billingratio.PriceRules {
+	configs := channel.GetModelPriceConfigs()
+	if configs == nil {
+		return nil
+	}
+
+	rules := make(map[string]billingratio.PriceRules)
+	for modelName, config := range configs {
+		if config.Ratio != 0 {
+			rules[modelName] = config.PriceRules()
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return rules
+}
+
 // GetCompletionRatioFromConfigs extracts completion ratios from the unified ModelConfigs
 func (channel *Channel) GetCompletionRatioFromConfigs() map[string]float64 {
 	configs := channel.GetModelPriceConfigs()
@@ -513,27 +593,38 @@ func ValidateInferenceProfileArnMapJSON(jsonStr string) error {
 
 func (channel *Channel) Insert() error {
 	var err error
+	if err = channel.encryptSecrets(); err != nil {
+		return err
+	}
 	err = DB.Create(channel).Error
+	if decErr := channel.decryptSecrets(); decErr != nil && err == nil {
+		err = decErr
+	}
 	if err != nil {
 		return err
 	}
 	err = channel.AddAbilities()
 	if err == nil {
-		InitChannelCache()
+		invalidateCache(CacheChannels)
 	}
 	return err
 }
 
 func (channel *Channel) Update() error {
 	var err error
+	if err = channel.encryptSecrets(); err != nil {
+		return err
+	}
 	err = DB.Model(channel).Updates(channel).Error
 	if err != nil {
+		_ = channel.decryptSecrets()
 		return err
 	}
+	// reload the whole row, AfterFind decrypts the secrets again
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	err = channel.UpdateAbilities()
 	if err == nil {
-		InitChannelCache()
+		invalidateCache(CacheChannels)
 	}
 	return err
 }
@@ -566,7 +657,7 @@ func (channel *Channel) Delete() error {
 	}
 	err = channel.DeleteAbilities()
 	if err == nil {
-		InitChannelCache()
+		invalidateCache(CacheChannels)
 	}
 	return err
 }
@@ -659,7 +750,7 @@ func UpdateChannelStatusById(id int, status int) {
 		logger.Logger.Error("failed to update channel status: " + err.Error())
 	}
 	if err == nil {
-		InitChannelCache()
+		invalidateCache(CacheChannels)
 	}
 }
 
@@ -681,7 +772,7 @@ func updateChannelUsedQuota(id int, quota int64) {
 func DeleteChannelByStatus(status int64) (int64, error) {
 	result := DB.Where("status = ?", status).Delete(&Channel{})
 	if result.Error == nil {
-		InitChannelCache()
+		invalidateCache(CacheChannels)
 	}
 	return result.RowsAffected, result.Error
 }
@@ -689,7 +780,7 @@ func DeleteChannelByStatus(status int64) (int64, error) {
 func DeleteDisabledChannel() (int64, error) {
 	result := DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Delete(&Channel{})
 	if result.Error == nil {
-		InitChannelCache()
+		invalidateCache(CacheChannels)
 	}
 	return result.RowsAffected, result.Error
 }
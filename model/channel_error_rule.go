@@ -0,0 +1,253 @@
+package model
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Channel error rule actions
+const (
+	// ChannelErrorActionDisable auto-disables the channel, if AutomaticDisableChannelEnabled is on
+	ChannelErrorActionDisable = "disable"
+	// ChannelErrorActionSuspend suspends the failed model of the channel in the group for Seconds
+	ChannelErrorActionSuspend = "suspend"
+	// ChannelErrorActionKeyCooldown suspends every model of the channel for Seconds, as its key is unusable for a while
+	ChannelErrorActionKeyCooldown = "key_cooldown"
+	// ChannelErrorActionIgnore does not count the error against the channel
+	ChannelErrorActionIgnore = "ignore"
+)
+
+// ChannelErrorRule decides what happens to a channel whose request failed. A rule
+// matches an error if all its set conditions match: ChannelType and StatusCode 0,
+// and empty ErrorTypes, ErrorCodes and MessageRegex match any error.
+type ChannelErrorRule struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64)"`
+	ChannelType int    `json:"channel_type" gorm:"default:0"`
+	StatusCode  int    `json:"status_code" gorm:"default:0"`
+	// ErrorTypes and ErrorCodes are comma separated, one of them has to equal the type or code of the error
+	ErrorTypes   string `json:"error_types" gorm:"type:varchar(255);default:''"`
+	ErrorCodes   string `json:"error_codes" gorm:"type:varchar(255);default:''"`
+	MessageRegex string `json:"message_regex" gorm:"type:text"`
+	Action       string `json:"action" gorm:"type:varchar(16)"`
+	// Seconds is how long suspend and key_cooldown last
+	Seconds int `json:"seconds" gorm:"default:0"`
+	// DryRun only logs what the rule would do, the rules after it are still evaluated
+	DryRun  bool `json:"dry_run"`
+	Enabled bool `json:"enabled"`
+	// Priority orders the rules, higher is evaluated first
+	Priority    int   `json:"priority" gorm:"default:0"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64 `json:"updated_time" gorm:"bigint"`
+
+	messageRegex *regexp.Regexp
+}
+
+// DefaultChannelErrorRules are created with the table, they handle the errors the way
+// it was hard-coded before rules could be configured: 400 errors are the fault of the
+// request, 429 errors suspend the model for CHANNEL_SUSPEND_SECONDS_FOR_429, and the
+// rest disable the channel.
+var DefaultChannelErrorRules = []ChannelErrorRule{
+	{Name: "bad request", StatusCode: http.StatusBadRequest, Action: ChannelErrorActionIgnore},
+	{Name: "rate limited", StatusCode: http.StatusTooManyRequests, Action: ChannelErrorActionSuspend,
+		Seconds: int(config.ChannelSuspendSecondsFor429 / time.Second)},
+	{Name: "unauthorized", StatusCode: http.StatusUnauthorized, Action: ChannelErrorActionDisable},
+	{Name: "quota or permission error", ErrorTypes: "insufficient_quota,authentication_error,permission_error,forbidden", Action: ChannelErrorActionDisable},
+	{Name: "invalid or deactivated key", ErrorCodes: "invalid_api_key,account_deactivated", Action: ChannelErrorActionDisable},
+	{Name: "account terminated or restricted", MessageRegex: `(?i)your access was terminated|violation of our policies|your credit balance is too low|organization has been disabled|permission denied|organization has been restricted|api key not valid|api key expired|insufficient balance|已欠费`, Action: ChannelErrorActionDisable},
+	{Name: "credit or balance mentioned", MessageRegex: `(?i)credit|balance`, Action: ChannelErrorActionDisable},
+}
+
+// validate normalizes the rule, checks its settings and compiles its regular expression.
+func (r *ChannelErrorRule) validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.ChannelType < 0 {
+		return errors.New("channel type must not be negative")
+	}
+	if r.StatusCode != 0 && (r.StatusCode < 100 || r.StatusCode > 599) {
+		return errors.Errorf("invalid status code %d", r.StatusCode)
+	}
+	r.ErrorTypes = strings.Join(splitModels(r.ErrorTypes), ",")
+	r.ErrorCodes = strings.Join(splitModels(r.ErrorCodes), ",")
+	if err := r.compile(); err != nil {
+		return err
+	}
+	switch r.Action {
+	case ChannelErrorActionDisable, ChannelErrorActionIgnore:
+		r.Seconds = 0
+	case ChannelErrorActionSuspend, ChannelErrorActionKeyCooldown:
+		if r.Seconds <= 0 {
+			return errors.Errorf("action %s requires a positive duration in seconds", r.Action)
+		}
+	default:
+		return errors.Errorf("unknown action %q", r.Action)
+	}
+	return nil
+}
+
+// compile compiles MessageRegex.
+func (r *ChannelErrorRule) compile() error {
+	r.messageRegex = nil
+	if r.MessageRegex == "" {
+		return nil
+	}
+	re, err := regexp.Compile(r.MessageRegex)
+	if err != nil {
+		return errors.Errorf("invalid message regex %q", r.MessageRegex)
+	}
+	r.messageRegex = re
+	return nil
+}
+
+// Matches reports whether the rule covers the error of a channel of the type.
+func (r *ChannelErrorRule) Matches(channelType int, statusCode int, errType string, errCode string, message string) bool {
+	if r.ChannelType != 0 && r.ChannelType != channelType {
+		return false
+	}
+	if r.StatusCode != 0 && r.StatusCode != statusCode {
+		return false
+	}
+	if r.ErrorTypes != "" && !containsFold(r.ErrorTypes, errType) {
+		return false
+	}
+	if r.ErrorCodes != "" && !containsFold(r.ErrorCodes, errCode) {
+		return false
+	}
+	if r.MessageRegex != "" && (r.messageRegex == nil || !r.messageRegex.MatchString(message)) {
+		return false
+	}
+	return true
+}
+
+// Duration is how long the suspend or key_cooldown of the rule lasts.
+func (r *ChannelErrorRule) Duration() time.Duration {
+	return time.Duration(r.Seconds) * time.Second
+}
+
+// containsFold reports whether one of the comma separated values equals value, ignoring case.
+func containsFold(values string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range strings.Split(values, ",") {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// createDefaultChannelErrorRules stores DefaultChannelErrorRules, enabled.
+func createDefaultChannelErrorRules() error {
+	now := helper.GetTimestamp()
+	rules := make([]ChannelErrorRule, len(DefaultChannelErrorRules))
+	for i, rule := range DefaultChannelErrorRules {
+		rule.Enabled = true
+		rule.CreatedTime, rule.UpdatedTime = now, now
+		rules[i] = rule
+	}
+	return errors.Wrap(DB.Create(&rules).Error, "create default channel error rules")
+}
+
+func GetAllChannelErrorRules() ([]*ChannelErrorRule, error) {
+	var rules []*ChannelErrorRule
+	err := DB.Order("priority desc, id asc").Find(&rules).Error
+	return rules, errors.Wrap(err, "get all channel error rules")
+}
+
+func GetChannelErrorRuleById(id int) (*ChannelErrorRule, error) {
+	rule := &ChannelErrorRule{}
+	err := DB.First(rule, "id = ?", id).Error
+	return rule, errors.Wrapf(err, "get channel error rule %d", id)
+}
+
+func (r *ChannelErrorRule) Insert() error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r.CreatedTime = helper.GetTimestamp()
+	r.UpdatedTime = r.CreatedTime
+	if err := DB.Create(r).Error; err != nil {
+		return errors.Wrapf(err, "create channel error rule %s", r.Name)
+	}
+	invalidateCache(CacheChannelErrorRules)
+	return nil
+}
+
+// Update saves all fields of the rule.
+func (r *ChannelErrorRule) Update() error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(r).
+		Select("name", "channel_type", "status_code", "error_types", "error_codes", "message_regex",
+			"action", "seconds", "dry_run", "enabled", "priority", "updated_time").
+		Updates(r).Error
+	if err != nil {
+		return errors.Wrapf(err, "update channel error rule %s", r.Name)
+	}
+	invalidateCache(CacheChannelErrorRules)
+	return nil
+}
+
+func (r *ChannelErrorRule) Delete() error {
+	if err := DB.Delete(r).Error; err != nil {
+		return errors.Wrapf(err, "delete channel error rule %s", r.Name)
+	}
+	invalidateCache(CacheChannelErrorRules)
+	return nil
+}
+
+var (
+	channelErrorRules    []*ChannelErrorRule
+	channelErrorRulesMux sync.RWMutex
+)
+
+// InitChannelErrorRuleCache loads the enabled channel error rules.
+func InitChannelErrorRuleCache() {
+	var rules []*ChannelErrorRule
+	if err := DB.Where("enabled = ?", true).Order("priority desc, id asc").Find(&rules).Error; err != nil {
+		logger.Logger.Error("failed to load channel error rules", zap.Error(err))
+		return
+	}
+	valid := rules[:0]
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			logger.Logger.Warn("skip invalid channel error rule", zap.Int("id", rule.Id), zap.Error(err))
+			continue
+		}
+		valid = append(valid, rule)
+	}
+	channelErrorRulesMux.Lock()
+	channelErrorRules = valid
+	channelErrorRulesMux.Unlock()
+}
+
+func SyncChannelErrorRuleCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing channel error rules from database")
+		InitChannelErrorRuleCache()
+	}
+}
+
+// GetChannelErrorRules returns the enabled rules in the order they are evaluated.
+func GetChannelErrorRules() []*ChannelErrorRule {
+	channelErrorRulesMux.RLock()
+	defer channelErrorRulesMux.RUnlock()
+	return channelErrorRules
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelErrorRuleValidate(t *testing.T) {
+	valid := &ChannelErrorRule{Name: " cooldown ", ErrorCodes: " rate_limit , ", Action: ChannelErrorActionKeyCooldown, Seconds: 60}
+	require.NoError(t, valid.validate())
+	assert.Equal(t, "cooldown", valid.Name)
+	assert.Equal(t, "rate_limit", valid.ErrorCodes)
+	assert.Equal(t, time.Minute, valid.Duration())
+
+	for name, rule := range map[string]*ChannelErrorRule{
+		"name":    {Action: ChannelErrorActionDisable},
+		"status":  {Name: "s", StatusCode: 42, Action: ChannelErrorActionDisable},
+		"regex":   {Name: "r", MessageRegex: "(", Action: ChannelErrorActionDisable},
+		"action":  {Name: "a", Action: "drop"},
+		"seconds": {Name: "s", Action: ChannelErrorActionSuspend},
+	} {
+		assert.Error(t, rule.validate(), name)
+	}
+}
+
+func TestChannelErrorRuleMatches(t *testing.T) {
+	rule := &ChannelErrorRule{Name: "r", ChannelType: 14, StatusCode: http.StatusForbidden,
+		ErrorTypes: "permission_error,forbidden", MessageRegex: `(?i)organization .* disabled`, Action: ChannelErrorActionDisable}
+	require.NoError(t, rule.validate())
+	assert.True(t, rule.Matches(14, http.StatusForbidden, "Forbidden", "", "Your Organization has been disabled"))
+	assert.False(t, rule.Matches(1, http.StatusForbidden, "forbidden", "", "Your organization has been disabled"))
+	assert.False(t, rule.Matches(14, http.StatusUnauthorized, "forbidden", "", "Your organization has been disabled"))
+	assert.False(t, rule.Matches(14, http.StatusForbidden, "", "", "Your organization has been disabled"))
+	assert.False(t, rule.Matches(14, http.StatusForbidden, "forbidden", "", "permission denied"))
+
+	for _, rule := range DefaultChannelErrorRules {
+		require.NoError(t, rule.validate(), rule.Name)
+	}
+}
+
+func TestChannelErrorRuleCache(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&ChannelErrorRule{}))
+	originalDB := DB
+	DB = testDB
+	defer func() {
+		channelErrorRulesMux.Lock()
+		channelErrorRules = nil
+		channelErrorRulesMux.Unlock()
+		DB = originalDB
+	}()
+
+	require.NoError(t, createDefaultChannelErrorRules())
+	ignore := &ChannelErrorRule{Name: "ignore", StatusCode: http.StatusUnauthorized, Action: ChannelErrorActionIgnore, Priority: 1, Enabled: true}
+	require.NoError(t, ignore.Insert())
+	disabled := &ChannelErrorRule{Name: "disabled", Action: ChannelErrorActionDisable}
+	require.NoError(t, disabled.Insert())
+
+	rules := GetChannelErrorRules()
+	require.Len(t, rules, len(DefaultChannelErrorRules)+1)
+	assert.Equal(t, ignore.Id, rules[0].Id)
+	assert.Equal(t, ChannelErrorActionIgnore, rules[1].Action)
+	assert.Equal(t, ChannelErrorActionSuspend, rules[2].Action)
+	// compiled regular expressions survive the reload
+	assert.True(t, rules[len(rules)-1].Matches(1, http.StatusPaymentRequired, "", "", "Insufficient BALANCE"))
+
+	require.NoError(t, ignore.Delete())
+	assert.Len(t, GetChannelErrorRules(), len(DefaultChannelErrorRules))
+}
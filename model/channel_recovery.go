@@ -0,0 +1,146 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// ChannelRecovery is the recovery state of an auto-disabled channel, which is probed with
+// the model that failed until it succeeds ChannelRecoverySuccesses times in a row.
+type ChannelRecovery struct {
+	ChannelId int `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	// Model is the model the channel failed with, empty probes the channel's test model
+	Model        string `json:"model" gorm:"type:varchar(255);default:''"`
+	Reason       string `json:"reason" gorm:"type:text"`
+	DisabledTime int64  `json:"disabled_time" gorm:"bigint"`
+	// Failures counts the failed probes since the last success, each doubles the delay to the next probe
+	Failures      int    `json:"failures" gorm:"default:0"`
+	Successes     int    `json:"successes" gorm:"default:0"`
+	LastProbeTime int64  `json:"last_probe_time" gorm:"bigint;default:0"`
+	LastError     string `json:"last_error" gorm:"type:text"`
+	NextProbeTime int64  `json:"next_probe_time" gorm:"bigint;index"`
+}
+
+// channelRecoveryDelay is the delay in seconds before the next probe after the failures.
+func channelRecoveryDelay(failures int) int64 {
+	delay := int64(max(config.ChannelRecoveryInterval, 1))
+	maxDelay := int64(max(config.ChannelRecoveryMaxInterval, config.ChannelRecoveryInterval))
+	for i := 0; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// StartChannelRecovery resets the recovery state of a channel that was just auto-disabled.
+func StartChannelRecovery(channelId int, modelName string, reason string) error {
+	now := time.Now().Unix()
+	recovery := &ChannelRecovery{
+		ChannelId:     channelId,
+		Model:         modelName,
+		Reason:        reason,
+		DisabledTime:  now,
+		NextProbeTime: now + channelRecoveryDelay(0),
+	}
+	return errors.Wrapf(DB.Save(recovery).Error, "start recovery of channel %d", channelId)
+}
+
+// RecordProbe stores the result of a probe at the unix time and schedules the next one,
+// a nil probeErr is a success.
+func (r *ChannelRecovery) RecordProbe(probeErr error, now int64) error {
+	r.LastProbeTime = now
+	if probeErr == nil {
+		r.Successes++
+		r.Failures = 0
+		r.LastError = ""
+	} else {
+		r.Successes = 0
+		r.Failures++
+		r.LastError = probeErr.Error()
+	}
+	r.NextProbeTime = now + channelRecoveryDelay(r.Failures)
+	err := DB.Model(r).
+		Select("successes", "failures", "last_probe_time", "last_error", "next_probe_time").
+		Updates(r).Error
+	return errors.Wrapf(err, "record probe of channel %d", r.ChannelId)
+}
+
+func DeleteChannelRecovery(channelId int) error {
+	err := DB.Delete(&ChannelRecovery{}, "channel_id = ?", channelId).Error
+	return errors.Wrapf(err, "delete recovery of channel %d", channelId)
+}
+
+// GetDueChannelRecoveries returns the recovery states whose next probe is due at the unix time.
+func GetDueChannelRecoveries(now int64) ([]*ChannelRecovery, error) {
+	var recoveries []*ChannelRecovery
+	err := DB.Where("next_probe_time <= ?", now).Order("next_probe_time asc").Find(&recoveries).Error
+	return recoveries, errors.Wrap(err, "get due channel recoveries")
+}
+
+// SyncChannelRecoveries drops the recovery states of channels that are no longer
+// auto-disabled, and starts probing auto-disabled channels that have none.
+func SyncChannelRecoveries() error {
+	var channelIds []int
+	if err := DB.Model(&Channel{}).Where("status = ?", ChannelStatusAutoDisabled).Pluck("id", &channelIds).Error; err != nil {
+		return errors.Wrap(err, "get auto-disabled channels")
+	}
+	stale := DB.Where("1 = 1")
+	if len(channelIds) > 0 {
+		stale = DB.Where("channel_id NOT IN ?", channelIds)
+	}
+	if err := stale.Delete(&ChannelRecovery{}).Error; err != nil {
+		return errors.Wrap(err, "delete stale channel recoveries")
+	}
+
+	recoveries, err := GetChannelRecoveries(channelIds)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, id := range channelIds {
+		if recoveries[id] != nil {
+			continue
+		}
+		recovery := &ChannelRecovery{ChannelId: id, NextProbeTime: now}
+		if err = DB.Create(recovery).Error; err != nil {
+			return errors.Wrapf(err, "start recovery of channel %d", id)
+		}
+	}
+	return nil
+}
+
+// GetChannelRecoveries returns the recovery states of the channels by channel id.
+func GetChannelRecoveries(channelIds []int) (map[int]*ChannelRecovery, error) {
+	result := make(map[int]*ChannelRecovery)
+	if len(channelIds) == 0 {
+		return result, nil
+	}
+	var recoveries []*ChannelRecovery
+	if err := DB.Where("channel_id IN ?", channelIds).Find(&recoveries).Error; err != nil {
+		return nil, errors.Wrap(err, "get channel recoveries")
+	}
+	for _, recovery := range recoveries {
+		result[recovery.ChannelId] = recovery
+	}
+	return result, nil
+}
+
+// AttachChannelRecoveries sets the recovery state of the auto-disabled channels.
+func AttachChannelRecoveries(channels []*Channel) error {
+	var channelIds []int
+	for _, channel := range channels {
+		if channel.Status == ChannelStatusAutoDisabled {
+			channelIds = append(channelIds, channel.Id)
+		}
+	}
+	recoveries, err := GetChannelRecoveries(channelIds)
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		channel.Recovery = recoveries[channel.Id]
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestChannelRecoveryDelay(t *testing.T) {
+	originalInterval, originalMax := config.ChannelRecoveryInterval, config.ChannelRecoveryMaxInterval
+	config.ChannelRecoveryInterval, config.ChannelRecoveryMaxInterval = 60, 600
+	defer func() {
+		config.ChannelRecoveryInterval, config.ChannelRecoveryMaxInterval = originalInterval, originalMax
+	}()
+
+	for failures, delay := range []int64{60, 120, 240, 480, 600, 600} {
+		assert.Equal(t, delay, channelRecoveryDelay(failures), failures)
+	}
+	assert.EqualValues(t, 600, channelRecoveryDelay(1000))
+}
+
+func TestChannelRecovery(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&ChannelRecovery{}))
+	originalDB := DB
+	DB = testDB
+	defer func() { DB = originalDB }()
+
+	channels := []*Channel{
+		{Id: 1, Name: "disabled", Status: ChannelStatusAutoDisabled},
+		{Id: 2, Name: "old", Status: ChannelStatusAutoDisabled},
+		{Id: 3, Name: "enabled", Status: ChannelStatusEnabled},
+	}
+	for _, channel := range channels {
+		require.NoError(t, DB.Create(channel).Error)
+	}
+
+	require.NoError(t, StartChannelRecovery(1, "gpt-4o", "invalid key"))
+	require.NoError(t, StartChannelRecovery(3, "gpt-4o", "manually enabled since"))
+	require.NoError(t, SyncChannelRecoveries())
+
+	// channel 2 was disabled without recovery state and is probed at once,
+	// channel 3 is no longer disabled
+	now := time.Now().Unix()
+	due, err := GetDueChannelRecoveries(now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 2, due[0].ChannelId)
+
+	require.NoError(t, AttachChannelRecoveries(channels))
+	require.NotNil(t, channels[0].Recovery)
+	assert.Equal(t, "gpt-4o", channels[0].Recovery.Model)
+	assert.Nil(t, channels[2].Recovery)
+
+	recovery := channels[0].Recovery
+	require.NoError(t, recovery.RecordProbe(errors.New("401"), now))
+	require.NoError(t, recovery.RecordProbe(errors.New("401"), now))
+	assert.Equal(t, now+channelRecoveryDelay(2), recovery.NextProbeTime)
+	require.NoError(t, recovery.RecordProbe(nil, now))
+	stored, err := GetChannelRecoveries([]int{1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored[1].Successes)
+	assert.Equal(t, 0, stored[1].Failures)
+	assert.Empty(t, stored[1].LastError)
+
+	require.NoError(t, DeleteChannelRecovery(1))
+	stored, err = GetChannelRecoveries([]int{1, 2})
+	require.NoError(t, err)
+	assert.Len(t, stored, 1)
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+// channelConfigSecretFields are the ChannelConfig json fields that hold credentials
+// and therefore are encrypted at rest.
+var channelConfigSecretFields = []string{"sk", "ak", "vertex_ai_adc"}
+
+// AfterFind decrypts the channel secrets right after they are loaded from the database,
+// so that the rest of the code base only ever sees plaintext.
+func (channel *Channel) AfterFind(tx *gorm.DB) error {
+	return channel.decryptSecrets()
+}
+
+// encryptSecrets encrypts Key and the secret fields of Config in place.
+// It is a no-op when no master key is configured.
+func (channel *Channel) encryptSecrets() error {
+	key, err := secret.Encrypt(channel.Key)
+	if err != nil {
+		return errors.Wrapf(err, "encrypt key of channel %d", channel.Id)
+	}
+	cfg, err := transformConfigSecrets(channel.Config, secret.Encrypt)
+	if err != nil {
+		return errors.Wrapf(err, "encrypt config of channel %d", channel.Id)
+	}
+	channel.Key = key
+	channel.Config = cfg
+	return nil
+}
+
+// decryptSecrets reverses encryptSecrets.
+func (channel *Channel) decryptSecrets() error {
+	key, err := secret.Decrypt(channel.Key)
+	if err != nil {
+		return errors.Wrapf(err, "decrypt key of channel %d", channel.Id)
+	}
+	cfg, err := transformConfigSecrets(channel.Config, secret.Decrypt)
+	if err != nil {
+		return errors.Wrapf(err, "decrypt config of channel %d", channel.Id)
+	}
+	channel.Key = key
+	channel.Config = cfg
+	return nil
+}
+
+// MaskSecrets removes the channel key and masks the config secrets,
+// it must be called before a channel is returned by the API.
+func (channel *Channel) MaskSecrets() {
+	channel.Key = ""
+	cfg, err := transformConfigSecrets(channel.Config, func(v string) (string, error) {
+		return secret.Mask(v), nil
+	})
+	if err != nil {
+		// never fall back to the raw config, it may contain plaintext secrets
+		channel.Config = ""
+		return
+	}
+	channel.Config = cfg
+}
+
+// KeepMaskedSecrets restores config secrets that the client sent back in masked form,
+// so that editing a channel in the UI does not overwrite its credentials with the mask.
+func (channel *Channel) KeepMaskedSecrets(stored *Channel) error {
+	if channel.Config == "" || stored == nil || stored.Config == "" {
+		return nil
+	}
+	var storedCfg map[string]any
+	if err := json.Unmarshal([]byte(stored.Config), &storedCfg); err != nil {
+		return errors.Wrap(err, "unmarshal stored channel config")
+	}
+	cfg, err := transformConfigSecretsWithField(channel.Config, func(field, v string) (string, error) {
+		if !strings.HasPrefix(v, secret.Masked) {
+			return v, nil
+		}
+		old, _ := storedCfg[field].(string)
+		return old, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "restore masked channel config")
+	}
+	channel.Config = cfg
+	return nil
+}
+
+func transformConfigSecrets(raw string, fn func(string) (string, error)) (string, error) {
+	return transformConfigSecretsWithField(raw, func(_ string, v string) (string, error) {
+		return fn(v)
+	})
+}
+
+// transformConfigSecretsWithField applies fn to every non-empty secret field in a
+// ChannelConfig json string, leaving all other fields untouched.
+func transformConfigSecretsWithField(raw string, fn func(field, value string) (string, error)) (string, error) {
+	if raw == "" {
+		return raw, nil
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return "", errors.Wrap(err, "unmarshal channel config")
+	}
+
+	changed := false
+	for _, field := range channelConfigSecretFields {
+		value, ok := cfg[field].(string)
+		if !ok || value == "" {
+			continue
+		}
+		newValue, err := fn(field, value)
+		if err != nil {
+			return "", errors.Wrapf(err, "field %s", field)
+		}
+		if newValue != value {
+			cfg[field] = newValue
+			changed = true
+		}
+	}
+	if !changed {
+		return raw, nil
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal channel config")
+	}
+	return string(out), nil
+}
+
+// channelSecretsNeedRotation reports whether any secret of the raw (undecrypted) channel
+// is stored in plaintext or wrapped by a retired master key.
+func channelSecretsNeedRotation(channel *Channel) bool {
+	if secret.NeedsRotation(channel.Key) {
+		return true
+	}
+	needs := false
+	_, _ = transformConfigSecrets(channel.Config, func(v string) (string, error) {
+		if secret.NeedsRotation(v) {
+			needs = true
+		}
+		return v, nil
+	})
+	return needs
+}
+
+// MigrateChannelSecrets encrypts plaintext channel secrets and re-wraps secrets that
+// were encrypted with a previous master key. It is idempotent and is run at startup,
+// which is when a rotated CHANNEL_SECRET_KEY takes effect.
+//
+// It returns the number of channels that were rewritten.
+func MigrateChannelSecrets() (int, error) {
+	var channels []*Channel
+	// read the raw column values, AfterFind would decrypt them
+	err := DB.Session(&gorm.Session{SkipHooks: true}).
+		Select("id", "key", "config").Find(&channels).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "fetch channels")
+	}
+
+	if !secret.Enabled() {
+		for _, channel := range channels {
+			if secret.IsEncrypted(channel.Key) || strings.Contains(channel.Config, "enc:v1:") {
+				return 0, errors.New("channel secrets are encrypted but CHANNEL_SECRET_KEY is not set")
+			}
+		}
+		return 0, nil
+	}
+
+	migrated := 0
+	for _, channel := range channels {
+		if !channelSecretsNeedRotation(channel) {
+			continue
+		}
+		if err := channel.decryptSecrets(); err != nil {
+			return migrated, err
+		}
+		if err := channel.encryptSecrets(); err != nil {
+			return migrated, err
+		}
+		err = DB.Session(&gorm.Session{SkipHooks: true}).Model(&Channel{}).
+			Where("id = ?", channel.Id).
+			Updates(map[string]any{"key": channel.Key, "config": channel.Config}).Error
+		if err != nil {
+			return migrated, errors.Wrapf(err, "save secrets of channel %d", channel.Id)
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		logger.Logger.Info("channel secrets encrypted with current master key",
+			zap.Int("channel_count", migrated))
+	}
+	return migrated, nil
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+func setupChannelSecretTest(t *testing.T, masterKey string) {
+	t.Helper()
+	originalDB := DB
+	originalKey := config.ChannelSecretKey
+	DB = setupTestDB(t)
+	config.ChannelSecretKey = masterKey
+	secret.Reload()
+	t.Cleanup(func() {
+		DB = originalDB
+		config.ChannelSecretKey = originalKey
+		secret.Reload()
+	})
+}
+
+func rawChannel(t *testing.T, id int) Channel {
+	t.Helper()
+	var raw Channel
+	require.NoError(t, DB.Session(&gorm.Session{SkipHooks: true}).First(&raw, "id = ?", id).Error)
+	return raw
+}
+
+func TestChannelSecretsEncryptedAtRest(t *testing.T) {
+	setupChannelSecretTest(t, "test-master-key")
+
+	channel := &Channel{
+		Name:   "secret",
+		Key:    "sk-very-secret",
+		Models: "gpt-4o",
+		Group:  "default",
+		Config: `{"region":"us-east-1","ak":"AKIA123","sk":"aws-secret"}`,
+	}
+	require.NoError(t, channel.Insert())
+	assert.Equal(t, "sk-very-secret", channel.Key, "in-memory channel keeps plaintext")
+
+	raw := rawChannel(t, channel.Id)
+	assert.True(t, secret.IsEncrypted(raw.Key))
+	assert.NotContains(t, raw.Config, "aws-secret")
+	assert.NotContains(t, raw.Config, "AKIA123")
+	assert.Contains(t, raw.Config, "us-east-1")
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-very-secret", loaded.Key)
+	cfg, err := loaded.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "aws-secret", cfg.SK)
+	assert.Equal(t, "AKIA123", cfg.AK)
+}
+
+func TestMigrateChannelSecrets(t *testing.T) {
+	setupChannelSecretTest(t, "")
+
+	channel := &Channel{Name: "legacy", Key: "sk-legacy", Models: "gpt-4o", Group: "default"}
+	require.NoError(t, channel.Insert())
+	assert.Equal(t, "sk-legacy", rawChannel(t, channel.Id).Key)
+
+	config.ChannelSecretKey = "first-key"
+	secret.Reload()
+	migrated, err := MigrateChannelSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+	firstRaw := rawChannel(t, channel.Id).Key
+	assert.True(t, secret.IsEncrypted(firstRaw))
+
+	// idempotent
+	migrated, err = MigrateChannelSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+
+	// rotate
+	config.ChannelSecretKey = "second-key"
+	config.ChannelSecretPreviousKeys = "first-key"
+	t.Cleanup(func() { config.ChannelSecretPreviousKeys = "" })
+	secret.Reload()
+	migrated, err = MigrateChannelSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+	assert.NotEqual(t, firstRaw, rawChannel(t, channel.Id).Key)
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-legacy", loaded.Key)
+
+	// refuse to start without a master key once secrets are encrypted
+	config.ChannelSecretKey = ""
+	config.ChannelSecretPreviousKeys = ""
+	secret.Reload()
+	_, err = MigrateChannelSecrets()
+	assert.Error(t, err)
+}
+
+func TestChannelMaskSecrets(t *testing.T) {
+	stored := &Channel{Key: "sk-secret", Config: `{"region":"us-east-1","sk":"aws-secret-value"}`}
+
+	masked := *stored
+	masked.MaskSecrets()
+	assert.Empty(t, masked.Key)
+	assert.NotContains(t, masked.Config, "aws-secret-value")
+	assert.Contains(t, masked.Config, "us-east-1")
+
+	// the client sends the masked config back unchanged
+	require.NoError(t, masked.KeepMaskedSecrets(stored))
+	cfg, err := masked.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "aws-secret-value", cfg.SK)
+}
@@ -0,0 +1,292 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Content policy rule types
+const (
+	// ContentPolicyTypeRegex matches Pattern as a regular expression
+	ContentPolicyTypeRegex = "regex"
+	// ContentPolicyTypeKeyword matches any of the comma or newline separated keywords of Pattern, ignoring case
+	ContentPolicyTypeKeyword = "keyword"
+	// ContentPolicyTypePII detects the comma separated detectors of Pattern, see PIIDetectors
+	ContentPolicyTypePII = "pii"
+	// ContentPolicyTypeModeration asks the moderation endpoint of channel ChannelId, Pattern is the moderation model
+	ContentPolicyTypeModeration = "moderation"
+)
+
+// Content policy actions
+const (
+	ContentPolicyActionBlock  = "block"
+	ContentPolicyActionRedact = "redact"
+	ContentPolicyActionFlag   = "flag"
+)
+
+// Content policy stages
+const (
+	ContentPolicyStageInput  = "input"
+	ContentPolicyStageOutput = "output"
+	ContentPolicyStageBoth   = "both"
+)
+
+// PIIDetectors are the detectors a pii rule can use.
+var PIIDetectors = []string{"email", "phone", "card"}
+
+// ContentPolicy is a rule of the content guard of the relay. Group and TokenId narrow
+// the requests the rule applies to, empty and 0 apply to every group and token.
+type ContentPolicy struct {
+	Id        int    `json:"id"`
+	Name      string `json:"name" gorm:"type:varchar(64)"`
+	Group     string `json:"group" gorm:"column:group_name;type:varchar(32);default:''"`
+	TokenId   int    `json:"token_id" gorm:"default:0"`
+	Stage     string `json:"stage" gorm:"type:varchar(16)"`
+	Type      string `json:"type" gorm:"type:varchar(16)"`
+	Pattern   string `json:"pattern" gorm:"type:text"`
+	ChannelId int    `json:"channel_id" gorm:"default:0"`
+	Action    string `json:"action" gorm:"type:varchar(16)"`
+	Enabled   bool   `json:"enabled"`
+	// Priority orders the rules, higher runs first
+	Priority    int   `json:"priority" gorm:"default:0"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64 `json:"updated_time" gorm:"bigint"`
+}
+
+// AppliesTo reports whether the policy covers requests of the group and token at the stage.
+func (p *ContentPolicy) AppliesTo(group string, tokenId int, stage string) bool {
+	return (p.Group == "" || p.Group == group) &&
+		(p.TokenId == 0 || p.TokenId == tokenId) &&
+		(p.Stage == ContentPolicyStageBoth || p.Stage == stage)
+}
+
+// validate normalizes the policy and checks its settings.
+func (p *ContentPolicy) validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if p.Group != "" && !ValidGroupName(p.Group) {
+		return errors.Errorf("invalid group %q", p.Group)
+	}
+	if p.TokenId < 0 {
+		return errors.New("token id must not be negative")
+	}
+	if p.Stage == "" {
+		p.Stage = ContentPolicyStageInput
+	}
+	switch p.Stage {
+	case ContentPolicyStageInput, ContentPolicyStageOutput, ContentPolicyStageBoth:
+	default:
+		return errors.Errorf("unknown stage %q", p.Stage)
+	}
+	switch p.Action {
+	case ContentPolicyActionBlock, ContentPolicyActionRedact, ContentPolicyActionFlag:
+	default:
+		return errors.Errorf("unknown action %q", p.Action)
+	}
+
+	switch p.Type {
+	case ContentPolicyTypeRegex:
+		if _, err := regexp.Compile(p.Pattern); err != nil || p.Pattern == "" {
+			return errors.Errorf("invalid regular expression %q", p.Pattern)
+		}
+	case ContentPolicyTypeKeyword:
+		if len(SplitContentPolicyKeywords(p.Pattern)) == 0 {
+			return errors.New("at least one keyword is required")
+		}
+	case ContentPolicyTypePII:
+		detectors, err := normalizePIIDetectors(p.Pattern)
+		if err != nil {
+			return err
+		}
+		if detectors == "" {
+			return errors.New("at least one pii detector is required")
+		}
+		p.Pattern = detectors
+	case ContentPolicyTypeModeration:
+		if p.ChannelId <= 0 {
+			return errors.New("moderation rules require a channel")
+		}
+		if p.Action == ContentPolicyActionRedact {
+			return errors.New("moderation rules can only block or flag")
+		}
+		p.Pattern = strings.TrimSpace(p.Pattern)
+	default:
+		return errors.Errorf("unknown type %q", p.Type)
+	}
+	return nil
+}
+
+// normalizePIIDetectors checks the comma separated detectors and returns them without blanks.
+func normalizePIIDetectors(detectors string) (string, error) {
+	names := splitModels(detectors)
+	for _, name := range names {
+		known := false
+		for _, d := range PIIDetectors {
+			known = known || d == name
+		}
+		if !known {
+			return "", errors.Errorf("unknown pii detector %q, expect one of %s", name, strings.Join(PIIDetectors, ", "))
+		}
+	}
+	return strings.Join(names, ","), nil
+}
+
+// SplitContentPolicyKeywords splits the comma or newline separated keywords of a keyword rule.
+func SplitContentPolicyKeywords(pattern string) []string {
+	var keywords []string
+	for _, keyword := range strings.FieldsFunc(pattern, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+func GetAllContentPolicies() ([]*ContentPolicy, error) {
+	var policies []*ContentPolicy
+	err := DB.Order("priority desc, id asc").Find(&policies).Error
+	return policies, errors.Wrap(err, "get all content policies")
+}
+
+func GetContentPolicyById(id int) (*ContentPolicy, error) {
+	policy := &ContentPolicy{}
+	err := DB.First(policy, "id = ?", id).Error
+	return policy, errors.Wrapf(err, "get content policy %d", id)
+}
+
+func (p *ContentPolicy) Insert() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.CreatedTime = helper.GetTimestamp()
+	p.UpdatedTime = p.CreatedTime
+	if err := DB.Create(p).Error; err != nil {
+		return errors.Wrapf(err, "create content policy %s", p.Name)
+	}
+	invalidateCache(CacheContentPolicies)
+	return nil
+}
+
+// Update saves all fields of the policy.
+func (p *ContentPolicy) Update() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(p).
+		Select("name", "group_name", "token_id", "stage", "type", "pattern", "channel_id", "action", "enabled", "priority", "updated_time").
+		Updates(p).Error
+	if err != nil {
+		return errors.Wrapf(err, "update content policy %s", p.Name)
+	}
+	invalidateCache(CacheContentPolicies)
+	return nil
+}
+
+func (p *ContentPolicy) Delete() error {
+	if err := DB.Delete(p).Error; err != nil {
+		return errors.Wrapf(err, "delete content policy %s", p.Name)
+	}
+	invalidateCache(CacheContentPolicies)
+	return nil
+}
+
+var (
+	contentPolicies    []*ContentPolicy
+	contentPoliciesMux sync.RWMutex
+)
+
+// InitContentPolicyCache loads the enabled content policies.
+func InitContentPolicyCache() {
+	var policies []*ContentPolicy
+	if err := DB.Where("enabled = ?", true).Order("priority desc, id asc").Find(&policies).Error; err != nil {
+		logger.Logger.Error("failed to load content policies", zap.Error(err))
+		return
+	}
+	contentPoliciesMux.Lock()
+	contentPolicies = policies
+	contentPoliciesMux.Unlock()
+}
+
+func SyncContentPolicyCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing content policies from database")
+		InitContentPolicyCache()
+	}
+}
+
+// GetContentPolicies returns the enabled policies covering requests of the group and token,
+// in the order they are applied.
+func GetContentPolicies(group string, tokenId int) []*ContentPolicy {
+	contentPoliciesMux.RLock()
+	defer contentPoliciesMux.RUnlock()
+	var result []*ContentPolicy
+	for _, policy := range contentPolicies {
+		if (policy.Group == "" || policy.Group == group) && (policy.TokenId == 0 || policy.TokenId == tokenId) {
+			result = append(result, policy)
+		}
+	}
+	return result
+}
+
+// ContentPolicyEvent records a request that matched a content policy, for review.
+type ContentPolicyEvent struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	PolicyId   int    `json:"policy_id" gorm:"index"`
+	PolicyName string `json:"policy_name" gorm:"type:varchar(64)"`
+	Stage      string `json:"stage" gorm:"type:varchar(16)"`
+	Action     string `json:"action" gorm:"type:varchar(16)"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	TokenId    int    `json:"token_id"`
+	Group      string `json:"group" gorm:"column:group_name;type:varchar(32)"`
+	Model      string `json:"model" gorm:"type:varchar(255)"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64)"`
+	// Excerpt is the text around the match, detected personal data is masked
+	Excerpt  string `json:"excerpt" gorm:"type:text"`
+	Reviewed bool   `json:"reviewed" gorm:"index"`
+}
+
+func (e *ContentPolicyEvent) Insert() error {
+	if e.CreatedAt == 0 {
+		e.CreatedAt = helper.GetTimestamp()
+	}
+	return errors.Wrap(DB.Create(e).Error, "create content policy event")
+}
+
+// GetContentPolicyEvents returns a page of events, newest first. reviewed filters the
+// events by their review status, nil returns all events.
+func GetContentPolicyEvents(startIdx int, num int, reviewed *bool) (events []*ContentPolicyEvent, total int64, err error) {
+	query := DB.Model(&ContentPolicyEvent{})
+	if reviewed != nil {
+		query = query.Where("reviewed = ?", *reviewed)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "count content policy events")
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&events).Error
+	return events, total, errors.Wrap(err, "get content policy events")
+}
+
+// ReviewContentPolicyEvent marks the event as reviewed.
+func ReviewContentPolicyEvent(id int) error {
+	result := DB.Model(&ContentPolicyEvent{}).Where("id = ?", id).Update("reviewed", true)
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "review content policy event %d", id)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Errorf("content policy event %d not found", id)
+	}
+	return nil
+}
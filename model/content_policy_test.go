@@ -0,0 +1,72 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentPolicyValidate(t *testing.T) {
+	valid := &ContentPolicy{Name: " pii ", Type: ContentPolicyTypePII, Pattern: "email, card", Action: ContentPolicyActionRedact}
+	require.NoError(t, valid.validate())
+	assert.Equal(t, "pii", valid.Name)
+	assert.Equal(t, "email,card", valid.Pattern)
+	assert.Equal(t, ContentPolicyStageInput, valid.Stage)
+
+	for name, policy := range map[string]*ContentPolicy{
+		"regex":      {Name: "r", Type: ContentPolicyTypeRegex, Pattern: "(", Action: ContentPolicyActionBlock},
+		"keywords":   {Name: "k", Type: ContentPolicyTypeKeyword, Pattern: " , \n", Action: ContentPolicyActionBlock},
+		"detector":   {Name: "p", Type: ContentPolicyTypePII, Pattern: "ssn", Action: ContentPolicyActionRedact},
+		"channel":    {Name: "m", Type: ContentPolicyTypeModeration, Action: ContentPolicyActionBlock},
+		"redact":     {Name: "m", Type: ContentPolicyTypeModeration, ChannelId: 1, Action: ContentPolicyActionRedact},
+		"action":     {Name: "k", Type: ContentPolicyTypeKeyword, Pattern: "a", Action: "drop"},
+		"stage":      {Name: "k", Type: ContentPolicyTypeKeyword, Pattern: "a", Action: ContentPolicyActionFlag, Stage: "never"},
+		"group name": {Name: "k", Type: ContentPolicyTypeKeyword, Pattern: "a", Action: ContentPolicyActionFlag, Group: "a,b"},
+	} {
+		assert.Error(t, policy.validate(), name)
+	}
+}
+
+func TestContentPolicyCacheAndEvents(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&ContentPolicy{}, &ContentPolicyEvent{}))
+	originalDB := DB
+	DB = testDB
+	defer func() {
+		contentPoliciesMux.Lock()
+		contentPolicies = nil
+		contentPoliciesMux.Unlock()
+		DB = originalDB
+	}()
+
+	for _, policy := range []*ContentPolicy{
+		{Name: "all", Type: ContentPolicyTypeKeyword, Pattern: "a", Action: ContentPolicyActionFlag, Enabled: true},
+		{Name: "vip", Group: "vip", Type: ContentPolicyTypeKeyword, Pattern: "a", Action: ContentPolicyActionFlag, Enabled: true, Priority: 10},
+		{Name: "token", TokenId: 3, Type: ContentPolicyTypeKeyword, Pattern: "a", Action: ContentPolicyActionFlag, Enabled: true},
+		{Name: "disabled", Type: ContentPolicyTypeKeyword, Pattern: "a", Action: ContentPolicyActionFlag},
+	} {
+		require.NoError(t, policy.Insert())
+	}
+	names := func(policies []*ContentPolicy) (result []string) {
+		for _, policy := range policies {
+			result = append(result, policy.Name)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"vip", "all", "token"}, names(GetContentPolicies("vip", 3)))
+	assert.Equal(t, []string{"all"}, names(GetContentPolicies("default", 4)))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, (&ContentPolicyEvent{PolicyName: "all", Action: ContentPolicyActionFlag}).Insert())
+	}
+	require.NoError(t, ReviewContentPolicyEvent(2))
+	assert.Error(t, ReviewContentPolicyEvent(42))
+
+	unreviewed := false
+	events, total, err := GetContentPolicyEvents(0, 1, &unreviewed)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, total)
+	require.Len(t, events, 1)
+	assert.Equal(t, 3, events[0].Id)
+}
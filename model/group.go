@@ -0,0 +1,408 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+// DefaultGroupName is the group new users join, it cannot be deleted.
+const DefaultGroupName = "default"
+
+// maxGroupDepth bounds the parent chain, it also protects against cycles
+// that slipped into the database by other means than the API.
+const maxGroupDepth = 16
+
+// Group is a user group. Unset settings are inherited from the parent group.
+//
+// Channels are still bound to groups by name through Channel.Group, so a group
+// does not need to exist here to be usable, it then simply has no restrictions.
+type Group struct {
+	Name        string `json:"name" gorm:"primaryKey;type:varchar(32)"`
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	// Ratio is the billing multiplier, nil inherits from the parent or defaults to 1
+	Ratio *float64 `json:"ratio"`
+	// AllowedModels is a comma separated list of reachable models,
+	// empty inherits from the parent, empty at the root allows every model
+	AllowedModels string `json:"allowed_models" gorm:"type:text"`
+	// DeniedModels is a comma separated list of blocked models, merged with the parent's
+	DeniedModels string `json:"denied_models" gorm:"type:text"`
+	// DefaultRPM is the per user requests per minute limit, nil inherits, 0 means unlimited
+	DefaultRPM *int `json:"default_rpm" gorm:"column:default_rpm"`
+	// QueuePriority orders the requests waiting for a channel, higher is served first, nil inherits or defaults to 0
+	QueuePriority *int   `json:"queue_priority"`
+	Parent        string `json:"parent" gorm:"type:varchar(32);default:''"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime   int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// TableName avoids `groups`, which is a reserved word in MySQL 8.
+func (Group) TableName() string {
+	return "user_groups"
+}
+
+// GroupPolicy is the effective setting of a group after inheritance is resolved.
+type GroupPolicy struct {
+	Name  string  `json:"name"`
+	Ratio float64 `json:"ratio"`
+	// ModelRatios overrides Ratio for single models
+	ModelRatios map[string]float64 `json:"model_ratios"`
+	// AllowedModels is nil when every model is allowed
+	AllowedModels []string `json:"allowed_models"`
+	DeniedModels  []string `json:"denied_models"`
+	RPM           int      `json:"rpm"`
+	QueuePriority int      `json:"queue_priority"`
+
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+// IsModelAllowed reports whether the group may use the model.
+func (p *GroupPolicy) IsModelAllowed(modelName string) bool {
+	if p == nil {
+		return true
+	}
+	if p.denied[modelName] {
+		return false
+	}
+	return p.allowed == nil || p.allowed[modelName]
+}
+
+func splitModels(models string) []string {
+	var result []string
+	for _, m := range strings.Split(models, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// ValidGroupName reports whether name can be used as a group name,
+// channels store their groups comma separated.
+func ValidGroupName(name string) bool {
+	return name != "" && len(name) <= 32 && !strings.ContainsAny(name, ", ")
+}
+
+func GetAllGroups() ([]*Group, error) {
+	var groups []*Group
+	err := DB.Order("name asc").Find(&groups).Error
+	return groups, errors.Wrap(err, "get all groups")
+}
+
+func GetGroupByName(name string) (*Group, error) {
+	group := &Group{}
+	err := DB.First(group, "name = ?", name).Error
+	return group, err
+}
+
+// validate checks the group against the groups stored in the database.
+func (group *Group) validate() error {
+	if !ValidGroupName(group.Name) {
+		return errors.Errorf("invalid group name %q", group.Name)
+	}
+	if group.Ratio != nil && *group.Ratio < 0 {
+		return errors.New("ratio must not be negative")
+	}
+	if group.DefaultRPM != nil && *group.DefaultRPM < 0 {
+		return errors.New("default rpm must not be negative")
+	}
+	group.AllowedModels = strings.Join(splitModels(group.AllowedModels), ",")
+	group.DeniedModels = strings.Join(splitModels(group.DeniedModels), ",")
+
+	// walk up the parent chain to reject unknown parents and cycles
+	parent := group.Parent
+	for depth := 0; parent != ""; depth++ {
+		if parent == group.Name {
+			return errors.Errorf("group %s cannot inherit from itself", group.Name)
+		}
+		if depth >= maxGroupDepth {
+			return errors.Errorf("group inheritance is deeper than %d levels", maxGroupDepth)
+		}
+		parentGroup, err := GetGroupByName(parent)
+		if err != nil {
+			return errors.Wrapf(err, "get parent group %s", parent)
+		}
+		parent = parentGroup.Parent
+	}
+	return nil
+}
+
+func (group *Group) Insert() error {
+	if err := group.validate(); err != nil {
+		return err
+	}
+	group.CreatedTime = helper.GetTimestamp()
+	group.UpdatedTime = group.CreatedTime
+	if err := DB.Create(group).Error; err != nil {
+		return errors.Wrapf(err, "create group %s", group.Name)
+	}
+	invalidateCache(CacheGroups)
+	return nil
+}
+
+// Update saves all fields of the group, so nil settings go back to being inherited.
+func (group *Group) Update() error {
+	if err := group.validate(); err != nil {
+		return err
+	}
+	group.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(group).
+		Select("description", "ratio", "allowed_models", "denied_models", "default_rpm", "queue_priority", "parent", "updated_time").
+		Updates(group).Error
+	if err != nil {
+		return errors.Wrapf(err, "update group %s", group.Name)
+	}
+	invalidateCache(CacheGroups)
+	return nil
+}
+
+// Delete removes the group unless it is still referenced by users or child groups.
+func (group *Group) Delete() error {
+	if group.Name == DefaultGroupName {
+		return errors.New("the default group cannot be deleted")
+	}
+	var count int64
+	if err := DB.Model(&Group{}).Where("parent = ?", group.Name).Count(&count).Error; err != nil {
+		return errors.Wrap(err, "count child groups")
+	}
+	if count > 0 {
+		return errors.Errorf("group %s is the parent of %d groups", group.Name, count)
+	}
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	if err := DB.Model(&User{}).Where(groupCol+" = ?", group.Name).Count(&count).Error; err != nil {
+		return errors.Wrap(err, "count group users")
+	}
+	if count > 0 {
+		return errors.Errorf("group %s still has %d users", group.Name, count)
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_name = ?", group.Name).Delete(&GroupModelRatio{}).Error; err != nil {
+			return errors.Wrap(err, "delete model ratios")
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "delete group %s", group.Name)
+	}
+	invalidateCache(CacheGroups)
+	return nil
+}
+
+// GetGroupUsers returns the users in the group that are not deleted, ordered by id.
+func GetGroupUsers(name string) (users []*User, err error) {
+	err = DB.Select("id", "username", "display_name").Where(&User{Group: name}).
+		Where("status != ?", UserStatusDeleted).Order("id asc").Find(&users).Error
+	return users, errors.Wrapf(err, "get users of group %s", name)
+}
+
+// SetUsersGroup moves the users to the group.
+func SetUsersGroup(userIds []int, name string) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	if err := DB.Model(&User{}).Where("id IN ?", userIds).Update("group", name).Error; err != nil {
+		return errors.Wrapf(err, "move users to group %s", name)
+	}
+	for _, id := range userIds {
+		invalidateUserCache(id, 0)
+	}
+	return nil
+}
+
+var (
+	groupPolicies    map[string]*GroupPolicy
+	groupPoliciesMux sync.RWMutex
+)
+
+// resolveGroupPolicies computes the effective settings of every group.
+func resolveGroupPolicies(groups []*Group) map[string]*GroupPolicy {
+	byName := make(map[string]*Group, len(groups))
+	for _, group := range groups {
+		byName[group.Name] = group
+	}
+
+	policies := make(map[string]*GroupPolicy, len(groups))
+	for _, group := range groups {
+		policy := &GroupPolicy{Name: group.Name, Ratio: 1, denied: make(map[string]bool)}
+		ratioSet, rpmSet, prioritySet, allowedSet := false, false, false, false
+
+		// walk from the group up to the root, the closest setting wins
+		for g, depth := group, 0; g != nil && depth < maxGroupDepth; g, depth = byName[g.Parent], depth+1 {
+			if !ratioSet && g.Ratio != nil {
+				policy.Ratio, ratioSet = *g.Ratio, true
+			}
+			if !rpmSet && g.DefaultRPM != nil {
+				policy.RPM, rpmSet = *g.DefaultRPM, true
+			}
+			if !prioritySet && g.QueuePriority != nil {
+				policy.QueuePriority, prioritySet = *g.QueuePriority, true
+			}
+			if !allowedSet && g.AllowedModels != "" {
+				policy.AllowedModels, allowedSet = splitModels(g.AllowedModels), true
+			}
+			for _, m := range splitModels(g.DeniedModels) {
+				if !policy.denied[m] {
+					policy.denied[m] = true
+					policy.DeniedModels = append(policy.DeniedModels, m)
+				}
+			}
+			if g.Parent == "" {
+				break
+			}
+		}
+
+		if policy.AllowedModels != nil {
+			policy.allowed = make(map[string]bool, len(policy.AllowedModels))
+			for _, m := range policy.AllowedModels {
+				policy.allowed[m] = true
+			}
+		}
+		policies[group.Name] = policy
+	}
+	return policies
+}
+
+// InitGroupCache loads all groups and refreshes the effective group ratios used by billing.
+func InitGroupCache() {
+	groups, err := GetAllGroups()
+	if err != nil {
+		logger.Logger.Error("failed to load groups", zap.Error(err))
+		return
+	}
+
+	var modelRatioRows []*GroupModelRatio
+	if err = DB.Find(&modelRatioRows).Error; err != nil {
+		logger.Logger.Error("failed to load group model ratios", zap.Error(err))
+		return
+	}
+
+	policies := resolveGroupPolicies(groups)
+	modelRatios := resolveGroupModelRatios(groups, modelRatioRows)
+	ratios := make(map[string]float64, len(policies))
+	for name, policy := range policies {
+		ratios[name] = policy.Ratio
+		policy.ModelRatios = modelRatios[name]
+	}
+
+	groupPoliciesMux.Lock()
+	groupPolicies = policies
+	groupPoliciesMux.Unlock()
+	billingratio.SetGroupRatios(ratios)
+	billingratio.SetGroupModelRatios(modelRatios)
+}
+
+func SyncGroupCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing groups from database")
+		InitGroupCache()
+	}
+}
+
+// GetGroupPolicy returns the effective settings of a group,
+// or nil if the group is not declared, which means no restrictions.
+func GetGroupPolicy(name string) *GroupPolicy {
+	groupPoliciesMux.RLock()
+	defer groupPoliciesMux.RUnlock()
+	return groupPolicies[name]
+}
+
+// IsGroupModelAllowed reports whether users of the group may use the model.
+func IsGroupModelAllowed(group string, modelName string) bool {
+	return GetGroupPolicy(group).IsModelAllowed(modelName)
+}
+
+// GetGroupRPM returns the per user requests per minute limit of the group, 0 means unlimited.
+func GetGroupRPM(group string) int {
+	if policy := GetGroupPolicy(group); policy != nil {
+		return policy.RPM
+	}
+	return 0
+}
+
+// GetGroupQueuePriority returns the priority of the group's requests waiting for a channel.
+func GetGroupQueuePriority(group string) int {
+	if policy := GetGroupPolicy(group); policy != nil {
+		return policy.QueuePriority
+	}
+	return 0
+}
+
+// filterGroupModels drops abilities whose model the group may not use.
+func filterGroupModels(group string, abilities []EnabledAbility) []EnabledAbility {
+	policy := GetGroupPolicy(group)
+	if policy == nil {
+		return abilities
+	}
+	filtered := make([]EnabledAbility, 0, len(abilities))
+	for _, ability := range abilities {
+		if policy.IsModelAllowed(ability.Model) {
+			filtered = append(filtered, ability)
+		}
+	}
+	return filtered
+}
+
+// migrateGroups seeds the group table from the legacy GroupRatio option on first start.
+func migrateGroups() error {
+	var count int64
+	if err := DB.Model(&Group{}).Count(&count).Error; err != nil {
+		return errors.Wrap(err, "count groups")
+	}
+	if count > 0 {
+		return nil
+	}
+
+	ratios := map[string]float64{"default": 1, "vip": 1, "svip": 1}
+	var option Option
+	err := DB.Where(&Option{Key: "GroupRatio"}).First(&option).Error
+	switch {
+	case err == nil:
+		legacy := make(map[string]float64)
+		if err = json.Unmarshal([]byte(option.Value), &legacy); err != nil {
+			return errors.Wrap(err, "unmarshal legacy GroupRatio option")
+		}
+		ratios = legacy
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return errors.Wrap(err, "get legacy GroupRatio option")
+	}
+	if _, ok := ratios[DefaultGroupName]; !ok {
+		ratios[DefaultGroupName] = 1
+	}
+
+	now := helper.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for name, ratio := range ratios {
+			ratio := ratio
+			if !ValidGroupName(name) {
+				logger.Logger.Warn(fmt.Sprintf("skip legacy group with invalid name %q", name))
+				continue
+			}
+			group := &Group{Name: name, Ratio: &ratio, CreatedTime: now, UpdatedTime: now}
+			if err := tx.Create(group).Error; err != nil {
+				return errors.Wrapf(err, "create group %s", name)
+			}
+		}
+		// the option is no longer read, drop it so that it does not show up as a stale setting
+		if err := tx.Where(&Option{Key: "GroupRatio"}).Delete(&Option{}).Error; err != nil {
+			return errors.Wrap(err, "delete legacy GroupRatio option")
+		}
+		logger.Logger.Info("groups migrated from GroupRatio option", zap.Int("group_count", len(ratios)))
+		return nil
+	})
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// GroupModelRatio overrides the group ratio of a group for a single model,
+// e.g. to sell one model at a discount to a VIP group without changing the others.
+// Overrides are inherited by child groups unless they declare their own.
+type GroupModelRatio struct {
+	Id          int     `json:"id"`
+	Group       string  `json:"group" gorm:"column:group_name;type:varchar(32);uniqueIndex:idx_group_model"`
+	Model       string  `json:"model" gorm:"type:varchar(255);uniqueIndex:idx_group_model"`
+	Ratio       float64 `json:"ratio"`
+	CreatedTime int64   `json:"created_time" gorm:"bigint"`
+}
+
+// GetGroupModelRatios returns the overrides declared by the group itself, model -> ratio.
+func GetGroupModelRatios(group string) (map[string]float64, error) {
+	var rows []*GroupModelRatio
+	if err := DB.Where("group_name = ?", group).Find(&rows).Error; err != nil {
+		return nil, errors.Wrapf(err, "get model ratios of group %s", group)
+	}
+	ratios := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		ratios[row.Model] = row.Ratio
+	}
+	return ratios, nil
+}
+
+// SetGroupModelRatios replaces all overrides of the group.
+func SetGroupModelRatios(group string, ratios map[string]float64) error {
+	if _, err := GetGroupByName(group); err != nil {
+		return errors.Wrapf(err, "get group %s", group)
+	}
+	for modelName, ratio := range ratios {
+		if modelName == "" {
+			return errors.New("model name must not be empty")
+		}
+		if ratio < 0 {
+			return errors.Errorf("ratio of model %s must not be negative", modelName)
+		}
+	}
+
+	now := helper.GetTimestamp()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_name = ?", group).Delete(&GroupModelRatio{}).Error; err != nil {
+			return errors.Wrap(err, "delete model ratios")
+		}
+		for modelName, ratio := range ratios {
+			row := &GroupModelRatio{Group: group, Model: modelName, Ratio: ratio, CreatedTime: now}
+			if err := tx.Create(row).Error; err != nil {
+				return errors.Wrapf(err, "create model ratio of %s", modelName)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "set model ratios of group %s", group)
+	}
+	invalidateCache(CacheGroups)
+	return nil
+}
+
+// resolveGroupModelRatios computes the effective overrides of every group,
+// the closest override along the parent chain wins.
+func resolveGroupModelRatios(groups []*Group, rows []*GroupModelRatio) map[string]map[string]float64 {
+	own := make(map[string]map[string]float64)
+	for _, row := range rows {
+		if own[row.Group] == nil {
+			own[row.Group] = make(map[string]float64)
+		}
+		own[row.Group][row.Model] = row.Ratio
+	}
+	byName := make(map[string]*Group, len(groups))
+	for _, group := range groups {
+		byName[group.Name] = group
+	}
+
+	effective := make(map[string]map[string]float64)
+	for _, group := range groups {
+		ratios := make(map[string]float64)
+		for g, depth := group, 0; g != nil && depth < maxGroupDepth; g, depth = byName[g.Parent], depth+1 {
+			for modelName, ratio := range own[g.Name] {
+				if _, ok := ratios[modelName]; !ok {
+					ratios[modelName] = ratio
+				}
+			}
+			if g.Parent == "" {
+				break
+			}
+		}
+		if len(ratios) > 0 {
+			effective[group.Name] = ratios
+		}
+	}
+	return effective
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+func setupGroupTest(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&Group{}, &GroupModelRatio{}, &Option{}, &User{}))
+
+	originalDB := DB
+	DB = testDB
+	originalUsingSQLite := common.UsingSQLite
+	common.UsingSQLite = true
+	t.Cleanup(func() {
+		DB = originalDB
+		common.UsingSQLite = originalUsingSQLite
+		groupPoliciesMux.Lock()
+		groupPolicies = nil
+		groupPoliciesMux.Unlock()
+		billingratio.SetGroupRatios(map[string]float64{"default": 1, "vip": 1, "svip": 1})
+	})
+}
+
+func TestResolveGroupPolicies(t *testing.T) {
+	half, rpm, zero, priority := 0.5, 30, 0, 10
+	policies := resolveGroupPolicies([]*Group{
+		{Name: "base", Ratio: &half, DefaultRPM: &rpm, QueuePriority: &priority, AllowedModels: "gpt-4o,gpt-4o-mini", DeniedModels: "o1"},
+		{Name: "child", Parent: "base", DeniedModels: "gpt-4o-mini"},
+		{Name: "grandchild", Parent: "child", DefaultRPM: &zero, AllowedModels: "o1,gpt-4o"},
+		{Name: "orphan", Parent: "missing"},
+	})
+
+	child := policies["child"]
+	assert.Equal(t, 0.5, child.Ratio)
+	assert.Equal(t, 30, child.RPM)
+	assert.Equal(t, 10, child.QueuePriority)
+	assert.True(t, child.IsModelAllowed("gpt-4o"))
+	assert.False(t, child.IsModelAllowed("gpt-4o-mini"))
+	assert.False(t, child.IsModelAllowed("claude-3"))
+
+	grandchild := policies["grandchild"]
+	assert.Equal(t, 0, grandchild.RPM)
+	assert.False(t, grandchild.IsModelAllowed("o1"), "denied models are inherited")
+	assert.True(t, grandchild.IsModelAllowed("gpt-4o"))
+
+	orphan := policies["orphan"]
+	assert.Equal(t, 1.0, orphan.Ratio)
+	assert.Equal(t, 0, orphan.QueuePriority)
+	assert.True(t, orphan.IsModelAllowed("anything"))
+
+	var unknown *GroupPolicy
+	assert.True(t, unknown.IsModelAllowed("anything"))
+}
+
+func TestMigrateGroupsFromLegacyOption(t *testing.T) {
+	setupGroupTest(t)
+	require.NoError(t, DB.Create(&Option{Key: "GroupRatio", Value: `{"default": 1, "vip": 0.8}`}).Error)
+
+	require.NoError(t, migrateGroups())
+	InitGroupCache()
+
+	groups, err := GetAllGroups()
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, 0.8, billingratio.GetGroupRatio("vip"))
+
+	var count int64
+	require.NoError(t, DB.Model(&Option{}).Where("key = ?", "GroupRatio").Count(&count).Error)
+	assert.Zero(t, count)
+
+	// the migration only runs on an empty table
+	require.NoError(t, DB.Delete(&Group{Name: "vip"}).Error)
+	require.NoError(t, migrateGroups())
+	groups, err = GetAllGroups()
+	require.NoError(t, err)
+	assert.Len(t, groups, 1)
+
+	// the option cannot be saved anymore, the groups are edited with the group API
+	assert.ErrorContains(t, UpdateOption("GroupRatio", `{"default": 2}`), "/api/group/")
+	require.NoError(t, DB.Model(&Option{}).Where("key = ?", "GroupRatio").Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestGroupCRUD(t *testing.T) {
+	setupGroupTest(t)
+	ratio := 2.0
+
+	require.NoError(t, (&Group{Name: "default"}).Insert())
+	require.NoError(t, (&Group{Name: "pro", Ratio: &ratio, Parent: "default"}).Insert())
+	require.Error(t, (&Group{Name: "bad,name"}).Insert())
+	require.Error(t, (&Group{Name: "team", Parent: "missing"}).Insert())
+
+	team := &Group{Name: "team", Parent: "pro", DeniedModels: " gpt-4o , "}
+	require.NoError(t, team.Insert())
+	assert.Equal(t, "gpt-4o", team.DeniedModels)
+	assert.Equal(t, 2.0, billingratio.GetGroupRatio("team"))
+	assert.False(t, IsGroupModelAllowed("team", "gpt-4o"))
+
+	// cycles are rejected
+	pro := &Group{Name: "pro", Ratio: &ratio, Parent: "team"}
+	require.Error(t, pro.Update())
+
+	// clearing a setting makes it inherited again
+	pro = &Group{Name: "pro", Parent: "default"}
+	require.NoError(t, pro.Update())
+	assert.Equal(t, 1.0, billingratio.GetGroupRatio("team"))
+
+	// groups that are still referenced cannot be deleted
+	require.Error(t, (&Group{Name: "default"}).Delete())
+	require.Error(t, (&Group{Name: "pro"}).Delete())
+	require.NoError(t, DB.Create(&User{Username: "u", Group: "team", AccessToken: "t", AffCode: "a"}).Error)
+	require.Error(t, (&Group{Name: "team"}).Delete())
+	require.NoError(t, DB.Model(&User{}).Where("username = ?", "u").Update("group", "default").Error)
+	require.NoError(t, (&Group{Name: "team"}).Delete())
+	assert.Nil(t, GetGroupPolicy("team"))
+}
+
+func TestGroupModelRatios(t *testing.T) {
+	setupGroupTest(t)
+	ratio := 0.8
+
+	require.NoError(t, (&Group{Name: "vip", Ratio: &ratio}).Insert())
+	require.NoError(t, (&Group{Name: "vip-team", Parent: "vip"}).Insert())
+	require.Error(t, SetGroupModelRatios("missing", map[string]float64{"gpt-4o": 0.5}))
+	require.Error(t, SetGroupModelRatios("vip", map[string]float64{"gpt-4o": -1}))
+
+	require.NoError(t, SetGroupModelRatios("vip", map[string]float64{"gpt-4o": 0.5, "o1": 0.6}))
+	require.NoError(t, SetGroupModelRatios("vip-team", map[string]float64{"o1": 0.4}))
+
+	assert.Equal(t, 0.5, billingratio.GetGroupModelRatio("vip", "gpt-4o"))
+	assert.Equal(t, 0.8, billingratio.GetGroupModelRatio("vip", "claude-3"), "models without override use the group ratio")
+	assert.Equal(t, 0.5, billingratio.GetGroupModelRatio("vip-team", "gpt-4o"), "overrides are inherited")
+	assert.Equal(t, 0.4, billingratio.GetGroupModelRatio("vip-team", "o1"), "the closest override wins")
+	assert.Equal(t, map[string]float64{"gpt-4o": 0.5, "o1": 0.4}, GetGroupPolicy("vip-team").ModelRatios)
+
+	// replacing the overrides drops the old ones
+	require.NoError(t, SetGroupModelRatios("vip", map[string]float64{}))
+	assert.Equal(t, 0.8, billingratio.GetGroupModelRatio("vip-team", "gpt-4o"))
+	ratios, err := GetGroupModelRatios("vip-team")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"o1": 0.4}, ratios)
+
+	// deleting a group removes its overrides
+	require.NoError(t, (&Group{Name: "vip-team"}).Delete())
+	var count int64
+	require.NoError(t, DB.Model(&GroupModelRatio{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
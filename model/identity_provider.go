@@ -0,0 +1,492 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+// Identity provider types
+const (
+	// IdentityProviderTypeOAuth2 is a generic OAuth2 authorization code provider,
+	// the claims are read from the userinfo endpoint
+	IdentityProviderTypeOAuth2 = "oauth2"
+	// IdentityProviderTypeSAML is a SAML 2.0 identity provider, the claims are the
+	// attributes of the signed assertion
+	IdentityProviderTypeSAML = "saml"
+	// IdentityProviderTypeJWT is an issuer of JWTs that authenticate relay calls, it has
+	// no login, the claims are those of the token
+	IdentityProviderTypeJWT = "jwt"
+)
+
+// BuiltinIdentityProviders are the providers configured by options, whose links are
+// kept in the columns of User. Configured providers cannot use their names.
+var BuiltinIdentityProviders = map[string]string{
+	"github": "github_id",
+	"wechat": "wechat_id",
+	"lark":   "lark_id",
+	"oidc":   "oidc_id",
+}
+
+// IdentityProviderClaims names the claims, or SAML attributes, an identity is read from.
+type IdentityProviderClaims struct {
+	// Subject identifies the user at the provider, NameID is the subject of SAML assertions
+	Subject     string `json:"subject,omitempty"`
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	// Group and Role are mapped by GroupMapping and RoleMapping
+	Group string `json:"group,omitempty"`
+	Role  string `json:"role,omitempty"`
+	// Models and Token are read from JWTs only, Models restricts the models a call may use
+	// and Token names the token of the user whose quota it is charged to
+	Models string `json:"models,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+// defaultIdentityProviderClaims are used for the claims a provider does not name.
+var defaultIdentityProviderClaims = map[string]IdentityProviderClaims{
+	IdentityProviderTypeOAuth2: {
+		Subject:     "sub",
+		Username:    "preferred_username",
+		DisplayName: "name",
+		Email:       "email",
+	},
+	IdentityProviderTypeSAML: {
+		Subject:     "NameID",
+		Username:    "uid",
+		DisplayName: "displayName",
+		Email:       "mail",
+	},
+	IdentityProviderTypeJWT: {
+		Subject: "sub",
+	},
+}
+
+// IdentityProvider is a login provider configured by the admins, in addition to the
+// built-in GitHub, Lark, OIDC and WeChat logins.
+type IdentityProvider struct {
+	Id int `json:"id"`
+	// Name is used in the login URLs and to link users, e.g. /api/sso/corp/login
+	Name    string `json:"name" gorm:"type:varchar(32);uniqueIndex"`
+	Title   string `json:"title" gorm:"type:varchar(64)"`
+	Type    string `json:"type" gorm:"type:varchar(16)"`
+	Enabled bool   `json:"enabled"`
+	// RegisterEnabled lets unknown users sign up, on top of the global RegisterEnabled
+	RegisterEnabled bool `json:"register_enabled"`
+
+	// OAuth2 settings
+	ClientId         string `json:"client_id" gorm:"type:varchar(255)"`
+	ClientSecret     string `json:"client_secret" gorm:"type:text"`
+	AuthorizationURL string `json:"authorization_url" gorm:"type:varchar(512)"`
+	TokenURL         string `json:"token_url" gorm:"type:varchar(512)"`
+	UserinfoURL      string `json:"userinfo_url" gorm:"type:varchar(512)"`
+	// Scopes are space separated
+	Scopes string `json:"scopes" gorm:"type:varchar(255)"`
+
+	// SAML settings, the IdP metadata is either fetched from MetadataURL or given in Metadata
+	MetadataURL string `json:"metadata_url" gorm:"type:varchar(512)"`
+	Metadata    string `json:"metadata" gorm:"type:text"`
+	// Certificate and PrivateKey are the optional PEM encoded key pair of the service
+	// provider, used to sign authentication requests and to decrypt assertions
+	Certificate string `json:"certificate" gorm:"type:text"`
+	PrivateKey  string `json:"private_key" gorm:"type:text"`
+
+	// JWT settings, the signing keys of Issuer are fetched from JwksURL
+	Issuer  string `json:"issuer" gorm:"type:varchar(512);index"`
+	JwksURL string `json:"jwks_url" gorm:"type:varchar(512)"`
+	// Audience, if set, must be an audience of the tokens
+	Audience string `json:"audience" gorm:"type:varchar(255)"`
+	// TokenName is the token the calls are charged to when tokens have no token claim
+	TokenName string `json:"token_name" gorm:"type:varchar(255)"`
+	// AllowAdmins lets the tokens of the issuer act for admins and the root user, who are
+	// refused by default even if they are linked to a subject
+	AllowAdmins bool `json:"allow_admins"`
+
+	// Claims is the JSON encoded IdentityProviderClaims
+	Claims string `json:"claims" gorm:"type:text"`
+	// GroupMapping is the JSON object mapping values of the group claim to groups
+	GroupMapping string `json:"group_mapping" gorm:"type:text"`
+	// RoleMapping is the JSON object mapping values of the role claim to "admin" or "common"
+	RoleMapping string `json:"role_mapping" gorm:"type:text"`
+
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64 `json:"updated_time" gorm:"bigint"`
+}
+
+var identityProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// AfterFind decrypts the secrets of the provider right after it is loaded.
+func (p *IdentityProvider) AfterFind(tx *gorm.DB) error {
+	return p.transformSecrets(secret.Decrypt)
+}
+
+func (p *IdentityProvider) transformSecrets(fn func(string) (string, error)) error {
+	clientSecret, err := fn(p.ClientSecret)
+	if err != nil {
+		return errors.Wrapf(err, "client secret of identity provider %s", p.Name)
+	}
+	privateKey, err := fn(p.PrivateKey)
+	if err != nil {
+		return errors.Wrapf(err, "private key of identity provider %s", p.Name)
+	}
+	p.ClientSecret, p.PrivateKey = clientSecret, privateKey
+	return nil
+}
+
+// MaskSecrets masks the client secret and the private key, it must be called before a
+// provider is returned by the API.
+func (p *IdentityProvider) MaskSecrets() {
+	if p.ClientSecret != "" {
+		p.ClientSecret = secret.Masked
+	}
+	if p.PrivateKey != "" {
+		p.PrivateKey = secret.Masked
+	}
+}
+
+// KeepMaskedSecrets restores the secrets the client sent back masked.
+func (p *IdentityProvider) KeepMaskedSecrets(stored *IdentityProvider) {
+	if p.ClientSecret == secret.Masked {
+		p.ClientSecret = stored.ClientSecret
+	}
+	if p.PrivateKey == secret.Masked {
+		p.PrivateKey = stored.PrivateKey
+	}
+}
+
+// GetClaims returns the claims of the provider, with the defaults of its type.
+func (p *IdentityProvider) GetClaims() IdentityProviderClaims {
+	claims := IdentityProviderClaims{}
+	_ = json.Unmarshal([]byte(p.Claims), &claims)
+	defaults := defaultIdentityProviderClaims[p.Type]
+	for _, field := range []struct{ value, fallback *string }{
+		{&claims.Subject, &defaults.Subject},
+		{&claims.Username, &defaults.Username},
+		{&claims.DisplayName, &defaults.DisplayName},
+		{&claims.Email, &defaults.Email},
+	} {
+		if *field.value == "" {
+			*field.value = *field.fallback
+		}
+	}
+	return claims
+}
+
+// ClaimValues returns the values of the claim as strings, names of nested claims are
+// separated by dots, e.g. realm_access.roles.
+func ClaimValues(claims map[string]any, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var value any = claims
+	for _, key := range strings.Split(name, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if value, ok = object[key]; !ok {
+			// names may contain dots themselves, e.g. SAML attribute URIs
+			if value, ok = object[name]; !ok {
+				return nil
+			}
+			break
+		}
+	}
+	var values []string
+	var collect func(any)
+	collect = func(v any) {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				values = append(values, v)
+			}
+		case []any:
+			for _, item := range v {
+				collect(item)
+			}
+		case []string:
+			for _, item := range v {
+				collect(item)
+			}
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	collect(value)
+	return values
+}
+
+// MapGroup returns the group of the first value mapped by GroupMapping, or "".
+func (p *IdentityProvider) MapGroup(values []string) string {
+	mapping := make(map[string]string)
+	_ = json.Unmarshal([]byte(p.GroupMapping), &mapping)
+	for _, value := range values {
+		if group, ok := mapping[value]; ok {
+			return group
+		}
+	}
+	return ""
+}
+
+// MapRole returns RoleAdminUser if any value maps to "admin", RoleCommonUser if any
+// maps to "common", and 0 if none is mapped. Providers never grant the root role.
+func (p *IdentityProvider) MapRole(values []string) int {
+	mapping := make(map[string]string)
+	_ = json.Unmarshal([]byte(p.RoleMapping), &mapping)
+	role := 0
+	for _, value := range values {
+		switch mapping[value] {
+		case "admin":
+			return RoleAdminUser
+		case "common":
+			role = RoleCommonUser
+		}
+	}
+	return role
+}
+
+// validate normalizes the provider and checks its settings.
+func (p *IdentityProvider) validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if !identityProviderName.MatchString(p.Name) {
+		return errors.Errorf("invalid identity provider name %q, use lower case letters, digits, - and _", p.Name)
+	}
+	if _, ok := BuiltinIdentityProviders[p.Name]; ok || p.Name == SCIMIdentityProvider {
+		return errors.Errorf("identity provider name %s is reserved", p.Name)
+	}
+	if p.Title == "" {
+		p.Title = p.Name
+	}
+	switch p.Type {
+	case IdentityProviderTypeOAuth2:
+		if p.ClientId == "" {
+			return errors.New("client_id is required")
+		}
+		for name, value := range map[string]string{
+			"authorization_url": p.AuthorizationURL,
+			"token_url":         p.TokenURL,
+			"userinfo_url":      p.UserinfoURL,
+		} {
+			if err := validateProviderURL(name, value); err != nil {
+				return err
+			}
+		}
+	case IdentityProviderTypeSAML:
+		if p.Metadata == "" && p.MetadataURL == "" {
+			return errors.New("metadata or metadata_url is required")
+		}
+		if p.Metadata == "" {
+			if err := validateProviderURL("metadata_url", p.MetadataURL); err != nil {
+				return err
+			}
+		}
+		if (p.Certificate == "") != (p.PrivateKey == "") {
+			return errors.New("certificate and private_key must be set together")
+		}
+	case IdentityProviderTypeJWT:
+		p.Issuer = strings.TrimSpace(p.Issuer)
+		if p.Issuer == "" {
+			return errors.New("issuer is required")
+		}
+		if err := validateProviderURL("jwks_url", p.JwksURL); err != nil {
+			return err
+		}
+		var count int64
+		if err := DB.Model(&IdentityProvider{}).
+			Where("type = ? AND issuer = ? AND id <> ?", IdentityProviderTypeJWT, p.Issuer, p.Id).
+			Count(&count).Error; err != nil {
+			return errors.Wrap(err, "check issuer")
+		}
+		if count > 0 {
+			return errors.Errorf("issuer %s is already configured", p.Issuer)
+		}
+	default:
+		return errors.Errorf("unknown identity provider type %q", p.Type)
+	}
+
+	if p.Claims != "" {
+		claims := IdentityProviderClaims{}
+		if err := json.Unmarshal([]byte(p.Claims), &claims); err != nil {
+			return errors.Wrap(err, "claims must be a JSON object")
+		}
+	}
+	groups := make(map[string]string)
+	if p.GroupMapping != "" {
+		if err := json.Unmarshal([]byte(p.GroupMapping), &groups); err != nil {
+			return errors.Wrap(err, "group_mapping must be a JSON object of strings")
+		}
+	}
+	for value, group := range groups {
+		if !ValidGroupName(group) {
+			return errors.Errorf("invalid group %q of group claim value %q", group, value)
+		}
+	}
+	roles := make(map[string]string)
+	if p.RoleMapping != "" {
+		if err := json.Unmarshal([]byte(p.RoleMapping), &roles); err != nil {
+			return errors.Wrap(err, "role_mapping must be a JSON object of strings")
+		}
+	}
+	for value, role := range roles {
+		if role != "admin" && role != "common" {
+			return errors.Errorf("role of role claim value %q must be admin or common, got %q", value, role)
+		}
+	}
+	return nil
+}
+
+func validateProviderURL(name string, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.Errorf("%s must be an http(s) URL", name)
+	}
+	return nil
+}
+
+func GetAllIdentityProviders() ([]*IdentityProvider, error) {
+	var providers []*IdentityProvider
+	err := DB.Order("id asc").Find(&providers).Error
+	return providers, errors.Wrap(err, "get all identity providers")
+}
+
+func GetIdentityProviderById(id int) (*IdentityProvider, error) {
+	provider := &IdentityProvider{}
+	err := DB.First(provider, "id = ?", id).Error
+	return provider, errors.Wrapf(err, "get identity provider %d", id)
+}
+
+// save writes the provider with its secrets encrypted, the provider keeps the plaintext.
+func (p *IdentityProvider) save(create bool) error {
+	stored := *p
+	if err := stored.transformSecrets(secret.Encrypt); err != nil {
+		return err
+	}
+	var err error
+	if create {
+		err = DB.Create(&stored).Error
+		p.Id = stored.Id
+	} else {
+		err = DB.Model(&stored).Select("*").Omit("created_time").Updates(&stored).Error
+	}
+	return err
+}
+
+func (p *IdentityProvider) Insert() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.CreatedTime = helper.GetTimestamp()
+	p.UpdatedTime = p.CreatedTime
+	if err := p.save(true); err != nil {
+		return errors.Wrapf(err, "create identity provider %s", p.Name)
+	}
+	invalidateCache(CacheIdentityProviders)
+	return nil
+}
+
+func (p *IdentityProvider) Update() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.UpdatedTime = helper.GetTimestamp()
+	if err := p.save(false); err != nil {
+		return errors.Wrapf(err, "update identity provider %s", p.Name)
+	}
+	invalidateCache(CacheIdentityProviders)
+	return nil
+}
+
+// Delete removes the provider and the links of the users to it.
+func (p *IdentityProvider) Delete() error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("provider = ?", p.Name).Delete(&UserIdentity{}).Error; err != nil {
+			return errors.Wrap(err, "delete user identities")
+		}
+		return tx.Delete(p).Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "delete identity provider %s", p.Name)
+	}
+	invalidateCache(CacheIdentityProviders)
+	return nil
+}
+
+var (
+	identityProviders    map[string]*IdentityProvider
+	identityProvidersMux sync.RWMutex
+)
+
+// InitIdentityProviderCache loads the enabled identity providers.
+func InitIdentityProviderCache() {
+	var providers []*IdentityProvider
+	if err := DB.Where("enabled = ?", true).Find(&providers).Error; err != nil {
+		logger.Logger.Error("failed to load identity providers", zap.Error(err))
+		return
+	}
+	byName := make(map[string]*IdentityProvider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name] = provider
+	}
+	identityProvidersMux.Lock()
+	identityProviders = byName
+	identityProvidersMux.Unlock()
+}
+
+func SyncIdentityProviderCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing identity providers from database")
+		InitIdentityProviderCache()
+	}
+}
+
+// GetIdentityProvider returns the enabled provider of the name, or nil.
+func GetIdentityProvider(name string) *IdentityProvider {
+	identityProvidersMux.RLock()
+	defer identityProvidersMux.RUnlock()
+	return identityProviders[name]
+}
+
+// GetJWTIssuer returns the enabled JWT provider of the issuer, or nil.
+func GetJWTIssuer(issuer string) *IdentityProvider {
+	identityProvidersMux.RLock()
+	defer identityProvidersMux.RUnlock()
+	for _, provider := range identityProviders {
+		if provider.Type == IdentityProviderTypeJWT && provider.Issuer == issuer {
+			return provider
+		}
+	}
+	return nil
+}
+
+// GetIdentityProviders returns the enabled providers ordered by id.
+func GetIdentityProviders() []*IdentityProvider {
+	identityProvidersMux.RLock()
+	providers := make([]*IdentityProvider, 0, len(identityProviders))
+	for _, provider := range identityProviders {
+		providers = append(providers, provider)
+	}
+	identityProvidersMux.RUnlock()
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Id < providers[j].Id
+	})
+	return providers
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+func TestIdentityProviderValidate(t *testing.T) {
+	valid := func() *IdentityProvider {
+		return &IdentityProvider{
+			Name:             "corp",
+			Type:             IdentityProviderTypeOAuth2,
+			ClientId:         "client",
+			AuthorizationURL: "https://idp.example.com/authorize",
+			TokenURL:         "https://idp.example.com/token",
+			UserinfoURL:      "https://idp.example.com/userinfo",
+		}
+	}
+	provider := valid()
+	require.NoError(t, provider.validate())
+	assert.Equal(t, "corp", provider.Title)
+
+	for name, change := range map[string]func(p *IdentityProvider){
+		"bad name":      func(p *IdentityProvider) { p.Name = "Corp SSO" },
+		"builtin name":  func(p *IdentityProvider) { p.Name = "github" },
+		"unknown type":  func(p *IdentityProvider) { p.Type = "ldap" },
+		"no client id":  func(p *IdentityProvider) { p.ClientId = "" },
+		"bad token url": func(p *IdentityProvider) { p.TokenURL = "idp.example.com/token" },
+		"bad claims":    func(p *IdentityProvider) { p.Claims = "[]" },
+		"bad group":     func(p *IdentityProvider) { p.GroupMapping = `{"staff": "no such group!"}` },
+		"root role":     func(p *IdentityProvider) { p.RoleMapping = `{"ops": "root"}` },
+		"saml without metadata": func(p *IdentityProvider) {
+			p.Type = IdentityProviderTypeSAML
+		},
+		"saml key without certificate": func(p *IdentityProvider) {
+			p.Type, p.Metadata, p.PrivateKey = IdentityProviderTypeSAML, "<EntityDescriptor/>", "key"
+		},
+	} {
+		provider := valid()
+		change(provider)
+		assert.Error(t, provider.validate(), name)
+	}
+}
+
+func TestIdentityProviderMapping(t *testing.T) {
+	provider := &IdentityProvider{
+		Type:         IdentityProviderTypeSAML,
+		Claims:       `{"username": "email", "group": "department", "role": "memberOf"}`,
+		GroupMapping: `{"research": "vip"}`,
+		RoleMapping:  `{"staff": "common", "ops": "admin"}`,
+	}
+	claims := provider.GetClaims()
+	assert.Equal(t, "NameID", claims.Subject)
+	assert.Equal(t, "email", claims.Username)
+	assert.Equal(t, "displayName", claims.DisplayName)
+	assert.Equal(t, "department", claims.Group)
+
+	assert.Equal(t, "vip", provider.MapGroup([]string{"sales", "research"}))
+	assert.Equal(t, "", provider.MapGroup([]string{"sales"}))
+	assert.Equal(t, RoleAdminUser, provider.MapRole([]string{"staff", "ops"}))
+	assert.Equal(t, RoleCommonUser, provider.MapRole([]string{"staff"}))
+	assert.Equal(t, 0, provider.MapRole(nil))
+}
+
+func TestIdentityProviderSecrets(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&IdentityProvider{}, &UserIdentity{}))
+	originalDB, originalKey := DB, config.ChannelSecretKey
+	DB = testDB
+	config.ChannelSecretKey = "master-key"
+	secret.Reload()
+	defer func() {
+		identityProvidersMux.Lock()
+		identityProviders = nil
+		identityProvidersMux.Unlock()
+		DB, config.ChannelSecretKey = originalDB, originalKey
+		secret.Reload()
+	}()
+
+	provider := &IdentityProvider{
+		Name:             "corp",
+		Type:             IdentityProviderTypeOAuth2,
+		Enabled:          true,
+		ClientId:         "client",
+		ClientSecret:     "client-secret",
+		AuthorizationURL: "https://idp.example.com/authorize",
+		TokenURL:         "https://idp.example.com/token",
+		UserinfoURL:      "https://idp.example.com/userinfo",
+	}
+	require.NoError(t, provider.Insert())
+	assert.Equal(t, "client-secret", provider.ClientSecret)
+
+	var raw string
+	require.NoError(t, DB.Raw("SELECT client_secret FROM identity_providers WHERE id = ?", provider.Id).Scan(&raw).Error)
+	assert.True(t, secret.IsEncrypted(raw))
+	require.NotNil(t, GetIdentityProvider("corp"))
+	assert.Equal(t, "client-secret", GetIdentityProvider("corp").ClientSecret)
+
+	// a masked secret sent back by the admin page keeps the stored one
+	update := *provider
+	update.MaskSecrets()
+	update.Title = "Corp"
+	stored, err := GetIdentityProviderById(provider.Id)
+	require.NoError(t, err)
+	update.KeepMaskedSecrets(stored)
+	require.NoError(t, update.Update())
+	stored, err = GetIdentityProviderById(provider.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "Corp", stored.Title)
+	assert.Equal(t, "client-secret", stored.ClientSecret)
+
+	require.NoError(t, BindIdentity(7, "corp", "alice"))
+	assert.True(t, IsIdentityTaken("corp", "alice"))
+	require.NoError(t, stored.Delete())
+	assert.False(t, IsIdentityTaken("corp", "alice"))
+	assert.Nil(t, GetIdentityProvider("corp"))
+}
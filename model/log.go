@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Laisky/zap"
@@ -31,6 +32,16 @@ type Log struct {
 	ElapsedTime       int64  `json:"elapsed_time" gorm:"default:0;index"` // Added index for sorting (unit is ms)
 	IsStream          bool   `json:"is_stream" gorm:"default:false"`
 	SystemPromptReset bool   `json:"system_prompt_reset" gorm:"default:false"`
+	CachedTokens      int    `json:"cached_tokens" gorm:"default:0"`      // prompt tokens read from cache
+	CacheWriteTokens  int    `json:"cache_write_tokens" gorm:"default:0"` // prompt tokens written to cache
+	// token breakdown, all of them are part of PromptTokens or CompletionTokens
+	// except reasoning tokens of upstreams that report them separately
+	ReasoningTokens       int `json:"reasoning_tokens" gorm:"default:0"`
+	PromptAudioTokens     int `json:"prompt_audio_tokens" gorm:"default:0"`
+	CompletionAudioTokens int `json:"completion_audio_tokens" gorm:"default:0"`
+	ImageTokens           int `json:"image_tokens" gorm:"default:0"`
+	// PromptTemplate is the version of the prompt template the request used, e.g. support-bot@v3
+	PromptTemplate string `json:"prompt_template" gorm:"type:varchar(128);default:''"`
 }
 
 const (
@@ -42,6 +53,32 @@ const (
 	LogTypeTest
 )
 
+// logTokenKindColumns maps the token kinds logs can be filtered by to their columns.
+var logTokenKindColumns = map[string]string{
+	"cached":    "cached_tokens",
+	"reasoning": "reasoning_tokens",
+	"audio":     "prompt_audio_tokens + completion_audio_tokens",
+	"image":     "image_tokens",
+}
+
+// IsValidLogTokenKind reports whether logs can be filtered by tokenKind, empty means no filter.
+func IsValidLogTokenKind(tokenKind string) bool {
+	if tokenKind == "" {
+		return true
+	}
+	_, ok := logTokenKindColumns[tokenKind]
+	return ok
+}
+
+// filterLogsByTokenKind keeps the logs that used tokens of the kind, unknown kinds are ignored.
+func filterLogsByTokenKind(tx *gorm.DB, tokenKind string) *gorm.DB {
+	column, ok := logTokenKindColumns[tokenKind]
+	if !ok {
+		return tx
+	}
+	return tx.Where(fmt.Sprintf("%s > 0", column))
+}
+
 func GetLogOrderClause(sortBy string, sortOrder string) string {
 	// Validate sort order
 	if sortOrder != "asc" && sortOrder != "desc" {
@@ -124,7 +161,7 @@ func RecordTestLog(ctx context.Context, log *Log) {
 	recordLogHelper(ctx, log)
 }
 
-func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, sortBy string, sortOrder string) (logs []*Log, err error) {
+func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, sortBy string, sortOrder string, tokenKind string) (logs []*Log, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB
@@ -149,6 +186,7 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	if channel != 0 {
 		tx = tx.Where("channel_id = ?", channel)
 	}
+	tx = filterLogsByTokenKind(tx, tokenKind)
 
 	// Apply sorting with timeout for sorting queries
 	orderClause := GetLogOrderClause(sortBy, sortOrder)
@@ -162,7 +200,7 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	return logs, err
 }
 
-func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, sortBy string, sortOrder string) (logs []*Log, err error) {
+func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, sortBy string, sortOrder string, tokenKind string) (logs []*Log, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB.Where("user_id = ?", userId)
@@ -181,6 +219,7 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	if endTimestamp != 0 {
 		tx = tx.Where("created_at <= ?", endTimestamp)
 	}
+	tx = filterLogsByTokenKind(tx, tokenKind)
 
 	// Apply sorting with timeout for sorting queries
 	orderClause := GetLogOrderClause(sortBy, sortOrder)
@@ -204,12 +243,21 @@ func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
 	return logs, err
 }
 
-func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int) (quota int64) {
-	ifnull := "ifnull"
-	if common.UsingPostgreSQL {
-		ifnull = "COALESCE"
-	}
-	tx := LOG_DB.Table("logs").Select(fmt.Sprintf("%s(sum(quota),0)", ifnull))
+// LogTokenStat sums the tokens of consume logs by kind.
+type LogTokenStat struct {
+	PromptTokens          int64 `json:"prompt_tokens"`
+	CompletionTokens      int64 `json:"completion_tokens"`
+	CachedTokens          int64 `json:"cached_tokens"`
+	CacheWriteTokens      int64 `json:"cache_write_tokens"`
+	ReasoningTokens       int64 `json:"reasoning_tokens"`
+	PromptAudioTokens     int64 `json:"prompt_audio_tokens"`
+	CompletionAudioTokens int64 `json:"completion_audio_tokens"`
+	ImageTokens           int64 `json:"image_tokens"`
+}
+
+// consumeLogsQuery selects the consume logs matching the stat filters.
+func consumeLogsQuery(startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, tokenKind string) *gorm.DB {
+	tx := LOG_DB.Table("logs").Where("type = ?", LogTypeConsume)
 	if username != "" {
 		tx = tx.Where("username = ?", username)
 	}
@@ -228,10 +276,38 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	if channel != 0 {
 		tx = tx.Where("channel_id = ?", channel)
 	}
-	tx.Where("type = ?", LogTypeConsume).Scan(&quota)
+	return filterLogsByTokenKind(tx, tokenKind)
+}
+
+func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, tokenKind string) (quota int64) {
+	ifnull := "ifnull"
+	if common.UsingPostgreSQL {
+		ifnull = "COALESCE"
+	}
+	consumeLogsQuery(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tokenKind).
+		Select(fmt.Sprintf("%s(sum(quota),0)", ifnull)).Scan(&quota)
 	return quota
 }
 
+// SumLogTokens sums the tokens of the consume logs matching the filters by kind.
+func SumLogTokens(startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, tokenKind string) (stat LogTokenStat, err error) {
+	ifnull := "ifnull"
+	if common.UsingPostgreSQL {
+		ifnull = "COALESCE"
+	}
+	columns := []string{
+		"prompt_tokens", "completion_tokens", "cached_tokens", "cache_write_tokens",
+		"reasoning_tokens", "prompt_audio_tokens", "completion_audio_tokens", "image_tokens",
+	}
+	selects := make([]string, 0, len(columns))
+	for _, column := range columns {
+		selects = append(selects, fmt.Sprintf("%s(sum(%s),0) as %s", ifnull, column, column))
+	}
+	err = consumeLogsQuery(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tokenKind).
+		Select(strings.Join(selects, ", ")).Scan(&stat).Error
+	return stat, err
+}
+
 func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string) (token int) {
 	ifnull := "ifnull"
 	if common.UsingPostgreSQL {
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogTokenKindFilterAndSum(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&Log{}))
+	originalLogDB := LOG_DB
+	LOG_DB = testDB
+	t.Cleanup(func() { LOG_DB = originalLogDB })
+
+	logs := []*Log{
+		{UserId: 1, Username: "alice", Type: LogTypeConsume, CreatedAt: 10, ModelName: "o3", Quota: 100,
+			PromptTokens: 100, CompletionTokens: 50, ReasoningTokens: 30, CachedTokens: 20},
+		{UserId: 1, Username: "alice", Type: LogTypeConsume, CreatedAt: 20, ModelName: "gpt-4o-audio-preview", Quota: 200,
+			PromptTokens: 300, CompletionTokens: 80, PromptAudioTokens: 200, CompletionAudioTokens: 40},
+		{UserId: 2, Username: "bob", Type: LogTypeConsume, CreatedAt: 30, ModelName: "gpt-4o", Quota: 50,
+			PromptTokens: 500, CompletionTokens: 10, ImageTokens: 400},
+		{UserId: 2, Username: "bob", Type: LogTypeTopup, CreatedAt: 40, Quota: 1000},
+	}
+	require.NoError(t, testDB.Create(&logs).Error)
+
+	got, err := GetAllLogs(LogTypeUnknown, 0, 0, "", "", "", 0, 10, 0, "", "", "reasoning")
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "o3", got[0].ModelName)
+
+	got, err = GetUserLogs(1, LogTypeUnknown, 0, 0, "", "", 0, 10, "", "", "audio")
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, 40, got[0].CompletionAudioTokens)
+
+	assert.Equal(t, int64(350), SumUsedQuota(LogTypeUnknown, 0, 0, "", "", "", 0, ""))
+	assert.Equal(t, int64(50), SumUsedQuota(LogTypeUnknown, 0, 0, "", "", "", 0, "image"))
+
+	stat, err := SumLogTokens(0, 0, "", "alice", "", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, LogTokenStat{
+		PromptTokens:          400,
+		CompletionTokens:      130,
+		CachedTokens:          20,
+		ReasoningTokens:       30,
+		PromptAudioTokens:     200,
+		CompletionAudioTokens: 40,
+	}, stat)
+
+	assert.True(t, IsValidLogTokenKind(""))
+	assert.False(t, IsValidLogTokenKind("video"))
+}
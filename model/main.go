@@ -154,6 +154,18 @@ func InitDB() {
 		logger.Logger.Error("failed to migrate channel ModelConfigs: " + err.Error())
 		// Don't fail startup for this migration, just log the error
 	}
+
+	// Seed groups from the legacy GroupRatio option
+	if err = migrateGroups(); err != nil {
+		logger.Logger.Fatal("failed to migrate groups: " + err.Error())
+		return
+	}
+
+	// Encrypt plaintext channel secrets and re-wrap the ones using a retired master key
+	if _, err = MigrateChannelSecrets(); err != nil {
+		logger.Logger.Fatal("failed to migrate channel secrets: " + err.Error())
+		return
+	}
 }
 
 func migrateDB() error {
@@ -182,12 +194,61 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&UserRequestCost{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&Group{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&GroupModelRatio{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ModelCatalogOverride{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&VirtualModel{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ContentPolicy{}, &ContentPolicyEvent{}); err != nil {
+		return err
+	}
+	// transcripts are kept with the logs, see migrateLOGDB
+	if err = DB.AutoMigrate(&TranscriptRule{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&PromptTemplate{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&IdentityProvider{}, &UserIdentity{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&WebAuthnCredential{}, &RecoveryCode{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Ban{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ChannelRecovery{}); err != nil {
+		return err
+	}
+	seedChannelErrorRules := !DB.Migrator().HasTable(&ChannelErrorRule{})
+	if err = DB.AutoMigrate(&ChannelErrorRule{}); err != nil {
+		return err
+	}
+	if seedChannelErrorRules {
+		if err = createDefaultChannelErrorRules(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func InitLogDB() {
 	if os.Getenv("LOG_SQL_DSN") == "" {
 		LOG_DB = DB
+		if config.IsMasterNode {
+			// the log tables live in the main database
+			if err := migrateLOGDB(); err != nil {
+				logger.Logger.Fatal("failed to migrate log tables: " + err.Error())
+			}
+		}
 		return
 	}
 
@@ -219,6 +280,9 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&Transcript{}); err != nil {
+		return err
+	}
 	return nil
 }
 
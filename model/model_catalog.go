@@ -0,0 +1,101 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// ModelCatalogOverride overrides the metadata the model catalog derives from the adaptors.
+// ChannelType 0 applies to the model on every channel type, zero values keep the derived value.
+type ModelCatalogOverride struct {
+	Id          int    `json:"id"`
+	Model       string `json:"model" gorm:"type:varchar(255);uniqueIndex:idx_catalog_model_type"`
+	ChannelType int    `json:"channel_type" gorm:"uniqueIndex:idx_catalog_model_type"`
+	// ContextLength is the maximum number of prompt and completion tokens
+	ContextLength   int `json:"context_length"`
+	MaxOutputTokens int `json:"max_output_tokens"`
+	// InputModalities and OutputModalities are comma separated, e.g. "text,image"
+	InputModalities  string `json:"input_modalities"`
+	OutputModalities string `json:"output_modalities"`
+	SupportsTools    *bool  `json:"supports_tools"`
+	SupportsVision   *bool  `json:"supports_vision"`
+	Description      string `json:"description" gorm:"type:text"`
+	// Hidden removes the model from /v1/models, the model can still be called
+	Hidden      bool  `json:"hidden"`
+	UpdatedTime int64 `json:"updated_time" gorm:"bigint"`
+}
+
+// Validate normalizes the override and checks its values.
+func (o *ModelCatalogOverride) Validate() error {
+	o.Model = strings.TrimSpace(o.Model)
+	if o.Model == "" {
+		return errors.New("model is required")
+	}
+	if o.ChannelType < 0 {
+		return errors.New("channel type must not be negative")
+	}
+	if o.ContextLength < 0 || o.MaxOutputTokens < 0 {
+		return errors.New("token limits must not be negative")
+	}
+	if o.ContextLength > 0 && o.MaxOutputTokens > o.ContextLength {
+		return errors.New("max output tokens must not exceed the context length")
+	}
+	o.InputModalities = normalizeModalities(o.InputModalities)
+	o.OutputModalities = normalizeModalities(o.OutputModalities)
+	return nil
+}
+
+func normalizeModalities(modalities string) string {
+	var normalized []string
+	for _, modality := range strings.Split(modalities, ",") {
+		if modality = strings.ToLower(strings.TrimSpace(modality)); modality != "" {
+			normalized = append(normalized, modality)
+		}
+	}
+	return strings.Join(normalized, ",")
+}
+
+// GetModelCatalogOverrides returns all overrides ordered by model and channel type.
+func GetModelCatalogOverrides() ([]*ModelCatalogOverride, error) {
+	var overrides []*ModelCatalogOverride
+	if err := DB.Order("model, channel_type").Find(&overrides).Error; err != nil {
+		return nil, errors.Wrap(err, "get model catalog overrides")
+	}
+	return overrides, nil
+}
+
+// SaveModelCatalogOverride creates the override, or replaces the existing override
+// of the same model and channel type.
+func SaveModelCatalogOverride(override *ModelCatalogOverride) error {
+	if err := override.Validate(); err != nil {
+		return errors.Wrap(err, "validate model catalog override")
+	}
+
+	var existing ModelCatalogOverride
+	err := DB.Where("model = ? AND channel_type = ?", override.Model, override.ChannelType).
+		Limit(1).Find(&existing).Error
+	if err != nil {
+		return errors.Wrap(err, "find model catalog override")
+	}
+	override.Id = existing.Id
+	override.UpdatedTime = helper.GetTimestamp()
+	if err = DB.Save(override).Error; err != nil {
+		return errors.Wrapf(err, "save model catalog override of %s", override.Model)
+	}
+	return nil
+}
+
+// DeleteModelCatalogOverride deletes the override with the id.
+func DeleteModelCatalogOverride(id int) error {
+	result := DB.Delete(&ModelCatalogOverride{}, id)
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "delete model catalog override %d", id)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Errorf("model catalog override %d not found", id)
+	}
+	return nil
+}
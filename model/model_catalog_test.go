@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveModelCatalogOverride(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&ModelCatalogOverride{}))
+	originalDB := DB
+	DB = testDB
+	t.Cleanup(func() { DB = originalDB })
+
+	require.NoError(t, SaveModelCatalogOverride(&ModelCatalogOverride{
+		Model: " gpt-4o ", ContextLength: 128000, InputModalities: "Text, image,",
+	}))
+	// the same model and channel type is replaced
+	require.NoError(t, SaveModelCatalogOverride(&ModelCatalogOverride{
+		Model: "gpt-4o", ContextLength: 128000, MaxOutputTokens: 16384, InputModalities: "text,image",
+	}))
+	require.NoError(t, SaveModelCatalogOverride(&ModelCatalogOverride{Model: "gpt-4o", ChannelType: 3, Hidden: true}))
+
+	overrides, err := GetModelCatalogOverrides()
+	require.NoError(t, err)
+	require.Len(t, overrides, 2)
+	assert.Equal(t, "gpt-4o", overrides[0].Model)
+	assert.Equal(t, 16384, overrides[0].MaxOutputTokens)
+	assert.Equal(t, "text,image", overrides[0].InputModalities)
+	assert.True(t, overrides[1].Hidden)
+
+	assert.Error(t, SaveModelCatalogOverride(&ModelCatalogOverride{Model: ""}))
+	assert.Error(t, SaveModelCatalogOverride(&ModelCatalogOverride{Model: "m", ContextLength: 10, MaxOutputTokens: 20}))
+
+	require.NoError(t, DeleteModelCatalogOverride(overrides[1].Id))
+	assert.Error(t, DeleteModelCatalogOverride(overrides[1].Id))
+}
@@ -5,9 +5,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Laisky/errors/v2"
+
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 )
 
 type Option struct {
@@ -61,6 +62,7 @@ func InitOptionMap() {
 	config.OptionMap["WeChatAccountQRCodeImageURL"] = ""
 	config.OptionMap["MessagePusherAddress"] = ""
 	config.OptionMap["MessagePusherToken"] = ""
+	config.OptionMap["SCIMToken"] = ""
 	config.OptionMap["TurnstileSiteKey"] = ""
 	config.OptionMap["TurnstileSecretKey"] = ""
 	config.OptionMap["QuotaForNewUser"] = strconv.FormatInt(config.QuotaForNewUser, 10)
@@ -68,7 +70,6 @@ func InitOptionMap() {
 	config.OptionMap["QuotaForInvitee"] = strconv.FormatInt(config.QuotaForInvitee, 10)
 	config.OptionMap["QuotaRemindThreshold"] = strconv.FormatInt(config.QuotaRemindThreshold, 10)
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
-	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
@@ -101,6 +102,10 @@ func SyncOptions(frequency int) {
 }
 
 func UpdateOption(key string, value string) error {
+	if key == "GroupRatio" {
+		// the option is only read once, to seed the groups of old installations
+		return errors.New("GroupRatio is no longer an option, set the ratio of each group with PUT /api/group/")
+	}
 	// Save to database first
 	option := Option{
 		Key: key,
@@ -113,7 +118,11 @@ func UpdateOption(key string, value string) error {
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
 	// Update OptionMap
-	return updateOptionMap(key, value)
+	if err := updateOptionMap(key, value); err != nil {
+		return err
+	}
+	publishCacheInvalidation(&CacheInvalidation{Cache: CacheOptions, Key: key})
+	return nil
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -207,6 +216,8 @@ func updateOptionMap(key string, value string) (err error) {
 		config.MessagePusherAddress = value
 	case "MessagePusherToken":
 		config.MessagePusherToken = value
+	case "SCIMToken":
+		config.SCIMToken = value
 	case "TurnstileSiteKey":
 		config.TurnstileSiteKey = value
 	case "TurnstileSecretKey":
@@ -227,7 +238,9 @@ func updateOptionMap(key string, value string) (err error) {
 		// Skip deprecated global pricing options - they are now handled by individual adapters
 		return nil
 	case "GroupRatio":
-		err = billingratio.UpdateGroupRatioByJSONString(value)
+		// Skip deprecated group ratio option - groups are now managed through the group API,
+		// UpdateOption refuses to store it
+		return nil
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
@@ -0,0 +1,246 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PromptTemplate is a version of a named system prompt that requests select with
+// "prompt_template": "name@v3", or "name" for the latest enabled version. The content
+// of a version never changes, a changed prompt is a new version.
+type PromptTemplate struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex:idx_prompt_template_version"`
+	Version     int    `json:"version" gorm:"uniqueIndex:idx_prompt_template_version"`
+	Description string `json:"description" gorm:"type:text"`
+	// Content is the system prompt, {{variable}} placeholders are replaced by the
+	// variables of the request
+	Content string `json:"content" gorm:"type:text"`
+	// Variables is the JSON object of the default values of the variables,
+	// variables without a default must be sent by the request
+	Variables string `json:"variables" gorm:"type:text"`
+	// Groups are the comma separated groups that can use the template, empty allows all groups
+	Groups      string `json:"groups" gorm:"column:group_names;type:varchar(255);default:''"`
+	Enabled     bool   `json:"enabled"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+var promptTemplateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Ref returns the reference of the template version, e.g. support-bot@v3.
+func (t *PromptTemplate) Ref() string {
+	return fmt.Sprintf("%s@v%d", t.Name, t.Version)
+}
+
+// AllowsGroup reports whether requests of the group can use the template.
+func (t *PromptTemplate) AllowsGroup(group string) bool {
+	groups := splitModels(t.Groups)
+	if len(groups) == 0 {
+		return true
+	}
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Render returns the content with the placeholders replaced by the variables, or by
+// their defaults. Values that are not strings are JSON encoded.
+func (t *PromptTemplate) Render(variables map[string]any) (string, error) {
+	defaults, err := t.defaults()
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	rendered := promptTemplateVariable.ReplaceAllStringFunc(t.Content, func(placeholder string) string {
+		name := promptTemplateVariable.FindStringSubmatch(placeholder)[1]
+		value, ok := variables[name]
+		if !ok || value == nil {
+			if value, ok := defaults[name]; ok {
+				return value
+			}
+			missing = append(missing, name)
+			return placeholder
+		}
+		if s, ok := value.(string); ok {
+			return s
+		}
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	})
+	if len(missing) > 0 {
+		return "", errors.Errorf("prompt template %s is missing variables: %s", t.Ref(), strings.Join(missing, ", "))
+	}
+	return rendered, nil
+}
+
+func (t *PromptTemplate) defaults() (map[string]string, error) {
+	defaults := make(map[string]string)
+	if strings.TrimSpace(t.Variables) == "" {
+		return defaults, nil
+	}
+	if err := json.Unmarshal([]byte(t.Variables), &defaults); err != nil {
+		return nil, errors.Wrapf(err, "variables of prompt template %s must be a JSON object of strings", t.Ref())
+	}
+	return defaults, nil
+}
+
+// validate normalizes the template and checks its settings.
+func (t *PromptTemplate) validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" || strings.ContainsAny(t.Name, "@, ") {
+		return errors.Errorf("invalid prompt template name %q", t.Name)
+	}
+	if strings.TrimSpace(t.Content) == "" {
+		return errors.New("content is required")
+	}
+	if _, err := t.defaults(); err != nil {
+		return err
+	}
+	groups := splitModels(t.Groups)
+	for _, group := range groups {
+		if !ValidGroupName(group) {
+			return errors.Errorf("invalid group %q", group)
+		}
+	}
+	t.Groups = strings.Join(groups, ",")
+	return nil
+}
+
+// ParsePromptTemplateRef splits a reference like support-bot@v3 into the name and the
+// version, the version is 0 if the reference has none.
+func ParsePromptTemplateRef(ref string) (name string, version int, err error) {
+	name, v, found := strings.Cut(strings.TrimSpace(ref), "@")
+	if name == "" {
+		return "", 0, errors.Errorf("invalid prompt template %q", ref)
+	}
+	if !found {
+		return name, 0, nil
+	}
+	version, err = strconv.Atoi(strings.TrimPrefix(v, "v"))
+	if err != nil || version <= 0 {
+		return "", 0, errors.Errorf("invalid prompt template version %q", ref)
+	}
+	return name, version, nil
+}
+
+func GetAllPromptTemplates() ([]*PromptTemplate, error) {
+	var templates []*PromptTemplate
+	err := DB.Order("name asc, version desc").Find(&templates).Error
+	return templates, errors.Wrap(err, "get all prompt templates")
+}
+
+func GetPromptTemplateById(id int) (*PromptTemplate, error) {
+	template := &PromptTemplate{}
+	err := DB.First(template, "id = ?", id).Error
+	return template, errors.Wrapf(err, "get prompt template %d", id)
+}
+
+// Insert stores the template as the next version of its name.
+func (t *PromptTemplate) Insert() error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	var latest int
+	if err := DB.Model(&PromptTemplate{}).Where("name = ?", t.Name).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return errors.Wrapf(err, "get latest version of prompt template %s", t.Name)
+	}
+	t.Version = latest + 1
+	t.CreatedTime = helper.GetTimestamp()
+	t.UpdatedTime = t.CreatedTime
+	if err := DB.Create(t).Error; err != nil {
+		return errors.Wrapf(err, "create prompt template %s", t.Ref())
+	}
+	invalidateCache(CachePromptTemplates)
+	return nil
+}
+
+// Update saves the description, groups and status of the version, its content and
+// variables cannot be changed.
+func (t *PromptTemplate) Update() error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	t.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(t).Select("description", "group_names", "enabled", "updated_time").Updates(t).Error
+	if err != nil {
+		return errors.Wrapf(err, "update prompt template %s", t.Ref())
+	}
+	invalidateCache(CachePromptTemplates)
+	return nil
+}
+
+func (t *PromptTemplate) Delete() error {
+	if err := DB.Delete(t).Error; err != nil {
+		return errors.Wrapf(err, "delete prompt template %s", t.Ref())
+	}
+	invalidateCache(CachePromptTemplates)
+	return nil
+}
+
+var (
+	// promptTemplates maps the names to the enabled versions, latest first
+	promptTemplates    map[string][]*PromptTemplate
+	promptTemplatesMux sync.RWMutex
+)
+
+// InitPromptTemplateCache loads the enabled prompt templates.
+func InitPromptTemplateCache() {
+	var templates []*PromptTemplate
+	if err := DB.Where("enabled = ?", true).Order("name asc, version desc").Find(&templates).Error; err != nil {
+		logger.Logger.Error("failed to load prompt templates", zap.Error(err))
+		return
+	}
+	byName := make(map[string][]*PromptTemplate)
+	for _, template := range templates {
+		byName[template.Name] = append(byName[template.Name], template)
+	}
+	promptTemplatesMux.Lock()
+	promptTemplates = byName
+	promptTemplatesMux.Unlock()
+}
+
+func SyncPromptTemplateCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing prompt templates from database")
+		InitPromptTemplateCache()
+	}
+}
+
+// GetPromptTemplate returns the enabled template the reference points to if the group
+// can use it, a reference without version selects the latest enabled version.
+func GetPromptTemplate(ref string, group string) (*PromptTemplate, error) {
+	name, version, err := ParsePromptTemplateRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	promptTemplatesMux.RLock()
+	versions := promptTemplates[name]
+	promptTemplatesMux.RUnlock()
+	for _, template := range versions {
+		if version != 0 && template.Version != version {
+			continue
+		}
+		if !template.AllowsGroup(group) {
+			return nil, errors.Errorf("prompt template %s is not available to group %s", template.Ref(), group)
+		}
+		return template, nil
+	}
+	return nil, errors.Errorf("prompt template %s not found", ref)
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptTemplateRender(t *testing.T) {
+	template := &PromptTemplate{Name: "support-bot", Version: 3,
+		Content:   "You support {{ product }} for {{customer}}. Limits: {{limits}}.",
+		Variables: `{"product": "One API"}`}
+	rendered, err := template.Render(map[string]any{"customer": "ACME", "limits": map[string]any{"rpm": 10}})
+	require.NoError(t, err)
+	assert.Equal(t, `You support One API for ACME. Limits: {"rpm":10}.`, rendered)
+
+	_, err = template.Render(map[string]any{"product": "X"})
+	assert.EqualError(t, err, "prompt template support-bot@v3 is missing variables: customer, limits")
+}
+
+func TestParsePromptTemplateRef(t *testing.T) {
+	for ref, expected := range map[string]struct {
+		name    string
+		version int
+	}{
+		"support-bot":    {"support-bot", 0},
+		"support-bot@v3": {"support-bot", 3},
+		"support-bot@12": {"support-bot", 12},
+	} {
+		name, version, err := ParsePromptTemplateRef(ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, expected.name, name)
+		assert.Equal(t, expected.version, version)
+	}
+	for _, ref := range []string{"", "@v1", "support-bot@", "support-bot@v0", "support-bot@latest"} {
+		_, _, err := ParsePromptTemplateRef(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestPromptTemplateVersions(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&PromptTemplate{}))
+	originalDB := DB
+	DB = testDB
+	defer func() {
+		promptTemplatesMux.Lock()
+		promptTemplates = nil
+		promptTemplatesMux.Unlock()
+		DB = originalDB
+	}()
+
+	assert.Error(t, (&PromptTemplate{Name: "a@b", Content: "x"}).Insert())
+	assert.Error(t, (&PromptTemplate{Name: "bot", Content: "x", Variables: `{"n": 1}`}).Insert())
+
+	for _, content := range []string{"v1", "v2", "v3"} {
+		require.NoError(t, (&PromptTemplate{Name: "bot", Content: content, Enabled: true, Groups: "vip, default"}).Insert())
+	}
+	require.NoError(t, (&PromptTemplate{Name: "bot", Content: "draft"}).Insert())
+
+	latest, err := GetPromptTemplate("bot", "vip")
+	require.NoError(t, err)
+	// disabled versions are never selected
+	assert.Equal(t, "bot@v3", latest.Ref())
+	assert.Equal(t, "vip,default", latest.Groups)
+
+	pinned, err := GetPromptTemplate("bot@v1", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", pinned.Content)
+
+	_, err = GetPromptTemplate("bot@v4", "vip")
+	assert.ErrorContains(t, err, "not found")
+	_, err = GetPromptTemplate("bot", "free")
+	assert.ErrorContains(t, err, "not available to group free")
+
+	pinned.Enabled = false
+	require.NoError(t, pinned.Update())
+	_, err = GetPromptTemplate("bot@v1", "default")
+	assert.Error(t, err)
+}
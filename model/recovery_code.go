@@ -0,0 +1,91 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// RecoveryCodeCount is the number of recovery codes generated at once.
+const RecoveryCodeCount = 10
+
+// RecoveryCode is a one-time code that replaces the second factor of a user who lost
+// their authenticator. Only the hash of the code is stored.
+type RecoveryCode struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	CodeHash    string `json:"-" gorm:"type:char(64)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	// UsedTime is 0 while the code can be used
+	UsedTime int64 `json:"used_time" gorm:"bigint;default:0"`
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// hashRecoveryCode hashes the code as typed, ignoring case, spaces and dashes. Codes
+// carry 50 random bits, so a plain hash is enough.
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of the user with new ones and
+// returns them, they cannot be shown again.
+func GenerateRecoveryCodes(userId int) ([]string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	rows := make([]RecoveryCode, 0, RecoveryCodeCount)
+	now := helper.GetTimestamp()
+	for range RecoveryCodeCount {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, errors.Wrap(err, "generate recovery code")
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw)[:10])
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		rows = append(rows, RecoveryCode{UserId: userId, CodeHash: hashRecoveryCode(code), CreatedTime: now})
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "save recovery codes of user %d", userId)
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode marks the code as used and reports whether it was an unused code of
+// the user.
+func UseRecoveryCode(userId int, code string) bool {
+	if code == "" {
+		return false
+	}
+	result := DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_time = 0", userId, hashRecoveryCode(code)).
+		Update("used_time", helper.GetTimestamp())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of the user.
+func CountRecoveryCodes(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_time = 0", userId).Count(&count).Error
+	return count, errors.Wrapf(err, "count recovery codes of user %d", userId)
+}
+
+// DeleteRecoveryCodes deletes the recovery codes of the user.
+func DeleteRecoveryCodes(userId int) error {
+	err := DB.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error
+	return errors.Wrapf(err, "delete recovery codes of user %d", userId)
+}
@@ -143,6 +143,13 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// GetTokenByName returns the user's token of the name, the oldest if several have it.
+func GetTokenByName(userId int, name string) (*Token, error) {
+	token := &Token{}
+	err := DB.Where("user_id = ? AND name = ?", userId, name).Order("id asc").First(token).Error
+	return token, err
+}
+
 func (t *Token) Insert() error {
 	var err error
 	err = DB.Create(t).Error
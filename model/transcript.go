@@ -0,0 +1,218 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// TranscriptRule opts the requests of a user or token in to transcript capture, the
+// request and response bodies of the sampled requests are stored as Transcript.
+type TranscriptRule struct {
+	Id int `json:"id"`
+	// UserId and TokenId select the captured requests, 0 matches any user or token
+	// but at least one of them must be set
+	UserId  int `json:"user_id" gorm:"default:0;index"`
+	TokenId int `json:"token_id" gorm:"default:0;index"`
+	// SampleRate is the share of the requests that are captured, in (0, 1]
+	SampleRate float64 `json:"sample_rate"`
+	// RedactPII lists the comma separated detectors of PIIDetectors applied before writing
+	RedactPII string `json:"redact_pii" gorm:"type:varchar(64);default:''"`
+	// RedactPatterns are newline separated regular expressions whose matches are redacted
+	RedactPatterns string `json:"redact_patterns" gorm:"type:text"`
+	Enabled        bool   `json:"enabled"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime    int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// validate normalizes the rule and checks its settings.
+func (r *TranscriptRule) validate() error {
+	if r.UserId < 0 || r.TokenId < 0 {
+		return errors.New("user id and token id must not be negative")
+	}
+	if r.UserId == 0 && r.TokenId == 0 {
+		return errors.New("a user id or token id is required")
+	}
+	if r.SampleRate <= 0 || r.SampleRate > 1 {
+		return errors.Errorf("sample rate must be greater than 0 and at most 1, got %v", r.SampleRate)
+	}
+	detectors, err := normalizePIIDetectors(r.RedactPII)
+	if err != nil {
+		return err
+	}
+	r.RedactPII = detectors
+	for _, pattern := range SplitTranscriptRedactPatterns(r.RedactPatterns) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.Errorf("invalid redaction pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// SplitTranscriptRedactPatterns splits the newline separated redaction patterns of a rule.
+func SplitTranscriptRedactPatterns(patterns string) []string {
+	var result []string
+	for _, pattern := range strings.Split(patterns, "\n") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+func GetAllTranscriptRules() ([]*TranscriptRule, error) {
+	var rules []*TranscriptRule
+	err := DB.Order("id asc").Find(&rules).Error
+	return rules, errors.Wrap(err, "get all transcript rules")
+}
+
+func GetTranscriptRuleById(id int) (*TranscriptRule, error) {
+	rule := &TranscriptRule{}
+	err := DB.First(rule, "id = ?", id).Error
+	return rule, errors.Wrapf(err, "get transcript rule %d", id)
+}
+
+func (r *TranscriptRule) Insert() error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r.CreatedTime = helper.GetTimestamp()
+	r.UpdatedTime = r.CreatedTime
+	if err := DB.Create(r).Error; err != nil {
+		return errors.Wrap(err, "create transcript rule")
+	}
+	invalidateCache(CacheTranscriptRules)
+	return nil
+}
+
+// Update saves all fields of the rule.
+func (r *TranscriptRule) Update() error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(r).
+		Select("user_id", "token_id", "sample_rate", "redact_pii", "redact_patterns", "enabled", "updated_time").
+		Updates(r).Error
+	if err != nil {
+		return errors.Wrapf(err, "update transcript rule %d", r.Id)
+	}
+	invalidateCache(CacheTranscriptRules)
+	return nil
+}
+
+func (r *TranscriptRule) Delete() error {
+	if err := DB.Delete(r).Error; err != nil {
+		return errors.Wrapf(err, "delete transcript rule %d", r.Id)
+	}
+	invalidateCache(CacheTranscriptRules)
+	return nil
+}
+
+var (
+	transcriptRules    []*TranscriptRule
+	transcriptRulesMux sync.RWMutex
+)
+
+// InitTranscriptRuleCache loads the enabled transcript rules.
+func InitTranscriptRuleCache() {
+	var rules []*TranscriptRule
+	if err := DB.Where("enabled = ?", true).Order("id asc").Find(&rules).Error; err != nil {
+		logger.Logger.Error("failed to load transcript rules", zap.Error(err))
+		return
+	}
+	transcriptRulesMux.Lock()
+	transcriptRules = rules
+	transcriptRulesMux.Unlock()
+}
+
+func SyncTranscriptRuleCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing transcript rules from database")
+		InitTranscriptRuleCache()
+	}
+}
+
+// GetTranscriptRule returns the enabled rule capturing the requests of the user and token,
+// rules of the token take precedence over rules of the user. It returns nil if there is none.
+func GetTranscriptRule(userId int, tokenId int) *TranscriptRule {
+	transcriptRulesMux.RLock()
+	defer transcriptRulesMux.RUnlock()
+	var userRule *TranscriptRule
+	for _, rule := range transcriptRules {
+		if (rule.UserId != 0 && rule.UserId != userId) || (rule.TokenId != 0 && rule.TokenId != tokenId) {
+			continue
+		}
+		if rule.TokenId != 0 {
+			return rule
+		}
+		if userRule == nil {
+			userRule = rule
+		}
+	}
+	return userRule
+}
+
+// Transcript is the captured request and response of a relayed request, it is stored
+// in the log database.
+type Transcript struct {
+	Id          int    `json:"id"`
+	RequestId   string `json:"request_id" gorm:"type:varchar(64);index"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id"`
+	ChannelId   int    `json:"channel"`
+	ModelName   string `json:"model_name" gorm:"type:varchar(255);default:''"`
+	Method      string `json:"method" gorm:"type:varchar(16)"`
+	Path        string `json:"path" gorm:"type:varchar(255)"`
+	StatusCode  int    `json:"status_code"`
+	IsStream    bool   `json:"is_stream"`
+	ElapsedTime int64  `json:"elapsed_time"` // ms
+	// RequestBody and ResponseBody are redacted and cut to TranscriptMaxBodyBytes,
+	// the Truncated flags tell whether they were cut
+	RequestBody       string `json:"request_body"`
+	RequestTruncated  bool   `json:"request_truncated"`
+	ResponseBody      string `json:"response_body"`
+	ResponseTruncated bool   `json:"response_truncated"`
+}
+
+func (t *Transcript) Insert() error {
+	if t.CreatedAt == 0 {
+		t.CreatedAt = helper.GetTimestamp()
+	}
+	return errors.Wrapf(LOG_DB.Create(t).Error, "create transcript of request %s", t.RequestId)
+}
+
+// GetTranscriptByRequestId returns the transcript of the request.
+func GetTranscriptByRequestId(requestId string) (*Transcript, error) {
+	transcript := &Transcript{}
+	err := LOG_DB.Where("request_id = ?", requestId).Order("id desc").First(transcript).Error
+	return transcript, errors.Wrapf(err, "get transcript of request %s", requestId)
+}
+
+// DeleteTranscriptsBefore deletes the transcripts created before the timestamp.
+func DeleteTranscriptsBefore(timestamp int64) (int64, error) {
+	result := LOG_DB.Where("created_at < ?", timestamp).Delete(&Transcript{})
+	return result.RowsAffected, errors.Wrap(result.Error, "delete old transcripts")
+}
+
+// PruneTranscripts deletes the transcripts older than retentionDays every hour.
+func PruneTranscripts(retentionDays int) {
+	for {
+		count, err := DeleteTranscriptsBefore(time.Now().AddDate(0, 0, -retentionDays).Unix())
+		if err != nil {
+			logger.Logger.Error("failed to prune transcripts", zap.Error(err))
+		} else if count > 0 {
+			logger.Logger.Info("pruned transcripts", zap.Int64("count", count), zap.Int("retention_days", retentionDays))
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscriptRuleValidate(t *testing.T) {
+	rule := &TranscriptRule{UserId: 1, SampleRate: 0.5, RedactPII: " card , email"}
+	require.NoError(t, rule.validate())
+	assert.Equal(t, "card,email", rule.RedactPII)
+
+	for name, rule := range map[string]*TranscriptRule{
+		"scope":    {SampleRate: 1},
+		"rate":     {UserId: 1, SampleRate: 1.5},
+		"zero":     {UserId: 1},
+		"detector": {UserId: 1, SampleRate: 1, RedactPII: "ssn"},
+		"pattern":  {UserId: 1, SampleRate: 1, RedactPatterns: "ok\n(broken"},
+	} {
+		assert.Error(t, rule.validate(), name)
+	}
+}
+
+func TestTranscriptRulesAndRetention(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&TranscriptRule{}, &Transcript{}))
+	originalDB, originalLogDB := DB, LOG_DB
+	DB, LOG_DB = testDB, testDB
+	defer func() {
+		transcriptRulesMux.Lock()
+		transcriptRules = nil
+		transcriptRulesMux.Unlock()
+		DB, LOG_DB = originalDB, originalLogDB
+	}()
+
+	userRule := &TranscriptRule{UserId: 1, SampleRate: 1, Enabled: true}
+	tokenRule := &TranscriptRule{UserId: 1, TokenId: 2, SampleRate: 0.1, Enabled: true}
+	require.NoError(t, userRule.Insert())
+	require.NoError(t, tokenRule.Insert())
+	require.NoError(t, (&TranscriptRule{TokenId: 3, SampleRate: 1}).Insert())
+
+	assert.Equal(t, tokenRule.Id, GetTranscriptRule(1, 2).Id)
+	assert.Equal(t, userRule.Id, GetTranscriptRule(1, 4).Id)
+	assert.Nil(t, GetTranscriptRule(2, 2))
+	// disabled rules capture nothing
+	assert.Nil(t, GetTranscriptRule(5, 3))
+
+	require.NoError(t, (&Transcript{RequestId: "old", CreatedAt: 100}).Insert())
+	require.NoError(t, (&Transcript{RequestId: "new", CreatedAt: 200}).Insert())
+	count, err := DeleteTranscriptsBefore(150)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+	_, err = GetTranscriptByRequestId("old")
+	assert.Error(t, err)
+	transcript, err := GetTranscriptByRequestId("new")
+	require.NoError(t, err)
+	assert.EqualValues(t, 200, transcript.CreatedAt)
+}
@@ -78,6 +78,13 @@ func GetAllUsers(startIdx int, num int, order string) (users []*User, err error)
 	return users, err
 }
 
+// GetAllUsersForProvisioning returns the users that are not deleted, without their
+// password and access token, ordered by id.
+func GetAllUsersForProvisioning() (users []*User, err error) {
+	err = DB.Omit("password", "access_token").Where("status != ?", UserStatusDeleted).Order("id asc").Find(&users).Error
+	return users, err
+}
+
 func SearchUsers(keyword string) (users []*User, err error) {
 	if !common.UsingPostgreSQL {
 		err = DB.Omit("password").Where("id = ? or username LIKE ? or email LIKE ? or display_name LIKE ?", keyword, keyword+"%", keyword+"%", keyword+"%").Find(&users).Error
@@ -179,6 +186,9 @@ func (user *User) Update(updatePassword bool) error {
 		blacklist.UnbanUser(user.Id)
 	}
 	err = DB.Model(user).Updates(user).Error
+	if err == nil {
+		invalidateUserCache(user.Id, user.Status)
+	}
 	return err
 }
 
@@ -197,9 +207,65 @@ func (user *User) Delete() error {
 	user.Username = fmt.Sprintf("deleted_%s", random.GetUUID())
 	user.Status = UserStatusDeleted
 	err := DB.Model(user).Updates(user).Error
+	if err == nil {
+		invalidateUserCache(user.Id, user.Status)
+	}
 	return err
 }
 
+// UpdateProvisioned saves the attributes a provisioning client manages, unlike Update
+// it also saves empty values.
+func (user *User) UpdateProvisioned(updatePassword bool) error {
+	columns := []string{"username", "display_name", "email", "status"}
+	if updatePassword {
+		var err error
+		if user.Password, err = common.Password2Hash(user.Password); err != nil {
+			return err
+		}
+		columns = append(columns, "password")
+	}
+	if user.Status == UserStatusEnabled {
+		blacklist.UnbanUser(user.Id)
+	} else {
+		blacklist.BanUser(user.Id)
+	}
+	if err := DB.Model(user).Select(columns).Updates(user).Error; err != nil {
+		return errors.Wrapf(err, "update user %d", user.Id)
+	}
+	invalidateUserCache(user.Id, user.Status)
+	return nil
+}
+
+// DisableWithTokens disables the user together with all their enabled tokens, both
+// take effect at once, e.g. when the user is deprovisioned.
+func (user *User) DisableWithTokens() error {
+	if user.Id == 0 {
+		return errors.New("id is empty!")
+	}
+	blacklist.BanUser(user.Id)
+	var tokens []*Token
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", user.Id).Update("status", UserStatusDisabled).Error; err != nil {
+			return errors.Wrap(err, "disable user")
+		}
+		if err := tx.Where("user_id = ? AND status = ?", user.Id, TokenStatusEnabled).Find(&tokens).Error; err != nil {
+			return errors.Wrap(err, "get user tokens")
+		}
+		err := tx.Model(&Token{}).Where("user_id = ? AND status = ?", user.Id, TokenStatusEnabled).
+			Update("status", TokenStatusDisabled).Error
+		return errors.Wrap(err, "disable user tokens")
+	})
+	if err != nil {
+		return errors.Wrapf(err, "disable user %d", user.Id)
+	}
+	user.Status = UserStatusDisabled
+	for _, token := range tokens {
+		clearTokenCache(token.Key)
+	}
+	invalidateUserCache(user.Id, user.Status)
+	return nil
+}
+
 // ValidateAndFill check password & user status
 func (user *User) ValidateAndFill() (err error) {
 	// When querying with struct, GORM will only query with non-zero fields,
@@ -241,38 +307,6 @@ func (user *User) FillUserByEmail() error {
 	return nil
 }
 
-func (user *User) FillUserByGitHubId() error {
-	if user.GitHubId == "" {
-		return errors.New("GitHub id is empty!")
-	}
-	DB.Where(User{GitHubId: user.GitHubId}).First(user)
-	return nil
-}
-
-func (user *User) FillUserByLarkId() error {
-	if user.LarkId == "" {
-		return errors.New("lark id is empty!")
-	}
-	DB.Where(User{LarkId: user.LarkId}).First(user)
-	return nil
-}
-
-func (user *User) FillUserByOidcId() error {
-	if user.OidcId == "" {
-		return errors.New("oidc id is empty!")
-	}
-	DB.Where(User{OidcId: user.OidcId}).First(user)
-	return nil
-}
-
-func (user *User) FillUserByWeChatId() error {
-	if user.WeChatId == "" {
-		return errors.New("WeChat id is empty!")
-	}
-	DB.Where(User{WeChatId: user.WeChatId}).First(user)
-	return nil
-}
-
 func (user *User) FillUserByUsername() error {
 	if user.Username == "" {
 		return errors.New("username is empty!")
@@ -285,22 +319,6 @@ func IsEmailAlreadyTaken(email string) bool {
 	return DB.Where("email = ?", email).Find(&User{}).RowsAffected == 1
 }
 
-func IsWeChatIdAlreadyTaken(wechatId string) bool {
-	return DB.Where("wechat_id = ?", wechatId).Find(&User{}).RowsAffected == 1
-}
-
-func IsGitHubIdAlreadyTaken(githubId string) bool {
-	return DB.Where("github_id = ?", githubId).Find(&User{}).RowsAffected == 1
-}
-
-func IsLarkIdAlreadyTaken(githubId string) bool {
-	return DB.Where("lark_id = ?", githubId).Find(&User{}).RowsAffected == 1
-}
-
-func IsOidcIdAlreadyTaken(oidcId string) bool {
-	return DB.Where("oidc_id = ?", oidcId).Find(&User{}).RowsAffected == 1
-}
-
 func IsUsernameAlreadyTaken(username string) bool {
 	return DB.Where("username = ?", username).Find(&User{}).RowsAffected == 1
 }
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// SCIMIdentityProvider links users to their externalId at the SCIM client that
+// provisions them. Configured providers cannot use the name.
+const SCIMIdentityProvider = "scim"
+
+// UserIdentity links a user to their subject at a configured identity provider. The
+// links of the built-in providers are kept in the columns of User, see
+// BuiltinIdentityProviders.
+type UserIdentity struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Provider    string `json:"provider" gorm:"type:varchar(32);uniqueIndex:idx_user_identity_subject"`
+	Subject     string `json:"subject" gorm:"type:varchar(255);uniqueIndex:idx_user_identity_subject"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// GetUserByIdentity returns the user linked to the subject at the provider.
+func GetUserByIdentity(provider string, subject string) (*User, error) {
+	if subject == "" {
+		return nil, errors.Errorf("%s id is empty", provider)
+	}
+	user := &User{}
+	if column, ok := BuiltinIdentityProviders[provider]; ok {
+		err := DB.Where(column+" = ?", subject).First(user).Error
+		return user, errors.Wrapf(err, "get user by %s id", provider)
+	}
+	identity := &UserIdentity{}
+	if err := DB.Where("provider = ? AND subject = ?", provider, subject).First(identity).Error; err != nil {
+		return nil, errors.Wrapf(err, "get %s identity", provider)
+	}
+	err := DB.First(user, "id = ?", identity.UserId).Error
+	return user, errors.Wrapf(err, "get user of %s identity", provider)
+}
+
+// IsIdentityTaken reports whether a user is linked to the subject at the provider.
+func IsIdentityTaken(provider string, subject string) bool {
+	if column, ok := BuiltinIdentityProviders[provider]; ok {
+		return DB.Where(column+" = ?", subject).Find(&User{}).RowsAffected == 1
+	}
+	return DB.Where("provider = ? AND subject = ?", provider, subject).Find(&UserIdentity{}).RowsAffected == 1
+}
+
+// BindIdentity links the user to the subject at the provider.
+func BindIdentity(userId int, provider string, subject string) error {
+	if subject == "" {
+		return errors.Errorf("%s id is empty", provider)
+	}
+	if column, ok := BuiltinIdentityProviders[provider]; ok {
+		err := DB.Model(&User{}).Where("id = ?", userId).Update(column, subject).Error
+		return errors.Wrapf(err, "bind %s id", provider)
+	}
+	err := DB.Create(&UserIdentity{
+		UserId:      userId,
+		Provider:    provider,
+		Subject:     subject,
+		CreatedTime: helper.GetTimestamp(),
+	}).Error
+	return errors.Wrapf(err, "bind %s identity", provider)
+}
+
+// GetIdentitySubjects returns the subjects users are linked to at the configured
+// provider, by user id.
+func GetIdentitySubjects(provider string) (map[int]string, error) {
+	var identities []*UserIdentity
+	if err := DB.Where("provider = ?", provider).Find(&identities).Error; err != nil {
+		return nil, errors.Wrapf(err, "get %s identities", provider)
+	}
+	subjects := make(map[int]string, len(identities))
+	for _, identity := range identities {
+		subjects[identity.UserId] = identity.Subject
+	}
+	return subjects, nil
+}
+
+// SetIdentity links the user to the subject at the configured provider, replacing the
+// link they had. An empty subject removes the link.
+func SetIdentity(userId int, provider string, subject string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND provider = ?", userId, provider).Delete(&UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if subject == "" {
+			return nil
+		}
+		return tx.Create(&UserIdentity{
+			UserId:      userId,
+			Provider:    provider,
+			Subject:     subject,
+			CreatedTime: helper.GetTimestamp(),
+		}).Error
+	})
+	return errors.Wrapf(err, "set %s identity of user %d", provider, userId)
+}
+
+// ApplyIdentityAttributes sets the group and role an identity provider assigned to the
+// user, "" and 0 keep the current ones. Root users are left alone.
+func (user *User) ApplyIdentityAttributes(group string, role int) error {
+	if user.Role == RoleRootUser {
+		return nil
+	}
+	changed := false
+	if group != "" && group != user.Group {
+		user.Group = group
+		changed = true
+	}
+	if role != 0 && role != user.Role {
+		user.Role = role
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	// Update skips zero values, so the columns are selected explicitly
+	if err := DB.Model(user).Select("group", "role").Updates(user).Error; err != nil {
+		return errors.Wrapf(err, "update group and role of user %d", user.Id)
+	}
+	invalidateUserCache(user.Id, 0)
+	return nil
+}
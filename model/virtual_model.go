@@ -0,0 +1,229 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// VirtualModel is a gateway level model name that is served by other models.
+// Requests to the virtual model are routed to the first target with an available
+// channel, and fall back to the next target when the channels of a target fail.
+type VirtualModel struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(255);uniqueIndex"`
+	Description string `json:"description" gorm:"type:text"`
+	// Targets is the JSON encoded, ordered list of VirtualModelTarget
+	Targets     string `json:"targets" gorm:"type:text"`
+	Enabled     bool   `json:"enabled"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+
+	targets []VirtualModelTarget
+}
+
+// VirtualModelTarget is a model a virtual model falls back to.
+type VirtualModelTarget struct {
+	Model string `json:"model"`
+	// Group selects the channels of this group instead of the caller's group,
+	// the caller is still billed with the ratio of its own group
+	Group string `json:"group,omitempty"`
+	// Params overrides top level request parameters, e.g. {"temperature": 0.2},
+	// a null value removes the parameter from the request
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// ChannelGroup returns the group whose channels serve the target.
+func (t VirtualModelTarget) ChannelGroup(userGroup string) string {
+	if t.Group != "" {
+		return t.Group
+	}
+	return userGroup
+}
+
+// GetTargets returns the decoded targets of the virtual model.
+func (vm *VirtualModel) GetTargets() ([]VirtualModelTarget, error) {
+	if vm.targets != nil {
+		return vm.targets, nil
+	}
+	var targets []VirtualModelTarget
+	if err := json.Unmarshal([]byte(vm.Targets), &targets); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal targets of virtual model %s", vm.Name)
+	}
+	return targets, nil
+}
+
+// validate normalizes the virtual model and checks its targets.
+func (vm *VirtualModel) validate() error {
+	vm.Name = strings.TrimSpace(vm.Name)
+	if vm.Name == "" || strings.Contains(vm.Name, ",") {
+		return errors.Errorf("invalid virtual model name %q", vm.Name)
+	}
+
+	targets, err := vm.GetTargets()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("at least one target is required")
+	}
+
+	// virtual models cannot be nested, neither as a target nor by being a target
+	others, err := GetAllVirtualModels()
+	if err != nil {
+		return err
+	}
+	otherNames := make(map[string]bool, len(others))
+	for _, other := range others {
+		if other.Id == vm.Id {
+			continue
+		}
+		otherNames[other.Name] = true
+		otherTargets, err := other.GetTargets()
+		if err != nil {
+			continue
+		}
+		for _, target := range otherTargets {
+			if target.Model == vm.Name {
+				return errors.Errorf("virtual model %s is a target of %s, virtual models cannot be nested", vm.Name, other.Name)
+			}
+		}
+	}
+
+	for i := range targets {
+		target := &targets[i]
+		target.Model = strings.TrimSpace(target.Model)
+		switch {
+		case target.Model == "":
+			return errors.Errorf("model of target %d is required", i)
+		case target.Model == vm.Name:
+			return errors.Errorf("target %d must not refer to the virtual model itself", i)
+		case otherNames[target.Model]:
+			return errors.Errorf("target %d refers to the virtual model %s, virtual models cannot be nested", i, target.Model)
+		case target.Group != "" && !ValidGroupName(target.Group):
+			return errors.Errorf("invalid group %q of target %d", target.Group, i)
+		}
+		if _, ok := target.Params["model"]; ok {
+			return errors.Errorf("params of target %d must not override the model", i)
+		}
+	}
+
+	encoded, err := json.Marshal(targets)
+	if err != nil {
+		return errors.Wrap(err, "marshal targets")
+	}
+	vm.Targets = string(encoded)
+	vm.targets = targets
+	return nil
+}
+
+func GetAllVirtualModels() ([]*VirtualModel, error) {
+	var virtualModels []*VirtualModel
+	err := DB.Order("name asc").Find(&virtualModels).Error
+	return virtualModels, errors.Wrap(err, "get all virtual models")
+}
+
+func GetVirtualModelById(id int) (*VirtualModel, error) {
+	vm := &VirtualModel{}
+	err := DB.First(vm, "id = ?", id).Error
+	return vm, errors.Wrapf(err, "get virtual model %d", id)
+}
+
+func (vm *VirtualModel) Insert() error {
+	if err := vm.validate(); err != nil {
+		return err
+	}
+	vm.CreatedTime = helper.GetTimestamp()
+	vm.UpdatedTime = vm.CreatedTime
+	if err := DB.Create(vm).Error; err != nil {
+		return errors.Wrapf(err, "create virtual model %s", vm.Name)
+	}
+	invalidateCache(CacheVirtualModels)
+	return nil
+}
+
+// Update saves all fields of the virtual model.
+func (vm *VirtualModel) Update() error {
+	if err := vm.validate(); err != nil {
+		return err
+	}
+	vm.UpdatedTime = helper.GetTimestamp()
+	err := DB.Model(vm).
+		Select("name", "description", "targets", "enabled", "updated_time").
+		Updates(vm).Error
+	if err != nil {
+		return errors.Wrapf(err, "update virtual model %s", vm.Name)
+	}
+	invalidateCache(CacheVirtualModels)
+	return nil
+}
+
+func (vm *VirtualModel) Delete() error {
+	if err := DB.Delete(vm).Error; err != nil {
+		return errors.Wrapf(err, "delete virtual model %s", vm.Name)
+	}
+	invalidateCache(CacheVirtualModels)
+	return nil
+}
+
+var (
+	virtualModels    map[string]*VirtualModel
+	virtualModelsMux sync.RWMutex
+)
+
+// InitVirtualModelCache loads the enabled virtual models.
+func InitVirtualModelCache() {
+	var rows []*VirtualModel
+	if err := DB.Where("enabled = ?", true).Find(&rows).Error; err != nil {
+		logger.Logger.Error("failed to load virtual models", zap.Error(err))
+		return
+	}
+
+	loaded := make(map[string]*VirtualModel, len(rows))
+	for _, vm := range rows {
+		targets, err := vm.GetTargets()
+		if err != nil || len(targets) == 0 {
+			logger.Logger.Error("skip virtual model with invalid targets", zap.String("name", vm.Name), zap.Error(err))
+			continue
+		}
+		vm.targets = targets
+		loaded[vm.Name] = vm
+	}
+
+	virtualModelsMux.Lock()
+	virtualModels = loaded
+	virtualModelsMux.Unlock()
+}
+
+func SyncVirtualModelCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.Logger.Info("syncing virtual models from database")
+		InitVirtualModelCache()
+	}
+}
+
+// GetVirtualModel returns the enabled virtual model with the name, or nil if there is none.
+func GetVirtualModel(name string) *VirtualModel {
+	virtualModelsMux.RLock()
+	defer virtualModelsMux.RUnlock()
+	return virtualModels[name]
+}
+
+// GetVirtualModels returns the enabled virtual models.
+func GetVirtualModels() []*VirtualModel {
+	virtualModelsMux.RLock()
+	defer virtualModelsMux.RUnlock()
+	result := make([]*VirtualModel, 0, len(virtualModels))
+	for _, vm := range virtualModels {
+		result = append(result, vm)
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualModel(t *testing.T) {
+	testDB := setupTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(&VirtualModel{}))
+	originalDB := DB
+	DB = testDB
+	t.Cleanup(func() {
+		DB = originalDB
+		virtualModels = nil
+	})
+
+	smart := &VirtualModel{
+		Name:    " smart ",
+		Targets: `[{"model":" claude-sonnet-4-0 ","group":"a"},{"model":"gpt-4o","params":{"temperature":0.2}}]`,
+		Enabled: true,
+	}
+	require.NoError(t, smart.Insert())
+	assert.Equal(t, "smart", smart.Name)
+
+	cached := GetVirtualModel("smart")
+	require.NotNil(t, cached)
+	targets, err := cached.GetTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	assert.Equal(t, "claude-sonnet-4-0", targets[0].Model)
+	assert.Equal(t, "a", targets[0].ChannelGroup("default"))
+	assert.Equal(t, "default", targets[1].ChannelGroup("default"))
+	assert.Equal(t, 0.2, targets[1].Params["temperature"])
+
+	invalid := []*VirtualModel{
+		{Name: "empty", Targets: `[]`},
+		{Name: "self", Targets: `[{"model":"self"}]`},
+		{Name: "nested", Targets: `[{"model":"smart"}]`},
+		{Name: "gpt-4o", Targets: `[{"model":"gpt-4o-mini"}]`},
+		{Name: "model-param", Targets: `[{"model":"gpt-4o","params":{"model":"x"}}]`},
+		{Name: "bad-group", Targets: `[{"model":"gpt-4o","group":"a,b"}]`},
+		{Name: "a,b", Targets: `[{"model":"gpt-4o"}]`},
+	}
+	for _, vm := range invalid {
+		assert.Error(t, vm.Insert(), vm.Name)
+	}
+	// gpt-4o is not a virtual model, but it is a target of smart
+	assert.Nil(t, GetVirtualModel("gpt-4o"))
+
+	smart.Enabled = false
+	require.NoError(t, smart.Update())
+	assert.Nil(t, GetVirtualModel("smart"))
+
+	require.NoError(t, smart.Delete())
+	all, err := GetAllVirtualModels()
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// WebAuthnCredential is a passkey or security key of a user, it is used as second
+// factor after the password, or on its own for passwordless login.
+type WebAuthnCredential struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"user_id" gorm:"index"`
+	Name   string `json:"name" gorm:"type:varchar(64)"`
+	// CredentialId is the base64url encoded id the authenticator gave the credential
+	CredentialId string `json:"credential_id" gorm:"type:varchar(255);uniqueIndex"`
+	// Credential is the JSON encoded credential with the public key and the sign count,
+	// it is only read by the WebAuthn ceremonies
+	Credential   string `json:"-" gorm:"type:text"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint"`
+}
+
+// GetUserWebAuthnCredentials returns the credentials of the user, oldest first.
+func GetUserWebAuthnCredentials(userId int) ([]*WebAuthnCredential, error) {
+	var credentials []*WebAuthnCredential
+	err := DB.Where("user_id = ?", userId).Order("id asc").Find(&credentials).Error
+	return credentials, errors.Wrapf(err, "get webauthn credentials of user %d", userId)
+}
+
+// HasWebAuthnCredentials reports whether the user registered any credential.
+func HasWebAuthnCredentials(userId int) bool {
+	var count int64
+	DB.Model(&WebAuthnCredential{}).Where("user_id = ?", userId).Count(&count)
+	return count > 0
+}
+
+func (c *WebAuthnCredential) Insert() error {
+	c.CreatedTime = helper.GetTimestamp()
+	err := DB.Create(c).Error
+	return errors.Wrapf(err, "create webauthn credential of user %d", c.UserId)
+}
+
+// UpdateUsage stores the credential after a login, its sign count changes with every
+// use of the authenticator.
+func (c *WebAuthnCredential) UpdateUsage() error {
+	c.LastUsedTime = helper.GetTimestamp()
+	err := DB.Model(c).Select("credential", "last_used_time").Updates(c).Error
+	return errors.Wrapf(err, "update webauthn credential %d", c.Id)
+}
+
+// DeleteWebAuthnCredential deletes the credential of the user.
+func DeleteWebAuthnCredential(id int, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&WebAuthnCredential{})
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "delete webauthn credential %d", id)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Errorf("webauthn credential %d not found", id)
+	}
+	return nil
+}
+
+// DeleteUserWebAuthnCredentials deletes all credentials of the user.
+func DeleteUserWebAuthnCredentials(userId int) error {
+	err := DB.Where("user_id = ?", userId).Delete(&WebAuthnCredential{}).Error
+	return errors.Wrapf(err, "delete webauthn credentials of user %d", userId)
+}
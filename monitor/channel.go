@@ -27,9 +27,15 @@ func notifyRootUser(subject string, content string) {
 	}
 }
 
-// DisableChannel disable & notify
-func DisableChannel(channelId int, channelName string, reason string) {
+// DisableChannel disable & notify, modelName is the model the channel failed with and is
+// probed by the channel recovery, empty for the channel's test model
+func DisableChannel(channelId int, channelName string, modelName string, reason string) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
+	if config.ChannelRecoveryEnabled {
+		if err := model.StartChannelRecovery(channelId, modelName, reason); err != nil {
+			logger.Logger.Error(fmt.Sprintf("failed to start recovery of channel #%d: %s", channelId, err.Error()))
+		}
+	}
 	logger.Logger.Info(fmt.Sprintf("channel #%d has been disabled: %s", channelId, reason))
 	subject := fmt.Sprintf("Channel Status Change Reminder")
 	content := message.EmailTemplate(
@@ -46,6 +52,11 @@ func DisableChannel(channelId int, channelName string, reason string) {
 
 func MetricDisableChannel(channelId int, successRate float64) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
+	if config.ChannelRecoveryEnabled {
+		if err := model.StartChannelRecovery(channelId, "", fmt.Sprintf("success rate %.2f%%", successRate*100)); err != nil {
+			logger.Logger.Error(fmt.Sprintf("failed to start recovery of channel #%d: %s", channelId, err.Error()))
+		}
+	}
 	logger.Logger.Info(fmt.Sprintf("channel #%d has been disabled due to low success rate: %.2f", channelId, successRate*100))
 	subject := fmt.Sprintf("Channel Status Change Reminder")
 	content := message.EmailTemplate(
@@ -63,6 +74,9 @@ func MetricDisableChannel(channelId int, successRate float64) {
 // EnableChannel enable & notify
 func EnableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusEnabled)
+	if err := model.DeleteChannelRecovery(channelId); err != nil {
+		logger.Logger.Error(fmt.Sprintf("failed to delete recovery of channel #%d: %s", channelId, err.Error()))
+	}
 	logger.Logger.Info(fmt.Sprintf("channel #%d has been enabled", channelId))
 	subject := fmt.Sprintf("Channel Status Change Reminder")
 	content := message.EmailTemplate(
@@ -1,48 +1,54 @@
 package monitor
 
 import (
-	"net/http"
-	"strings"
+	"fmt"
+
+	"github.com/Laisky/zap"
 
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
-func ShouldDisableChannel(err *model.Error, statusCode int) bool {
-	if !config.AutomaticDisableChannelEnabled {
-		return false
-	}
+// MatchChannelErrorRule returns the first enabled rule matching the error of a channel
+// of the type, or nil. Matching dry-run rules are logged and skipped.
+func MatchChannelErrorRule(channelId int, channelType int, err *model.Error, statusCode int) *dbmodel.ChannelErrorRule {
 	if err == nil {
-		return false
+		return nil
 	}
-	if statusCode == http.StatusUnauthorized {
-		return true
+	errCode := ""
+	if err.Code != nil {
+		errCode = fmt.Sprint(err.Code)
 	}
-
-	switch err.Type {
-	case "insufficient_quota", "authentication_error", "permission_error", "forbidden":
-		return true
-	}
-	if err.Code == "invalid_api_key" || err.Code == "account_deactivated" {
-		return true
+	for _, rule := range dbmodel.GetChannelErrorRules() {
+		if !rule.Matches(channelType, statusCode, err.Type, errCode, err.Message) {
+			continue
+		}
+		if rule.DryRun {
+			logger.Logger.Info("dry run: channel error rule matched",
+				zap.Int("rule_id", rule.Id),
+				zap.String("rule", rule.Name),
+				zap.String("action", rule.Action),
+				zap.Int("seconds", rule.Seconds),
+				zap.Int("channel_id", channelId),
+				zap.Int("status_code", statusCode),
+				zap.String("error", err.Message))
+			continue
+		}
+		return rule
 	}
+	return nil
+}
 
-	lowerMessage := strings.ToLower(err.Message)
-	if strings.Contains(lowerMessage, "your access was terminated") ||
-		strings.Contains(lowerMessage, "violation of our policies") ||
-		strings.Contains(lowerMessage, "your credit balance is too low") ||
-		strings.Contains(lowerMessage, "organization has been disabled") ||
-		strings.Contains(lowerMessage, "credit") ||
-		strings.Contains(lowerMessage, "balance") ||
-		strings.Contains(lowerMessage, "permission denied") ||
-		strings.Contains(lowerMessage, "organization has been restricted") || // groq
-		strings.Contains(lowerMessage, "api key not valid") || // gemini
-		strings.Contains(lowerMessage, "api key expired") || // gemini
-		strings.Contains(lowerMessage, "insufficient balance") || // Chinese: 已欠费
-		strings.Contains(lowerMessage, "已欠费") {
-		return true
+// ShouldDisableChannel reports whether the error of a channel of the type matches a rule
+// disabling the channel, and automatic disabling is on.
+func ShouldDisableChannel(channelId int, channelType int, err *model.Error, statusCode int) bool {
+	if !config.AutomaticDisableChannelEnabled {
+		return false
 	}
-	return false
+	rule := MatchChannelErrorRule(channelId, channelType, err, statusCode)
+	return rule != nil && rule.Action == dbmodel.ChannelErrorActionDisable
 }
 
 func ShouldEnableChannel(err error, openAIErr *model.Error) bool {
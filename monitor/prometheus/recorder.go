@@ -80,6 +80,17 @@ var (
 		Help: "Number of requests currently being processed by channel",
 	}, []string{"channel_id", "channel_name", "channel_type"})
 
+	channelQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "one_api_channel_queue_depth",
+		Help: "Number of requests waiting for an available channel",
+	}, []string{"group", "model"})
+
+	channelQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "one_api_channel_queue_wait_seconds",
+		Help:    "Time requests waited for an available channel in seconds",
+		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"group", "model", "served"})
+
 	// User metrics
 	userRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "one_api_user_requests_total",
@@ -281,6 +292,16 @@ func (p *PrometheusRecorder) UpdateChannelRequestsInFlight(channelId int, channe
 	channelRequestsInFlight.WithLabelValues(channelIdStr, channelName, channelType).Add(delta)
 }
 
+// UpdateChannelQueueDepth updates the number of requests waiting for a channel
+func (p *PrometheusRecorder) UpdateChannelQueueDepth(group, model string, depth int) {
+	channelQueueDepth.WithLabelValues(group, model).Set(float64(depth))
+}
+
+// RecordChannelQueueWait records how long a request waited for a channel, served is false on timeout
+func (p *PrometheusRecorder) RecordChannelQueueWait(group, model string, wait time.Duration, served bool) {
+	channelQueueWait.WithLabelValues(group, model, strconv.FormatBool(served)).Observe(wait.Seconds())
+}
+
 // RecordUserMetrics records user-related metrics
 func (p *PrometheusRecorder) RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64) {
 	userRequestsTotal.WithLabelValues(userId, username, group).Inc()
@@ -12,6 +12,8 @@ import (
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/alibailian"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -34,6 +36,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", meta.BaseURL)
 	case relaymode.ImagesGenerations:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", meta.BaseURL)
+	case relaymode.Rerank:
+		fullRequestURL = fmt.Sprintf("%s%s", meta.BaseURL, alibailian.RerankPath)
 	default:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text-generation/generation", meta.BaseURL)
 	}
@@ -81,6 +85,14 @@ func (a *Adaptor) ConvertImageRequest(_ *gin.Context, request *model.ImageReques
 	return aliRequest, nil
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor.
+func (a *Adaptor) ConvertRerankRequest(_ *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return alibailian.ConvertRerankRequest(*request), nil
+}
+
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -236,6 +248,8 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 			err, usage = EmbeddingHandler(c, resp)
 		case relaymode.ImagesGenerations:
 			err, usage = ImageHandler(c, resp)
+		case relaymode.Rerank:
+			err, usage = openai.RerankHandler(c, resp, meta, alibailian.ParseRerankResponse)
 		default:
 			err, usage = Handler(c, resp)
 		}
@@ -136,6 +136,10 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"text-embedding-async-v2": {Ratio: 0.5 * ratio.MilliTokensRmb, CompletionRatio: 1},
 	"text-embedding-async-v1": {Ratio: 0.5 * ratio.MilliTokensRmb, CompletionRatio: 1},
 
+	// Rerank Models
+	"gte-rerank":    {Ratio: 0.8 * ratio.MilliTokensRmb, CompletionRatio: 1},
+	"gte-rerank-v2": {Ratio: 0.8 * ratio.MilliTokensRmb, CompletionRatio: 1},
+
 	// Image Generation Models
 	"ali-stable-diffusion-xl":   {Ratio: 8 * ratio.MilliTokensRmb, CompletionRatio: 1},
 	"ali-stable-diffusion-v1.5": {Ratio: 8 * ratio.MilliTokensRmb, CompletionRatio: 1},
@@ -22,6 +22,10 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"qwen-mt-turbo":           {Ratio: 0.3 * ratio.MilliTokensRmb, CompletionRatio: 1},
 	"qwq-32b-preview":         {Ratio: 0.5 * ratio.MilliTokensRmb, CompletionRatio: 1},
 
+	// Rerank Models
+	"gte-rerank":    {Ratio: 0.8 * ratio.MilliTokensRmb, CompletionRatio: 1},
+	"gte-rerank-v2": {Ratio: 0.8 * ratio.MilliTokensRmb, CompletionRatio: 1},
+
 	// DeepSeek Models (hosted on Alibaba)
 	"deepseek-r1": {Ratio: 1.0 * ratio.MilliTokensRmb, CompletionRatio: 1},
 	"deepseek-v3": {Ratio: 0.07 * ratio.MilliTokensRmb, CompletionRatio: 1},
@@ -7,12 +7,17 @@ import (
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
+// RerankPath is the DashScope text rerank service, it has no OpenAI-compatible endpoint.
+const RerankPath = "/api/v1/services/rerank/text-rerank/text-rerank"
+
 func GetRequestURL(meta *meta.Meta) (string, error) {
 	switch meta.Mode {
 	case relaymode.ChatCompletions:
 		return fmt.Sprintf("%s/compatible-mode/v1/chat/completions", meta.BaseURL), nil
 	case relaymode.Embeddings:
 		return fmt.Sprintf("%s/compatible-mode/v1/embeddings", meta.BaseURL), nil
+	case relaymode.Rerank:
+		return fmt.Sprintf("%s%s", meta.BaseURL, RerankPath), nil
 	default:
 	}
 	return "", fmt.Errorf("unsupported relay mode %d for ali bailian", meta.Mode)
@@ -0,0 +1,65 @@
+package alibailian
+
+import (
+	"encoding/json"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankRequest is the request of the DashScope text rerank service,
+// https://help.aliyun.com/zh/model-studio/text-rerank-api
+type RerankRequest struct {
+	Model      string           `json:"model"`
+	Input      RerankInput      `json:"input"`
+	Parameters RerankParameters `json:"parameters,omitempty"`
+}
+
+type RerankInput struct {
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type RerankParameters struct {
+	TopN            int  `json:"top_n,omitempty"`
+	ReturnDocuments bool `json:"return_documents"`
+}
+
+type RerankResponse struct {
+	Output struct {
+		Results []model.RerankResult `json:"results"`
+	} `json:"output"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+	RequestId string `json:"request_id"`
+}
+
+// ConvertRerankRequest converts the canonical request to DashScope.
+func ConvertRerankRequest(request model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model: request.Model,
+		Input: RerankInput{
+			Query:     request.Query,
+			Documents: request.Documents,
+		},
+		Parameters: RerankParameters{TopN: request.TopN},
+	}
+}
+
+// ParseRerankResponse converts the DashScope response to the canonical response.
+func ParseRerankResponse(body []byte) (*model.RerankResponse, error) {
+	var parsed RerankResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, errors.Wrap(err, "unmarshal dashscope rerank response")
+	}
+	return &model.RerankResponse{
+		Id:      parsed.RequestId,
+		Results: parsed.Output.Results,
+		Usage: model.Usage{
+			PromptTokens: parsed.Usage.TotalTokens,
+			TotalTokens:  parsed.Usage.TotalTokens,
+		},
+	}, nil
+}
@@ -70,6 +70,10 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		return nil, errors.New("request is nil")
 	}
 
+	if relayMode == relaymode.Embeddings {
+		return nil, errors.New("anthropic does not provide embeddings, please use a Voyage AI channel")
+	}
+
 	c.Set(ctxkey.ClaudeModel, request.Model)
 	return ConvertRequest(c, *request)
 }
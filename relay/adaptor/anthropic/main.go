@@ -781,9 +781,11 @@ func ClaudeNativeStreamHandler(c *gin.Context, resp *http.Response) (*model.Erro
 		}
 
 		// Extract usage info from message_delta
+		if claudeResponse.Type == "message_start" && claudeResponse.Message != nil {
+			usage.AddClaudeStreamUsage(&claudeResponse.Message.Usage)
+		}
 		if claudeResponse.Type == "message_delta" && claudeResponse.Usage != nil {
-			usage.PromptTokens += claudeResponse.Usage.InputTokens
-			usage.CompletionTokens += claudeResponse.Usage.OutputTokens
+			usage.AddClaudeStreamUsage(claudeResponse.Usage)
 		}
 	}
 
@@ -843,8 +845,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 		response, meta := StreamResponseClaude2OpenAI(c, &claudeResponse)
 		if meta != nil {
-			usage.PromptTokens += meta.Usage.InputTokens
-			usage.CompletionTokens += meta.Usage.OutputTokens
+			usage.AddClaudeStreamUsage(&meta.Usage)
 			if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 				modelName = meta.Model
 				id = fmt.Sprintf("chatcmpl-%s", meta.Id)
@@ -931,11 +932,7 @@ func ClaudeNativeHandler(c *gin.Context, resp *http.Response, promptTokens int,
 
 	// Return response in Claude's native format
 	claudeResponse.Model = modelName
-	usage := model.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := *claudeResponse.Usage.ToUsage()
 
 	jsonResponse, err := json.Marshal(claudeResponse)
 	if err != nil {
@@ -977,11 +974,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := ResponseClaude2OpenAI(c, &claudeResponse)
 	fullTextResponse.Model = modelName
-	usage := model.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := *claudeResponse.Usage.ToUsage()
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
@@ -64,10 +64,9 @@ type Request struct {
 	AnthropicVersion string          `json:"anthropic_version,omitempty"`
 }
 
-type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
-}
+// Usage is shared with the Claude Messages API types so that cache tokens are
+// converted the same way everywhere.
+type Usage = model.ClaudeUsage
 
 type Error struct {
 	Type    string `json:"type"`
@@ -50,6 +50,10 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		return nil, errors.New("request is nil")
 	}
 
+	if relayMode == relaymode.Embeddings {
+		return nil, errors.New("aws does not support embeddings")
+	}
+
 	adaptor := GetAdaptor(request.Model)
 	if adaptor == nil {
 		return nil, errors.New("adaptor not found")
@@ -12,6 +12,7 @@ import (
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -229,9 +230,12 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
+	switch {
+	case meta.Mode == relaymode.Embeddings:
+		err, usage = openai_compatible.EmbeddingHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	case meta.IsStream:
 		err, usage = StreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
-	} else {
+	default:
 		err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
 	}
 	return
@@ -12,8 +12,10 @@ import (
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 type Adaptor struct {
@@ -31,6 +33,12 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	switch meta.Mode {
+	case relaymode.Rerank:
+		return fmt.Sprintf("%s/v1/rerank", meta.BaseURL), nil
+	case relaymode.Embeddings:
+		return fmt.Sprintf("%s/v2/embed", meta.BaseURL), nil
+	}
 	return fmt.Sprintf("%s/v1/chat", meta.BaseURL), nil
 }
 
@@ -44,9 +52,20 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if relayMode == relaymode.Embeddings {
+		return ConvertEmbeddingRequest(*request)
+	}
 	return ConvertRequest(*request), nil
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor.
+func (a *Adaptor) ConvertRerankRequest(_ *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertRerankRequest(*request), nil
+}
+
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -194,9 +213,14 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
+	switch {
+	case meta.Mode == relaymode.Rerank:
+		err, usage = openai.RerankHandler(c, resp, meta, ParseRerankResponse)
+	case meta.Mode == relaymode.Embeddings:
+		err, usage = EmbeddingHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	case meta.IsStream:
 		err, usage = StreamHandler(c, resp)
-	} else {
+	default:
 		err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
 	}
 	return
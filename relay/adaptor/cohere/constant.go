@@ -27,4 +27,17 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"command-light-nightly-internet": {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2}, // $0.3/$0.6 per 1M tokens
 	"command-r-internet":             {Ratio: 0.5 * ratio.MilliTokensUsd, CompletionRatio: 3}, // $0.5/$1.5 per 1M tokens
 	"command-r-plus-internet":        {Ratio: 3 * ratio.MilliTokensUsd, CompletionRatio: 5},   // $3/$15 per 1M tokens
+
+	// Embed Models
+	"embed-v4.0":                    {Ratio: 0.12 * ratio.MilliTokensUsd, CompletionRatio: 1}, // $0.12 per 1M tokens
+	"embed-english-v3.0":            {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},  // $0.1 per 1M tokens
+	"embed-multilingual-v3.0":       {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},  // $0.1 per 1M tokens
+	"embed-english-light-v3.0":      {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},  // $0.1 per 1M tokens
+	"embed-multilingual-light-v3.0": {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},  // $0.1 per 1M tokens
+
+	// Rerank Models are billed per search unit, a query with up to 100 documents,
+	// the ratio is the quota of one search unit
+	"rerank-v3.5":              {Ratio: 2.0 / 1000 * ratio.QuotaPerUsd, CompletionRatio: 1}, // $2 per 1k searches
+	"rerank-english-v3.0":      {Ratio: 2.0 / 1000 * ratio.QuotaPerUsd, CompletionRatio: 1}, // $2 per 1k searches
+	"rerank-multilingual-v3.0": {Ratio: 2.0 / 1000 * ratio.QuotaPerUsd, CompletionRatio: 1}, // $2 per 1k searches
 }
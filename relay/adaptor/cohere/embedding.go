@@ -0,0 +1,106 @@
+package cohere
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// EmbeddingRequest is the request of https://docs.cohere.com/reference/embed
+type EmbeddingRequest struct {
+	Model           string   `json:"model"`
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	EmbeddingTypes  []string `json:"embedding_types"`
+	OutputDimension int      `json:"output_dimension,omitempty"`
+}
+
+type EmbeddingResponse struct {
+	Id         string `json:"id"`
+	Message    string `json:"message"`
+	Embeddings struct {
+		Float [][]float64 `json:"float"`
+	} `json:"embeddings"`
+	Meta struct {
+		BilledUnits struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"billed_units"`
+	} `json:"meta"`
+}
+
+// ConvertEmbeddingRequest converts the OpenAI request to Cohere. Cohere requires an input
+// type, the OpenAI API has none, so the texts are embedded as documents.
+func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) (*EmbeddingRequest, error) {
+	texts := request.ParseInput()
+	if len(texts) == 0 {
+		return nil, errors.New("cohere only embeds text input")
+	}
+	return &EmbeddingRequest{
+		Model:           request.Model,
+		Texts:           texts,
+		InputType:       "search_document",
+		EmbeddingTypes:  []string{"float"},
+		OutputDimension: request.Dimensions,
+	}, nil
+}
+
+func embeddingResponseCohere2OpenAI(response *EmbeddingResponse, modelName string) *openai.EmbeddingResponse {
+	openAIEmbeddingResponse := openai.EmbeddingResponse{
+		Object: "list",
+		Data:   make([]openai.EmbeddingResponseItem, 0, len(response.Embeddings.Float)),
+		Model:  modelName,
+		Usage: model.Usage{
+			PromptTokens: response.Meta.BilledUnits.InputTokens,
+			TotalTokens:  response.Meta.BilledUnits.InputTokens,
+		},
+	}
+	for idx, embedding := range response.Embeddings.Float {
+		openAIEmbeddingResponse.Data = append(openAIEmbeddingResponse.Data, openai.EmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     idx,
+			Embedding: embedding,
+		})
+	}
+	return &openAIEmbeddingResponse
+}
+
+func EmbeddingHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if err = resp.Body.Close(); err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var cohereResponse EmbeddingResponse
+	if err = json.Unmarshal(responseBody, &cohereResponse); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Id == "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: cohereResponse.Message,
+				Type:    "cohere_error",
+				Code:    resp.StatusCode,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+
+	fullTextResponse := embeddingResponseCohere2OpenAI(&cohereResponse, modelName)
+	if fullTextResponse.PromptTokens == 0 {
+		fullTextResponse.PromptTokens = promptTokens
+		fullTextResponse.TotalTokens = promptTokens
+	}
+	openai.ApplyEmbeddingOptions(c, fullTextResponse)
+
+	c.JSON(resp.StatusCode, fullTextResponse)
+	return nil, &fullTextResponse.Usage
+}
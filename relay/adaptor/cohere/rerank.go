@@ -0,0 +1,66 @@
+package cohere
+
+import (
+	"encoding/json"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// documentsPerSearchUnit is the number of documents Cohere bills as one search unit,
+// https://docs.cohere.com/docs/rerank-overview#pricing
+const documentsPerSearchUnit = 100
+
+// SearchUnits estimates the search units of a rerank request with documents documents.
+func SearchUnits(documents int) int {
+	if documents <= 0 {
+		return 1
+	}
+	return (documents + documentsPerSearchUnit - 1) / documentsPerSearchUnit
+}
+
+// RerankRequest is the request of https://docs.cohere.com/reference/rerank
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments bool     `json:"return_documents"`
+}
+
+type RerankResponse struct {
+	Id      string               `json:"id"`
+	Results []model.RerankResult `json:"results"`
+	Meta    struct {
+		BilledUnits struct {
+			SearchUnits int `json:"search_units"`
+		} `json:"billed_units"`
+	} `json:"meta"`
+}
+
+// ConvertRerankRequest converts the canonical request to Cohere.
+func ConvertRerankRequest(request model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model:     request.Model,
+		Query:     request.Query,
+		Documents: request.Documents,
+		TopN:      request.TopN,
+	}
+}
+
+// ParseRerankResponse converts the Cohere response, Cohere bills search units instead of tokens.
+func ParseRerankResponse(body []byte) (*model.RerankResponse, error) {
+	var parsed RerankResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, errors.Wrap(err, "unmarshal cohere rerank response")
+	}
+	return &model.RerankResponse{
+		Id:      parsed.Id,
+		Results: parsed.Results,
+		Usage: model.Usage{
+			PromptTokens: parsed.Meta.BilledUnits.SearchUnits,
+			TotalTokens:  parsed.Meta.BilledUnits.SearchUnits,
+		},
+	}, nil
+}
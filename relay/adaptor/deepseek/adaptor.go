@@ -11,6 +11,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 type Adaptor struct {
@@ -71,6 +72,10 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 }
 
 func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if relayMode == relaymode.Embeddings {
+		return nil, errors.New("deepseek does not support embeddings")
+	}
+
 	// DeepSeek is OpenAI-compatible, so we can pass the request through with minimal changes
 	// Remove reasoning_effort as DeepSeek doesn't support it
 	if request.ReasoningEffort != nil {
@@ -9,6 +9,13 @@ import (
 // Model list is derived from the keys of this map, eliminating redundancy
 // Based on official DeepSeek pricing: https://platform.deepseek.com/api-docs/pricing/
 var ModelRatios = map[string]adaptor.ModelConfig{
-	"deepseek-chat":     {Ratio: 0.27 * ratio.MilliTokensUsd, CompletionRatio: 1.1 / 0.27},
-	"deepseek-reasoner": {Ratio: 0.55 * ratio.MilliTokensUsd, CompletionRatio: 2.19 / 0.55},
+	"deepseek-chat": {Ratio: 0.27 * ratio.MilliTokensUsd, CompletionRatio: 1.1 / 0.27,
+		CachedInputRatio: 0.07 / 0.27, Windows: offPeakWindows(0.5)},
+	"deepseek-reasoner": {Ratio: 0.55 * ratio.MilliTokensUsd, CompletionRatio: 2.19 / 0.55,
+		CachedInputRatio: 0.14 / 0.55, Windows: offPeakWindows(0.25)},
+}
+
+// offPeakWindows returns the DeepSeek off-peak discount, 16:30-00:30 UTC every day.
+func offPeakWindows(multiplier float64) []ratio.PriceWindow {
+	return []ratio.PriceWindow{{Start: "16:30", End: "00:30", Multiplier: multiplier}}
 }
@@ -744,6 +744,20 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 	return nil, responseText
 }
 
+// promptTokensDetails returns the cached and image prompt tokens, nil when there are none.
+func (m *UsageMetadata) promptTokensDetails() *model.UsagePromptTokensDetails {
+	details := &model.UsagePromptTokensDetails{CachedTokens: m.CachedContentTokenCount}
+	for _, d := range m.PromptTokensDetails {
+		if d.Modality == "IMAGE" {
+			details.ImageTokens += d.TokenCount
+		}
+	}
+	if details.CachedTokens == 0 && details.ImageTokens == 0 {
+		return nil
+	}
+	return details
+}
+
 func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -785,6 +799,12 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 				geminiResponse.UsageMetadata.ThoughtsTokenCount,
 			TotalTokens: geminiResponse.UsageMetadata.TotalTokenCount,
 		}
+		// cached content and images are part of the prompt token count
+		usage.PromptTokensDetails = geminiResponse.UsageMetadata.promptTokensDetails()
+		// thoughts are billed as completion tokens
+		if thoughts := geminiResponse.UsageMetadata.ThoughtsTokenCount; thoughts > 0 {
+			usage.CompletionTokensDetails = &model.UsageCompletionTokensDetails{ReasoningTokens: thoughts}
+		}
 	} else {
 		// Fall back to manual calculation if usageMetadata is unavailable or zero
 		completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
@@ -832,6 +852,7 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 		}, nil
 	}
 	fullTextResponse := embeddingResponseGemini2OpenAI(&geminiEmbeddingResponse)
+	openai.ApplyEmbeddingOptions(c, fullTextResponse)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return openai.ErrorWrapper(errors.Wrap(err, "marshal_response_body_failed"), "marshal_response_body_failed", http.StatusInternalServerError), nil
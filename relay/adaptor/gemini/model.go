@@ -15,6 +15,7 @@ type UsageMetadata struct {
 	CandidatesTokenCount    int                   `json:"candidatesTokenCount,omitempty"`
 	TotalTokenCount         int                   `json:"totalTokenCount,omitempty"`
 	ThoughtsTokenCount      int                   `json:"thoughtsTokenCount,omitempty"`
+	CachedContentTokenCount int                   `json:"cachedContentTokenCount,omitempty"`
 	PromptTokensDetails     []PromptTokensDetails `json:"promptTokensDetails,omitempty"`
 	CandidatesTokensDetails []PromptTokensDetails `json:"candidatesTokensDetails,omitempty"`
 }
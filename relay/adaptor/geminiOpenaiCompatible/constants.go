@@ -22,12 +22,12 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"gemma-3-27b-it": {Ratio: 0.35 * ratio.MilliTokensUsd, CompletionRatio: 1.4},
 
 	// Gemini 1.5 Flash Models
-	"gemini-1.5-flash":    {Ratio: 0.075 * ratio.MilliTokensUsd, CompletionRatio: 4},
-	"gemini-1.5-flash-8b": {Ratio: 0.0375 * ratio.MilliTokensUsd, CompletionRatio: 4},
+	"gemini-1.5-flash":    {Ratio: 0.075 * ratio.MilliTokensUsd, CompletionRatio: 4, CachedInputRatio: 0.25},
+	"gemini-1.5-flash-8b": {Ratio: 0.0375 * ratio.MilliTokensUsd, CompletionRatio: 4, CachedInputRatio: 0.25},
 
 	// Gemini 1.5 Pro Models
-	"gemini-1.5-pro":              {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 4},
-	"gemini-1.5-pro-experimental": {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 4},
+	"gemini-1.5-pro":              {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 4, Tiers: gemini15ProTiers, CachedInputRatio: 0.25},
+	"gemini-1.5-pro-experimental": {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 4, Tiers: gemini15ProTiers, CachedInputRatio: 0.25},
 
 	// Embedding Models
 	"text-embedding-004": {Ratio: 0.00001 * ratio.MilliTokensUsd, CompletionRatio: 1},
@@ -44,16 +44,26 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"gemini-2.0-pro-exp-02-05": {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 4},
 
 	// Gemini 2.5 Flash Models
-	"gemini-2.5-flash-lite-preview-06-17": {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 4},
-	"gemini-2.5-flash":                    {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2.5 / 0.3},
-	"gemini-2.5-flash-preview-04-17":      {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2.5 / 0.3},
-	"gemini-2.5-flash-preview-05-20":      {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2.5 / 0.3},
+	"gemini-2.5-flash-lite-preview-06-17": {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 4, CachedInputRatio: 0.25},
+	"gemini-2.5-flash":                    {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2.5 / 0.3, CachedInputRatio: 0.25},
+	"gemini-2.5-flash-preview-04-17":      {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2.5 / 0.3, CachedInputRatio: 0.25},
+	"gemini-2.5-flash-preview-05-20":      {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2.5 / 0.3, CachedInputRatio: 0.25},
 
 	// Gemini 2.5 Pro Models
-	"gemini-2.5-pro":               {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8},
-	"gemini-2.5-pro-exp-03-25":     {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8},
-	"gemini-2.5-pro-preview-05-06": {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8},
-	"gemini-2.5-pro-preview-06-05": {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8},
+	"gemini-2.5-pro":               {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8, Tiers: gemini25ProTiers, CachedInputRatio: 0.25},
+	"gemini-2.5-pro-exp-03-25":     {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8, Tiers: gemini25ProTiers, CachedInputRatio: 0.25},
+	"gemini-2.5-pro-preview-05-06": {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8, Tiers: gemini25ProTiers, CachedInputRatio: 0.25},
+	"gemini-2.5-pro-preview-06-05": {Ratio: 1.25 * ratio.MilliTokensUsd, CompletionRatio: 8, Tiers: gemini25ProTiers, CachedInputRatio: 0.25},
+}
+
+// gemini15ProTiers doubles the price of prompts longer than 128k tokens
+var gemini15ProTiers = []ratio.Tier{
+	{InputTokenThreshold: 128000, Ratio: 2.5 * ratio.MilliTokensUsd, CompletionRatio: 4},
+}
+
+// gemini25ProTiers prices prompts longer than 200k tokens at $2.5 input / $15 output
+var gemini25ProTiers = []ratio.Tier{
+	{InputTokenThreshold: 200000, Ratio: 2.5 * ratio.MilliTokensUsd, CompletionRatio: 6},
 }
 
 // ModelList derived from ModelRatios for backward compatibility
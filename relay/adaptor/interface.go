@@ -7,6 +7,7 @@ import (
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
 
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
@@ -21,6 +22,24 @@ type ModelConfig struct {
 	// MaxTokens represents the maximum token limit for this model on this channel
 	// 0 means no limit (infinity)
 	MaxTokens int32 `json:"max_tokens,omitempty"`
+	// Tiers replace the price when the prompt is longer than a threshold
+	Tiers []ratio.Tier `json:"tiers,omitempty"`
+	// Windows multiply the price during some hours of the day
+	Windows []ratio.PriceWindow `json:"windows,omitempty"`
+	// CachedInputRatio represents the rate of prompt tokens read from cache / input rate, 0 means 1
+	CachedInputRatio float64 `json:"cached_input_ratio,omitempty"`
+	// CacheWriteRatio represents the rate of prompt tokens written to cache / input rate, 0 means 1
+	CacheWriteRatio float64 `json:"cache_write_ratio,omitempty"`
+}
+
+// PriceRules returns the rules that refine the base price of the model.
+func (c ModelConfig) PriceRules() ratio.PriceRules {
+	return ratio.PriceRules{
+		Tiers:            c.Tiers,
+		Windows:          c.Windows,
+		CachedInputRatio: c.CachedInputRatio,
+		CacheWriteRatio:  c.CacheWriteRatio,
+	}
 }
 
 type Adaptor interface {
@@ -41,6 +60,12 @@ type Adaptor interface {
 	GetCompletionRatio(modelName string) float64
 }
 
+// RerankAdaptor is implemented by adaptors whose upstreams can rerank documents.
+// DoResponse must answer rerank requests with a model.RerankResponse.
+type RerankAdaptor interface {
+	ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error)
+}
+
 // DefaultPricingMethods provides default implementations for adapters without specific pricing
 type DefaultPricingMethods struct{}
 
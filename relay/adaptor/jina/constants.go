@@ -0,0 +1,26 @@
+package jina
+
+import (
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+// ModelRatios contains all supported models and their pricing ratios
+// Model list is derived from the keys of this map, eliminating redundancy
+// Based on Jina AI pricing: https://jina.ai/pricing
+var ModelRatios = map[string]adaptor.ModelConfig{
+	// Reranker Models
+	"jina-reranker-m0":                   {Ratio: 0.05 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"jina-reranker-v2-base-multilingual": {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"jina-reranker-v1-base-en":           {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"jina-colbert-v2":                    {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+
+	// Embedding Models
+	"jina-embeddings-v3":           {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"jina-embeddings-v4":           {Ratio: 0.05 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"jina-clip-v2":                 {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"jina-embeddings-v2-base-code": {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+}
+
+// ModelList derived from ModelRatios for backward compatibility
+var ModelList = adaptor.GetModelListFromPricing(ModelRatios)
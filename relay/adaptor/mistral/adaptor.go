@@ -11,6 +11,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 type Adaptor struct {
@@ -71,6 +72,10 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 }
 
 func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if relayMode == relaymode.Embeddings {
+		return ConvertEmbeddingRequest(*request), nil
+	}
+
 	// Mistral is OpenAI-compatible, so we can pass the request through with minimal changes
 	// Remove reasoning_effort as Mistral doesn't support it
 	if request.ReasoningEffort != nil {
@@ -94,9 +99,12 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	// Use the shared OpenAI-compatible response handling
-	if meta.IsStream {
+	switch {
+	case meta.Mode == relaymode.Embeddings:
+		err, usage = openai_compatible.EmbeddingHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	case meta.IsStream:
 		err, usage = openai_compatible.StreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
-	} else {
+	default:
 		err, usage = openai_compatible.Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
 	}
 	return
@@ -0,0 +1,19 @@
+package mistral
+
+import "github.com/songquanpeng/one-api/relay/model"
+
+// EmbeddingRequest is the request of https://docs.mistral.ai/api/#tag/embeddings
+type EmbeddingRequest struct {
+	Model           string `json:"model"`
+	Input           any    `json:"input"`
+	OutputDimension int    `json:"output_dimension,omitempty"`
+}
+
+// ConvertEmbeddingRequest converts the OpenAI request, Mistral names dimensions output_dimension.
+func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *EmbeddingRequest {
+	return &EmbeddingRequest{
+		Model:           request.Model,
+		Input:           request.Input,
+		OutputDimension: request.Dimensions,
+	}
+}
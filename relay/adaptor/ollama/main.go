@@ -203,6 +203,7 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 	}
 
 	fullTextResponse := embeddingResponseOllama2OpenAI(&ollamaResponse)
+	openai.ApplyEmbeddingOptions(c, fullTextResponse)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -24,6 +24,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/geminiOpenaiCompatible"
 	"github.com/songquanpeng/one-api/relay/adaptor/minimax"
 	"github.com/songquanpeng/one-api/relay/adaptor/novita"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
+	"github.com/songquanpeng/one-api/relay/adaptor/voyage"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
@@ -121,6 +123,10 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 
 	meta := meta.GetByContext(c)
 
+	if relayMode == relaymode.Embeddings {
+		return ConvertEmbeddingRequest(meta.ChannelType, *request), nil
+	}
+
 	// Handle direct Response API requests
 	if relayMode == relaymode.ResponseAPI {
 		// For direct Response API requests, the request should already be in the correct format
@@ -234,6 +240,21 @@ func (a *Adaptor) ConvertImageRequest(_ *gin.Context, request *model.ImageReques
 	return request, nil
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor.
+func (a *Adaptor) ConvertRerankRequest(_ *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	switch a.ChannelType {
+	case channeltype.Voyage:
+		return voyage.ConvertRerankRequest(*request), nil
+	case channeltype.AliBailian:
+		return alibailian.ConvertRerankRequest(*request), nil
+	default:
+		return ConvertRerankRequest(*request), nil
+	}
+}
+
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -423,6 +444,14 @@ func (a *Adaptor) DoResponse(c *gin.Context,
 		case relaymode.ImagesGenerations,
 			relaymode.ImagesEdits:
 			err, usage = ImageHandler(c, resp)
+		case relaymode.Embeddings:
+			err, usage = openai_compatible.EmbeddingHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+		case relaymode.Rerank:
+			if meta.ChannelType == channeltype.AliBailian {
+				err, usage = RerankHandler(c, resp, meta, alibailian.ParseRerankResponse)
+			} else {
+				err, usage = RerankHandler(c, resp, meta, ParseRerankResponse)
+			}
 		// case relaymode.ImagesEdits:
 		// err, usage = ImagesEditsHandler(c, resp)
 		case relaymode.ResponseAPI:
@@ -1,13 +1,16 @@
 package openai
 
 import (
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/ai360"
 	"github.com/songquanpeng/one-api/relay/adaptor/alibailian"
 	"github.com/songquanpeng/one-api/relay/adaptor/baichuan"
 	"github.com/songquanpeng/one-api/relay/adaptor/baiduv2"
+	"github.com/songquanpeng/one-api/relay/adaptor/deepseek"
 	"github.com/songquanpeng/one-api/relay/adaptor/doubao"
 	"github.com/songquanpeng/one-api/relay/adaptor/geminiOpenaiCompatible"
 	"github.com/songquanpeng/one-api/relay/adaptor/groq"
+	"github.com/songquanpeng/one-api/relay/adaptor/jina"
 	"github.com/songquanpeng/one-api/relay/adaptor/lingyiwanwu"
 	"github.com/songquanpeng/one-api/relay/adaptor/minimax"
 	"github.com/songquanpeng/one-api/relay/adaptor/mistral"
@@ -17,6 +20,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/siliconflow"
 	"github.com/songquanpeng/one-api/relay/adaptor/stepfun"
 	"github.com/songquanpeng/one-api/relay/adaptor/togetherai"
+	"github.com/songquanpeng/one-api/relay/adaptor/voyage"
 	"github.com/songquanpeng/one-api/relay/adaptor/xai"
 	"github.com/songquanpeng/one-api/relay/adaptor/xunfeiv2"
 	"github.com/songquanpeng/one-api/relay/channeltype"
@@ -40,6 +44,8 @@ var CompatibleChannels = []int{
 	channeltype.XAI,
 	channeltype.BaiduV2,
 	channeltype.XunfeiV2,
+	channeltype.Jina,
+	channeltype.Voyage,
 }
 
 func GetCompatibleChannelMeta(channelType int) (string, []string) {
@@ -85,7 +91,61 @@ func GetCompatibleChannelMeta(channelType int) (string, []string) {
 		return "alibailian", alibailian.ModelList
 	case channeltype.GeminiOpenAICompatible:
 		return "geminiv2", geminiOpenaiCompatible.ModelList
+	case channeltype.Jina:
+		return "jina", jina.ModelList
+	case channeltype.Voyage:
+		return "voyage", voyage.ModelList
 	default:
 		return "openai", ModelList
 	}
 }
+
+// GetCompatibleChannelPricing returns the default pricing of the models of an OpenAI-compatible channel type.
+func GetCompatibleChannelPricing(channelType int) map[string]adaptor.ModelConfig {
+	switch channelType {
+	case channeltype.AI360:
+		return ai360.ModelRatios
+	case channeltype.Moonshot:
+		return moonshot.ModelRatios
+	case channeltype.Baichuan:
+		return baichuan.ModelRatios
+	case channeltype.Minimax:
+		return minimax.ModelRatios
+	case channeltype.Mistral:
+		return mistral.ModelRatios
+	case channeltype.Groq:
+		return groq.ModelRatios
+	case channeltype.LingYiWanWu:
+		return lingyiwanwu.ModelRatios
+	case channeltype.StepFun:
+		return stepfun.ModelRatios
+	case channeltype.DeepSeek:
+		return deepseek.ModelRatios
+	case channeltype.TogetherAI:
+		return togetherai.ModelRatios
+	case channeltype.Doubao:
+		return doubao.ModelRatios
+	case channeltype.Novita:
+		return novita.ModelRatios
+	case channeltype.SiliconFlow:
+		return siliconflow.ModelRatios
+	case channeltype.XAI:
+		return xai.ModelRatios
+	case channeltype.BaiduV2:
+		return baiduv2.ModelRatios
+	case channeltype.XunfeiV2:
+		return xunfeiv2.ModelRatios
+	case channeltype.OpenRouter:
+		return openrouter.ModelRatios
+	case channeltype.AliBailian:
+		return alibailian.ModelRatios
+	case channeltype.GeminiOpenAICompatible:
+		return geminiOpenaiCompatible.ModelRatios
+	case channeltype.Jina:
+		return jina.ModelRatios
+	case channeltype.Voyage:
+		return voyage.ModelRatios
+	default:
+		return ModelRatios
+	}
+}
@@ -0,0 +1,31 @@
+package openai
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
+	"github.com/songquanpeng/one-api/relay/adaptor/voyage"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ConvertEmbeddingRequest keeps only the embeddings fields of the request, the
+// encoding_format is applied by the relay, see ApplyEmbeddingOptions.
+func ConvertEmbeddingRequest(channelType int, request model.GeneralOpenAIRequest) any {
+	if channelType == channeltype.Voyage {
+		return voyage.ConvertEmbeddingRequest(request)
+	}
+
+	return &model.GeneralOpenAIRequest{
+		Model:      request.Model,
+		Input:      request.Input,
+		Dimensions: request.Dimensions,
+		User:       request.User,
+	}
+}
+
+// ApplyEmbeddingOptions applies the dimensions and encoding_format of the client
+// request to an embeddings response converted from another vendor.
+func ApplyEmbeddingOptions(c *gin.Context, response *EmbeddingResponse) {
+	openai_compatible.ApplyEmbeddingOptions(c, response)
+}
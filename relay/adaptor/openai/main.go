@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"net/http"
 	"strings"
 
@@ -18,7 +17,6 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/render"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
-	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
@@ -301,40 +299,8 @@ func calculateTokenUsage(response *SlimTextResponse, promptTokens int, modelName
 			CompletionTokens: completionTokens,
 			TotalTokens:      promptTokens + completionTokens,
 		}
-	} else if hasAudioTokens(response) {
-		// Handle audio tokens conversion
-		calculateAudioTokens(response, modelName)
 	}
-}
-
-// Helper function to check if response has audio tokens
-func hasAudioTokens(response *SlimTextResponse) bool {
-	return (response.PromptTokensDetails != nil && response.PromptTokensDetails.AudioTokens > 0) ||
-		(response.CompletionTokensDetails != nil && response.CompletionTokensDetails.AudioTokens > 0)
-}
-
-// Helper function to calculate audio token usage
-func calculateAudioTokens(response *SlimTextResponse, modelName string) {
-	// Convert audio tokens for prompt
-	if response.PromptTokensDetails != nil {
-		response.Usage.PromptTokens = response.PromptTokensDetails.TextTokens +
-			int(math.Ceil(
-				float64(response.PromptTokensDetails.AudioTokens)*
-					ratio.GetAudioPromptRatio(modelName),
-			))
-	}
-
-	// Convert audio tokens for completion
-	if response.CompletionTokensDetails != nil {
-		response.Usage.CompletionTokens = response.CompletionTokensDetails.TextTokens +
-			int(math.Ceil(
-				float64(response.CompletionTokensDetails.AudioTokens)*
-					ratio.GetAudioPromptRatio(modelName)*ratio.GetAudioCompletionRatio(modelName),
-			))
-	}
-
-	// Calculate total tokens
-	response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
+	// audio tokens are weighted by their ratios when billing, see relay/controller.getBilledPrice
 }
 
 // ResponseAPIHandler processes non-streaming responses from Response API format and converts them back to ChatCompletion format
@@ -119,18 +119,9 @@ type TextResponse struct {
 	model.Usage `json:"usage"`
 }
 
-type EmbeddingResponseItem struct {
-	Object    string    `json:"object"`
-	Index     int       `json:"index"`
-	Embedding []float64 `json:"embedding"`
-}
+type EmbeddingResponseItem = model.EmbeddingResponseItem
 
-type EmbeddingResponse struct {
-	Object      string                  `json:"object"`
-	Data        []EmbeddingResponseItem `json:"data"`
-	Model       string                  `json:"model"`
-	model.Usage `json:"usage"`
-}
+type EmbeddingResponse = model.EmbeddingResponse
 
 // ImageData represents an image in the response
 type ImageData struct {
@@ -0,0 +1,129 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankRequest is the request of Jina-style rerankers, which most OpenAI-compatible
+// servers such as vLLM, Xinference, SiliconFlow and Baidu Qianfan accept.
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments bool     `json:"return_documents"`
+}
+
+// ConvertRerankRequest converts the canonical request, the documents are attached
+// to the results by the relay so the upstream does not need to return them.
+func ConvertRerankRequest(request model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model:     request.Model,
+		Query:     request.Query,
+		Documents: request.Documents,
+		TopN:      request.TopN,
+	}
+}
+
+type rerankResult struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	// Score is used by text-embeddings-inference and infinity
+	Score *float64 `json:"score"`
+}
+
+// rerankResponse covers the response schemas of Jina-style rerankers.
+type rerankResponse struct {
+	Id      string         `json:"id"`
+	Model   string         `json:"model"`
+	Results []rerankResult `json:"results"`
+	// Data is used by Voyage
+	Data  []rerankResult `json:"data"`
+	Usage *model.Usage   `json:"usage"`
+	Meta  *struct {
+		// Tokens is used by SiliconFlow
+		Tokens *struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"tokens"`
+	} `json:"meta"`
+}
+
+// ParseRerankResponse parses the response of a Jina-style reranker, a bare array
+// of results as returned by text-embeddings-inference is accepted as well.
+func ParseRerankResponse(body []byte) (*model.RerankResponse, error) {
+	var parsed rerankResponse
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &parsed.Results); err != nil {
+			return nil, errors.Wrap(err, "unmarshal rerank results")
+		}
+	} else if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, errors.Wrap(err, "unmarshal rerank response")
+	}
+
+	response := &model.RerankResponse{Id: parsed.Id, Model: parsed.Model}
+	for _, result := range append(parsed.Results, parsed.Data...) {
+		converted := model.RerankResult{Index: result.Index}
+		switch {
+		case result.RelevanceScore != nil:
+			converted.RelevanceScore = *result.RelevanceScore
+		case result.Score != nil:
+			converted.RelevanceScore = *result.Score
+		}
+		response.Results = append(response.Results, converted)
+	}
+
+	switch {
+	case parsed.Usage != nil && parsed.Usage.TotalTokens > 0:
+		response.Usage.PromptTokens = parsed.Usage.TotalTokens
+	case parsed.Usage != nil:
+		response.Usage.PromptTokens = parsed.Usage.PromptTokens
+	case parsed.Meta != nil && parsed.Meta.Tokens != nil:
+		response.Usage.PromptTokens = parsed.Meta.Tokens.InputTokens
+	}
+	response.Usage.TotalTokens = response.Usage.PromptTokens
+	return response, nil
+}
+
+// RerankHandler converts the upstream rerank response with parse and answers with the
+// canonical response. Upstreams that do not report usage are billed by meta.PromptTokens.
+func RerankHandler(c *gin.Context, resp *http.Response, meta *meta.Meta,
+	parse func(body []byte) (*model.RerankResponse, error)) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if err = resp.Body.Close(); err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	response, err := parse(responseBody)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if request, ok := c.Get(ctxkey.RerankRequest); ok {
+		if request, ok := request.(*model.RerankRequest); ok {
+			response.Results = request.Normalize(response.Results)
+		}
+	}
+	if response.Results == nil {
+		response.Results = []model.RerankResult{}
+	}
+	response.Model = meta.OriginModelName
+	if response.Usage.PromptTokens == 0 {
+		response.Usage.PromptTokens = meta.PromptTokens
+		response.Usage.TotalTokens = meta.PromptTokens
+	}
+
+	c.JSON(http.StatusOK, response)
+	return nil, &response.Usage
+}
@@ -284,6 +284,18 @@ func CountTokenInput(input any, model string) int {
 			text += s
 		}
 		return CountTokenText(text, model)
+	case []any:
+		// an array of strings, a token array, or an array of token arrays
+		tokens := 0
+		for _, item := range v {
+			switch item := item.(type) {
+			case float64, int:
+				tokens++
+			default:
+				tokens += CountTokenInput(item, model)
+			}
+		}
+		return tokens
 	}
 	return 0
 }
@@ -0,0 +1,75 @@
+package openai_compatible
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ApplyEmbeddingOptions applies the dimensions and encoding_format of the client request
+// stored in the context to the embeddings response.
+func ApplyEmbeddingOptions(c *gin.Context, response *model.EmbeddingResponse) {
+	options, ok := c.Get(ctxkey.EmbeddingOptions)
+	if !ok {
+		return
+	}
+	if options, ok := options.(model.EmbeddingOptions); ok {
+		response.ApplyOptions(options)
+	}
+}
+
+// EmbeddingHandler processes the embeddings responses of OpenAI-compatible APIs,
+// embeddings are accepted both as float arrays and as base64.
+func EmbeddingHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	logger := gmw.GetLogger(c)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	logger.Debug("receive embeddings from upstream channel", zap.Int("body_size", len(responseBody)))
+	if err = resp.Body.Close(); err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var embeddingResponse struct {
+		model.EmbeddingResponse
+		Error model.Error `json:"error"`
+	}
+	if err = json.Unmarshal(responseBody, &embeddingResponse); err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if embeddingResponse.Error.Type != "" || embeddingResponse.Error.Message != "" {
+		return &model.ErrorWithStatusCode{
+			Error:      embeddingResponse.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+
+	response := embeddingResponse.EmbeddingResponse
+	if response.Object == "" {
+		response.Object = "list"
+	}
+	if response.Model == "" {
+		response.Model = modelName
+	}
+	if response.PromptTokens == 0 {
+		response.PromptTokens = response.TotalTokens
+	}
+	if response.PromptTokens == 0 {
+		response.PromptTokens = promptTokens
+	}
+	response.CompletionTokens = 0
+	response.TotalTokens = response.PromptTokens
+	ApplyEmbeddingOptions(c, &response)
+
+	c.JSON(resp.StatusCode, response)
+	return nil, &response.Usage
+}
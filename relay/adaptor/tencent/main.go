@@ -77,6 +77,7 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 	requestModel := c.GetString(ctxkey.RequestModel)
 	fullTextResponse := embeddingResponseTencent2OpenAI(&tencentResponse)
 	fullTextResponse.Model = requestModel
+	openai.ApplyEmbeddingOptions(c, fullTextResponse)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
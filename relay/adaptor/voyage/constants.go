@@ -0,0 +1,26 @@
+package voyage
+
+import (
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+// ModelRatios contains all supported models and their pricing ratios
+// Model list is derived from the keys of this map, eliminating redundancy
+// Based on Voyage AI pricing: https://docs.voyageai.com/docs/pricing
+var ModelRatios = map[string]adaptor.ModelConfig{
+	// Reranker Models
+	"rerank-2.5":      {Ratio: 0.05 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"rerank-2.5-lite": {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"rerank-2":        {Ratio: 0.05 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"rerank-2-lite":   {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+
+	// Embedding Models
+	"voyage-3.5":      {Ratio: 0.06 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"voyage-3.5-lite": {Ratio: 0.02 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"voyage-3-large":  {Ratio: 0.18 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"voyage-code-3":   {Ratio: 0.18 * ratio.MilliTokensUsd, CompletionRatio: 1},
+}
+
+// ModelList derived from ModelRatios for backward compatibility
+var ModelList = adaptor.GetModelListFromPricing(ModelRatios)
@@ -0,0 +1,19 @@
+package voyage
+
+import "github.com/songquanpeng/one-api/relay/model"
+
+// EmbeddingRequest is the request of https://docs.voyageai.com/reference/embeddings-api
+type EmbeddingRequest struct {
+	Model           string `json:"model"`
+	Input           any    `json:"input"`
+	OutputDimension int    `json:"output_dimension,omitempty"`
+}
+
+// ConvertEmbeddingRequest converts the OpenAI request, Voyage names dimensions output_dimension.
+func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *EmbeddingRequest {
+	return &EmbeddingRequest{
+		Model:           request.Model,
+		Input:           request.Input,
+		OutputDimension: request.Dimensions,
+	}
+}
@@ -0,0 +1,21 @@
+package voyage
+
+import "github.com/songquanpeng/one-api/relay/model"
+
+// RerankRequest is the request of https://docs.voyageai.com/reference/reranker-api
+type RerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopK      int      `json:"top_k,omitempty"`
+}
+
+// ConvertRerankRequest converts the canonical request, Voyage names top_n top_k.
+func ConvertRerankRequest(request model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model:     request.Model,
+		Query:     request.Query,
+		Documents: request.Documents,
+		TopK:      request.TopN,
+	}
+}
@@ -84,6 +84,26 @@ func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQ
 	}
 }
 
+// UsageDetails carries the token breakdown of a request and the price rules applied to it,
+// both are recorded on the consume log.
+type UsageDetails struct {
+	// CachedTokens are the prompt tokens read from the provider's cache
+	CachedTokens int
+	// CacheWriteTokens are the prompt tokens written to the provider's cache
+	CacheWriteTokens int
+	// ReasoningTokens are the completion tokens spent on reasoning
+	ReasoningTokens int
+	// PromptAudioTokens and CompletionAudioTokens are billed at the audio ratios of the model
+	PromptAudioTokens     int
+	CompletionAudioTokens int
+	// ImageTokens are the prompt tokens of input images
+	ImageTokens int
+	// PriceBreakdown describes the tiers, windows and cache rates that changed the price
+	PriceBreakdown string
+	// PromptTemplate is the version of the prompt template rendered into the request
+	PromptTemplate string
+}
+
 // PostConsumeQuotaDetailed handles detailed billing for ChatCompletion and Response API requests
 // This function properly logs individual prompt and completion tokens with additional metadata
 // SAFETY: This function validates all inputs to prevent billing errors
@@ -91,7 +111,7 @@ func PostConsumeQuotaDetailed(ctx context.Context, tokenId int, quotaDelta int64
 	userId int, channelId int, promptTokens int, completionTokens int,
 	modelRatio float64, groupRatio float64, modelName string, tokenName string,
 	isStream bool, startTime time.Time, systemPromptReset bool,
-	completionRatio float64, toolsCost int64) {
+	completionRatio float64, toolsCost int64, details UsageDetails) {
 
 	// Record billing operation start time for monitoring
 	billingStartTime := time.Now()
@@ -151,18 +171,28 @@ func PostConsumeQuotaDetailed(ctx context.Context, tokenId int, quotaDelta int64
 	} else {
 		logContent = fmt.Sprintf("model rate %.2f, group rate %.2f, completion rate %.2f, tools cost %d", modelRatio, groupRatio, completionRatio, toolsCost)
 	}
+	if details.PriceBreakdown != "" {
+		logContent += ", " + details.PriceBreakdown
+	}
 	model.RecordConsumeLog(ctx, &model.Log{
-		UserId:            userId,
-		ChannelId:         channelId,
-		PromptTokens:      promptTokens,
-		CompletionTokens:  completionTokens,
-		ModelName:         modelName,
-		TokenName:         tokenName,
-		Quota:             int(totalQuota),
-		Content:           logContent,
-		IsStream:          isStream,
-		ElapsedTime:       helper.CalcElapsedTime(startTime),
-		SystemPromptReset: systemPromptReset,
+		UserId:                userId,
+		ChannelId:             channelId,
+		PromptTokens:          promptTokens,
+		CompletionTokens:      completionTokens,
+		ModelName:             modelName,
+		TokenName:             tokenName,
+		Quota:                 int(totalQuota),
+		Content:               logContent,
+		IsStream:              isStream,
+		ElapsedTime:           helper.CalcElapsedTime(startTime),
+		SystemPromptReset:     systemPromptReset,
+		CachedTokens:          details.CachedTokens,
+		CacheWriteTokens:      details.CacheWriteTokens,
+		ReasoningTokens:       details.ReasoningTokens,
+		PromptAudioTokens:     details.PromptAudioTokens,
+		CompletionAudioTokens: details.CompletionAudioTokens,
+		ImageTokens:           details.ImageTokens,
+		PromptTemplate:        details.PromptTemplate,
 	})
 
 	// Only update quotas when totalQuota > 0
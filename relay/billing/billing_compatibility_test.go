@@ -94,7 +94,7 @@ func TestInputValidation(t *testing.T) {
 			testFunc: func() bool {
 				defer func() { recover() }()
 				PostConsumeQuotaDetailed(ctx, 123, 10, 50, 1, 5, -10, 20, 1.0, 1.0, "test-model", "test-token",
-					false, validTime, false, 1.0, 0)
+					false, validTime, false, 1.0, 0, UsageDetails{})
 				return true
 			},
 			shouldFail:  true,
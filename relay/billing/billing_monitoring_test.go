@@ -82,6 +82,9 @@ func (m *MockMetricsRecorder) UpdateChannelMetrics(channelId int, channelName, c
 }
 func (m *MockMetricsRecorder) UpdateChannelRequestsInFlight(channelId int, channelName, channelType string, delta float64) {
 }
+func (m *MockMetricsRecorder) UpdateChannelQueueDepth(group, model string, depth int) {}
+func (m *MockMetricsRecorder) RecordChannelQueueWait(group, model string, wait time.Duration, served bool) {
+}
 func (m *MockMetricsRecorder) RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64) {
 }
 func (m *MockMetricsRecorder) RecordDBQuery(startTime time.Time, operation, table string, success bool) {
@@ -1,32 +1,34 @@
 package ratio
 
 import (
-	"encoding/json"
 	"sync"
 
 	"github.com/songquanpeng/one-api/common/logger"
 )
 
 var groupRatioLock sync.RWMutex
+
+// GroupRatio holds the effective ratio of every group, it is maintained by the
+// group cache in the model package and must not be modified directly.
 var GroupRatio = map[string]float64{
 	"default": 1,
 	"vip":     1,
 	"svip":    1,
 }
 
-func GroupRatio2JSONString() string {
-	jsonBytes, err := json.Marshal(GroupRatio)
-	if err != nil {
-		logger.Logger.Error("error marshalling model ratio: " + err.Error())
+// groupModelRatio overrides the group ratio for single models, group -> model -> ratio
+var groupModelRatio = map[string]map[string]float64{}
+
+// SetGroupRatios replaces all group ratios.
+func SetGroupRatios(ratios map[string]float64) {
+	newRatios := make(map[string]float64, len(ratios))
+	for name, ratio := range ratios {
+		newRatios[name] = ratio
 	}
-	return string(jsonBytes)
-}
 
-func UpdateGroupRatioByJSONString(jsonStr string) error {
 	groupRatioLock.Lock()
 	defer groupRatioLock.Unlock()
-	GroupRatio = make(map[string]float64)
-	return json.Unmarshal([]byte(jsonStr), &GroupRatio)
+	GroupRatio = newRatios
 }
 
 func GetGroupRatio(name string) float64 {
@@ -39,3 +41,30 @@ func GetGroupRatio(name string) float64 {
 	}
 	return ratio
 }
+
+// SetGroupModelRatios replaces all per group per model ratio overrides.
+func SetGroupModelRatios(ratios map[string]map[string]float64) {
+	newRatios := make(map[string]map[string]float64, len(ratios))
+	for group, models := range ratios {
+		newRatios[group] = make(map[string]float64, len(models))
+		for model, ratio := range models {
+			newRatios[group][model] = ratio
+		}
+	}
+
+	groupRatioLock.Lock()
+	defer groupRatioLock.Unlock()
+	groupModelRatio = newRatios
+}
+
+// GetGroupModelRatio returns the ratio of the group for the model,
+// falling back to the group ratio when the model has no override.
+func GetGroupModelRatio(group string, model string) float64 {
+	groupRatioLock.RLock()
+	ratio, ok := groupModelRatio[group][model]
+	groupRatioLock.RUnlock()
+	if ok {
+		return ratio
+	}
+	return GetGroupRatio(group)
+}
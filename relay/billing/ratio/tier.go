@@ -0,0 +1,253 @@
+package ratio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// Tier replaces the price of a model once the prompt exceeds InputTokenThreshold tokens,
+// e.g. Gemini 2.5 Pro charges more for prompts longer than 200k tokens.
+// The whole request is billed at the tier price, not only the tokens above the threshold.
+type Tier struct {
+	// InputTokenThreshold the tier applies when the prompt tokens are greater than it
+	InputTokenThreshold int `json:"input_token_threshold" yaml:"input_token_threshold"`
+	// Ratio replaces the model ratio, 0 keeps the base ratio
+	Ratio float64 `json:"ratio,omitempty" yaml:"ratio"`
+	// CompletionRatio replaces the completion ratio, 0 keeps the base completion ratio
+	CompletionRatio float64 `json:"completion_ratio,omitempty" yaml:"completion_ratio"`
+}
+
+// PriceWindow multiplies the price of a model during a time of day,
+// e.g. DeepSeek sells its models at a discount during off-peak hours.
+// A window whose End is before its Start crosses midnight.
+type PriceWindow struct {
+	// Start is the inclusive start of the window, formatted as HH:MM
+	Start string `json:"start" yaml:"start"`
+	// End is the exclusive end of the window, formatted as HH:MM
+	End string `json:"end" yaml:"end"`
+	// Timezone is an IANA timezone name such as Asia/Shanghai, empty means UTC
+	Timezone string `json:"timezone,omitempty" yaml:"timezone"`
+	// Weekdays restricts the window to some days (0 = Sunday) in its timezone,
+	// empty means every day. For windows crossing midnight the day the window starts is used.
+	Weekdays []time.Weekday `json:"weekdays,omitempty" yaml:"weekdays"`
+	// Multiplier is applied to the model ratio while the window is active
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+}
+
+// PriceRules bundles the rules that refine the base price of a model.
+type PriceRules struct {
+	Tiers   []Tier
+	Windows []PriceWindow
+	// CachedInputRatio is the price of prompt tokens read from cache / the input price, 0 means 1
+	CachedInputRatio float64
+	// CacheWriteRatio is the price of prompt tokens written to cache / the input price, 0 means 1
+	CacheWriteRatio float64
+}
+
+// parseClock parses HH:MM into minutes since midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q, expect HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *PriceWindow) location() (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load timezone %s", w.Timezone)
+	}
+	return loc, nil
+}
+
+// Validate checks the window is well formed.
+func (w *PriceWindow) Validate() error {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return errors.Errorf("window %s-%s is empty", w.Start, w.End)
+	}
+	if _, err = w.location(); err != nil {
+		return err
+	}
+	for _, day := range w.Weekdays {
+		if day < time.Sunday || day > time.Saturday {
+			return errors.Errorf("invalid weekday %d", day)
+		}
+	}
+	if w.Multiplier <= 0 {
+		return errors.Errorf("multiplier of window %s-%s must be positive", w.Start, w.End)
+	}
+	return nil
+}
+
+// Contains reports whether now falls into the window, malformed windows never match.
+func (w *PriceWindow) Contains(now time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	loc, err := w.location()
+	if err != nil {
+		return false
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	switch {
+	case start < end:
+		if minute < start || minute >= end {
+			return false
+		}
+	case minute >= start:
+		// crossing midnight, before midnight
+	case minute < end:
+		// crossing midnight, after midnight the window started the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the window for the consume log.
+func (w *PriceWindow) String() string {
+	tz := w.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("%s-%s %s", w.Start, w.End, tz)
+}
+
+// Validate checks the rules are well formed.
+func (r PriceRules) Validate() error {
+	if r.CachedInputRatio < 0 || r.CacheWriteRatio < 0 {
+		return errors.New("cache ratios must not be negative")
+	}
+	thresholds := make(map[int]bool, len(r.Tiers))
+	for _, tier := range r.Tiers {
+		if tier.InputTokenThreshold <= 0 {
+			return errors.Errorf("tier threshold must be positive, got %d", tier.InputTokenThreshold)
+		}
+		if thresholds[tier.InputTokenThreshold] {
+			return errors.Errorf("duplicated tier threshold %d", tier.InputTokenThreshold)
+		}
+		thresholds[tier.InputTokenThreshold] = true
+		if tier.Ratio < 0 || tier.CompletionRatio < 0 {
+			return errors.Errorf("tier above %d tokens has a negative ratio", tier.InputTokenThreshold)
+		}
+		if tier.Ratio == 0 && tier.CompletionRatio == 0 {
+			return errors.Errorf("tier above %d tokens changes nothing", tier.InputTokenThreshold)
+		}
+	}
+	for i := range r.Windows {
+		if err := r.Windows[i].Validate(); err != nil {
+			return errors.Wrapf(err, "window %d", i)
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether there are no rules at all.
+func (r PriceRules) IsEmpty() bool {
+	return len(r.Tiers) == 0 && len(r.Windows) == 0 && r.CachedInputRatio == 0 && r.CacheWriteRatio == 0
+}
+
+// GetCachedInputRatio returns the rate of prompt tokens read from cache relative to the input price.
+func (r PriceRules) GetCachedInputRatio() float64 {
+	if r.CachedInputRatio == 0 {
+		return 1
+	}
+	return r.CachedInputRatio
+}
+
+// GetCacheWriteRatio returns the rate of prompt tokens written to cache relative to the input price.
+func (r PriceRules) GetCacheWriteRatio() float64 {
+	if r.CacheWriteRatio == 0 {
+		return 1
+	}
+	return r.CacheWriteRatio
+}
+
+// WeightedPromptTokens returns the prompt tokens with cache reads and cache writes weighted by
+// their rates, cachedTokens and cacheWriteTokens are part of promptTokens.
+func (r PriceRules) WeightedPromptTokens(promptTokens int, cachedTokens int, cacheWriteTokens int) float64 {
+	uncached := promptTokens - cachedTokens - cacheWriteTokens
+	if uncached < 0 {
+		// providers reporting inconsistent numbers must not get a discount for it
+		return float64(promptTokens)
+	}
+	return float64(uncached) +
+		float64(cachedTokens)*r.GetCachedInputRatio() +
+		float64(cacheWriteTokens)*r.GetCacheWriteRatio()
+}
+
+// Apply adjusts the model and completion ratios for a request with promptTokens made at now.
+// The tier with the highest threshold below promptTokens wins, then the first active window
+// multiplies the model ratio. The returned breakdown describes the applied rules for the
+// consume log and is empty when no rule applied.
+func (r PriceRules) Apply(modelRatio float64, completionRatio float64, promptTokens int, now time.Time) (float64, float64, string) {
+	var parts []string
+
+	if len(r.Tiers) > 0 {
+		tiers := make([]Tier, len(r.Tiers))
+		copy(tiers, r.Tiers)
+		sort.Slice(tiers, func(i, j int) bool {
+			return tiers[i].InputTokenThreshold > tiers[j].InputTokenThreshold
+		})
+		for _, tier := range tiers {
+			if promptTokens <= tier.InputTokenThreshold {
+				continue
+			}
+			if tier.Ratio > 0 {
+				modelRatio = tier.Ratio
+			}
+			if tier.CompletionRatio > 0 {
+				completionRatio = tier.CompletionRatio
+			}
+			parts = append(parts, fmt.Sprintf("context tier >%d tokens (model rate %.2f, completion rate %.2f)",
+				tier.InputTokenThreshold, modelRatio, completionRatio))
+			break
+		}
+	}
+
+	for i := range r.Windows {
+		window := &r.Windows[i]
+		if !window.Contains(now) {
+			continue
+		}
+		modelRatio *= window.Multiplier
+		parts = append(parts, fmt.Sprintf("price window %s x%.2f", window, window.Multiplier))
+		break
+	}
+
+	return modelRatio, completionRatio, strings.Join(parts, ", ")
+}
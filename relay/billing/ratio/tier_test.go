@@ -0,0 +1,80 @@
+package ratio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceWindowContains(t *testing.T) {
+	offPeak := PriceWindow{Start: "16:30", End: "00:30", Multiplier: 0.5}
+	assert.True(t, offPeak.Contains(time.Date(2025, 1, 6, 16, 30, 0, 0, time.UTC)))
+	assert.True(t, offPeak.Contains(time.Date(2025, 1, 6, 0, 29, 0, 0, time.UTC)))
+	assert.False(t, offPeak.Contains(time.Date(2025, 1, 6, 0, 30, 0, 0, time.UTC)))
+	assert.False(t, offPeak.Contains(time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)))
+
+	// 09:00-18:00 in Shanghai is 01:00-10:00 UTC
+	office := PriceWindow{Start: "09:00", End: "18:00", Timezone: "Asia/Shanghai", Multiplier: 1.5}
+	assert.True(t, office.Contains(time.Date(2025, 1, 6, 1, 0, 0, 0, time.UTC)))
+	assert.False(t, office.Contains(time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)))
+
+	// after midnight a crossing window belongs to the day it started, 2025-01-06 is a Monday
+	weekend := PriceWindow{Start: "22:00", End: "02:00", Weekdays: []time.Weekday{time.Sunday}, Multiplier: 0.8}
+	assert.True(t, weekend.Contains(time.Date(2025, 1, 6, 1, 0, 0, 0, time.UTC)))
+	assert.False(t, weekend.Contains(time.Date(2025, 1, 6, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestPriceRulesValidate(t *testing.T) {
+	require.NoError(t, PriceRules{
+		Tiers:   []Tier{{InputTokenThreshold: 128000, Ratio: 2}},
+		Windows: []PriceWindow{{Start: "16:30", End: "00:30", Timezone: "Asia/Shanghai", Multiplier: 0.5}},
+	}.Validate())
+
+	for name, rules := range map[string]PriceRules{
+		"zero threshold":     {Tiers: []Tier{{Ratio: 1}}},
+		"duplicated tier":    {Tiers: []Tier{{InputTokenThreshold: 1, Ratio: 1}, {InputTokenThreshold: 1, Ratio: 2}}},
+		"empty tier":         {Tiers: []Tier{{InputTokenThreshold: 1}}},
+		"bad clock":          {Windows: []PriceWindow{{Start: "25:00", End: "01:00", Multiplier: 1}}},
+		"empty window":       {Windows: []PriceWindow{{Start: "01:00", End: "01:00", Multiplier: 1}}},
+		"unknown timezone":   {Windows: []PriceWindow{{Start: "01:00", End: "02:00", Timezone: "Mars/Base", Multiplier: 1}}},
+		"missing multiplier": {Windows: []PriceWindow{{Start: "01:00", End: "02:00"}}},
+	} {
+		assert.Error(t, rules.Validate(), name)
+	}
+}
+
+func TestPriceRulesApply(t *testing.T) {
+	rules := PriceRules{
+		Tiers: []Tier{
+			{InputTokenThreshold: 100, Ratio: 2},
+			{InputTokenThreshold: 1000, Ratio: 3, CompletionRatio: 6},
+		},
+		Windows: []PriceWindow{{Start: "16:30", End: "00:30", Multiplier: 0.5}},
+	}
+	peak := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	offPeak := time.Date(2025, 1, 6, 20, 0, 0, 0, time.UTC)
+
+	modelRatio, completionRatio, breakdown := rules.Apply(1, 4, 100, peak)
+	assert.Equal(t, 1.0, modelRatio)
+	assert.Equal(t, 4.0, completionRatio)
+	assert.Empty(t, breakdown)
+
+	modelRatio, completionRatio, _ = rules.Apply(1, 4, 101, peak)
+	assert.Equal(t, 2.0, modelRatio)
+	assert.Equal(t, 4.0, completionRatio)
+
+	modelRatio, completionRatio, breakdown = rules.Apply(1, 4, 5000, offPeak)
+	assert.Equal(t, 1.5, modelRatio)
+	assert.Equal(t, 6.0, completionRatio)
+	assert.Contains(t, breakdown, "context tier >1000 tokens")
+	assert.Contains(t, breakdown, "price window 16:30-00:30 UTC x0.50")
+}
+
+func TestWeightedPromptTokens(t *testing.T) {
+	rules := PriceRules{CachedInputRatio: 0.1, CacheWriteRatio: 1.25}
+	assert.InDelta(t, 100+80*0.1+20*1.25, rules.WeightedPromptTokens(200, 80, 20), 1e-9)
+	assert.InDelta(t, 200, PriceRules{}.WeightedPromptTokens(200, 80, 20), 1e-9, "unset cache ratios charge the full price")
+	assert.InDelta(t, 10, rules.WeightedPromptTokens(10, 80, 0), 1e-9, "inconsistent usage is charged in full")
+}
@@ -45,7 +45,7 @@ func TestZeroQuotaFix(t *testing.T) {
 		// Before the fix: this would skip logging entirely when totalQuota == 0
 		// After the fix: this will attempt to log (and may panic on DB operations, which is fine)
 		PostConsumeQuotaDetailed(ctx, 123, 10, 0, 1, 5, 10, 20, 1.0, 1.0, "test-model", "test-token",
-			false, validTime, false, 1.0, 0)
+			false, validTime, false, 1.0, 0, UsageDetails{})
 
 		t.Log("Function completed without database panic")
 	})
@@ -71,7 +71,7 @@ func TestZeroQuotaFix(t *testing.T) {
 		}()
 
 		PostConsumeQuotaDetailed(ctx, 123, 10, 100, 1, 5, 10, 20, 1.0, 1.0, "test-model", "test-token",
-			false, validTime, false, 1.0, 0)
+			false, validTime, false, 1.0, 0, UsageDetails{})
 		t.Log("Function completed")
 	})
 }
@@ -0,0 +1,305 @@
+// Package catalog describes the models the gateway can serve. The metadata is derived
+// from the pricing of the adaptors and refined by the overrides of the administrators.
+package catalog
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/pricing"
+)
+
+// Entry is the metadata of a model served by a channel type. ChannelType is 0 for
+// models that only exist in the overrides, e.g. the custom models of a channel.
+type Entry struct {
+	Model       string
+	ChannelType int
+	OwnedBy     string
+
+	ContextLength    int
+	MaxOutputTokens  int
+	InputModalities  []string
+	OutputModalities []string
+	// SupportsTools and SupportsVision are nil when unknown
+	SupportsTools  *bool
+	SupportsVision *bool
+	Description    string
+	Hidden         bool
+
+	ModelRatio      float64
+	CompletionRatio float64
+	// CachedInputRatio is the rate of cached prompt tokens / input rate, 0 means 1
+	CachedInputRatio float64
+}
+
+// Pricing is the price of a model in USD per 1M tokens.
+type Pricing struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input,omitempty"`
+}
+
+// Pricing returns the price of the model with the group ratio applied.
+func (e Entry) Pricing(groupRatio float64) Pricing {
+	input := USDPerMillionTokens(e.ModelRatio) * groupRatio
+	price := Pricing{
+		Input:  input,
+		Output: input * e.CompletionRatio,
+	}
+	if e.CachedInputRatio > 0 {
+		price.CachedInput = input * e.CachedInputRatio
+	}
+	return price
+}
+
+// USDPerMillionTokens converts a model ratio to USD per 1M tokens. Some adaptors
+// declare their ratios in USD per token, they are told apart by the magnitude.
+func USDPerMillionTokens(modelRatio float64) float64 {
+	if modelRatio < 0.001 {
+		return modelRatio * 1000000
+	}
+	return modelRatio * 1000000 / billingratio.QuotaPerUsd
+}
+
+type entryKey struct {
+	channelType int
+	model       string
+}
+
+// Catalog is an immutable snapshot of the model metadata.
+type Catalog struct {
+	entries map[entryKey]Entry
+	// byModel lists the entries of a model ordered by channel type
+	byModel map[string][]Entry
+}
+
+// Lookup returns the entry of the model on the channel type. When the channel type
+// does not declare the model, e.g. a custom model of an OpenAI-compatible channel,
+// the entry of the lowest channel type declaring the model is returned and native is false.
+func (c *Catalog) Lookup(channelType int, modelName string) (entry Entry, native bool, ok bool) {
+	if entry, ok = c.entries[entryKey{channelType, modelName}]; ok {
+		return entry, true, true
+	}
+	if entries := c.byModel[modelName]; len(entries) > 0 {
+		return entries[0], false, true
+	}
+	return Entry{}, false, false
+}
+
+// Models returns one entry per model name, the entry of the lowest channel type wins.
+func (c *Catalog) Models() []Entry {
+	models := make([]Entry, 0, len(c.byModel))
+	for _, entries := range c.byModel {
+		models = append(models, entries[0])
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Model < models[j].Model
+	})
+	return models
+}
+
+// Build merges the overrides into the seed entries. Overrides of channel type 0 apply
+// to the model on every channel type, overrides of a channel type are applied last.
+func Build(seed []Entry, overrides []*model.ModelCatalogOverride) *Catalog {
+	entries := make(map[entryKey]Entry, len(seed))
+	for _, entry := range seed {
+		entries[entryKey{entry.ChannelType, entry.Model}] = entry
+	}
+
+	sorted := make([]*model.ModelCatalogOverride, len(overrides))
+	copy(sorted, overrides)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ChannelType == 0 && sorted[j].ChannelType != 0
+	})
+	for _, override := range sorted {
+		applied := false
+		for key, entry := range entries {
+			if key.model != override.Model ||
+				(override.ChannelType != 0 && key.channelType != override.ChannelType) {
+				continue
+			}
+			entries[key] = applyOverride(entry, override)
+			applied = true
+		}
+		if !applied {
+			entry := Entry{
+				Model:            override.Model,
+				ChannelType:      override.ChannelType,
+				OwnedBy:          channeltype.IdToName(override.ChannelType),
+				InputModalities:  []string{"text"},
+				OutputModalities: []string{"text"},
+			}
+			if override.ChannelType == 0 {
+				entry.OwnedBy = "custom"
+			}
+			entries[entryKey{override.ChannelType, override.Model}] = applyOverride(entry, override)
+		}
+	}
+
+	catalog := &Catalog{entries: entries, byModel: make(map[string][]Entry)}
+	for _, entry := range entries {
+		catalog.byModel[entry.Model] = append(catalog.byModel[entry.Model], entry)
+	}
+	for _, modelEntries := range catalog.byModel {
+		sort.Slice(modelEntries, func(i, j int) bool {
+			return modelEntries[i].ChannelType < modelEntries[j].ChannelType
+		})
+	}
+	return catalog
+}
+
+func applyOverride(entry Entry, override *model.ModelCatalogOverride) Entry {
+	if override.ContextLength > 0 {
+		entry.ContextLength = override.ContextLength
+	}
+	if override.MaxOutputTokens > 0 {
+		entry.MaxOutputTokens = override.MaxOutputTokens
+	}
+	if override.InputModalities != "" {
+		entry.InputModalities = strings.Split(override.InputModalities, ",")
+	}
+	if override.OutputModalities != "" {
+		entry.OutputModalities = strings.Split(override.OutputModalities, ",")
+	}
+	if override.SupportsTools != nil {
+		entry.SupportsTools = override.SupportsTools
+	}
+	if override.SupportsVision != nil {
+		entry.SupportsVision = override.SupportsVision
+	}
+	if override.Description != "" {
+		entry.Description = override.Description
+	}
+	entry.Hidden = entry.Hidden || override.Hidden
+	return entry
+}
+
+var (
+	seedOnce    sync.Once
+	seedEntries []Entry
+)
+
+// Seed returns the entries derived from the adaptors of every channel type.
+func Seed() []Entry {
+	seedOnce.Do(func() {
+		seedEntries = buildSeed()
+	})
+	return seedEntries
+}
+
+func buildSeed() []Entry {
+	var entries []Entry
+	for channelType := 1; channelType < channeltype.Dummy; channelType++ {
+		apiType := channeltype.ToAPIType(channelType)
+		if apiType == apitype.AIProxyLibrary {
+			continue
+		}
+		adaptorImpl := relay.GetAdaptor(apiType)
+		if adaptorImpl == nil {
+			continue
+		}
+		adaptorImpl.Init(&meta.Meta{ChannelType: channelType})
+
+		ownedBy, modelNames := adaptorImpl.GetChannelName(), adaptorImpl.GetModelList()
+		modelConfigs := adaptorImpl.GetDefaultModelPricing()
+		if apiType == apitype.OpenAI {
+			ownedBy, modelNames = openai.GetCompatibleChannelMeta(channelType)
+			modelConfigs = openai.GetCompatibleChannelPricing(channelType)
+		}
+		modelNames = append([]string(nil), modelNames...)
+		sort.Strings(modelNames)
+
+		for _, modelName := range modelNames {
+			entries = append(entries, seedEntry(channelType, ownedBy, modelName, modelConfigs, adaptorImpl))
+		}
+	}
+	return entries
+}
+
+func seedEntry(channelType int, ownedBy string, modelName string,
+	modelConfigs map[string]adaptor.ModelConfig, adaptorImpl adaptor.Adaptor) Entry {
+	inputModalities, outputModalities := defaultModalities(modelName)
+	entry := Entry{
+		Model:            modelName,
+		ChannelType:      channelType,
+		OwnedBy:          ownedBy,
+		InputModalities:  inputModalities,
+		OutputModalities: outputModalities,
+	}
+
+	if modelConfig, ok := modelConfigs[modelName]; ok {
+		entry.ContextLength = int(modelConfig.MaxTokens)
+		entry.ModelRatio = modelConfig.Ratio
+		entry.CompletionRatio = modelConfig.CompletionRatio
+		entry.CachedInputRatio = modelConfig.CachedInputRatio
+		return entry
+	}
+	entry.ModelRatio = pricing.GetModelRatioWithThreeLayers(modelName, nil, adaptorImpl)
+	entry.CompletionRatio = pricing.GetCompletionRatioWithThreeLayers(modelName, nil, adaptorImpl)
+	return entry
+}
+
+// defaultModalities guesses the modalities of a model from its name,
+// administrators correct the guess with overrides.
+func defaultModalities(modelName string) (input []string, output []string) {
+	name := strings.ToLower(modelName)
+	switch {
+	case strings.Contains(name, "rerank"):
+		return []string{"text"}, []string{"rerank"}
+	case strings.Contains(name, "embed"):
+		return []string{"text"}, []string{"embedding"}
+	case strings.Contains(name, "whisper"), strings.Contains(name, "transcribe"):
+		return []string{"audio"}, []string{"text"}
+	case strings.HasPrefix(name, "tts"), strings.Contains(name, "-tts"):
+		return []string{"text"}, []string{"audio"}
+	case strings.Contains(name, "dall-e"), strings.Contains(name, "gpt-image"),
+		strings.Contains(name, "imagen"), strings.Contains(name, "flux"):
+		return []string{"text"}, []string{"image"}
+	default:
+		return []string{"text"}, []string{"text"}
+	}
+}
+
+var (
+	cacheLock sync.Mutex
+	cached    *Catalog
+	cachedAt  time.Time
+)
+
+// Get returns the catalog with the current overrides, it is rebuilt after
+// Invalidate and at least every SYNC_FREQUENCY seconds.
+func Get() (*Catalog, error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if cached != nil && time.Since(cachedAt) < time.Duration(config.SyncFrequency)*time.Second {
+		return cached, nil
+	}
+
+	overrides, err := model.GetModelCatalogOverrides()
+	if err != nil {
+		return nil, errors.Wrap(err, "load model catalog overrides")
+	}
+	cached = Build(Seed(), overrides)
+	cachedAt = time.Now()
+	return cached, nil
+}
+
+// Invalidate drops the cached catalog, e.g. after the overrides changed.
+func Invalidate() {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	cached = nil
+}
@@ -0,0 +1,75 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestBuildAppliesOverrides(t *testing.T) {
+	yes := true
+	seed := []Entry{
+		{Model: "gpt-4o", ChannelType: channeltype.OpenAI, OwnedBy: "openai", ContextLength: 128000},
+		{Model: "gpt-4o", ChannelType: channeltype.Azure, OwnedBy: "azure"},
+		{Model: "claude-3-5-sonnet", ChannelType: channeltype.Anthropic, OwnedBy: "anthropic"},
+	}
+	catalog := Build(seed, []*model.ModelCatalogOverride{
+		{Model: "gpt-4o", ChannelType: channeltype.Azure, Hidden: true},
+		{Model: "gpt-4o", MaxOutputTokens: 16384, InputModalities: "text,image", SupportsTools: &yes},
+		{Model: "my-finetune", ContextLength: 8192},
+	})
+
+	entry, native, ok := catalog.Lookup(channeltype.OpenAI, "gpt-4o")
+	require.True(t, ok)
+	assert.True(t, native)
+	assert.Equal(t, 128000, entry.ContextLength)
+	assert.Equal(t, 16384, entry.MaxOutputTokens)
+	assert.Equal(t, []string{"text", "image"}, entry.InputModalities)
+	assert.True(t, *entry.SupportsTools)
+	assert.False(t, entry.Hidden)
+
+	entry, _, ok = catalog.Lookup(channeltype.Azure, "gpt-4o")
+	require.True(t, ok)
+	assert.True(t, entry.Hidden)
+	assert.Equal(t, 16384, entry.MaxOutputTokens)
+
+	// a custom model of an OpenAI-compatible channel borrows the metadata of the declaring type
+	entry, native, ok = catalog.Lookup(channeltype.OpenAICompatible, "claude-3-5-sonnet")
+	require.True(t, ok)
+	assert.False(t, native)
+	assert.Equal(t, "anthropic", entry.OwnedBy)
+
+	entry, _, ok = catalog.Lookup(channeltype.OpenAICompatible, "my-finetune")
+	require.True(t, ok)
+	assert.Equal(t, "custom", entry.OwnedBy)
+	assert.Equal(t, 8192, entry.ContextLength)
+
+	_, _, ok = catalog.Lookup(channeltype.OpenAI, "unknown")
+	assert.False(t, ok)
+
+	models := catalog.Models()
+	require.Len(t, models, 3)
+	assert.Equal(t, "claude-3-5-sonnet", models[0].Model)
+	assert.Equal(t, channeltype.OpenAI, models[1].ChannelType)
+}
+
+func TestSeedAndPricing(t *testing.T) {
+	entries := Seed()
+	require.NotEmpty(t, entries)
+
+	var found bool
+	for _, entry := range entries {
+		if entry.ChannelType == channeltype.Cohere && entry.Model == "embed-v4.0" {
+			found = true
+			assert.Equal(t, "Cohere", entry.OwnedBy)
+			assert.Equal(t, []string{"embedding"}, entry.OutputModalities)
+			assert.InDelta(t, 0.12, entry.Pricing(1).Input, 1e-9)
+			assert.InDelta(t, 0.06, entry.Pricing(0.5).Input, 1e-9)
+		}
+	}
+	assert.True(t, found)
+}
@@ -161,6 +161,10 @@ func IdToName(channelType int) string {
 		return "openaicompatible"
 	case GeminiOpenAICompatible:
 		return "geminiopenaicompatible"
+	case Jina:
+		return "jina"
+	case Voyage:
+		return "voyage"
 	case Dummy:
 		return "dummy"
 	default:
@@ -54,6 +54,8 @@ var ChannelBaseURLs = []string{
 	"",                                          // 50
 
 	"https://generativelanguage.googleapis.com/v1beta/openai/", // 51
+	"https://api.jina.ai",      // 52
+	"https://api.voyageai.com", // 53
 }
 
 func init() {
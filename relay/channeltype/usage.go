@@ -0,0 +1,27 @@
+package channeltype
+
+// ReasoningInCompletionTokens tells whether the upstream of a channel type counts reasoning
+// tokens as part of completion_tokens. When it does not, the reasoning tokens reported in
+// completion_tokens_details are added to the completion tokens for billing.
+func ReasoningInCompletionTokens(channelType int) bool {
+	switch channelType {
+	case OpenAI, Azure, OpenAICompatible:
+		// completion_tokens includes completion_tokens_details.reasoning_tokens
+		return true
+	case DeepSeek:
+		// reasoning_content tokens are merged into completion_tokens
+		return true
+	case Anthropic, AwsClaude, VertextAI:
+		// thinking blocks are part of output_tokens
+		return true
+	case Gemini, GeminiOpenAICompatible:
+		// thoughtsTokenCount is added to the completion tokens by the adaptor
+		return true
+	case XAI:
+		// Grok reports reasoning_tokens outside of completion_tokens
+		return false
+	default:
+		// follow the OpenAI convention
+		return true
+	}
+}
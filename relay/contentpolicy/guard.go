@@ -0,0 +1,508 @@
+// Package contentpolicy is the input and output guard of the relay. It applies the
+// content policies of the caller's group and token to prompts before they are sent
+// upstream and to completions before they reach the caller, and records the matches
+// for review.
+package contentpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// ErrBlocked is wrapped by the errors of blocked requests and responses.
+var ErrBlocked = errors.New("content policy violation")
+
+// FinishReasonContentFilter is the finish reason of choices cut by a block rule, as used by OpenAI.
+const FinishReasonContentFilter = "content_filter"
+
+// Guard applies the content policies to a single request. A nil Guard applies nothing.
+type Guard struct {
+	rules     []*rule
+	userId    int
+	tokenId   int
+	group     string
+	model     string
+	requestId string
+
+	mu            sync.Mutex
+	recorded      map[string]bool
+	inputRedacted bool
+}
+
+// Attach returns the guard of the request, it is created on first use and kept in the
+// context so that retries neither record the same event twice nor lose the redactions.
+// It returns nil if no policy covers the caller.
+func Attach(c *gin.Context, relayMeta *meta.Meta) *Guard {
+	if guard := FromContext(c); guard != nil {
+		guard.mu.Lock()
+		guard.model = relayMeta.ActualModelName
+		guard.mu.Unlock()
+		return guard
+	}
+	guard := New(relayMeta.Group, relayMeta.TokenId, relayMeta.UserId, relayMeta.ActualModelName, c.GetString(ctxkey.RequestId))
+	if guard != nil {
+		c.Set(ctxkey.ContentGuard, guard)
+	}
+	return guard
+}
+
+// FromContext returns the guard attached to the request, or nil.
+func FromContext(c *gin.Context) *Guard {
+	if v, ok := c.Get(ctxkey.ContentGuard); ok {
+		return v.(*Guard)
+	}
+	return nil
+}
+
+// New returns a guard with the policies covering the group and token, or nil if there are none.
+func New(group string, tokenId int, userId int, modelName string, requestId string) *Guard {
+	policies := model.GetContentPolicies(group, tokenId)
+	if len(policies) == 0 {
+		return nil
+	}
+	guard := &Guard{
+		userId:    userId,
+		tokenId:   tokenId,
+		group:     group,
+		model:     modelName,
+		requestId: requestId,
+		recorded:  make(map[string]bool),
+	}
+	for _, policy := range policies {
+		guard.rules = append(guard.rules, getRule(policy))
+	}
+	return guard
+}
+
+// InputRedacted reports whether CheckRequest changed the request.
+func (g *Guard) InputRedacted() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.inputRedacted
+}
+
+// CheckRequest applies the input policies to the prompt of the request, redactions are
+// written into the request. The returned error wraps ErrBlocked if a policy blocks it.
+func (g *Guard) CheckRequest(ctx context.Context, request *relaymodel.GeneralOpenAIRequest) error {
+	return g.CheckTexts(ctx, func(fn func(string) string) {
+		forEachRequestText(request, fn)
+	})
+}
+
+// CheckClaudeRequest applies the input policies to the system prompt and the messages of
+// a Claude Messages request, redactions are written into the request.
+func (g *Guard) CheckClaudeRequest(ctx context.Context, request *relaymodel.ClaudeRequest) error {
+	return g.CheckTexts(ctx, func(fn func(string) string) {
+		if request.System != nil {
+			request.System = ForEachText(request.System, fn)
+		}
+		for i := range request.Messages {
+			request.Messages[i].Content = ForEachText(request.Messages[i].Content, fn)
+		}
+	})
+}
+
+// CheckTexts applies the input policies to the texts of a request that forEach visits,
+// forEach must replace every text with the result of fn. It is used for the request
+// formats of other packages, see ForEachText.
+func (g *Guard) CheckTexts(ctx context.Context, forEach func(fn func(string) string)) error {
+	if g == nil {
+		return nil
+	}
+	var texts []string
+	forEach(func(text string) string {
+		texts = append(texts, text)
+		return text
+	})
+	if err := g.moderate(ctx, model.ContentPolicyStageInput, strings.Join(texts, "\n"), true); err != nil {
+		return err
+	}
+
+	var blockErr error
+	redacted := false
+	forEach(func(text string) string {
+		if blockErr != nil {
+			return text
+		}
+		checked, err := g.applyPatterns(model.ContentPolicyStageInput, text, true)
+		if err != nil {
+			blockErr = err
+			return text
+		}
+		redacted = redacted || checked != text
+		return checked
+	})
+	if redacted {
+		g.mu.Lock()
+		g.inputRedacted = true
+		g.mu.Unlock()
+	}
+	return blockErr
+}
+
+// ReviewOutput checks the complete text of a streamed completion after it was sent.
+// It can only flag, it records the moderation results of the stream.
+func (g *Guard) ReviewOutput(ctx context.Context, text string) {
+	if g == nil || text == "" {
+		return
+	}
+	_, _ = g.applyPatterns(model.ContentPolicyStageOutput, text, false)
+	_ = g.moderate(ctx, model.ContentPolicyStageOutput, text, false)
+}
+
+// CheckResponseBody applies the output policies to a chat completion, completion, Claude
+// message or Response API response body. Blocked texts are emptied and the response is
+// marked as filtered in the way of its format. It returns the body unchanged if nothing
+// was redacted or blocked.
+func (g *Guard) CheckResponseBody(ctx context.Context, body []byte) (checked []byte, blocked bool) {
+	if g == nil {
+		return body, false
+	}
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body, false
+	}
+	switch {
+	case response["choices"] != nil:
+		return g.checkChoices(ctx, body)
+	case response["content"] != nil || response["output"] != nil:
+		return g.checkOutputTexts(ctx, body, response)
+	}
+	return body, false
+}
+
+// checkOutputTexts applies the output policies to the texts of a Claude message or
+// Response API response.
+func (g *Guard) checkOutputTexts(ctx context.Context, body []byte, response map[string]json.RawMessage) (checked []byte, blocked bool) {
+	var decoded map[string]any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return body, false
+	}
+	var texts []string
+	forEachOutputText(decoded, func(text string) string {
+		texts = append(texts, text)
+		return text
+	})
+	blocked = g.moderate(ctx, model.ContentPolicyStageOutput, strings.Join(texts, "\n"), true) != nil
+
+	changed := false
+	forEachOutputText(decoded, func(text string) string {
+		if blocked || text == "" {
+			return text
+		}
+		redacted, err := g.applyPatterns(model.ContentPolicyStageOutput, text, true)
+		if err != nil {
+			blocked = true
+			return text
+		}
+		changed = changed || redacted != text
+		return redacted
+	})
+	if blocked {
+		forEachOutputText(decoded, func(string) string { return "" })
+		markFiltered(decoded)
+		changed = true
+	}
+	if !changed {
+		return body, false
+	}
+	checked, err := json.Marshal(decoded)
+	if err != nil {
+		// never forward what a policy removed
+		return []byte(`{}`), blocked
+	}
+	return checked, blocked
+}
+
+// markFiltered marks a Claude message or Response API response as cut by a block rule.
+func markFiltered(response map[string]any) {
+	if response["object"] == "response" {
+		response["status"] = "incomplete"
+		response["incomplete_details"] = map[string]any{"reason": FinishReasonContentFilter}
+		return
+	}
+	response["stop_reason"] = "refusal"
+}
+
+// checkChoices applies the output policies to the choices of a chat completion or completion.
+func (g *Guard) checkChoices(ctx context.Context, payload []byte) (checked []byte, blocked bool) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &response); err != nil {
+		return payload, false
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(response["choices"], &choices); err != nil || len(choices) == 0 {
+		return payload, false
+	}
+
+	texts := make([]string, len(choices))
+	for i, choice := range choices {
+		texts[i] = choiceText(choice)
+	}
+	blocked = g.moderate(ctx, model.ContentPolicyStageOutput, strings.Join(texts, "\n"), true) != nil
+
+	changed := false
+	for i, text := range texts {
+		if blocked || text == "" {
+			continue
+		}
+		redacted, err := g.applyPatterns(model.ContentPolicyStageOutput, text, true)
+		if err != nil {
+			blocked = true
+			continue
+		}
+		if redacted != text {
+			setChoiceText(choices[i], redacted)
+			changed = true
+		}
+	}
+	if blocked {
+		for _, choice := range choices {
+			setChoiceText(choice, "")
+			choice["finish_reason"], _ = json.Marshal(FinishReasonContentFilter)
+		}
+		changed = true
+	}
+	if !changed {
+		return payload, false
+	}
+
+	response["choices"], _ = json.Marshal(choices)
+	checked, err := json.Marshal(response)
+	if err != nil {
+		// never forward what a policy removed
+		return []byte(`{"choices":[]}`), blocked
+	}
+	return checked, blocked
+}
+
+// choiceMessageFields are the fields holding the message of a choice, the content is in
+// message for chat completions and in delta for their stream events.
+var choiceMessageFields = []string{"message", "delta"}
+
+// choiceText returns the text of a chat completion or completion choice.
+func choiceText(choice map[string]json.RawMessage) string {
+	var text string
+	if raw, ok := choice["text"]; ok {
+		_ = json.Unmarshal(raw, &text)
+		return text
+	}
+	for _, field := range choiceMessageFields {
+		var message map[string]json.RawMessage
+		if err := json.Unmarshal(choice[field], &message); err == nil && message != nil {
+			_ = json.Unmarshal(message["content"], &text)
+			return text
+		}
+	}
+	return text
+}
+
+func setChoiceText(choice map[string]json.RawMessage, text string) {
+	encoded, _ := json.Marshal(text)
+	if _, ok := choice["text"]; ok {
+		choice["text"] = encoded
+		return
+	}
+	for _, field := range choiceMessageFields {
+		var message map[string]json.RawMessage
+		if err := json.Unmarshal(choice[field], &message); err != nil || message == nil {
+			continue
+		}
+		if _, ok := message["content"]; ok || text != "" {
+			message["content"] = encoded
+		}
+		choice[field], _ = json.Marshal(message)
+		return
+	}
+}
+
+// applyPatterns applies the regex, keyword and pii rules of the stage to the text.
+// With enforce false the matches are only recorded.
+func (g *Guard) applyPatterns(stage string, text string, enforce bool) (string, error) {
+	for _, r := range g.rules {
+		if r.policy.Type == model.ContentPolicyTypeModeration || !r.policy.AppliesTo(g.group, g.tokenId, stage) {
+			continue
+		}
+		spans := r.find(text)
+		if len(spans) == 0 {
+			continue
+		}
+		g.record(r, stage, enforce, r.excerpt(text, spans[0]))
+		if !enforce {
+			continue
+		}
+		switch r.policy.Action {
+		case model.ContentPolicyActionBlock:
+			return text, errors.Wrapf(ErrBlocked, "blocked by content policy %s", r.policy.Name)
+		case model.ContentPolicyActionRedact:
+			text = r.redact(text, spans)
+		}
+	}
+	return text, nil
+}
+
+// moderate asks the moderation rules of the stage about the text. Moderation failures
+// are logged and let the text pass, the guard must not take the relay down with it.
+func (g *Guard) moderate(ctx context.Context, stage string, text string, enforce bool) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	for _, r := range g.rules {
+		if r.policy.Type != model.ContentPolicyTypeModeration || !r.policy.AppliesTo(g.group, g.tokenId, stage) {
+			continue
+		}
+		flagged, categories, err := moderate(ctx, r.policy, text)
+		if err != nil {
+			logger.Logger.Warn("content moderation failed, letting the text pass",
+				zap.String("policy", r.policy.Name), zap.Error(err))
+			continue
+		}
+		if !flagged {
+			continue
+		}
+		g.record(r, stage, enforce, "moderation categories: "+strings.Join(categories, ", "))
+		if enforce && r.policy.Action == model.ContentPolicyActionBlock {
+			return errors.Wrapf(ErrBlocked, "blocked by content policy %s", r.policy.Name)
+		}
+	}
+	return nil
+}
+
+// record stores an event for the review of the match, once per policy and stage of the request.
+func (g *Guard) record(r *rule, stage string, enforced bool, excerpt string) {
+	key := stage + ":" + strconv.Itoa(r.policy.Id)
+	g.mu.Lock()
+	if g.recorded[key] {
+		g.mu.Unlock()
+		return
+	}
+	g.recorded[key] = true
+	modelName := g.model
+	g.mu.Unlock()
+
+	action := r.policy.Action
+	if !enforced {
+		// matches found after the text was sent can only be flagged
+		action = model.ContentPolicyActionFlag
+	}
+	event := &model.ContentPolicyEvent{
+		PolicyId:   r.policy.Id,
+		PolicyName: r.policy.Name,
+		Stage:      stage,
+		Action:     action,
+		UserId:     g.userId,
+		TokenId:    g.tokenId,
+		Group:      g.group,
+		Model:      modelName,
+		RequestId:  g.requestId,
+		Excerpt:    excerpt,
+	}
+	logger.Logger.Info("content policy matched",
+		zap.String("policy", r.policy.Name),
+		zap.String("stage", stage),
+		zap.String("action", action),
+		zap.Int("user_id", g.userId),
+		zap.String("request_id", g.requestId))
+	if err := event.Insert(); err != nil {
+		logger.Logger.Error("failed to record content policy event", zap.Error(err))
+	}
+}
+
+// ForEachText calls fn for the texts of a decoded JSON request value and replaces them
+// with the result: the value itself or the elements of an array if they are strings, and
+// the text and content fields of objects, descending into content arrays. Other fields,
+// e.g. tool arguments and images, are left alone.
+func ForEachText(value any, fn func(string) string) any {
+	return walkTexts(value, inputTextFields, fn)
+}
+
+var (
+	// inputTextFields are the fields holding the texts of Claude and Response API requests
+	inputTextFields = map[string]bool{"content": true}
+	// outputTextFields are the fields holding the texts of Claude and Response API responses
+	// and of their stream events
+	outputTextFields = map[string]bool{"content": true, "output": true, "part": true, "item": true, "response": true}
+)
+
+func forEachOutputText(value any, fn func(string) string) any {
+	return walkTexts(value, outputTextFields, fn)
+}
+
+func walkTexts(value any, fields map[string]bool, fn func(string) string) any {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case []any:
+		for i := range v {
+			v[i] = walkTexts(v[i], fields, fn)
+		}
+	case map[string]any:
+		if text, ok := v["text"].(string); ok {
+			v["text"] = fn(text)
+		}
+		for field := range fields {
+			if nested, ok := v[field]; ok && nested != nil {
+				v[field] = walkTexts(nested, fields, fn)
+			}
+		}
+	}
+	return value
+}
+
+// forEachRequestText calls fn for every text of the prompt and replaces the text with the result.
+func forEachRequestText(request *relaymodel.GeneralOpenAIRequest, fn func(string) string) {
+	for i := range request.Messages {
+		switch content := request.Messages[i].Content.(type) {
+		case string:
+			request.Messages[i].Content = fn(content)
+		case []any:
+			for _, part := range content {
+				if part, ok := part.(map[string]any); ok {
+					if text, ok := part["text"].(string); ok {
+						part["text"] = fn(text)
+					}
+				}
+			}
+		case []relaymodel.MessageContent:
+			for j := range content {
+				if content[j].Text != nil {
+					text := fn(*content[j].Text)
+					content[j].Text = &text
+				}
+			}
+		}
+	}
+	if request.Prompt != "" {
+		request.Prompt = fn(request.Prompt)
+	}
+	switch input := request.Input.(type) {
+	case string:
+		request.Input = fn(input)
+	case []any:
+		for i, item := range input {
+			if text, ok := item.(string); ok {
+				input[i] = fn(text)
+			}
+		}
+	case []string:
+		for i := range input {
+			input[i] = fn(input[i])
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package contentpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func setupPolicies(t *testing.T, policies ...*model.ContentPolicy) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.ContentPolicy{}, &model.ContentPolicyEvent{}))
+	originalDB := model.DB
+	model.DB = db
+	t.Cleanup(func() {
+		require.NoError(t, db.Where("1 = 1").Delete(&model.ContentPolicy{}).Error)
+		model.InitContentPolicyCache()
+		model.DB = originalDB
+	})
+	for _, policy := range policies {
+		policy.Enabled = true
+		require.NoError(t, policy.Insert())
+	}
+}
+
+func events(t *testing.T) []*model.ContentPolicyEvent {
+	events, _, err := model.GetContentPolicyEvents(0, 100, nil)
+	require.NoError(t, err)
+	return events
+}
+
+func TestCheckRequest(t *testing.T) {
+	setupPolicies(t,
+		&model.ContentPolicy{Name: "pii", Type: model.ContentPolicyTypePII, Pattern: "email,card,phone", Action: model.ContentPolicyActionRedact},
+		&model.ContentPolicy{Name: "secret", Type: model.ContentPolicyTypeKeyword, Pattern: "Project X\nproject-y", Action: model.ContentPolicyActionBlock, Group: "vip"},
+	)
+
+	request := &relaymodel.GeneralOpenAIRequest{Messages: []relaymodel.Message{
+		{Role: "user", Content: "mail me at jane.doe@example.com or call +1 (415) 555-0100"},
+		{Role: "user", Content: []any{map[string]any{"type": "text", "text": "my card is 4111 1111 1111 1111, order 20240101"}}},
+	}}
+	guard := New("default", 1, 7, "gpt-4o", "req-1")
+	require.NotNil(t, guard)
+	require.NoError(t, guard.CheckRequest(context.Background(), request))
+	assert.True(t, guard.InputRedacted())
+	assert.Equal(t, "mail me at [REDACTED:email] or call [REDACTED:phone]", request.Messages[0].Content)
+	assert.Equal(t, "my card is [REDACTED:card], order 20240101",
+		request.Messages[1].Content.([]any)[0].(map[string]any)["text"])
+
+	// a retry of the same request does not record the match again
+	require.NoError(t, guard.CheckRequest(context.Background(), &relaymodel.GeneralOpenAIRequest{Prompt: "a@b.io"}))
+	recorded := events(t)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, model.ContentPolicyActionRedact, recorded[0].Action)
+	assert.Equal(t, "mail me at [email] or call +1 (415) 555-0100", recorded[0].Excerpt)
+	assert.Equal(t, 7, recorded[0].UserId)
+
+	// the keyword rule only covers the vip group
+	err := New("vip", 1, 7, "gpt-4o", "req-2").CheckRequest(context.Background(),
+		&relaymodel.GeneralOpenAIRequest{Input: []any{"about PROJECT x"}})
+	assert.ErrorIs(t, err, ErrBlocked)
+	assert.Len(t, New("other", 1, 7, "gpt-4o", "req-3").rules, 1)
+}
+
+func TestModerationPolicy(t *testing.T) {
+	var gotRequest moderationRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/moderations", r.URL.Path)
+		assert.Equal(t, "Bearer sk-moderation", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&gotRequest))
+		flagged := gotRequest.Input == "bad answer"
+		_ = json.NewEncoder(w).Encode(map[string]any{"results": []any{map[string]any{
+			"flagged":    flagged,
+			"categories": map[string]bool{"violence": flagged, "hate": false},
+		}}})
+	}))
+	defer upstream.Close()
+	originalClient := client.ImpatientHTTPClient
+	client.ImpatientHTTPClient = http.DefaultClient
+	t.Cleanup(func() { client.ImpatientHTTPClient = originalClient })
+
+	setupPolicies(t)
+	baseURL := upstream.URL
+	require.NoError(t, model.DB.Create(&model.Channel{Id: 9, Name: "moderation", Key: "sk-moderation", BaseURL: &baseURL}).Error)
+	policy := &model.ContentPolicy{Name: "moderation", Type: model.ContentPolicyTypeModeration, ChannelId: 9,
+		Action: model.ContentPolicyActionBlock, Stage: model.ContentPolicyStageOutput, Enabled: true}
+	require.NoError(t, policy.Insert())
+	assert.Error(t, (&model.ContentPolicy{Name: "m", Type: model.ContentPolicyTypeModeration, ChannelId: 9,
+		Action: model.ContentPolicyActionRedact}).Insert())
+
+	guard := New("default", 1, 7, "gpt-4o", "req-1")
+	body := []byte(`{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"bad answer"},"finish_reason":"stop"}]}`)
+	checked, blocked := guard.CheckResponseBody(context.Background(), body)
+	assert.True(t, blocked)
+	assert.Equal(t, DefaultModerationModel, gotRequest.Model)
+	assert.JSONEq(t, `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"content_filter"}]}`, string(checked))
+
+	recorded := events(t)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "moderation categories: violence", recorded[0].Excerpt)
+
+	good := []byte(`{"choices":[{"index":0,"message":{"content":"good answer"}}]}`)
+	checked, blocked = guard.CheckResponseBody(context.Background(), good)
+	assert.False(t, blocked)
+	assert.Equal(t, good, checked)
+}
+
+func TestLuhn(t *testing.T) {
+	assert.True(t, luhnValid("4111111111111111"))
+	assert.False(t, luhnValid("4111111111111112"))
+}
+
+func TestCheckClaudeRequest(t *testing.T) {
+	setupPolicies(t,
+		&model.ContentPolicy{Name: "pii", Type: model.ContentPolicyTypePII, Pattern: "email", Action: model.ContentPolicyActionRedact},
+		&model.ContentPolicy{Name: "secret", Type: model.ContentPolicyTypeKeyword, Pattern: "Project X", Action: model.ContentPolicyActionBlock},
+	)
+	guard := New("default", 1, 7, "claude-sonnet-4-0", "req-1")
+
+	request := &relaymodel.ClaudeRequest{
+		System: "reply to jane.doe@example.com",
+		Messages: []relaymodel.ClaudeMessage{
+			{Role: "user", Content: []any{map[string]any{"type": "text", "text": "cc a@b.io"}}},
+		},
+	}
+	require.NoError(t, guard.CheckClaudeRequest(context.Background(), request))
+	assert.True(t, guard.InputRedacted())
+	assert.Equal(t, "reply to [REDACTED:email]", request.System)
+	assert.Equal(t, "cc [REDACTED:email]", request.Messages[0].Content.([]any)[0].(map[string]any)["text"])
+
+	err := guard.CheckClaudeRequest(context.Background(), &relaymodel.ClaudeRequest{
+		Messages: []relaymodel.ClaudeMessage{{Role: "user", Content: "about project x"}},
+	})
+	assert.ErrorIs(t, err, ErrBlocked)
+}
+
+func TestCheckResponseBody_ClaudeAndResponseAPI(t *testing.T) {
+	setupPolicies(t,
+		&model.ContentPolicy{Name: "digits", Type: model.ContentPolicyTypeRegex, Pattern: `\d{4}`, Action: model.ContentPolicyActionRedact, Stage: model.ContentPolicyStageOutput},
+		&model.ContentPolicy{Name: "forbidden", Type: model.ContentPolicyTypeKeyword, Pattern: "forbidden", Action: model.ContentPolicyActionBlock, Stage: model.ContentPolicyStageOutput},
+	)
+	guard := New("default", 1, 7, "claude-sonnet-4-0", "req-1")
+
+	checked, blocked := guard.CheckResponseBody(context.Background(),
+		[]byte(`{"type":"message","content":[{"type":"text","text":"pin 1234"}],"stop_reason":"end_turn"}`))
+	assert.False(t, blocked)
+	assert.JSONEq(t, `{"type":"message","content":[{"type":"text","text":"pin [REDACTED]"}],"stop_reason":"end_turn"}`, string(checked))
+
+	checked, blocked = guard.CheckResponseBody(context.Background(),
+		[]byte(`{"type":"message","content":[{"type":"text","text":"a forbidden word"}],"stop_reason":"end_turn"}`))
+	assert.True(t, blocked)
+	assert.JSONEq(t, `{"type":"message","content":[{"type":"text","text":""}],"stop_reason":"refusal"}`, string(checked))
+
+	checked, blocked = guard.CheckResponseBody(context.Background(),
+		[]byte(`{"object":"response","status":"completed","output":[{"type":"message","content":[{"type":"output_text","text":"a forbidden word"}]}]}`))
+	assert.True(t, blocked)
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(checked, &response))
+	assert.Equal(t, "incomplete", response["status"])
+	assert.Equal(t, map[string]any{"reason": FinishReasonContentFilter}, response["incomplete_details"])
+	assert.NotContains(t, string(checked), "forbidden")
+}
@@ -0,0 +1,93 @@
+package contentpolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// DefaultModerationModel is used by moderation rules without a model.
+const DefaultModerationModel = "omni-moderation-latest"
+
+type moderationRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// moderate asks the OpenAI compatible moderation endpoint of the channel of the policy
+// whether the text is flagged, and returns the flagged categories.
+func moderate(ctx context.Context, policy *model.ContentPolicy, text string) (flagged bool, categories []string, err error) {
+	channel, err := model.GetChannelById(policy.ChannelId, true)
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "get moderation channel %d", policy.ChannelId)
+	}
+	baseURL := strings.TrimSuffix(channel.GetBaseURL(), "/")
+	if baseURL == "" && channel.Type >= 0 && channel.Type < len(channeltype.ChannelBaseURLs) {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	url := baseURL + "/v1/moderations"
+	if strings.HasSuffix(baseURL, "/v1") {
+		url = baseURL + "/moderations"
+	}
+
+	modelName := policy.Pattern
+	if modelName == "" {
+		modelName = DefaultModerationModel
+	}
+	body, err := json.Marshal(moderationRequest{Model: modelName, Input: text})
+	if err != nil {
+		return false, nil, errors.Wrap(err, "marshal moderation request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, nil, errors.Wrap(err, "new moderation request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+channel.Key)
+
+	resp, err := client.ImpatientHTTPClient.Do(req)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "do moderation request")
+	}
+	defer resp.Body.Close()
+
+	var result moderationResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, nil, errors.Wrapf(err, "decode moderation response, status %d", resp.StatusCode)
+	}
+	if result.Error != nil {
+		return false, nil, errors.Errorf("moderation failed with status %d: %s", resp.StatusCode, result.Error.Message)
+	}
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		flagged = true
+		for category, hit := range r.Categories {
+			if hit {
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return flagged, categories, nil
+}
@@ -0,0 +1,446 @@
+package contentpolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+const (
+	outputUndecided = iota
+	outputPassthrough
+	outputBody
+	outputStream
+)
+
+// outputWriter applies the output policies to what an adaptor writes to the caller, so
+// that every adaptor is covered whatever format it converted the upstream response to.
+// JSON bodies are held until the response is complete, server-sent events are checked
+// event by event with the end of each streamed text held back, see streamHoldBack.
+type outputWriter struct {
+	gin.ResponseWriter
+	guard *Guard
+	ctx   context.Context
+
+	mode    int
+	body    bytes.Buffer
+	events  []byte
+	blocked bool
+	// texts are the texts being streamed by delta events, by choice or content block
+	texts     map[string]*streamText
+	textOrder []string
+	// streamed is the text received in stream events, it is reviewed once the stream ended
+	streamed strings.Builder
+}
+
+// streamHoldBack is how many bytes of each streamed text are held back until the text
+// that follows them is known, so that block and redact rules also catch the matches
+// spanning stream events.
+const streamHoldBack = 256
+
+// streamText is a text streamed by a sequence of delta events.
+type streamText struct {
+	// pending is the text received but not sent yet
+	pending string
+	// render returns a delta event carrying text, modeled on the last delta of the text
+	render func(text string) string
+	// block returns the events ending the stream when the text is blocked
+	block func() string
+}
+
+// GuardOutput routes what is written to the caller through the output policies of the
+// guard of the request. The returned func must be called once the response is written,
+// it writes what was held back and restores the writer. Without a guard nothing changes.
+func GuardOutput(c *gin.Context) (finish func()) {
+	guard := FromContext(c)
+	if guard == nil {
+		return func() {}
+	}
+	original := c.Writer
+	writer := &outputWriter{ResponseWriter: original, guard: guard, ctx: c.Request.Context()}
+	c.Writer = writer
+	return func() {
+		writer.finish()
+		c.Writer = original
+	}
+}
+
+func (w *outputWriter) decide() {
+	if w.mode != outputUndecided {
+		return
+	}
+	contentType := w.Header().Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "text/event-stream"):
+		w.mode = outputStream
+	case strings.Contains(contentType, "json"):
+		w.mode = outputBody
+	default:
+		w.mode = outputPassthrough
+	}
+}
+
+func (w *outputWriter) Write(data []byte) (int, error) {
+	w.decide()
+	switch w.mode {
+	case outputBody:
+		return w.body.Write(data)
+	case outputStream:
+		w.events = append(w.events, data...)
+		w.writeEvents(false)
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *outputWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush only flushes what was checked, held bodies are written by finish.
+func (w *outputWriter) Flush() {
+	if w.mode != outputBody {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *outputWriter) finish() {
+	switch w.mode {
+	case outputBody:
+		body, _ := w.guard.CheckResponseBody(w.ctx, w.body.Bytes())
+		w.Header().Del("Content-Length")
+		_, _ = w.ResponseWriter.Write(body)
+	case outputStream:
+		w.writeEvents(true)
+		if !w.blocked {
+			// the stream ended without a finish event, send what is held back
+			_, _ = w.ResponseWriter.Write([]byte(w.flushTexts()))
+		}
+		w.ResponseWriter.Flush()
+		// moderation rules are only asked about the complete text
+		w.guard.ReviewOutput(w.ctx, w.streamed.String())
+	}
+}
+
+// writeEvents checks and writes the complete events received so far, or all of them at the end.
+func (w *outputWriter) writeEvents(final bool) {
+	for {
+		idx := bytes.Index(w.events, []byte("\n\n"))
+		if idx < 0 {
+			if !final || len(bytes.TrimSpace(w.events)) == 0 {
+				return
+			}
+			idx = len(w.events)
+			w.events = append(w.events, '\n', '\n')
+		}
+		event := string(w.events[:idx])
+		w.events = w.events[idx+2:]
+		if w.blocked {
+			// nothing is sent after a block
+			continue
+		}
+		_, _ = w.ResponseWriter.Write([]byte(w.checkEvent(event)))
+	}
+}
+
+// checkEvent applies the output policies to a server-sent event and returns the events
+// to send in its place: the texts it finishes are flushed before it, the deltas it
+// carries are held back in part.
+func (w *outputWriter) checkEvent(event string) string {
+	payload, ok := eventData(event)
+	if !ok {
+		return event + "\n\n"
+	}
+	if payload == "[DONE]" {
+		return w.flushTexts() + w.unlessBlocked(event)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+		return event + "\n\n"
+	}
+	if choices, ok := decoded["choices"].([]any); ok {
+		return w.checkChoicesEvent(event, decoded, choices)
+	}
+
+	switch decoded["type"] {
+	case "content_block_delta":
+		if delta, ok := decoded["delta"].(map[string]any); ok {
+			if text, ok := delta["text"].(string); ok {
+				return w.checkDeltaEvent(fmt.Sprintf("block:%v", decoded["index"]), text, event, decoded,
+					func(text string) { delta["text"] = text })
+			}
+		}
+	case "response.output_text.delta":
+		if text, ok := decoded["delta"].(string); ok {
+			key := fmt.Sprintf("output:%v:%v", decoded["output_index"], decoded["content_index"])
+			return w.checkDeltaEvent(key, text, event, decoded,
+				func(text string) { decoded["delta"] = text })
+		}
+	}
+
+	// any other event ends the texts streamed so far, events repeating the complete
+	// texts, e.g. response.output_text.done, are checked as they are
+	flushed := w.flushTexts()
+	if w.blocked {
+		return flushed
+	}
+	var err error
+	changed := false
+	forEachOutputText(decoded, func(text string) string {
+		if err != nil || text == "" {
+			return text
+		}
+		var redacted string
+		redacted, err = w.guard.applyPatterns(model.ContentPolicyStageOutput, text, true)
+		changed = changed || redacted != text
+		return redacted
+	})
+	if err != nil {
+		w.blocked = true
+		return flushed + blockedStreamEvents(decoded["type"])
+	}
+	if changed {
+		return flushed + renderEvent(event, decoded)
+	}
+	return flushed + event + "\n\n"
+}
+
+// checkDeltaEvent holds back the end of the text a Claude or Response API delta event adds
+// to the text of key, and sends the rest with the event.
+func (w *outputWriter) checkDeltaEvent(key string, text string, event string, decoded map[string]any, setText func(string)) string {
+	eventType := decoded["type"]
+	st := w.streamText(key)
+	st.render = func(text string) string {
+		setText(text)
+		return renderEvent(event, decoded)
+	}
+	st.block = func() string {
+		return blockedStreamEvents(eventType)
+	}
+	released, blocked := w.release(st, text, false)
+	if blocked {
+		return st.block()
+	}
+	return st.render(released)
+}
+
+// checkChoicesEvent holds back the end of the texts a chat completion or completion stream
+// event adds to its choices, the texts of the choices it finishes are sent completely.
+func (w *outputWriter) checkChoicesEvent(event string, decoded map[string]any, choices []any) string {
+	if len(choices) == 0 {
+		// e.g. the usage of the stream, sent after the last choice event
+		flushed := w.flushTexts()
+		return flushed + w.unlessBlocked(event)
+	}
+	changed := false
+	for _, item := range choices {
+		choice, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		text, hasText := streamChoiceText(choice)
+		finished := choice["finish_reason"] != nil && choice["finish_reason"] != ""
+		if !hasText && !finished {
+			continue
+		}
+		st := w.streamText(fmt.Sprintf("choice:%v", choice["index"]))
+		if hasText {
+			template := maps.Clone(decoded)
+			templateChoice := maps.Clone(choice)
+			template["choices"] = []any{templateChoice}
+			delete(templateChoice, "finish_reason")
+			st.render = func(text string) string {
+				setStreamChoiceText(templateChoice, text)
+				return renderEvent(event, template)
+			}
+			st.block = func() string {
+				setStreamChoiceText(templateChoice, "")
+				templateChoice["finish_reason"] = FinishReasonContentFilter
+				return renderEvent(event, template) + "data: [DONE]\n\n"
+			}
+		}
+		released, blocked := w.release(st, text, finished)
+		if blocked {
+			if st.block == nil {
+				return blockedStreamEvents(nil)
+			}
+			return st.block()
+		}
+		if released != text {
+			setStreamChoiceText(choice, released)
+			changed = true
+		}
+	}
+	if !changed {
+		return event + "\n\n"
+	}
+	return renderEvent(event, decoded)
+}
+
+// streamText returns the text streamed under key, it is added on first use.
+func (w *outputWriter) streamText(key string) *streamText {
+	if w.texts == nil {
+		w.texts = make(map[string]*streamText)
+	}
+	st, ok := w.texts[key]
+	if !ok {
+		st = &streamText{}
+		w.texts[key] = st
+		w.textOrder = append(w.textOrder, key)
+	}
+	return st
+}
+
+// release adds delta to the pending text and returns the redacted part of it that can be
+// sent, all of it if final. It reports whether a block rule matched.
+func (w *outputWriter) release(st *streamText, delta string, final bool) (string, bool) {
+	w.streamed.WriteString(delta)
+	st.pending += delta
+	cut := w.guard.streamCut(st.pending, final)
+	if cut == 0 {
+		return "", false
+	}
+	released, err := w.guard.applyPatterns(model.ContentPolicyStageOutput, st.pending[:cut], true)
+	st.pending = st.pending[cut:]
+	if err != nil {
+		w.blocked = true
+		return "", true
+	}
+	return released, false
+}
+
+// flushTexts returns the delta events sending the texts held back, or the events ending
+// the stream if one of them is blocked.
+func (w *outputWriter) flushTexts() string {
+	var b strings.Builder
+	for _, key := range w.textOrder {
+		st := w.texts[key]
+		if st.pending == "" || st.render == nil {
+			continue
+		}
+		released, blocked := w.release(st, "", true)
+		if blocked {
+			return st.block()
+		}
+		b.WriteString(st.render(released))
+	}
+	return b.String()
+}
+
+func (w *outputWriter) unlessBlocked(event string) string {
+	if w.blocked {
+		return ""
+	}
+	return event + "\n\n"
+}
+
+// streamCut returns how much of the pending text of a stream can be checked and sent:
+// all of it at the end of the text, otherwise all but the last streamHoldBack bytes,
+// cut before any match crossing the cut so that it is checked as a whole.
+func (g *Guard) streamCut(text string, final bool) int {
+	if final {
+		return len(text)
+	}
+	cut := len(text) - streamHoldBack
+	if cut <= 0 {
+		return 0
+	}
+	var spans []span
+	for _, r := range g.rules {
+		if r.policy.Type == model.ContentPolicyTypeModeration || !r.policy.AppliesTo(g.group, g.tokenId, model.ContentPolicyStageOutput) {
+			continue
+		}
+		spans = append(spans, r.find(text)...)
+	}
+	for moved := true; moved; {
+		moved = false
+		for _, s := range spans {
+			if s.start < cut && s.end >= cut {
+				cut = s.start
+				moved = true
+			}
+		}
+	}
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return cut
+}
+
+// eventData returns the payload of the data line of a server-sent event.
+func eventData(event string) (string, bool) {
+	for _, line := range strings.Split(event, "\n") {
+		if strings.HasPrefix(line, "data:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "data:")), true
+		}
+	}
+	return "", false
+}
+
+// renderEvent returns event with its data replaced by the encoded payload.
+func renderEvent(event string, payload map[string]any) string {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		// never forward what a policy removed
+		encoded = []byte(`{}`)
+	}
+	lines := strings.Split(event, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "data:") {
+			lines[i] = "data: " + string(encoded)
+			break
+		}
+	}
+	return strings.Join(lines, "\n") + "\n\n"
+}
+
+// blockedStreamEvents returns the error event ending a Claude or Response API stream cut
+// by a block rule.
+func blockedStreamEvents(eventType any) string {
+	message := "the output was blocked by a content policy"
+	var payload map[string]any
+	if eventType, _ := eventType.(string); strings.HasPrefix(eventType, "response.") {
+		payload = map[string]any{"type": "error", "code": "content_policy_violation", "message": message}
+	} else {
+		payload = map[string]any{"type": "error", "error": map[string]any{"type": "content_policy_violation", "message": message}}
+	}
+	encoded, _ := json.Marshal(payload)
+	return "event: error\ndata: " + string(encoded) + "\n\n"
+}
+
+// streamChoiceText returns the text of a choice of a chat completion or completion stream event.
+func streamChoiceText(choice map[string]any) (string, bool) {
+	if text, ok := choice["text"].(string); ok {
+		return text, true
+	}
+	if delta, ok := choice["delta"].(map[string]any); ok {
+		if content, ok := delta["content"].(string); ok {
+			return content, true
+		}
+	}
+	return "", false
+}
+
+func setStreamChoiceText(choice map[string]any, text string) {
+	if _, ok := choice["text"]; ok {
+		choice["text"] = text
+		return
+	}
+	delta, ok := choice["delta"].(map[string]any)
+	if !ok {
+		delta = make(map[string]any)
+		choice["delta"] = delta
+	} else {
+		delta = maps.Clone(delta)
+		choice["delta"] = delta
+	}
+	delta["content"] = text
+}
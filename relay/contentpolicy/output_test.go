@@ -0,0 +1,160 @@
+package contentpolicy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func setupOutputPolicies(t *testing.T) {
+	setupPolicies(t,
+		&model.ContentPolicy{Name: "digits", Type: model.ContentPolicyTypeRegex, Pattern: `\d{4}`, Action: model.ContentPolicyActionRedact, Stage: model.ContentPolicyStageOutput},
+		&model.ContentPolicy{Name: "forbidden", Type: model.ContentPolicyTypeKeyword, Pattern: "forbidden", Action: model.ContentPolicyActionBlock, Stage: model.ContentPolicyStageBoth},
+	)
+}
+
+func guardedContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	guard := New("default", 1, 7, "gpt-4o", "req-1")
+	require.NotNil(t, guard)
+	c.Set(ctxkey.ContentGuard, guard)
+	return c, recorder
+}
+
+// stream writes the events through the guarded writer and returns what the caller received.
+func stream(t *testing.T, events ...string) string {
+	c, recorder := guardedContext(t)
+	finish := GuardOutput(c)
+	c.Header("Content-Type", "text/event-stream")
+	for _, event := range events {
+		_, err := c.Writer.WriteString(event + "\n\n")
+		require.NoError(t, err)
+	}
+	finish()
+	return recorder.Body.String()
+}
+
+// streamedText returns the texts of the chat completion stream events in output.
+func streamedText(t *testing.T, output string) string {
+	var b strings.Builder
+	for _, event := range strings.Split(output, "\n\n") {
+		payload, ok := eventData(event)
+		if !ok || payload == "[DONE]" {
+			continue
+		}
+		var decoded struct {
+			Choices []struct {
+				Text  string `json:"text"`
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+		for _, choice := range decoded.Choices {
+			b.WriteString(choice.Text + choice.Delta.Content)
+		}
+	}
+	return b.String()
+}
+
+func TestGuardOutput_Body(t *testing.T) {
+	setupOutputPolicies(t)
+
+	// a converted JSON body is held and checked as a whole
+	c, recorder := guardedContext(t)
+	finish := GuardOutput(c)
+	c.JSON(http.StatusOK, map[string]any{"type": "message", "content": []any{map[string]any{"type": "text", "text": "pin 1234"}}})
+	assert.Empty(t, recorder.Body.String())
+	finish()
+	assert.JSONEq(t, `{"type":"message","content":[{"type":"text","text":"pin [REDACTED]"}]}`, recorder.Body.String())
+
+	// other responses pass through
+	c, recorder = guardedContext(t)
+	finish = GuardOutput(c)
+	c.Data(http.StatusOK, "audio/mpeg", []byte("1234"))
+	finish()
+	assert.Equal(t, "1234", recorder.Body.String())
+}
+
+func TestGuardOutput_ChatCompletionStream(t *testing.T) {
+	setupOutputPolicies(t)
+
+	// matches spanning chunks are redacted before they are sent
+	output := stream(t,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"pin 12"}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"34, bye"}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	)
+	assert.Equal(t, "pin [REDACTED], bye", streamedText(t, output))
+	assert.NotContains(t, output, "12")
+	assert.Contains(t, output, `"finish_reason":"stop"`)
+	assert.True(t, strings.HasSuffix(output, "data: [DONE]\n\n"))
+	// events without text pass unchanged
+	assert.True(t, strings.HasPrefix(output, `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant"}}]}`+"\n\n"))
+
+	// the text before the hold back window is sent as it streams
+	long := strings.Repeat("a", streamHoldBack+10)
+	output = stream(t, `data: {"choices":[{"index":0,"text":"`+long+`"}]}`)
+	assert.Equal(t, long, streamedText(t, output))
+	assert.Equal(t, 2, strings.Count(output, "data: "))
+
+	// a block rule spanning chunks ends the stream with content_filter
+	output = stream(t,
+		`data: {"choices":[{"index":0,"delta":{"content":"a forb"}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"content":"idden word"}}]}`,
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	)
+	assert.NotContains(t, output, "forb")
+	assert.Contains(t, output, `"finish_reason":"content_filter"`)
+	assert.NotContains(t, output, `"finish_reason":"stop"`)
+	assert.Equal(t, 1, strings.Count(output, "data: [DONE]"))
+}
+
+func TestGuardOutput_ClaudeAndResponseAPIStream(t *testing.T) {
+	setupOutputPolicies(t)
+
+	output := stream(t,
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"pin 1\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"234\"}}",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+	)
+	assert.Contains(t, output, `"text":"pin [REDACTED]"`)
+	assert.Less(t, strings.Index(output, "[REDACTED]"), strings.Index(output, "content_block_stop"))
+	assert.Contains(t, output, "event: message_stop\n")
+
+	// nothing is sent after a block
+	output = stream(t,
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"a forbi\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"dden word\"}}",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+	)
+	assert.Contains(t, output, "event: error\n")
+	assert.Contains(t, output, `"type":"content_policy_violation"`)
+	assert.NotContains(t, output, "forbi")
+	assert.NotContains(t, output, "message_stop")
+
+	output = stream(t,
+		"event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"output_index\":0,\"content_index\":0,\"delta\":\"Forbid\"}",
+		"event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"output_index\":0,\"content_index\":0,\"delta\":\"den\"}",
+		"event: response.output_text.done\ndata: {\"type\":\"response.output_text.done\",\"output_index\":0,\"content_index\":0,\"text\":\"Forbidden\"}",
+	)
+	assert.Contains(t, output, `"code":"content_policy_violation"`)
+	assert.NotContains(t, output, "Forbid")
+}
@@ -0,0 +1,38 @@
+package contentpolicy
+
+import (
+	"regexp"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// Redactor removes personal data and custom patterns from texts that are stored,
+// such as captured transcripts.
+type Redactor struct {
+	rule *rule
+}
+
+// NewRedactor returns a redactor for the comma separated detectors of model.PIIDetectors
+// and the regular expressions.
+func NewRedactor(detectors string, patterns []string) (*Redactor, error) {
+	r := compile(&model.ContentPolicy{Type: model.ContentPolicyTypePII, Pattern: detectors})
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compile redaction pattern %q", pattern)
+		}
+		r.matchers = append(r.matchers, matcher{re: re})
+	}
+	return &Redactor{rule: r}, nil
+}
+
+// Redact returns the text with the matches replaced.
+func (r *Redactor) Redact(text string) string {
+	spans := r.rule.find(text)
+	if len(spans) == 0 {
+		return text
+	}
+	return r.rule.redact(text, spans)
+}
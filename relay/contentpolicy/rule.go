@@ -0,0 +1,195 @@
+package contentpolicy
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// matcher finds the spans of text a rule acts on.
+type matcher struct {
+	// label names the match in redactions and excerpts of personal data
+	label string
+	re    *regexp.Regexp
+	// valid filters false positives of re, nil accepts every match
+	valid func(match string) bool
+}
+
+// span is a match of a matcher in a text.
+type span struct {
+	start, end int
+	label      string
+}
+
+var piiMatchers = map[string]matcher{
+	"email": {
+		label: "email",
+		re:    regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"card": {
+		label: "card",
+		re:    regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		valid: func(match string) bool {
+			digits := onlyDigits(match)
+			return len(digits) >= 13 && len(digits) <= 19 && luhnValid(digits)
+		},
+	},
+	"phone": {
+		label: "phone",
+		re:    regexp.MustCompile(`\+?\(?\d[\d\s().-]{7,18}\d`),
+		valid: func(match string) bool {
+			digits := onlyDigits(match)
+			// card numbers are left to the card detector
+			return len(digits) >= 9 && len(digits) <= 15 && !(len(digits) >= 13 && luhnValid(digits))
+		},
+	},
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// luhnValid reports whether the digits pass the Luhn checksum of payment card numbers.
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// rule is a compiled content policy.
+type rule struct {
+	policy   *model.ContentPolicy
+	matchers []matcher
+}
+
+// find returns the spans of text matched by the rule, ordered by position.
+func (r *rule) find(text string) []span {
+	var spans []span
+	for _, m := range r.matchers {
+		for _, loc := range m.re.FindAllStringIndex(text, -1) {
+			if m.valid != nil && !m.valid(text[loc[0]:loc[1]]) {
+				continue
+			}
+			spans = append(spans, span{start: loc[0], end: loc[1], label: m.label})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	return spans
+}
+
+// redact replaces the spans of text, overlapping spans are merged.
+func (r *rule) redact(text string, spans []span) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(spans); i++ {
+		current := spans[i]
+		for i+1 < len(spans) && spans[i+1].start < current.end {
+			if spans[i+1].end > current.end {
+				current.end = spans[i+1].end
+			}
+			i++
+		}
+		if current.start < last {
+			current.start = last
+		}
+		b.WriteString(text[last:current.start])
+		b.WriteString(r.replacement(current))
+		last = current.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (r *rule) replacement(s span) string {
+	if s.label != "" {
+		return "[REDACTED:" + s.label + "]"
+	}
+	return "[REDACTED]"
+}
+
+// excerptRadius is the number of bytes kept on each side of a match in an event excerpt.
+const excerptRadius = 40
+
+// excerpt returns the text around the first span for the review of an event.
+// Personal data is masked, reviewers do not need it to judge the event.
+func (r *rule) excerpt(text string, s span) string {
+	start, end := s.start-excerptRadius, s.end+excerptRadius
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	match := text[s.start:s.end]
+	if s.label != "" {
+		match = "[" + s.label + "]"
+	}
+	return strings.ToValidUTF8(text[start:s.start]+match+text[s.end:end], "")
+}
+
+// compile builds the matchers of the policy. Invalid policies are rejected when they
+// are saved, a policy that still fails to compile matches nothing.
+func compile(policy *model.ContentPolicy) *rule {
+	r := &rule{policy: policy}
+	switch policy.Type {
+	case model.ContentPolicyTypeRegex:
+		if re, err := regexp.Compile(policy.Pattern); err == nil {
+			r.matchers = append(r.matchers, matcher{re: re})
+		}
+	case model.ContentPolicyTypeKeyword:
+		keywords := model.SplitContentPolicyKeywords(policy.Pattern)
+		quoted := make([]string, 0, len(keywords))
+		for _, keyword := range keywords {
+			quoted = append(quoted, regexp.QuoteMeta(keyword))
+		}
+		if len(quoted) > 0 {
+			r.matchers = append(r.matchers, matcher{re: regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)})
+		}
+	case model.ContentPolicyTypePII:
+		for _, detector := range strings.Split(policy.Pattern, ",") {
+			if m, ok := piiMatchers[strings.TrimSpace(detector)]; ok {
+				r.matchers = append(r.matchers, m)
+			}
+		}
+	}
+	return r
+}
+
+var (
+	compiledRules    = make(map[int]*rule)
+	compiledRulesMux sync.Mutex
+)
+
+// getRule returns the compiled policy. The policy cache loads new policies on every
+// reload, so a rule compiled for another load of the policy is compiled again.
+func getRule(policy *model.ContentPolicy) *rule {
+	compiledRulesMux.Lock()
+	defer compiledRulesMux.Unlock()
+	if r, ok := compiledRules[policy.Id]; ok && r.policy == policy {
+		return r
+	}
+	r := compile(policy)
+	compiledRules[policy.Id] = r
+	return r
+}
@@ -241,7 +241,7 @@ func TestBillingRefactorSafety(t *testing.T) {
 			// billing.PostConsumeQuota(context.Background(), 1, 10, 50, 1, 5, 1.0, 1.0, "model", "token")
 
 			// billing.PostConsumeQuotaDetailed signature check
-			// billing.PostConsumeQuotaDetailed(context.Background(), 1, 10, 50, 1, 5, 10, 20, 1.0, 1.0, "model", "token", false, time.Now(), false, 1.0, 0)
+			// billing.PostConsumeQuotaDetailed(context.Background(), 1, 10, 50, 1, 5, 10, 20, 1.0, 1.0, "model", "token", false, time.Now(), false, 1.0, 0, billing.UsageDetails{})
 
 			// billing.ReturnPreConsumedQuota signature check
 			// billing.ReturnPreConsumedQuota(context.Background(), 50, 1)
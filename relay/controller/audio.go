@@ -27,6 +27,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/billing"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/pricing"
@@ -89,6 +90,20 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		}
 	}
 
+	// apply the content policies of the caller before the text to speak, or the prompt of
+	// a transcription, leaves the gateway
+	field := "prompt"
+	if relayMode == relaymode.AudioSpeech {
+		field = "input"
+	}
+	if err := checkBodyField(ctx, c, contentpolicy.Attach(c, meta), field); err != nil {
+		if !errors.Is(err, contentpolicy.ErrBlocked) {
+			return openai.ErrorWrapper(err, "invalid_audio_request", http.StatusBadRequest)
+		}
+		logger.Logger.Info("request blocked by content policy", zap.Error(err))
+		return openai.ErrorWrapper(err, "content_policy_violation", http.StatusBadRequest)
+	}
+
 	// get channel-specific pricing if available
 	var channelModelRatio map[string]float64
 	if channelModel, ok := c.Get(ctxkey.ChannelModel); ok {
@@ -101,8 +116,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	// Use three-layer pricing system
 	pricingAdaptor := relay.GetAdaptor(channelType)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(audioModel, channelModelRatio, pricingAdaptor)
-	// groupRatio := billingratio.GetGroupRatio(group)
-	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	groupRatio := getGroupModelRatio(meta, audioModel)
 	ratio := modelRatio * groupRatio
 	var quota int64
 	var preConsumedQuota int64
@@ -25,6 +25,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
 	metalib "github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/pricing"
@@ -55,14 +57,20 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	claudeRequest.Model = meta.ActualModelName
 	meta.ActualModelName = claudeRequest.Model
 	metalib.Set2Context(c, meta)
+	// apply the content policies of the caller before the prompt leaves the gateway
+	if err = contentpolicy.Attach(c, meta).CheckClaudeRequest(ctx, claudeRequest); err != nil {
+		logger.Logger.Info("request blocked by content policy", zap.Error(err))
+		return openai.ErrorWrapper(err, "content_policy_violation", http.StatusBadRequest)
+	}
 
 	// get channel model ratio
 	channelModelRatio, channelCompletionRatio := getChannelRatios(c, meta.ChannelId)
+	channelPriceRules := getChannelPriceRules(c)
 
 	// get model ratio using three-layer pricing system
 	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(claudeRequest.Model, channelModelRatio, pricingAdaptor)
-	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	groupRatio := getGroupModelRatio(meta, claudeRequest.Model)
 
 	ratio := modelRatio * groupRatio
 
@@ -118,7 +126,9 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	var usage *relaymodel.Usage
 	var respErr *relaymodel.ErrorWithStatusCode
 
-	// Call the adapter's DoResponse method to handle response conversion
+	// Call the adapter's DoResponse method to handle response conversion,
+	// the output content policies apply to whatever is written to the client
+	finishOutput := contentpolicy.GuardOutput(c)
 	usage, respErr = adaptorInstance.DoResponse(c, resp, meta)
 
 	// If the adapter didn't handle the conversion (e.g., for native Anthropic),
@@ -146,11 +156,7 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 				// Extract usage information from the Claude response body for billing
 				var claudeResp relaymodel.ClaudeResponse
 				if parseErr := json.Unmarshal(body, &claudeResp); parseErr == nil && claudeResp.Usage.InputTokens > 0 {
-					usage = &relaymodel.Usage{
-						PromptTokens:     claudeResp.Usage.InputTokens,
-						CompletionTokens: claudeResp.Usage.OutputTokens,
-						TotalTokens:      claudeResp.Usage.InputTokens + claudeResp.Usage.OutputTokens,
-					}
+					usage = claudeResp.Usage.ToUsage()
 				} else {
 					// Fallback: use estimated prompt tokens if parsing fails
 					promptTokens := getClaudeMessagesPromptTokens(ctx, claudeRequest)
@@ -173,6 +179,8 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		}
 	}
 
+	finishOutput()
+
 	if respErr != nil {
 		logger.Logger.Error("Claude native response handler failed", zap.Any("error", *respErr))
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, c.GetInt(ctxkey.TokenId))
@@ -196,7 +204,7 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		var quota int64
 
 		go func() {
-			quota = postConsumeClaudeMessagesQuota(ctx, usage, meta, claudeRequest, ratio, preConsumedQuota, modelRatio, groupRatio, channelCompletionRatio)
+			quota = postConsumeClaudeMessagesQuota(ctx, usage, meta, claudeRequest, ratio, preConsumedQuota, modelRatio, groupRatio, channelCompletionRatio, channelPriceRules)
 
 			// also update user request cost
 			if quota != 0 {
@@ -283,6 +291,9 @@ func getAndValidateClaudeMessagesRequest(c *gin.Context) (*ClaudeMessagesRequest
 		}
 	}
 
+	if err = applyClaudePromptTemplate(c, claudeRequest); err != nil {
+		return nil, err
+	}
 	return claudeRequest, nil
 }
 
@@ -676,7 +687,7 @@ func preConsumeClaudeMessagesQuota(c *gin.Context, request *ClaudeMessagesReques
 }
 
 // postConsumeClaudeMessagesQuota calculates and applies final quota consumption for Claude Messages API
-func postConsumeClaudeMessagesQuota(ctx context.Context, usage *relaymodel.Usage, meta *metalib.Meta, request *ClaudeMessagesRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, channelCompletionRatio map[string]float64) int64 {
+func postConsumeClaudeMessagesQuota(ctx context.Context, usage *relaymodel.Usage, meta *metalib.Meta, request *ClaudeMessagesRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, channelCompletionRatio map[string]float64, channelPriceRules map[string]billingratio.PriceRules) int64 {
 	if usage == nil {
 		logger.Logger.Warn("usage is nil for Claude Messages API")
 		return 0
@@ -687,16 +698,17 @@ func postConsumeClaudeMessagesQuota(ctx context.Context, usage *relaymodel.Usage
 	completionRatio := pricing.GetCompletionRatioWithThreeLayers(request.Model, channelCompletionRatio, pricingAdaptor)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
+	price := getBilledPrice(meta, request.Model, usage, modelRatio, groupRatio, completionRatio, channelPriceRules, pricingAdaptor)
 
 	// Calculate base quota
-	baseQuota := int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	baseQuota := int64(math.Ceil(price.tokenQuota()))
 
 	// Add structured output cost if applicable
-	structuredOutputCost := calculateClaudeStructuredOutputCost(request, completionTokens, modelRatio)
+	structuredOutputCost := calculateClaudeStructuredOutputCost(request, completionTokens, price.modelRatio)
 
 	// Total quota includes base cost, tools cost, and structured output cost
 	quota := baseQuota + usage.ToolsCost + structuredOutputCost
-	if ratio != 0 && quota <= 0 {
+	if price.ratio != 0 && quota <= 0 {
 		quota = 1
 	}
 
@@ -709,8 +721,8 @@ func postConsumeClaudeMessagesQuota(ctx context.Context, usage *relaymodel.Usage
 	// Use centralized detailed billing function to follow DRY principle
 	quotaDelta := quota - preConsumedQuota
 	billing.PostConsumeQuotaDetailed(ctx, meta.TokenId, quotaDelta, quota, meta.UserId, meta.ChannelId,
-		promptTokens, completionTokens, modelRatio, groupRatio, request.Model, meta.TokenName,
-		meta.IsStream, meta.StartTime, false, completionRatio, usage.ToolsCost)
+		promptTokens, completionTokens, price.modelRatio, groupRatio, request.Model, meta.TokenName,
+		meta.IsStream, meta.StartTime, false, price.completionRatio, usage.ToolsCost, price.details)
 
 	logger.Logger.Debug(fmt.Sprintf("Claude Messages quota: pre-consumed=%d, actual=%d, difference=%d", preConsumedQuota, quota, quotaDelta))
 	return quota
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
+)
+
+// checkBodyField applies the input content policies to a text field of the request
+// body, which is JSON or a multipart form. A redacted text is written back into the
+// body, the other fields and files are passed on as they are.
+func checkBodyField(ctx context.Context, c *gin.Context, guard *contentpolicy.Guard, field string) error {
+	if guard == nil {
+		return nil
+	}
+	value, err := getBodyField(c, field)
+	if err != nil || value == "" {
+		return err
+	}
+	checked := value
+	if err = guard.CheckTexts(ctx, func(fn func(string) string) {
+		checked = fn(checked)
+	}); err != nil {
+		return err
+	}
+	if checked == value {
+		return nil
+	}
+	return setBodyField(c, field, checked)
+}
+
+// getBodyField returns the text of a field of the JSON or multipart request body.
+func getBodyField(c *gin.Context, field string) (string, error) {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return "", err
+	}
+	boundary, err := multipartBoundary(c)
+	if err != nil {
+		return "", err
+	}
+	if boundary == "" {
+		fields := map[string]json.RawMessage{}
+		if err = json.Unmarshal(body, &fields); err != nil {
+			return "", errors.Wrap(err, "unmarshal request body")
+		}
+		var value string
+		if raw, ok := fields[field]; ok {
+			if err = json.Unmarshal(raw, &value); err != nil {
+				return "", errors.Wrapf(err, "%s must be a string", field)
+			}
+		}
+		return value, nil
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "read multipart body")
+		}
+		if part.FormName() == field && part.FileName() == "" {
+			value, err := io.ReadAll(part)
+			return string(value), errors.Wrapf(err, "read field %s", field)
+		}
+	}
+}
+
+// setBodyField replaces the text of a field of the JSON or multipart request body.
+func setBodyField(c *gin.Context, field string, value string) error {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	boundary, err := multipartBoundary(c)
+	if err != nil {
+		return err
+	}
+	out := &bytes.Buffer{}
+	if boundary == "" {
+		fields := map[string]json.RawMessage{}
+		if err = json.Unmarshal(body, &fields); err != nil {
+			return errors.Wrap(err, "unmarshal request body")
+		}
+		if fields[field], err = json.Marshal(value); err != nil {
+			return errors.Wrapf(err, "marshal field %s", field)
+		}
+		if err = json.NewEncoder(out).Encode(fields); err != nil {
+			return errors.Wrap(err, "marshal request body")
+		}
+	} else {
+		reader := multipart.NewReader(bytes.NewReader(body), boundary)
+		writer := multipart.NewWriter(out)
+		// the content type of the request stays valid
+		if err = writer.SetBoundary(boundary); err != nil {
+			return errors.Wrap(err, "set multipart boundary")
+		}
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrap(err, "read multipart body")
+			}
+			dst, err := writer.CreatePart(part.Header)
+			if err != nil {
+				return errors.Wrap(err, "write multipart body")
+			}
+			if part.FormName() == field && part.FileName() == "" {
+				_, err = io.WriteString(dst, value)
+			} else {
+				_, err = io.Copy(dst, part)
+			}
+			if err != nil {
+				return errors.Wrap(err, "write multipart body")
+			}
+		}
+		if err = writer.Close(); err != nil {
+			return errors.Wrap(err, "write multipart body")
+		}
+	}
+	c.Set(ctxkey.KeyRequestBody, out.Bytes())
+	c.Request.Body = io.NopCloser(bytes.NewReader(out.Bytes()))
+	c.Request.ContentLength = int64(out.Len())
+	return nil
+}
+
+// multipartBoundary returns the boundary of a multipart request, or "" for JSON requests.
+func multipartBoundary(c *gin.Context) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return "", errors.Wrap(err, "parse content type")
+	}
+	switch {
+	case mediaType == "application/json":
+		return "", nil
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		return params["boundary"], nil
+	default:
+		return "", errors.Errorf("unsupported content type %s", mediaType)
+	}
+}
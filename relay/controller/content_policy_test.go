@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
+)
+
+func newBodyContext(contentType string, body []byte) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestCheckBodyField(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.ContentPolicy{}, &model.ContentPolicyEvent{}))
+	originalDB := model.DB
+	model.DB = db
+	t.Cleanup(func() {
+		require.NoError(t, db.Where("1 = 1").Delete(&model.ContentPolicy{}).Error)
+		model.InitContentPolicyCache()
+		model.DB = originalDB
+	})
+	for _, policy := range []*model.ContentPolicy{
+		{Name: "pii", Type: model.ContentPolicyTypePII, Pattern: "email", Action: model.ContentPolicyActionRedact, Enabled: true},
+		{Name: "secret", Type: model.ContentPolicyTypeKeyword, Pattern: "project x", Action: model.ContentPolicyActionBlock, Enabled: true},
+	} {
+		require.NoError(t, policy.Insert())
+	}
+	guard := contentpolicy.New("default", 1, 1, "whisper-1", "req-1")
+	require.NotNil(t, guard)
+	ctx := context.Background()
+
+	// the prompt of a multipart form is redacted, the file is passed on as it is
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	require.NoError(t, writer.WriteField("model", "whisper-1"))
+	file, err := writer.CreateFormFile("file", "speech.mp3")
+	require.NoError(t, err)
+	_, err = file.Write([]byte("ID3 audio bytes"))
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("prompt", "names like jane.doe@example.com"))
+	require.NoError(t, writer.Close())
+	c := newBodyContext(writer.FormDataContentType(), form.Bytes())
+	require.NoError(t, checkBodyField(ctx, c, guard, "prompt"))
+	body, err := io.ReadAll(c.Request.Body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(body)), c.Request.ContentLength)
+	reader := multipart.NewReader(bytes.NewReader(body), writer.Boundary())
+	parsed, err := reader.ReadForm(1 << 20)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"names like [REDACTED:email]"}, parsed.Value["prompt"])
+	assert.Equal(t, []string{"whisper-1"}, parsed.Value["model"])
+	audio, err := parsed.File["file"][0].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(audio)
+	require.NoError(t, err)
+	assert.Equal(t, "ID3 audio bytes", string(content))
+
+	// the text of a JSON body is redacted, the other fields are kept
+	c = newBodyContext("application/json", []byte(`{"model":"tts-1","input":"write to jane.doe@example.com","voice":"alloy","extra":{"a":1}}`))
+	require.NoError(t, checkBodyField(ctx, c, guard, "input"))
+	body, err = common.GetRequestBody(c)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"tts-1","input":"write to [REDACTED:email]","voice":"alloy","extra":{"a":1}}`, string(body))
+
+	c = newBodyContext("application/json", []byte(`{"model":"tts-1","input":"all about Project X"}`))
+	assert.ErrorIs(t, checkBodyField(ctx, c, guard, "input"), contentpolicy.ErrBlocked)
+
+	// without a policy the body is not even read
+	c = newBodyContext("text/plain", []byte("anything"))
+	assert.NoError(t, checkBodyField(ctx, c, nil, "prompt"))
+}
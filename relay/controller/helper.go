@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"net/http"
 	"strings"
@@ -16,6 +17,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/billing"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
@@ -44,6 +46,9 @@ func getAndValidateTextRequest(c *gin.Context, relayMode int) (*relaymodel.Gener
 	if err != nil {
 		return nil, err
 	}
+	if err = applyPromptTemplate(c, textRequest, relayMode); err != nil {
+		return nil, err
+	}
 	return textRequest, nil
 }
 
@@ -60,7 +65,7 @@ func getPromptTokens(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 		return openai.CountTokenMessages(ctx, textRequest.Messages, textRequest.Model)
 	case relaymode.Completions:
 		return openai.CountTokenInput(textRequest.Prompt, textRequest.Model)
-	case relaymode.Moderations:
+	case relaymode.Moderations, relaymode.Embeddings:
 		return openai.CountTokenInput(textRequest.Input, textRequest.Model)
 	}
 	return 0
@@ -130,6 +135,106 @@ func preConsumeQuota(c *gin.Context, textRequest *relaymodel.GeneralOpenAIReques
 	return preConsumedQuota, nil
 }
 
+// getChannelPriceRules returns the price rules configured on the selected channel.
+func getChannelPriceRules(c *gin.Context) map[string]ratio.PriceRules {
+	if channel, ok := c.Get(ctxkey.ChannelModel); ok {
+		if channel, ok := channel.(*model.Channel); ok {
+			return channel.GetPriceRulesFromConfigs()
+		}
+	}
+	return nil
+}
+
+// getGroupModelRatio returns the ratio of the caller's group for the requested model,
+// a per group per model override takes precedence over the group ratio.
+func getGroupModelRatio(meta *meta.Meta, modelName string) float64 {
+	if meta.OriginModelName != "" {
+		modelName = meta.OriginModelName
+	}
+	return ratio.GetGroupModelRatio(meta.Group, modelName)
+}
+
+// billedPrice is the price of a finished request after the price rules of its model are applied.
+type billedPrice struct {
+	modelRatio      float64
+	ratio           float64
+	completionRatio float64
+	// promptTokens are the prompt tokens weighted by their cache and audio rates
+	promptTokens float64
+	// completionTokens are the text completion tokens,
+	// including reasoning tokens the upstream reports separately
+	completionTokens float64
+	// audioCompletionTokens are the audio completion tokens weighted by their rates relative to the input price
+	audioCompletionTokens float64
+	details               billing.UsageDetails
+}
+
+// tokenQuota returns the quota of the tokens before rounding, tool costs are not included.
+func (p billedPrice) tokenQuota() float64 {
+	return (p.promptTokens + p.completionTokens*p.completionRatio + p.audioCompletionTokens) * p.ratio
+}
+
+// getBilledPrice refines the price of a finished request with the context-length tier, the price
+// window and the cache rates of the model, taken from the layer that supplies the model ratio,
+// and weights audio and reasoning tokens according to the model and the upstream.
+func getBilledPrice(meta *meta.Meta, modelName string, usage *relaymodel.Usage,
+	modelRatio float64, groupRatio float64, completionRatio float64,
+	channelPriceRules map[string]ratio.PriceRules, pricingAdaptor adaptor.Adaptor) billedPrice {
+	rules := pricing.GetPriceRulesWithThreeLayers(modelName, channelPriceRules, pricingAdaptor)
+	modelRatio, completionRatio, breakdown := rules.Apply(modelRatio, completionRatio, usage.PromptTokens, meta.StartTime)
+
+	cachedTokens := usage.CachedPromptTokens()
+	cacheWriteTokens := usage.CacheWritePromptTokens()
+	promptAudioTokens := min(usage.PromptAudioTokens(), usage.PromptTokens)
+	completionAudioTokens := min(usage.CompletionAudioTokens(), usage.CompletionTokens)
+	reasoningTokens := usage.ReasoningTokens()
+	parts := make([]string, 0, 6)
+	if breakdown != "" {
+		parts = append(parts, breakdown)
+	}
+	if cachedTokens > 0 {
+		parts = append(parts, fmt.Sprintf("cached tokens %d, cached rate %.2f", cachedTokens, rules.GetCachedInputRatio()))
+	}
+	if cacheWriteTokens > 0 {
+		parts = append(parts, fmt.Sprintf("cache write tokens %d, cache write rate %.2f", cacheWriteTokens, rules.GetCacheWriteRatio()))
+	}
+
+	promptTokens := rules.WeightedPromptTokens(usage.PromptTokens-promptAudioTokens, cachedTokens, cacheWriteTokens)
+	completionTokens := float64(usage.CompletionTokens - completionAudioTokens)
+	var audioCompletion float64
+	if promptAudioTokens > 0 || completionAudioTokens > 0 {
+		audioRatio := ratio.GetAudioPromptRatio(modelName)
+		audioCompletionRatio := ratio.GetAudioCompletionRatio(modelName)
+		promptTokens += float64(promptAudioTokens) * audioRatio
+		audioCompletion = float64(completionAudioTokens) * audioRatio * audioCompletionRatio
+		parts = append(parts, fmt.Sprintf("audio tokens %d/%d, audio rate %.2f, audio completion rate %.2f",
+			promptAudioTokens, completionAudioTokens, audioRatio, audioCompletionRatio))
+	}
+	if reasoningTokens > 0 && !channeltype.ReasoningInCompletionTokens(meta.ChannelType) {
+		completionTokens += float64(reasoningTokens)
+		parts = append(parts, fmt.Sprintf("reasoning tokens %d billed separately", reasoningTokens))
+	}
+
+	return billedPrice{
+		modelRatio:            modelRatio,
+		ratio:                 modelRatio * groupRatio,
+		completionRatio:       completionRatio,
+		promptTokens:          promptTokens,
+		completionTokens:      completionTokens,
+		audioCompletionTokens: audioCompletion,
+		details: billing.UsageDetails{
+			CachedTokens:          cachedTokens,
+			CacheWriteTokens:      cacheWriteTokens,
+			ReasoningTokens:       reasoningTokens,
+			PromptAudioTokens:     promptAudioTokens,
+			CompletionAudioTokens: completionAudioTokens,
+			ImageTokens:           usage.PromptImageTokens(),
+			PriceBreakdown:        strings.Join(parts, ", "),
+			PromptTemplate:        meta.PromptTemplate,
+		},
+	}
+}
+
 func postConsumeQuota(ctx context.Context,
 	usage *relaymodel.Usage,
 	meta *meta.Meta,
@@ -139,7 +244,8 @@ func postConsumeQuota(ctx context.Context,
 	modelRatio float64,
 	groupRatio float64,
 	systemPromptReset bool,
-	channelCompletionRatio map[string]float64) (quota int64) {
+	channelCompletionRatio map[string]float64,
+	channelPriceRules map[string]ratio.PriceRules) (quota int64) {
 	if usage == nil {
 		logger.Logger.Error("usage is nil, which is unexpected")
 		return
@@ -148,13 +254,13 @@ func postConsumeQuota(ctx context.Context,
 	// Use three-layer pricing system for completion ratio
 	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
 	completionRatio := pricing.GetCompletionRatioWithThreeLayers(textRequest.Model, channelCompletionRatio, pricingAdaptor)
+	price := getBilledPrice(meta, textRequest.Model, usage, modelRatio, groupRatio, completionRatio, channelPriceRules, pricingAdaptor)
 	promptTokens := usage.PromptTokens
-	// It appears that DeepSeek's official service automatically merges ReasoningTokens into CompletionTokens,
-	// but the behavior of third-party providers may differ, so for now we do not add them manually.
-	// completionTokens := usage.CompletionTokens + usage.CompletionTokensDetails.ReasoningTokens
+	// reasoning tokens are added to the completion tokens by getBilledPrice
+	// when the upstream does not count them, see channeltype.ReasoningInCompletionTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens)+float64(completionTokens)*completionRatio)*ratio)) + usage.ToolsCost
-	if ratio != 0 && quota <= 0 {
+	quota = int64(math.Ceil(price.tokenQuota())) + usage.ToolsCost
+	if price.ratio != 0 && quota <= 0 {
 		quota = 1
 	}
 
@@ -167,8 +273,8 @@ func postConsumeQuota(ctx context.Context,
 	// Use centralized detailed billing function to follow DRY principle
 	quotaDelta := quota - preConsumedQuota
 	billing.PostConsumeQuotaDetailed(ctx, meta.TokenId, quotaDelta, quota, meta.UserId, meta.ChannelId,
-		promptTokens, completionTokens, modelRatio, groupRatio, textRequest.Model, meta.TokenName,
-		meta.IsStream, meta.StartTime, systemPromptReset, completionRatio, usage.ToolsCost)
+		promptTokens, completionTokens, price.modelRatio, groupRatio, textRequest.Model, meta.TokenName,
+		meta.IsStream, meta.StartTime, systemPromptReset, price.completionRatio, usage.ToolsCost, price.details)
 
 	return quota
 }
@@ -199,13 +305,24 @@ func isErrorHappened(meta *meta.Meta, resp *http.Response) bool {
 	return false
 }
 
-func setSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIRequest, prompt string) (reset bool) {
+// setSystemPrompt replaces the system prompt of the request with the forced prompt of the
+// channel. If the request selected a prompt template, the first message is the template,
+// the forced prompt is appended to it and replaces the system message of the caller.
+func setSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIRequest, prompt string, templated bool) (reset bool) {
 	if prompt == "" {
 		return false
 	}
 	if len(request.Messages) == 0 {
 		return false
 	}
+	if templated {
+		request.Messages[0].Content = request.Messages[0].StringContent() + "\n\n" + prompt
+		if len(request.Messages) > 1 && request.Messages[1].Role == role.System {
+			request.Messages = append(request.Messages[:1], request.Messages[2:]...)
+		}
+		logger.Logger.Info("append system prompt to prompt template")
+		return true
+	}
 	if request.Messages[0].Role == role.System {
 		request.Messages[0].Content = prompt
 		logger.Logger.Info("rewrite system prompt")
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestGetBilledPriceWithCache(t *testing.T) {
+	m := &meta.Meta{StartTime: time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)}
+	channelPriceRules := map[string]ratio.PriceRules{
+		"claude-sonnet-4": {CachedInputRatio: 0.1, CacheWriteRatio: 1.25},
+	}
+	usage := (&relaymodel.ClaudeUsage{
+		InputTokens:              100,
+		OutputTokens:             50,
+		CacheReadInputTokens:     1000,
+		CacheCreationInputTokens: 200,
+	}).ToUsage()
+
+	price := getBilledPrice(m, "claude-sonnet-4", usage, 2, 0.5, 5, channelPriceRules, nil)
+	assert.Equal(t, 1300, usage.PromptTokens)
+	assert.InDelta(t, 100+1000*0.1+200*1.25, price.promptTokens, 1e-9)
+	assert.Equal(t, 1.0, price.ratio)
+	assert.Equal(t, 1000, price.details.CachedTokens)
+	assert.Equal(t, 200, price.details.CacheWriteTokens)
+	assert.Contains(t, price.details.PriceBreakdown, "cached tokens 1000, cached rate 0.10")
+	assert.Contains(t, price.details.PriceBreakdown, "cache write tokens 200, cache write rate 1.25")
+
+	// DeepSeek reports cache hits in its own field, models without a cache ratio pay the full price
+	usage = &relaymodel.Usage{PromptTokens: 100, CompletionTokens: 10, PromptCacheHitTokens: 60}
+	price = getBilledPrice(m, "unknown", usage, 2, 1, 1, channelPriceRules, nil)
+	assert.Equal(t, 60, price.details.CachedTokens)
+	assert.InDelta(t, 100, price.promptTokens, 1e-9)
+	assert.Equal(t, 2.0, price.ratio)
+}
+
+func TestGetBilledPriceWithReasoningAndAudio(t *testing.T) {
+	m := &meta.Meta{StartTime: time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC), ChannelType: channeltype.OpenAI}
+	usage := &relaymodel.Usage{
+		PromptTokens:            1000,
+		CompletionTokens:        300,
+		PromptTokensDetails:     &relaymodel.UsagePromptTokensDetails{AudioTokens: 200, ImageTokens: 50},
+		CompletionTokensDetails: &relaymodel.UsageCompletionTokensDetails{AudioTokens: 100, ReasoningTokens: 80},
+	}
+
+	price := getBilledPrice(m, "gpt-4o-audio-preview", usage, 1, 1, 4, nil, nil)
+	assert.InDelta(t, 800+200*16, price.promptTokens, 1e-9)
+	assert.InDelta(t, 200, price.completionTokens, 1e-9, "reasoning tokens are already part of the completion")
+	assert.InDelta(t, 100*16*2, price.audioCompletionTokens, 1e-9)
+	assert.InDelta(t, 800+200*16+200*4+100*16*2, price.tokenQuota(), 1e-9)
+	assert.Equal(t, 80, price.details.ReasoningTokens)
+	assert.Equal(t, 200, price.details.PromptAudioTokens)
+	assert.Equal(t, 100, price.details.CompletionAudioTokens)
+	assert.Equal(t, 50, price.details.ImageTokens)
+	assert.Contains(t, price.details.PriceBreakdown, "audio tokens 200/100")
+
+	// xAI reports reasoning tokens next to the completion tokens
+	m.ChannelType = channeltype.XAI
+	usage = &relaymodel.Usage{
+		PromptTokens:            100,
+		CompletionTokens:        10,
+		CompletionTokensDetails: &relaymodel.UsageCompletionTokensDetails{ReasoningTokens: 90},
+	}
+	price = getBilledPrice(m, "grok-3-mini", usage, 1, 1, 2, nil, nil)
+	assert.InDelta(t, 100, price.completionTokens, 1e-9)
+	assert.Contains(t, price.details.PriceBreakdown, "reasoning tokens 90 billed separately")
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/replicate"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
 	metalib "github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -209,6 +210,22 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		return bizErr
 	}
 
+	// apply the content policies of the caller before the prompt leaves the gateway
+	prompt := imageRequest.Prompt
+	err = contentpolicy.Attach(c, meta).CheckTexts(ctx, func(fn func(string) string) {
+		imageRequest.Prompt = fn(imageRequest.Prompt)
+	})
+	if err != nil {
+		logger.Logger.Info("request blocked by content policy", zap.Error(err))
+		return openai.ErrorWrapper(err, "content_policy_violation", http.StatusBadRequest)
+	}
+	if imageRequest.Prompt != prompt {
+		// the body is forwarded as is to most channels
+		if err = setBodyField(c, "prompt", imageRequest.Prompt); err != nil {
+			return openai.ErrorWrapper(err, "redact_image_request_failed", http.StatusInternalServerError)
+		}
+	}
+
 	imageCostRatio, err := getImageCostRatio(imageRequest)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_image_cost_ratio_failed", http.StatusInternalServerError)
@@ -283,8 +300,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 
 	modelRatio := billingratio.GetModelRatioWithChannel(imageModel, meta.ChannelType, channelModelRatio)
-	// groupRatio := billingratio.GetGroupRatio(meta.Group)
-	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	groupRatio := getGroupModelRatio(meta, imageModel)
 
 	ratio := modelRatio * groupRatio
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"bytes"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// promptTemplateRequest holds the fields a request selects a prompt template with,
+// they are not part of the upstream APIs and are dropped when the request is converted.
+type promptTemplateRequest struct {
+	PromptTemplate string         `json:"prompt_template"`
+	Variables      map[string]any `json:"variables"`
+}
+
+// getPromptTemplateRequest returns the prompt template fields of the request, or nil
+// if the request selects no template.
+func getPromptTemplateRequest(c *gin.Context) (*promptTemplateRequest, error) {
+	body, err := common.GetRequestBody(c)
+	if err != nil || !bytes.Contains(body, []byte(`"prompt_template"`)) {
+		return nil, nil
+	}
+	request := &promptTemplateRequest{}
+	if err = common.UnmarshalBodyReusable(c, request); err != nil {
+		return nil, errors.Wrap(err, "unmarshal prompt template")
+	}
+	if request.PromptTemplate == "" {
+		return nil, nil
+	}
+	return request, nil
+}
+
+// renderPromptTemplate renders the prompt template the request selects and records the
+// version on the relay meta. It returns "" if the request selects no template.
+func renderPromptTemplate(c *gin.Context) (string, error) {
+	request, err := getPromptTemplateRequest(c)
+	if err != nil || request == nil {
+		return "", err
+	}
+	template, err := model.GetPromptTemplate(request.PromptTemplate, c.GetString(ctxkey.Group))
+	if err != nil {
+		return "", err
+	}
+	rendered, err := template.Render(request.Variables)
+	if err != nil {
+		return "", err
+	}
+	metalib.GetByContext(c).PromptTemplate = template.Ref()
+	return rendered, nil
+}
+
+// applyPromptTemplate puts the selected prompt template before the messages of a chat
+// completion request, as a system message of its own.
+func applyPromptTemplate(c *gin.Context, request *relaymodel.GeneralOpenAIRequest, relayMode int) error {
+	if relayMode != relaymode.ChatCompletions {
+		if selected, err := getPromptTemplateRequest(c); err != nil || selected != nil {
+			return errors.New("prompt templates are only supported by chat completions")
+		}
+		return nil
+	}
+	prompt, err := renderPromptTemplate(c)
+	if err != nil || prompt == "" {
+		return err
+	}
+	request.Messages = append([]relaymodel.Message{{
+		Role:    role.System,
+		Content: prompt,
+	}}, request.Messages...)
+	return nil
+}
+
+// applyClaudePromptTemplate puts the selected prompt template before the system prompt
+// of a Claude Messages request.
+func applyClaudePromptTemplate(c *gin.Context, request *ClaudeMessagesRequest) error {
+	prompt, err := renderPromptTemplate(c)
+	if err != nil || prompt == "" {
+		return err
+	}
+	switch system := request.System.(type) {
+	case nil:
+		request.System = prompt
+	case string:
+		if system == "" {
+			request.System = prompt
+		} else {
+			request.System = prompt + "\n\n" + system
+		}
+	case []any:
+		request.System = append([]any{map[string]any{"type": "text", "text": prompt}}, system...)
+	default:
+		return errors.Errorf("unsupported system prompt type %T", system)
+	}
+	return nil
+}
+
+// applyResponseAPIPromptTemplate puts the selected prompt template before the
+// instructions of a Response API request.
+func applyResponseAPIPromptTemplate(c *gin.Context, request *openai.ResponseAPIRequest) error {
+	prompt, err := renderPromptTemplate(c)
+	if err != nil || prompt == "" {
+		return err
+	}
+	if request.Instructions != nil && *request.Instructions != "" {
+		prompt += "\n\n" + *request.Instructions
+	}
+	request.Instructions = &prompt
+	return nil
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func setupPromptTemplates(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.PromptTemplate{}))
+	originalDB := model.DB
+	model.DB = db
+	t.Cleanup(func() {
+		require.NoError(t, db.Where("1 = 1").Delete(&model.PromptTemplate{}).Error)
+		model.InitPromptTemplateCache()
+		model.DB = originalDB
+	})
+	require.NoError(t, (&model.PromptTemplate{Name: "support-bot", Content: "Help {{customer}} with {{product}}.",
+		Variables: `{"product": "One API"}`, Groups: "default", Enabled: true}).Insert())
+}
+
+func newPromptTemplateContext(path string, body string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(ctxkey.Group, "default")
+	return c
+}
+
+func TestPromptTemplateChatCompletions(t *testing.T) {
+	setupPromptTemplates(t)
+
+	c := newPromptTemplateContext("/v1/chat/completions", `{"model":"gpt-4o","prompt_template":"support-bot@v1",
+		"variables":{"customer":"ACME"},"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`)
+	request, err := getAndValidateTextRequest(c, relaymode.ChatCompletions)
+	require.NoError(t, err)
+	require.Len(t, request.Messages, 3)
+	assert.Equal(t, "system", request.Messages[0].Role)
+	assert.Equal(t, "Help ACME with One API.", request.Messages[0].Content)
+	assert.Equal(t, "Be brief.", request.Messages[1].Content)
+	assert.Equal(t, "support-bot@v1", metalib.GetByContext(c).PromptTemplate)
+
+	c = newPromptTemplateContext("/v1/chat/completions", `{"model":"gpt-4o","prompt_template":"support-bot",
+		"messages":[{"role":"user","content":"hi"}]}`)
+	_, err = getAndValidateTextRequest(c, relaymode.ChatCompletions)
+	assert.ErrorContains(t, err, "missing variables: customer")
+
+	c = newPromptTemplateContext("/v1/chat/completions", `{"model":"gpt-4o","prompt_template":"support-bot",
+		"variables":{"customer":"ACME"},"messages":[{"role":"user","content":"hi"}]}`)
+	c.Set(ctxkey.Group, "free")
+	_, err = getAndValidateTextRequest(c, relaymode.ChatCompletions)
+	assert.ErrorContains(t, err, "not available to group free")
+
+	c = newPromptTemplateContext("/v1/embeddings", `{"model":"text-embedding-3-small","input":"hi","prompt_template":"support-bot"}`)
+	_, err = getAndValidateTextRequest(c, relaymode.Embeddings)
+	assert.ErrorContains(t, err, "only supported by chat completions")
+
+	c = newPromptTemplateContext("/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	request, err = getAndValidateTextRequest(c, relaymode.ChatCompletions)
+	require.NoError(t, err)
+	assert.Len(t, request.Messages, 1)
+	assert.Empty(t, metalib.GetByContext(c).PromptTemplate)
+}
+
+func TestPromptTemplateWithChannelSystemPrompt(t *testing.T) {
+	setupPromptTemplates(t)
+
+	c := newPromptTemplateContext("/v1/chat/completions", `{"model":"gpt-4o","prompt_template":"support-bot",
+		"variables":{"customer":"ACME"},"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`)
+	c.Set(ctxkey.SystemPrompt, "Answer in English.")
+	request, err := getAndValidateTextRequest(c, relaymode.ChatCompletions)
+	require.NoError(t, err)
+	meta := metalib.GetByContext(c)
+	require.True(t, setSystemPrompt(c.Request.Context(), request, meta.ForcedSystemPrompt, meta.PromptTemplate != ""))
+	require.Len(t, request.Messages, 2)
+	assert.Equal(t, "system", request.Messages[0].Role)
+	assert.Equal(t, "Help ACME with One API.\n\nAnswer in English.", request.Messages[0].Content)
+	assert.Equal(t, "hi", request.Messages[1].Content)
+
+	c = newPromptTemplateContext("/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`)
+	c.Set(ctxkey.SystemPrompt, "Answer in English.")
+	request, err = getAndValidateTextRequest(c, relaymode.ChatCompletions)
+	require.NoError(t, err)
+	meta = metalib.GetByContext(c)
+	require.True(t, setSystemPrompt(c.Request.Context(), request, meta.ForcedSystemPrompt, meta.PromptTemplate != ""))
+	require.Len(t, request.Messages, 2)
+	assert.Equal(t, "Answer in English.", request.Messages[0].Content)
+}
+
+func TestPromptTemplateClaudeAndResponseAPI(t *testing.T) {
+	setupPromptTemplates(t)
+
+	for system, expected := range map[string]any{
+		``:                                       "Help ACME with One API.",
+		`"system":"Be brief.",`:                  "Help ACME with One API.\n\nBe brief.",
+		`"system":[{"type":"text","text":"x"}],`: []any{map[string]any{"type": "text", "text": "Help ACME with One API."}, map[string]any{"type": "text", "text": "x"}},
+	} {
+		c := newPromptTemplateContext("/v1/messages", `{"model":"claude-sonnet-4-0","max_tokens":10,`+system+
+			`"prompt_template":"support-bot","variables":{"customer":"ACME"},"messages":[{"role":"user","content":"hi"}]}`)
+		request, err := getAndValidateClaudeMessagesRequest(c)
+		require.NoError(t, err)
+		assert.Equal(t, expected, request.System)
+	}
+
+	c := newPromptTemplateContext("/v1/responses", `{"model":"gpt-4o","input":[{"role":"user","content":"hi"}],
+		"instructions":"Be brief.","prompt_template":"support-bot","variables":{"customer":"ACME"}}`)
+	request, err := getAndValidateResponseAPIRequest(c)
+	require.NoError(t, err)
+	require.NotNil(t, request.Instructions)
+	assert.Equal(t, "Help ACME with One API.\n\nBe brief.", *request.Instructions)
+	assert.Equal(t, "support-bot@v1", metalib.GetByContext(c).PromptTemplate)
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/cohere"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+)
+
+func getRerankRequest(c *gin.Context) (*relaymodel.RerankRequest, error) {
+	rerankRequest := &relaymodel.RerankRequest{}
+	if err := common.UnmarshalBodyReusable(c, rerankRequest); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rerankRequest, nil
+}
+
+func validateRerankRequest(rerankRequest *relaymodel.RerankRequest) *relaymodel.ErrorWithStatusCode {
+	if rerankRequest.Model == "" {
+		return openai.ErrorWrapper(errors.New("model is required"), "model_missing", http.StatusBadRequest)
+	}
+	if rerankRequest.Query == "" {
+		return openai.ErrorWrapper(errors.New("query is required"), "query_missing", http.StatusBadRequest)
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return openai.ErrorWrapper(errors.New("documents are required"), "documents_missing", http.StatusBadRequest)
+	}
+	if rerankRequest.TopN < 0 {
+		return openai.ErrorWrapper(errors.New("top_n must not be negative"), "invalid_top_n", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// getRerankPromptUnits estimates the billed units of a rerank request, they are search units
+// for Cohere and the tokens of the query and the documents otherwise.
+func getRerankPromptUnits(rerankRequest *relaymodel.RerankRequest, channelType int) int {
+	if channelType == channeltype.Cohere {
+		return cohere.SearchUnits(len(rerankRequest.Documents))
+	}
+
+	tokens := openai.CountTokenText(rerankRequest.Query, rerankRequest.Model) * len(rerankRequest.Documents)
+	for _, document := range rerankRequest.Documents {
+		tokens += openai.CountTokenText(document, rerankRequest.Model)
+	}
+	return tokens
+}
+
+// RelayRerankHelper relays a rerank request to the upstream of the selected channel
+// and answers with the canonical rerank response.
+func RelayRerankHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := metalib.GetByContext(c)
+	rerankRequest, err := getRerankRequest(c)
+	if err != nil {
+		logger.Logger.Error("getRerankRequest failed", zap.Error(err))
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if bizErr := validateRerankRequest(rerankRequest); bizErr != nil {
+		return bizErr
+	}
+
+	// map model name
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model = meta.ActualModelName
+	metalib.Set2Context(c, meta)
+
+	// apply the content policies of the caller before the query and documents leave the gateway
+	err = contentpolicy.Attach(c, meta).CheckTexts(ctx, func(fn func(string) string) {
+		rerankRequest.Query = fn(rerankRequest.Query)
+		for i := range rerankRequest.Documents {
+			rerankRequest.Documents[i] = fn(rerankRequest.Documents[i])
+		}
+	})
+	if err != nil {
+		logger.Logger.Info("request blocked by content policy", zap.Error(err))
+		return openai.ErrorWrapper(err, "content_policy_violation", http.StatusBadRequest)
+	}
+	c.Set(ctxkey.RerankRequest, rerankRequest)
+
+	var channelModelRatio map[string]float64
+	var channelCompletionRatio map[string]float64
+	var channelPriceRules map[string]billingratio.PriceRules
+	if channelModel, ok := c.Get(ctxkey.ChannelModel); ok {
+		if channel, ok := channelModel.(*model.Channel); ok {
+			channelModelRatio = channel.GetModelRatioFromConfigs()
+			channelCompletionRatio = channel.GetCompletionRatioFromConfigs()
+			channelPriceRules = channel.GetPriceRulesFromConfigs()
+		}
+	}
+	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(rerankRequest.Model, channelModelRatio, pricingAdaptor)
+	groupRatio := getGroupModelRatio(meta, rerankRequest.Model)
+	ratio := modelRatio * groupRatio
+
+	// postConsumeQuota only needs the model of the text request
+	textRequest := &relaymodel.GeneralOpenAIRequest{Model: rerankRequest.Model}
+	meta.PromptTokens = getRerankPromptUnits(rerankRequest, meta.ChannelType)
+	preConsumedQuota, bizErr := preConsumeQuota(c, textRequest, meta.PromptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Logger.Warn("preConsumeQuota failed", zap.Any("error", *bizErr))
+		return bizErr
+	}
+
+	adaptorImpl := relay.GetAdaptor(meta.APIType)
+	if adaptorImpl == nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptorImpl.Init(meta)
+	rerankAdaptor, ok := adaptorImpl.(adaptor.RerankAdaptor)
+	if !ok {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(errors.Errorf("rerank is not supported by channel type %s", channeltype.IdToName(meta.ChannelType)),
+			"rerank_not_supported", http.StatusBadRequest)
+	}
+
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(c, rerankRequest)
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "convert_rerank_request_failed", http.StatusInternalServerError)
+	}
+	c.Set(ctxkey.ConvertedRequest, convertedRequest)
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "marshal_rerank_request_failed", http.StatusInternalServerError)
+	}
+
+	resp, err := adaptorImpl.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Logger.Error("DoRequest failed", zap.Error(err))
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return RelayErrorHandler(resp)
+	}
+
+	usage, respErr := adaptorImpl.DoResponse(c, resp, meta)
+	if respErr != nil {
+		logger.Logger.Error("respErr is not nil", zap.Any("error", respErr))
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.BillingTimeoutSec)*time.Second)
+		defer cancel()
+		postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, false,
+			channelCompletionRatio, channelPriceRules)
+	}()
+
+	return nil
+}
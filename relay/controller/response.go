@@ -22,6 +22,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
 	metalib "github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/pricing"
@@ -49,13 +51,28 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return openai.ErrorWrapper(errors.New("Response API is only supported for OpenAI channels"), "unsupported_channel", http.StatusBadRequest)
 	}
 
+	// apply the content policies of the caller before the prompt leaves the gateway
+	err = contentpolicy.Attach(c, meta).CheckTexts(ctx, func(fn func(string) string) {
+		if responseAPIRequest.Instructions != nil {
+			*responseAPIRequest.Instructions = fn(*responseAPIRequest.Instructions)
+		}
+		for i := range responseAPIRequest.Input {
+			responseAPIRequest.Input[i] = contentpolicy.ForEachText(responseAPIRequest.Input[i], fn)
+		}
+	})
+	if err != nil {
+		logger.Logger.Info("request blocked by content policy", zap.Error(err))
+		return openai.ErrorWrapper(err, "content_policy_violation", http.StatusBadRequest)
+	}
+
 	// get channel model ratio
 	channelModelRatio, channelCompletionRatio := getChannelRatios(c, meta.ChannelId)
+	channelPriceRules := getChannelPriceRules(c)
 
 	// get model ratio using three-layer pricing system
 	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(responseAPIRequest.Model, channelModelRatio, pricingAdaptor)
-	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	groupRatio := getGroupModelRatio(meta, responseAPIRequest.Model)
 
 	ratio := modelRatio * groupRatio
 
@@ -97,8 +114,10 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return RelayErrorHandler(resp)
 	}
 
-	// do response
+	// do response, the output content policies apply to whatever is written to the client
+	finishOutput := contentpolicy.GuardOutput(c)
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	finishOutput()
 	if respErr != nil {
 		logger.Logger.Error("DoResponse failed", zap.Any("error", *respErr))
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, c.GetInt(ctxkey.TokenId))
@@ -122,7 +141,7 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		var quota int64
 
 		go func() {
-			quota = postConsumeResponseAPIQuota(ctx, usage, meta, responseAPIRequest, ratio, preConsumedQuota, modelRatio, groupRatio, channelCompletionRatio)
+			quota = postConsumeResponseAPIQuota(ctx, usage, meta, responseAPIRequest, ratio, preConsumedQuota, modelRatio, groupRatio, channelCompletionRatio, channelPriceRules)
 
 			// also update user request cost
 			if quota != 0 {
@@ -199,6 +218,9 @@ func getAndValidateResponseAPIRequest(c *gin.Context) (*openai.ResponseAPIReques
 		return nil, errors.New("input and prompt are mutually exclusive - provide only one")
 	}
 
+	if err = applyResponseAPIPromptTemplate(c, responseAPIRequest); err != nil {
+		return nil, err
+	}
 	return responseAPIRequest, nil
 }
 
@@ -296,7 +318,8 @@ func postConsumeResponseAPIQuota(ctx context.Context,
 	preConsumedQuota int64,
 	modelRatio float64,
 	groupRatio float64,
-	channelCompletionRatio map[string]float64) (quota int64) {
+	channelCompletionRatio map[string]float64,
+	channelPriceRules map[string]billingratio.PriceRules) (quota int64) {
 
 	if usage == nil {
 		logger.Logger.Error("usage is nil, which is unexpected")
@@ -310,17 +333,18 @@ func postConsumeResponseAPIQuota(ctx context.Context,
 	// Calculate quota using the same formula as ChatCompletion
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64((float64(promptTokens)+float64(completionTokens)*completionRatio)*ratio) + usage.ToolsCost
-	if ratio != 0 && quota <= 0 {
+	price := getBilledPrice(meta, responseAPIRequest.Model, usage, modelRatio, groupRatio, completionRatio, channelPriceRules, pricingAdaptor)
+	quota = int64(price.tokenQuota()) + usage.ToolsCost
+	if price.ratio != 0 && quota <= 0 {
 		quota = 1
 	}
 
 	// Use centralized detailed billing function to follow DRY principle
 	quotaDelta := quota - preConsumedQuota
 	billing.PostConsumeQuotaDetailed(ctx, meta.TokenId, quotaDelta, quota, meta.UserId, meta.ChannelId,
-		promptTokens, completionTokens, modelRatio, groupRatio, responseAPIRequest.Model, meta.TokenName,
+		promptTokens, completionTokens, price.modelRatio, groupRatio, responseAPIRequest.Model, meta.TokenName,
 		meta.IsStream, meta.StartTime, false, // Response API doesn't have system prompt reset concept
-		completionRatio, usage.ToolsCost)
+		price.completionRatio, usage.ToolsCost, price.details)
 
 	return quota
 }
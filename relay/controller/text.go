@@ -23,10 +23,13 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
 	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
 	metalib "github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
@@ -53,25 +56,36 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	meta.OriginModelName = textRequest.Model
 	textRequest.Model = meta.ActualModelName
 	meta.ActualModelName = textRequest.Model
+	if meta.Mode == relaymode.Embeddings {
+		// the relay applies the output options itself, so every upstream is asked for floats
+		c.Set(ctxkey.EmbeddingOptions, textRequest.EmbeddingOptions())
+		textRequest.EncodingFormat = ""
+	}
+	// apply the content policies of the caller before the prompt leaves the gateway
+	if err = contentpolicy.Attach(c, meta).CheckRequest(ctx, textRequest); err != nil {
+		logger.Logger.Info("request blocked by content policy", zap.Error(err))
+		return openai.ErrorWrapper(err, "content_policy_violation", http.StatusBadRequest)
+	}
 	// set system prompt if not empty
-	systemPromptReset := setSystemPrompt(ctx, textRequest, meta.ForcedSystemPrompt)
+	systemPromptReset := setSystemPrompt(ctx, textRequest, meta.ForcedSystemPrompt, meta.PromptTemplate != "")
 
 	// get channel-specific pricing if available
 	var channelModelRatio map[string]float64
 	var channelCompletionRatio map[string]float64
+	var channelPriceRules map[string]billingratio.PriceRules
 	if channelModel, ok := c.Get(ctxkey.ChannelModel); ok {
 		if channel, ok := channelModel.(*model.Channel); ok {
 			// Get from unified ModelConfigs only (after migration)
 			channelModelRatio = channel.GetModelRatioFromConfigs()
 			channelCompletionRatio = channel.GetCompletionRatioFromConfigs()
+			channelPriceRules = channel.GetPriceRulesFromConfigs()
 		}
 	}
 
 	// get model ratio using three-layer pricing system
 	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(textRequest.Model, channelModelRatio, pricingAdaptor)
-	// groupRatio := billingratio.GetGroupRatio(meta.Group)
-	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	groupRatio := getGroupModelRatio(meta, textRequest.Model)
 
 	ratio := modelRatio * groupRatio
 	// pre-consume quota
@@ -92,6 +106,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// get request body
 	requestBody, err := getRequestBody(c, meta, textRequest, adaptor)
 	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
@@ -110,8 +125,13 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return RelayErrorHandler(resp)
 	}
 
-	// do response
+	// do response, the output content policies apply to completions whatever the adaptor
+	finishOutput := func() {}
+	if meta.Mode == relaymode.ChatCompletions || meta.Mode == relaymode.Completions {
+		finishOutput = contentpolicy.GuardOutput(c)
+	}
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	finishOutput()
 	if respErr != nil {
 		logger.Logger.Error("respErr is not nil", zap.Any("error", respErr))
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
@@ -177,7 +197,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		var quota int64
 
 		go func() {
-			quota = postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset, channelCompletionRatio)
+			quota = postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset, channelCompletionRatio, channelPriceRules)
 
 			// also update user request cost
 			if quota != 0 {
@@ -225,7 +245,10 @@ func getRequestBody(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.
 		meta.OriginModelName == meta.ActualModelName &&
 		meta.ChannelType != channeltype.OpenAI && // openai also need to convert request
 		meta.ChannelType != channeltype.Baichuan &&
-		meta.ForcedSystemPrompt == "" {
+		meta.Mode != relaymode.Embeddings && // embeddings options are applied by the relay
+		meta.ForcedSystemPrompt == "" &&
+		meta.PromptTemplate == "" &&
+		!contentpolicy.FromContext(c).InputRedacted() {
 		return c.Request.Body, nil
 	}
 
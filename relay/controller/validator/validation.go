@@ -26,6 +26,14 @@ func ValidateTextRequest(textRequest *model.GeneralOpenAIRequest, relayMode int)
 			return errors.New("field messages is required")
 		}
 	case relaymode.Embeddings:
+		if textRequest.Dimensions < 0 {
+			return errors.New("dimensions must not be negative")
+		}
+		switch textRequest.EncodingFormat {
+		case "", "float", model.EmbeddingEncodingBase64:
+		default:
+			return errors.Errorf("encoding_format %q is not supported", textRequest.EncodingFormat)
+		}
 	case relaymode.Moderations:
 		if textRequest.Input == "" {
 			return errors.New("field input is required")
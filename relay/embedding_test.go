@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestEmbeddingAdaptors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalClient := client.HTTPClient
+	client.HTTPClient = http.DefaultClient
+	t.Cleanup(func() { client.HTTPClient = originalClient })
+
+	cases := []struct {
+		name         string
+		channelType  int
+		path         string
+		upstream     string
+		expectBody   map[string]any
+		expectTokens int
+	}{
+		{
+			name:        "cohere uses the v2 embed api",
+			channelType: channeltype.Cohere,
+			path:        "/v2/embed",
+			upstream: `{"id":"e1","embeddings":{"float":[[0.6,0.8,0],[1,0,0]]},
+				"meta":{"billed_units":{"input_tokens":4}}}`,
+			expectBody: map[string]any{"texts": []any{"a", "b"}, "input_type": "search_document",
+				"embedding_types": []any{"float"}, "output_dimension": float64(2)},
+			expectTokens: 4,
+		},
+		{
+			name:         "mistral names dimensions output_dimension",
+			channelType:  channeltype.Mistral,
+			path:         "/v1/embeddings",
+			upstream:     `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.6,0.8,0]},{"object":"embedding","index":1,"embedding":[1,0,0]}],"usage":{"prompt_tokens":4,"total_tokens":4}}`,
+			expectBody:   map[string]any{"output_dimension": float64(2), "input": []any{"a", "b"}},
+			expectTokens: 4,
+		},
+		{
+			name:         "voyage names dimensions output_dimension",
+			channelType:  channeltype.Voyage,
+			path:         "/v1/embeddings",
+			upstream:     `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.6,0.8,0]},{"object":"embedding","index":1,"embedding":[1,0,0]}],"usage":{"total_tokens":4}}`,
+			expectBody:   map[string]any{"output_dimension": float64(2)},
+			expectTokens: 4,
+		},
+		{
+			// the upstream ignores dimensions and answers in base64, without usage
+			name:         "openai compatible",
+			channelType:  channeltype.OpenAICompatible,
+			path:         "/embeddings",
+			upstream:     `{"object":"list","data":[{"object":"embedding","index":0,"embedding":"` + model.EncodeEmbeddingBase64([]float64{0.6, 0.8, 0}) + `"},{"object":"embedding","index":1,"embedding":[1,0,0]}]}`,
+			expectBody:   map[string]any{"dimensions": float64(2), "encoding_format": nil},
+			expectTokens: 7,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotPath string
+			var gotBody map[string]any
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				body, _ := io.ReadAll(r.Body)
+				require.NoError(t, json.Unmarshal(body, &gotBody))
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tc.upstream))
+			}))
+			defer upstream.Close()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", bytes.NewBufferString("{}"))
+			request := &model.GeneralOpenAIRequest{
+				Model:      "embed-model",
+				Input:      []any{"a", "b"},
+				Dimensions: 2,
+			}
+			c.Set(ctxkey.EmbeddingOptions, model.EmbeddingOptions{Dimensions: 2, EncodingFormat: model.EmbeddingEncodingBase64})
+
+			m := &meta.Meta{
+				Mode:            relaymode.Embeddings,
+				ChannelType:     tc.channelType,
+				APIType:         channeltype.ToAPIType(tc.channelType),
+				BaseURL:         upstream.URL,
+				RequestURLPath:  "/v1/embeddings",
+				OriginModelName: "embed-model",
+				ActualModelName: "embed-model",
+				PromptTokens:    7,
+			}
+			meta.Set2Context(c, m)
+			a := GetAdaptor(m.APIType)
+			require.NotNil(t, a)
+			a.Init(m)
+
+			converted, err := a.ConvertRequest(c, relaymode.Embeddings, request)
+			require.NoError(t, err)
+			body, err := json.Marshal(converted)
+			require.NoError(t, err)
+			resp, err := a.DoRequest(c, m, bytes.NewBuffer(body))
+			require.NoError(t, err)
+			usage, bizErr := a.DoResponse(c, resp, m)
+			require.Nil(t, bizErr)
+
+			assert.Equal(t, tc.path, gotPath)
+			for key, value := range tc.expectBody {
+				assert.Equal(t, value, gotBody[key], key)
+			}
+			assert.Equal(t, tc.expectTokens, usage.PromptTokens)
+
+			var response struct {
+				Data []struct {
+					Index     int    `json:"index"`
+					Embedding string `json:"embedding"`
+				} `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.Data, 2)
+			for idx, expected := range [][]float64{{0.6, 0.8}, {1, 0}} {
+				embedding, err := model.DecodeEmbeddingBase64(response.Data[idx].Embedding)
+				require.NoError(t, err)
+				assert.InDeltaSlice(t, expected, embedding, 1e-6)
+			}
+		})
+	}
+}
+
+func TestEmbeddingsUnsupportedAdaptors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, channelType := range []int{channeltype.Anthropic, channeltype.DeepSeek, channeltype.Groq, channeltype.Moonshot} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		m := &meta.Meta{Mode: relaymode.Embeddings, ChannelType: channelType, APIType: channeltype.ToAPIType(channelType)}
+		a := GetAdaptor(m.APIType)
+		require.NotNil(t, a)
+		a.Init(m)
+		_, err := a.ConvertRequest(c, relaymode.Embeddings, &model.GeneralOpenAIRequest{Model: "m", Input: "a"})
+		assert.ErrorContains(t, err, "embeddings", channeltype.IdToName(channelType))
+	}
+}
+
+func TestCountEmbeddingInputTokens(t *testing.T) {
+	originalApproximate := config.ApproximateTokenEnabled
+	config.ApproximateTokenEnabled = true
+	t.Cleanup(func() { config.ApproximateTokenEnabled = originalApproximate })
+
+	var input any
+	require.NoError(t, json.Unmarshal([]byte(`[1, 2, 3]`), &input))
+	assert.Equal(t, 3, openai.CountTokenInput(input, "text-embedding-3-small"))
+	require.NoError(t, json.Unmarshal([]byte(`[[1, 2], [3]]`), &input))
+	assert.Equal(t, 3, openai.CountTokenInput(input, "text-embedding-3-small"))
+	require.NoError(t, json.Unmarshal([]byte(`["0123456789", "0123456789"]`), &input))
+	assert.Equal(t, 6, openai.CountTokenInput(input, "text-embedding-3-small"))
+}
@@ -37,7 +37,9 @@ type Meta struct {
 	PromptTokens       int // only for DoResponse
 	ChannelRatio       float64
 	ForcedSystemPrompt string
-	StartTime          time.Time
+	// PromptTemplate is the version of the prompt template rendered into the request, e.g. support-bot@v3
+	PromptTemplate string
+	StartTime      time.Time
 }
 
 // GetMappedModelName returns the mapped model name and a bool indicating if the model name is mapped
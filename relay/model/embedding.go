@@ -0,0 +1,150 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// EmbeddingEncodingBase64 is the encoding_format that asks for the embeddings
+// as base64 encoded little-endian float32 arrays.
+const EmbeddingEncodingBase64 = "base64"
+
+// EmbeddingOptions are the output options of an embeddings request. The relay applies
+// them to the upstream response, so they hold even if the upstream ignores them.
+type EmbeddingOptions struct {
+	Dimensions     int
+	EncodingFormat string
+}
+
+// EmbeddingOptions returns the output options of the embeddings request.
+func (r GeneralOpenAIRequest) EmbeddingOptions() EmbeddingOptions {
+	return EmbeddingOptions{
+		Dimensions:     r.Dimensions,
+		EncodingFormat: r.EncodingFormat,
+	}
+}
+
+type EmbeddingResponseItem struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+	// EncodingFormat decides how the embedding is marshaled, it is never sent upstream
+	EncodingFormat string `json:"-"`
+}
+
+type embeddingResponseItemJSON struct {
+	Object    string `json:"object"`
+	Index     int    `json:"index"`
+	Embedding any    `json:"embedding"`
+}
+
+// MarshalJSON writes the embedding as a float array, or as base64 if EncodingFormat is base64.
+func (i EmbeddingResponseItem) MarshalJSON() ([]byte, error) {
+	item := embeddingResponseItemJSON{Object: i.Object, Index: i.Index, Embedding: i.Embedding}
+	if i.EncodingFormat == EmbeddingEncodingBase64 {
+		item.Embedding = EncodeEmbeddingBase64(i.Embedding)
+	} else if i.Embedding == nil {
+		item.Embedding = []float64{}
+	}
+	return json.Marshal(item)
+}
+
+// UnmarshalJSON accepts the embedding both as a float array and as base64.
+func (i *EmbeddingResponseItem) UnmarshalJSON(data []byte) error {
+	var item struct {
+		Object    string          `json:"object"`
+		Index     int             `json:"index"`
+		Embedding json.RawMessage `json:"embedding"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return errors.WithStack(err)
+	}
+
+	i.Object = item.Object
+	i.Index = item.Index
+	i.Embedding = nil
+	if len(item.Embedding) == 0 || string(item.Embedding) == "null" {
+		return nil
+	}
+	if item.Embedding[0] == '"' {
+		var encoded string
+		if err := json.Unmarshal(item.Embedding, &encoded); err != nil {
+			return errors.WithStack(err)
+		}
+		embedding, err := DecodeEmbeddingBase64(encoded)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		i.Embedding = embedding
+		return nil
+	}
+	return errors.WithStack(json.Unmarshal(item.Embedding, &i.Embedding))
+}
+
+type EmbeddingResponse struct {
+	Object string                  `json:"object"`
+	Data   []EmbeddingResponseItem `json:"data"`
+	Model  string                  `json:"model"`
+	Usage  `json:"usage"`
+}
+
+// ApplyOptions shortens embeddings that are longer than the requested dimensions and
+// sets the encoding of every item. Shortened embeddings are normalized again, which is
+// how OpenAI and the Matryoshka models reduce dimensions.
+func (r *EmbeddingResponse) ApplyOptions(options EmbeddingOptions) {
+	for idx := range r.Data {
+		item := &r.Data[idx]
+		if options.Dimensions > 0 && len(item.Embedding) > options.Dimensions {
+			item.Embedding = normalizeEmbedding(item.Embedding[:options.Dimensions])
+		}
+		item.EncodingFormat = options.EncodingFormat
+	}
+}
+
+func normalizeEmbedding(embedding []float64) []float64 {
+	var norm float64
+	for _, value := range embedding {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+
+	normalized := make([]float64, len(embedding))
+	for idx, value := range embedding {
+		if norm == 0 {
+			normalized[idx] = value
+			continue
+		}
+		normalized[idx] = value / norm
+	}
+	return normalized
+}
+
+// EncodeEmbeddingBase64 encodes the embedding as little-endian float32, the same as OpenAI.
+func EncodeEmbeddingBase64(embedding []float64) string {
+	buf := make([]byte, 4*len(embedding))
+	for idx, value := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*idx:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// DecodeEmbeddingBase64 decodes an embedding encoded by EncodeEmbeddingBase64.
+func DecodeEmbeddingBase64(encoded string) ([]float64, error) {
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode base64 embedding")
+	}
+	if len(buf)%4 != 0 {
+		return nil, errors.Errorf("invalid base64 embedding length %d", len(buf))
+	}
+
+	embedding := make([]float64, len(buf)/4)
+	for idx := range embedding {
+		embedding[idx] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*idx:])))
+	}
+	return embedding, nil
+}
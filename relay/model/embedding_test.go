@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddingResponseOptions(t *testing.T) {
+	response := EmbeddingResponse{Data: []EmbeddingResponseItem{{Object: "embedding", Embedding: []float64{3, 4, 12}}}}
+	response.ApplyOptions(EmbeddingOptions{Dimensions: 2})
+	assert.InDeltaSlice(t, []float64{0.6, 0.8}, response.Data[0].Embedding, 1e-9)
+
+	body, err := json.Marshal(response)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"embedding":[0.6,0.8]`)
+
+	response.ApplyOptions(EmbeddingOptions{EncodingFormat: EmbeddingEncodingBase64})
+	body, err = json.Marshal(response)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"embedding":"`)
+
+	var decoded EmbeddingResponse
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.InDeltaSlice(t, []float64{0.6, 0.8}, decoded.Data[0].Embedding, 1e-6)
+
+	_, err = DecodeEmbeddingBase64("AAA=")
+	assert.Error(t, err)
+}
@@ -249,6 +249,50 @@ type ClaudeContent struct {
 }
 
 type ClaudeUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// ToUsage converts Claude usage, whose input tokens exclude the cached ones,
+// into a Usage whose prompt tokens include them.
+func (u *ClaudeUsage) ToUsage() *Usage {
+	promptTokens := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	usage := &Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      promptTokens + u.OutputTokens,
+	}
+	if u.CacheCreationInputTokens > 0 || u.CacheReadInputTokens > 0 {
+		usage.PromptTokensDetails = &UsagePromptTokensDetails{
+			CachedTokens:     u.CacheReadInputTokens,
+			CacheWriteTokens: u.CacheCreationInputTokens,
+		}
+	}
+	return usage
+}
+
+// AddClaudeStreamUsage merges the usage of a Claude stream event. message_start reports the
+// prompt and a placeholder output token, and message_delta repeats the cumulative counts,
+// so every count keeps its largest reported value instead of being summed.
+func (u *Usage) AddClaudeStreamUsage(claude *ClaudeUsage) {
+	var cached, written int
+	if u.PromptTokensDetails != nil {
+		cached, written = u.PromptTokensDetails.CachedTokens, u.PromptTokensDetails.CacheWriteTokens
+	}
+	input := max(u.PromptTokens-cached-written, claude.InputTokens)
+	cached = max(cached, claude.CacheReadInputTokens)
+	written = max(written, claude.CacheCreationInputTokens)
+
+	u.PromptTokens = input + cached + written
+	u.CompletionTokens = max(u.CompletionTokens, claude.OutputTokens)
+	if cached == 0 && written == 0 {
+		return
+	}
+	if u.PromptTokensDetails == nil {
+		u.PromptTokensDetails = &UsagePromptTokensDetails{}
+	}
+	u.PromptTokensDetails.CachedTokens = cached
+	u.PromptTokensDetails.CacheWriteTokens = written
 }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddClaudeStreamUsage(t *testing.T) {
+	usage := &Usage{}
+	// message_start reports the prompt and the cache tokens
+	usage.AddClaudeStreamUsage(&ClaudeUsage{InputTokens: 10, CacheReadInputTokens: 500, CacheCreationInputTokens: 100})
+	// message_delta may repeat the cache tokens
+	usage.AddClaudeStreamUsage(&ClaudeUsage{OutputTokens: 30, CacheReadInputTokens: 500, CacheCreationInputTokens: 100})
+
+	assert.Equal(t, 610, usage.PromptTokens)
+	assert.Equal(t, 30, usage.CompletionTokens)
+	assert.Equal(t, 500, usage.CachedPromptTokens())
+	assert.Equal(t, 100, usage.CacheWritePromptTokens())
+
+	// message_start reports a placeholder output token, message_delta repeats the cumulative counts
+	repeated := &Usage{}
+	repeated.AddClaudeStreamUsage(&ClaudeUsage{InputTokens: 10, OutputTokens: 1, CacheReadInputTokens: 500})
+	repeated.AddClaudeStreamUsage(&ClaudeUsage{InputTokens: 10, OutputTokens: 30, CacheReadInputTokens: 500})
+	assert.Equal(t, 510, repeated.PromptTokens)
+	assert.Equal(t, 30, repeated.CompletionTokens)
+	assert.Equal(t, 500, repeated.CachedPromptTokens())
+	assert.Zero(t, repeated.CacheWritePromptTokens())
+
+	plain := &Usage{}
+	plain.AddClaudeStreamUsage(&ClaudeUsage{InputTokens: 10, OutputTokens: 5})
+	assert.Nil(t, plain.PromptTokensDetails)
+}
@@ -17,6 +17,59 @@ type Usage struct {
 	// -------------------------------------
 	// ToolsCost is the cost of using tools, in quota.
 	ToolsCost int64 `json:"tools_cost,omitempty"`
+	// PromptCacheHitTokens is how DeepSeek reports the prompt tokens read from its cache.
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens,omitempty"`
+}
+
+// CachedPromptTokens returns the prompt tokens read from the provider's cache,
+// they are included in PromptTokens.
+func (u *Usage) CachedPromptTokens() int {
+	if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0 {
+		return u.PromptTokensDetails.CachedTokens
+	}
+	return u.PromptCacheHitTokens
+}
+
+// PromptAudioTokens returns the audio prompt tokens, they are included in PromptTokens.
+func (u *Usage) PromptAudioTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.AudioTokens
+}
+
+// PromptImageTokens returns the image prompt tokens, they are included in PromptTokens.
+func (u *Usage) PromptImageTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.ImageTokens
+}
+
+// CompletionAudioTokens returns the audio completion tokens, they are included in CompletionTokens.
+func (u *Usage) CompletionAudioTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.AudioTokens
+}
+
+// ReasoningTokens returns the reasoning tokens, whether they are included in CompletionTokens
+// depends on the upstream, see channeltype.ReasoningInCompletionTokens.
+func (u *Usage) ReasoningTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
+}
+
+// CacheWritePromptTokens returns the prompt tokens written to the provider's cache,
+// they are included in PromptTokens.
+func (u *Usage) CacheWritePromptTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CacheWriteTokens
 }
 
 type Error struct {
@@ -38,6 +91,9 @@ type UsagePromptTokensDetails struct {
 	// TextTokens could be zero for pure text chats
 	TextTokens  int `json:"text_tokens"`
 	ImageTokens int `json:"image_tokens"`
+	// CacheWriteTokens is not part of the OpenAI API, it holds the tokens
+	// written to the cache by providers that bill them separately, e.g. Anthropic.
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
 // UsageCompletionTokensDetails contains details about the completion tokens used in a request.
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// RerankRequest is the canonical rerank request, it follows the schema shared by Cohere and Jina.
+// Adaptors convert it to the schema of their upstream.
+type RerankRequest struct {
+	Model     string          `json:"model"`
+	Query     string          `json:"query"`
+	Documents RerankDocuments `json:"documents"`
+	// TopN limits the number of results, 0 returns all documents
+	TopN int `json:"top_n,omitempty"`
+	// ReturnDocuments adds the text of each document to its result
+	ReturnDocuments *bool `json:"return_documents,omitempty"`
+}
+
+// RerankDocuments are the texts to rank, they can be sent as strings or as {"text": "..."} objects.
+type RerankDocuments []string
+
+// UnmarshalJSON accepts both plain strings and objects with a text field.
+func (d *RerankDocuments) UnmarshalJSON(data []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return errors.Wrap(err, "documents must be an array")
+	}
+
+	docs := make(RerankDocuments, 0, len(raws))
+	for i, raw := range raws {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			docs = append(docs, text)
+			continue
+		}
+
+		var doc RerankDocument
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return errors.Errorf("document %d must be a string or an object with a text field", i)
+		}
+		docs = append(docs, doc.Text)
+	}
+
+	*d = docs
+	return nil
+}
+
+// RerankDocument is a document attached to a rerank result.
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+// RerankResult is the relevance of one document, Index points into the request documents.
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+// RerankResponse is the canonical rerank response.
+// Usage.PromptTokens holds the billed units, which are search units for Cohere and tokens otherwise.
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   Usage          `json:"usage"`
+}
+
+// Normalize sorts the results by relevance, applies TopN and attaches or strips the documents
+// as requested, so every upstream answers the same way whatever it supports.
+func (r *RerankRequest) Normalize(results []RerankResult) []RerankResult {
+	normalized := make([]RerankResult, 0, len(results))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(r.Documents) {
+			continue
+		}
+		result.Document = nil
+		if r.ReturnDocuments != nil && *r.ReturnDocuments {
+			result.Document = &RerankDocument{Text: r.Documents[result.Index]}
+		}
+		normalized = append(normalized, result)
+	}
+
+	sort.SliceStable(normalized, func(i, j int) bool {
+		return normalized[i].RelevanceScore > normalized[j].RelevanceScore
+	})
+	if r.TopN > 0 && len(normalized) > r.TopN {
+		normalized = normalized[:r.TopN]
+	}
+
+	return normalized
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
 )
 
 // DefaultGlobalPricingAdapters defines which adapters contribute to global pricing fallback
@@ -316,3 +317,34 @@ func GetCompletionRatioWithThreeLayers(modelName string, channelOverrides map[st
 	// Layer 4: Final fallback - reasonable default
 	return 1.0 // Default completion ratio
 }
+
+// GetPriceRulesWithThreeLayers returns the tiers, windows and cache ratios of a model.
+// The rules are taken from the same layer that supplies the model ratio, so that the absolute
+// prices of a tier never refine a base price from another layer.
+func GetPriceRulesWithThreeLayers(modelName string, channelOverrides map[string]ratio.PriceRules, adaptor adaptor.Adaptor) ratio.PriceRules {
+	// Layer 1: User custom ratio (channel-specific overrides)
+	if channelOverrides != nil {
+		if rules, exists := channelOverrides[modelName]; exists {
+			return rules
+		}
+	}
+
+	// Layer 2: Channel default ratio (adapter's default pricing)
+	if adaptor != nil {
+		if price, exists := adaptor.GetDefaultModelPricing()[modelName]; exists {
+			return price.PriceRules()
+		}
+	}
+
+	// Layer 3: Global model pricing (merged from selected adapters)
+	globalPricingManager.mu.RLock()
+	defer globalPricingManager.mu.RUnlock()
+
+	globalPricingManager.ensureInitialized()
+
+	if price, exists := globalPricingManager.globalModelPricing[modelName]; exists && price.Ratio > 0 {
+		return price.PriceRules()
+	}
+
+	return ratio.PriceRules{}
+}
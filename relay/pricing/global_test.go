@@ -4,11 +4,13 @@ import (
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 )
@@ -76,7 +78,8 @@ func mockGetAdaptor(apiType int) adaptor.Adaptor {
 		return &MockAdaptor{
 			name: "anthropic",
 			pricing: map[string]adaptor.ModelConfig{
-				"claude-3-opus":   {Ratio: 15 * 0.000001, CompletionRatio: 5.0},
+				"claude-3-opus": {Ratio: 15 * 0.000001, CompletionRatio: 5.0,
+					Tiers: []ratio.Tier{{InputTokenThreshold: 200000, Ratio: 30 * 0.000001}}},
 				"claude-3-sonnet": {Ratio: 3 * 0.000001, CompletionRatio: 5.0},
 			},
 		}
@@ -358,3 +361,33 @@ func TestIsGlobalPricingInitialized(t *testing.T) {
 		t.Error("Expected global pricing to be initialized")
 	}
 }
+
+func TestPriceRulesWithThreeLayers(t *testing.T) {
+	// Setup
+	globalPricingManager = &GlobalPricingManager{
+		contributingAdapters: []int{apitype.OpenAI, apitype.Anthropic},
+	}
+	InitializeGlobalPricingManager(mockGetAdaptor)
+	openaiAdaptor := mockGetAdaptor(apitype.OpenAI)
+
+	// Layer 3: rules come with the global price
+	rules := GetPriceRulesWithThreeLayers("claude-3-opus", nil, openaiAdaptor)
+	if len(rules.Tiers) != 1 {
+		t.Fatalf("Expected the global tier, got %v", rules.Tiers)
+	}
+	modelRatio, completionRatio, breakdown := rules.Apply(15*0.000001, 5.0, 250000, time.Now())
+	if modelRatio != 30*0.000001 || completionRatio != 5.0 || breakdown == "" {
+		t.Errorf("Expected the tier price, got %f, %f, %q", modelRatio, completionRatio, breakdown)
+	}
+
+	// Layer 1: a channel price replaces the rules of the lower layers, even without rules of its own
+	channelOverrides := map[string]ratio.PriceRules{"claude-3-opus": {}}
+	if rules = GetPriceRulesWithThreeLayers("claude-3-opus", channelOverrides, openaiAdaptor); !rules.IsEmpty() {
+		t.Errorf("Expected the channel rules, got %v", rules)
+	}
+
+	// Layer 2: the adapter price has no rules
+	if rules = GetPriceRulesWithThreeLayers("gpt-4", nil, openaiAdaptor); !rules.IsEmpty() {
+		t.Errorf("Expected no rules for gpt-4, got %v", rules)
+	}
+}
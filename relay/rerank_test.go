@@ -0,0 +1,164 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestRerankAdaptors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalClient := client.HTTPClient
+	client.HTTPClient = http.DefaultClient
+	t.Cleanup(func() { client.HTTPClient = originalClient })
+
+	returnDocuments := true
+	cases := []struct {
+		name         string
+		channelType  int
+		path         string
+		upstream     string
+		expectBody   map[string]any
+		expectTokens int
+	}{
+		{
+			name:        "cohere bills search units",
+			channelType: channeltype.Cohere,
+			path:        "/v1/rerank",
+			upstream: `{"id":"r1","results":[{"index":1,"relevance_score":0.9},{"index":0,"relevance_score":0.2}],
+				"meta":{"billed_units":{"search_units":1}}}`,
+			expectBody:   map[string]any{"model": "rerank-v3.5", "top_n": float64(1)},
+			expectTokens: 1,
+		},
+		{
+			name:         "jina",
+			channelType:  channeltype.Jina,
+			path:         "/v1/rerank",
+			upstream:     `{"model":"jina-reranker-v2-base-multilingual","results":[{"index":1,"relevance_score":0.9,"document":{"text":"b"}},{"index":0,"relevance_score":0.2}],"usage":{"total_tokens":42}}`,
+			expectBody:   map[string]any{"query": "q", "top_n": float64(1)},
+			expectTokens: 42,
+		},
+		{
+			name:         "voyage names top_n top_k",
+			channelType:  channeltype.Voyage,
+			path:         "/v1/rerank",
+			upstream:     `{"object":"list","data":[{"index":0,"relevance_score":0.2},{"index":1,"relevance_score":0.9}],"usage":{"total_tokens":30}}`,
+			expectBody:   map[string]any{"top_k": float64(1)},
+			expectTokens: 30,
+		},
+		{
+			name:         "bailian uses the dashscope rerank service",
+			channelType:  channeltype.AliBailian,
+			path:         "/api/v1/services/rerank/text-rerank/text-rerank",
+			upstream:     `{"output":{"results":[{"index":1,"relevance_score":0.9}]},"usage":{"total_tokens":12},"request_id":"abc"}`,
+			expectBody:   map[string]any{"input": map[string]any{"query": "q", "documents": []any{"a", "b"}}},
+			expectTokens: 12,
+		},
+		{
+			name:         "ali",
+			channelType:  channeltype.Ali,
+			path:         "/api/v1/services/rerank/text-rerank/text-rerank",
+			upstream:     `{"output":{"results":[{"index":1,"relevance_score":0.9}]},"usage":{"total_tokens":12},"request_id":"abc"}`,
+			expectBody:   map[string]any{"model": "rerank-v3.5"},
+			expectTokens: 12,
+		},
+		{
+			// the base url of OpenAI compatible channels includes the version
+			name:         "local server without usage",
+			channelType:  channeltype.OpenAICompatible,
+			path:         "/rerank",
+			upstream:     `[{"index":0,"score":0.2},{"index":1,"score":0.9}]`,
+			expectBody:   map[string]any{"documents": []any{"a", "b"}},
+			expectTokens: 7,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotPath string
+			var gotBody map[string]any
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				body, _ := io.ReadAll(r.Body)
+				require.NoError(t, json.Unmarshal(body, &gotBody))
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tc.upstream))
+			}))
+			defer upstream.Close()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/rerank", bytes.NewBufferString("{}"))
+			request := &model.RerankRequest{
+				Model:           "rerank-v3.5",
+				Query:           "q",
+				Documents:       model.RerankDocuments{"a", "b"},
+				TopN:            1,
+				ReturnDocuments: &returnDocuments,
+			}
+			c.Set(ctxkey.RerankRequest, request)
+
+			m := &meta.Meta{
+				Mode:            relaymode.Rerank,
+				ChannelType:     tc.channelType,
+				APIType:         channeltype.ToAPIType(tc.channelType),
+				BaseURL:         upstream.URL,
+				RequestURLPath:  "/v1/rerank",
+				OriginModelName: "my-reranker",
+				ActualModelName: "rerank-v3.5",
+				PromptTokens:    7,
+			}
+			a := GetAdaptor(m.APIType)
+			require.NotNil(t, a)
+			a.Init(m)
+			rerankAdaptor, ok := a.(adaptor.RerankAdaptor)
+			require.True(t, ok)
+
+			converted, err := rerankAdaptor.ConvertRerankRequest(c, request)
+			require.NoError(t, err)
+			body, err := json.Marshal(converted)
+			require.NoError(t, err)
+			resp, err := a.DoRequest(c, m, bytes.NewBuffer(body))
+			require.NoError(t, err)
+			usage, bizErr := a.DoResponse(c, resp, m)
+			require.Nil(t, bizErr)
+
+			assert.Equal(t, tc.path, gotPath)
+			for key, value := range tc.expectBody {
+				assert.Equal(t, value, gotBody[key], key)
+			}
+			assert.Equal(t, tc.expectTokens, usage.PromptTokens)
+
+			var response model.RerankResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "my-reranker", response.Model)
+			require.Len(t, response.Results, 1)
+			assert.Equal(t, 1, response.Results[0].Index)
+			assert.InDelta(t, 0.9, response.Results[0].RelevanceScore, 1e-9)
+			require.NotNil(t, response.Results[0].Document)
+			assert.Equal(t, "b", response.Results[0].Document.Text)
+		})
+	}
+}
+
+func TestRerankDocumentsUnmarshal(t *testing.T) {
+	var request model.RerankRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"query":"q","documents":["a",{"text":"b"}]}`), &request))
+	assert.Equal(t, model.RerankDocuments{"a", "b"}, request.Documents)
+	require.Error(t, json.Unmarshal([]byte(`{"documents":[1]}`), &request))
+}
@@ -30,6 +30,11 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/state", middleware.CriticalRateLimit(), auth.GenerateOAuthCode)
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), auth.WeChatAuth)
 		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
+		apiRouter.GET("/sso/:name/login", middleware.CriticalRateLimit(), auth.SSOLogin)
+		apiRouter.GET("/sso/:name/callback", middleware.CriticalRateLimit(), auth.SSOCallback)
+		apiRouter.POST("/sso/:name/acs", middleware.CriticalRateLimit(), auth.SSOCallback)
+		apiRouter.GET("/sso/:name/finish", middleware.CriticalRateLimit(), auth.SSOFinish)
+		apiRouter.GET("/sso/:name/metadata", auth.SAMLMetadata)
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
 		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
 
@@ -37,6 +42,8 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), controller.Login)
+			userRoute.POST("/login/webauthn/begin", middleware.CriticalRateLimit(), controller.BeginWebAuthnLogin)
+			userRoute.POST("/login/webauthn/finish", middleware.CriticalRateLimit(), controller.FinishWebAuthnLogin)
 			userRoute.GET("/logout", controller.Logout)
 
 			selfRoute := userRoute.Group("/")
@@ -55,6 +62,12 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/totp/setup", controller.SetupTotp)
 				selfRoute.POST("/totp/confirm", controller.ConfirmTotp)
 				selfRoute.POST("/totp/disable", controller.DisableTotp)
+				selfRoute.GET("/webauthn/credentials", controller.GetWebAuthnCredentials)
+				selfRoute.POST("/webauthn/register/begin", controller.BeginWebAuthnRegistration)
+				selfRoute.POST("/webauthn/register/finish", controller.FinishWebAuthnRegistration)
+				selfRoute.DELETE("/webauthn/credentials/:id", controller.DeleteWebAuthnCredential)
+				selfRoute.GET("/recovery_codes", controller.GetRecoveryCodeStatus)
+				selfRoute.POST("/recovery_codes", controller.RegenerateRecoveryCodes)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -68,6 +81,7 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 				adminRoute.POST("/totp/disable/:id", controller.AdminDisableUserTotp)
+				adminRoute.POST("/webauthn/reset/:id", controller.AdminResetUserWebAuthn)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
@@ -85,6 +99,7 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
+			channelRoute.POST("/replay", controller.ReplayRequests)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
 			channelRoute.GET("/pricing/:id", controller.GetChannelPricing)
@@ -143,6 +158,79 @@ func SetApiRouter(router *gin.Engine) {
 		groupRoute.Use(middleware.AdminAuth())
 		{
 			groupRoute.GET("/", controller.GetGroups)
+			groupRoute.GET("/list", controller.ListGroups)
+			groupRoute.GET("/:name", controller.GetGroup)
+			groupRoute.POST("/", middleware.RootAuth(), controller.AddGroup)
+			groupRoute.PUT("/", middleware.RootAuth(), controller.UpdateGroup)
+			groupRoute.DELETE("/:name", middleware.RootAuth(), controller.DeleteGroup)
+			groupRoute.GET("/:name/model_ratios", controller.GetGroupModelRatios)
+			groupRoute.PUT("/:name/model_ratios", middleware.RootAuth(), controller.UpdateGroupModelRatios)
+		}
+		modelCatalogRoute := apiRouter.Group("/model_catalog")
+		modelCatalogRoute.Use(middleware.AdminAuth())
+		{
+			modelCatalogRoute.GET("/", controller.GetModelCatalogOverrides)
+			modelCatalogRoute.PUT("/", middleware.RootAuth(), controller.SaveModelCatalogOverride)
+			modelCatalogRoute.DELETE("/:id", middleware.RootAuth(), controller.DeleteModelCatalogOverride)
+		}
+		virtualModelRoute := apiRouter.Group("/virtual_model")
+		virtualModelRoute.Use(middleware.AdminAuth())
+		{
+			virtualModelRoute.GET("/", controller.GetVirtualModels)
+			virtualModelRoute.POST("/", middleware.RootAuth(), controller.AddVirtualModel)
+			virtualModelRoute.PUT("/", middleware.RootAuth(), controller.UpdateVirtualModel)
+			virtualModelRoute.DELETE("/:id", middleware.RootAuth(), controller.DeleteVirtualModel)
+		}
+		contentPolicyRoute := apiRouter.Group("/content_policy")
+		contentPolicyRoute.Use(middleware.AdminAuth())
+		{
+			contentPolicyRoute.GET("/", controller.GetContentPolicies)
+			contentPolicyRoute.POST("/", middleware.RootAuth(), controller.AddContentPolicy)
+			contentPolicyRoute.PUT("/", middleware.RootAuth(), controller.UpdateContentPolicy)
+			contentPolicyRoute.DELETE("/:id", middleware.RootAuth(), controller.DeleteContentPolicy)
+			contentPolicyRoute.GET("/events", controller.GetContentPolicyEvents)
+			contentPolicyRoute.PUT("/events/:id/review", controller.ReviewContentPolicyEvent)
+		}
+		channelErrorRuleRoute := apiRouter.Group("/channel_error_rule")
+		channelErrorRuleRoute.Use(middleware.AdminAuth())
+		{
+			channelErrorRuleRoute.GET("/", controller.GetChannelErrorRules)
+			channelErrorRuleRoute.POST("/", controller.AddChannelErrorRule)
+			channelErrorRuleRoute.PUT("/", controller.UpdateChannelErrorRule)
+			channelErrorRuleRoute.DELETE("/:id", controller.DeleteChannelErrorRule)
+		}
+		transcriptRoute := apiRouter.Group("/transcript")
+		transcriptRoute.Use(middleware.AdminAuth())
+		{
+			transcriptRoute.GET("/rule", controller.GetTranscriptRules)
+			transcriptRoute.POST("/rule", middleware.RootAuth(), controller.AddTranscriptRule)
+			transcriptRoute.PUT("/rule", middleware.RootAuth(), controller.UpdateTranscriptRule)
+			transcriptRoute.DELETE("/rule/:id", middleware.RootAuth(), controller.DeleteTranscriptRule)
+			transcriptRoute.GET("/request/:request_id", controller.GetTranscript)
+		}
+		promptTemplateRoute := apiRouter.Group("/prompt_template")
+		promptTemplateRoute.Use(middleware.AdminAuth())
+		{
+			promptTemplateRoute.GET("/", controller.GetPromptTemplates)
+			promptTemplateRoute.POST("/", controller.AddPromptTemplate)
+			promptTemplateRoute.PUT("/", controller.UpdatePromptTemplate)
+			promptTemplateRoute.DELETE("/:id", middleware.RootAuth(), controller.DeletePromptTemplate)
+		}
+		banRoute := apiRouter.Group("/ban")
+		banRoute.Use(middleware.AdminAuth())
+		{
+			banRoute.GET("/", controller.GetBans)
+			banRoute.POST("/", controller.AddBan)
+			banRoute.DELETE("/:id", controller.LiftBan)
+		}
+		identityProviderRoute := apiRouter.Group("/identity_provider")
+		identityProviderRoute.Use(middleware.RootAuth())
+		{
+			identityProviderRoute.GET("/", controller.GetIdentityProviders)
+			identityProviderRoute.POST("/", controller.AddIdentityProvider)
+			identityProviderRoute.PUT("/", controller.UpdateIdentityProvider)
+			identityProviderRoute.DELETE("/:id", controller.DeleteIdentityProvider)
+			identityProviderRoute.PUT("/:id/user", controller.LinkIdentityProviderUser)
 		}
 	}
 }
@@ -18,7 +18,7 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
 	relayV1Router := router.Group("/v1")
-	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
+	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.CaptureTranscript(), middleware.Distribute())
 	relayV1Router.Use(middleware.GlobalRelayRateLimit())
 	relayV1Router.Use(middleware.ChannelRateLimit())
 	{
@@ -0,0 +1,30 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/controller/scim"
+	"github.com/songquanpeng/one-api/middleware"
+)
+
+func SetSCIMRouter(router *gin.Engine) {
+	scimRouter := router.Group("/scim/v2")
+	scimRouter.Use(middleware.GlobalAPIRateLimit())
+	scimRouter.Use(middleware.SCIMAuth())
+	{
+		scimRouter.GET("/ServiceProviderConfig", scim.GetServiceProviderConfig)
+		scimRouter.GET("/ResourceTypes", scim.GetResourceTypes)
+		scimRouter.GET("/Users", scim.GetUsers)
+		scimRouter.POST("/Users", scim.CreateUser)
+		scimRouter.GET("/Users/:id", scim.GetUser)
+		scimRouter.PUT("/Users/:id", scim.ReplaceUser)
+		scimRouter.PATCH("/Users/:id", scim.PatchUser)
+		scimRouter.DELETE("/Users/:id", scim.DeleteUser)
+		scimRouter.GET("/Groups", scim.GetGroups)
+		scimRouter.POST("/Groups", scim.CreateGroup)
+		scimRouter.GET("/Groups/:id", scim.GetGroup)
+		scimRouter.PUT("/Groups/:id", scim.ReplaceGroup)
+		scimRouter.PATCH("/Groups/:id", scim.PatchGroup)
+		scimRouter.DELETE("/Groups/:id", scim.DeleteGroup)
+	}
+}
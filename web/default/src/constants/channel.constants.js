@@ -76,6 +76,8 @@ export const CHANNEL_OPTIONS = [
   { key: 32, text: 'StepFun', value: 32, color: 'blue' },
   { key: 34, text: 'Coze', value: 34, color: 'blue' },
   { key: 35, text: 'Cohere', value: 35, color: 'blue' },
+  { key: 52, text: 'Jina AI', value: 52, color: 'blue' },
+  { key: 53, text: 'Voyage AI', value: 53, color: 'blue' },
   { key: 36, text: 'DeepSeek', value: 36, color: 'black' },
   { key: 37, text: 'Cloudflare', value: 37, color: 'orange' },
   { key: 38, text: 'DeepL', value: 38, color: 'black' },